@@ -0,0 +1,137 @@
+package http
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+// ExportMe returns everything stored about the logged user as a single json document
+// or, with format=zip, as a zip archive with a json file per kind of data
+func (app *App) ExportMe(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	format := req.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		responseWithErrorTxt(w, http.StatusBadRequest, `format must be one of "json", "zip"`)
+		return
+	}
+
+	export, err := app.accountUsecases.ExportUserData(ctx, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var rneErr *usecases.RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			// removed in the meantime
+			responseWithUnauthorized(w)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	fileName := "gymm-export-" + export.ExportedAt.Format("20060102")
+	if format != "zip" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".json"))
+		responseWithJSON(w, http.StatusOK, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".zip"))
+	w.WriteHeader(http.StatusOK)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"sessions.json", export.Sessions},
+		{"exercises.json", export.Exercises},
+		{"trainings.json", export.Trainings},
+		{"api_keys.json", export.APIKeys},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err == nil {
+			enc := json.NewEncoder(fw)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(f.data)
+		}
+		if err != nil {
+			// the status is already sent, the client gets the broken archive
+			logDebugError(app.l, req, err)
+			return
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		logDebugError(app.l, req, err)
+	}
+}
+
+// DeleteMe schedules the deletion of the logged user's account after the grace period,
+// all of the sessions are ended and the user can log in again to cancel the deletion
+func (app *App) DeleteMe(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	u, err := app.accountUsecases.ScheduleAccountDeletion(ctx, app.mailer, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var rneErr *usecases.RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			responseWithUnauthorized(w)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	clearCookieJWTAuthToken(w)
+	clearCookieRefreshToken(w)
+	responseWithJSON(w, http.StatusAccepted, u)
+}
+
+// CancelDeleteMe cancels the scheduled deletion of the logged user's account
+func (app *App) CancelDeleteMe(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	u, err := app.accountUsecases.CancelAccountDeletion(ctx, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var rneErr *usecases.RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			responseWithUnauthorized(w)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, u)
+}
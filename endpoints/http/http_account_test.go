@@ -0,0 +1,108 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+)
+
+func TestExportMe(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/me/export", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	var export entities.UserDataExport
+	err := json.NewDecoder(res.Body).Decode(&export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.Profile.ID != mocks.UserID {
+		t.Errorf("want export of user %q, got %+v", mocks.UserID, export.Profile)
+	}
+	if len(export.Trainings) == 0 {
+		t.Error("want trainings in the export")
+	}
+}
+
+func TestExportMeZip(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/me/export?format=zip", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	if ct := res.Header.Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("want zip content type, got %q", ct)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = true
+	}
+	for _, name := range []string{"profile.json", "sessions.json", "exercises.json", "trainings.json", "api_keys.json"} {
+		if !files[name] {
+			t.Errorf("want %q in the archive, got %v", name, files)
+		}
+	}
+}
+
+func TestExportMeUnknownFormat(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/me/export?format=xml", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestDeleteMe(t *testing.T) {
+	// the deletion ends the sessions of the user, so it is not the user of the other tests
+	userID := "6072d3206144644984a54fe6"
+	req, _ := http.NewRequest(http.MethodDelete, "/me", nil)
+	res := executeRequestAs(t, userID, req)
+	checkResponseCode(t, http.StatusAccepted, res.StatusCode)
+
+	var user entities.User
+	err := json.NewDecoder(res.Body).Decode(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.DeletionScheduledAt == nil {
+		t.Errorf("want deletion to be scheduled, got %+v", user)
+	}
+
+	cleared := 0
+	for _, c := range res.Cookies() {
+		if c.MaxAge < 0 {
+			cleared++
+		}
+	}
+	if cleared != 2 {
+		t.Errorf("want auth cookies to be cleared, got %v", res.Cookies())
+	}
+}
+
+func TestCancelDeleteMe(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/me/deletion/cancel", nil)
+	res := executeRequestAs(t, "deleting"+mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	var user entities.User
+	err := json.NewDecoder(res.Body).Decode(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.DeletionScheduledAt != nil {
+		t.Errorf("want deletion to be cancelled, got %v", user.DeletionScheduledAt)
+	}
+}
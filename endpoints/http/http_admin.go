@@ -0,0 +1,158 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+const (
+	adminUsersDefaultLimit = 50
+	adminUsersMaxLimit     = 100
+)
+
+// responseWithAdminError responds with the error of the action on the user's account
+func responseWithAdminError(w http.ResponseWriter, err error) {
+	var idErr *usecases.InvalidIDError
+	if errors.As(err, &idErr) {
+		responseWithError(w, http.StatusBadRequest, idErr)
+		return
+	}
+	var rneErr *usecases.RecordNotExistsError
+	if errors.As(err, &rneErr) {
+		responseWithError(w, http.StatusNotFound, rneErr)
+		return
+	}
+	var roleErr *usecases.InvalidRoleError
+	if errors.As(err, &roleErr) {
+		responseWithError(w, http.StatusBadRequest, roleErr)
+		return
+	}
+	responseWithInternalError(w)
+}
+
+// GetUsers returns a page of the users, the "q" query parameter filters them by the email address or username,
+// the next page starts after the last user's ID given with the "after" query parameter
+func (app *App) GetUsers(w http.ResponseWriter, req *http.Request) {
+	limit, err := pageLimit(req, adminUsersDefaultLimit, adminUsersMaxLimit)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	q := req.URL.Query()
+
+	query := strings.TrimSpace(q.Get("q"))
+	users, err := app.adminUsecases.GetUsers(req.Context(), query, q.Get("after"), limit)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithAdminError(w, err)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, users)
+}
+
+// GetUserSessions returns the not expired sessions of the user
+func (app *App) GetUserSessions(w http.ResponseWriter, req *http.Request) {
+	sessions, err := app.adminUsecases.GetUserSessions(req.Context(), mux.Vars(req)["userID"])
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithAdminError(w, err)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, sessions)
+}
+
+// LogoutUser ends all sessions of the user
+func (app *App) LogoutUser(w http.ResponseWriter, req *http.Request) {
+	err := app.adminUsecases.LogoutUser(req.Context(), mux.Vars(req)["userID"])
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithAdminError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableUser disables the user's account and ends all of its sessions
+func (app *App) DisableUser(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	targetID := mux.Vars(req)["userID"]
+	if targetID == userID {
+		// it keeps the last admin from locking everyone out
+		responseWithErrorTxt(w, http.StatusBadRequest, "cannot disable own account")
+		return
+	}
+
+	user, err := app.adminUsecases.DisableUser(ctx, targetID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithAdminError(w, err)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, user)
+}
+
+// EnableUser lets the user with the disabled account log in again
+func (app *App) EnableUser(w http.ResponseWriter, req *http.Request) {
+	user, err := app.adminUsecases.EnableUser(req.Context(), mux.Vars(req)["userID"])
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithAdminError(w, err)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, user)
+}
+
+// ChangeUserRole replaces the user's role with the one given in the body
+func (app *App) ChangeUserRole(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	var input struct {
+		Role entities.Role `json:"role"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer req.Body.Close()
+
+	targetID := mux.Vars(req)["userID"]
+	if targetID == userID {
+		// it keeps the last admin from demoting themselves
+		responseWithErrorTxt(w, http.StatusBadRequest, "cannot change own role")
+		return
+	}
+
+	user, err := app.adminUsecases.ChangeUserRole(ctx, targetID, input.Role)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithAdminError(w, err)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, user)
+}
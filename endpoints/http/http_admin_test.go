@@ -0,0 +1,279 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+)
+
+// adminTargetUserID is the user the admin acts on, the actions end the user's sessions,
+// so it is not the user of the other tests
+const adminTargetUserID = "6072d3206144644984a54fe5"
+
+// executeRequestAs sends the request with the new jwt of the user
+func executeRequestAs(t *testing.T, userID string, req *http.Request) *http.Response {
+	t.Helper()
+	ut, err := createJWTAuth(context.TODO(), userID, "admin test device", app.jwtKeys, app.authUsecases.SaveJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+ut.Token)
+	return executeRequestWithoutJWT(req).Result()
+}
+
+func TestAdminPermissions(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		userID string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{
+			desc:   "admin lists users",
+			userID: mocks.AdminUserID,
+			method: http.MethodGet,
+			path:   "/admin/users?limit=10",
+			want:   http.StatusOK,
+		},
+		{
+			desc:   "user lists users",
+			userID: mocks.UserID,
+			method: http.MethodGet,
+			path:   "/admin/users",
+			want:   http.StatusForbidden,
+		},
+		{
+			desc:   "incorrect limit",
+			userID: mocks.AdminUserID,
+			method: http.MethodGet,
+			path:   "/admin/users?limit=1000",
+			want:   http.StatusBadRequest,
+		},
+		{
+			desc:   "admin disables user",
+			userID: mocks.AdminUserID,
+			method: http.MethodPost,
+			path:   "/admin/users/" + adminTargetUserID + "/disable",
+			want:   http.StatusOK,
+		},
+		{
+			desc:   "admin disables not existing user",
+			userID: mocks.AdminUserID,
+			method: http.MethodPost,
+			path:   "/admin/users/notfound/disable",
+			want:   http.StatusNotFound,
+		},
+		{
+			desc:   "admin disables own account",
+			userID: mocks.AdminUserID,
+			method: http.MethodPost,
+			path:   "/admin/users/" + mocks.AdminUserID + "/disable",
+			want:   http.StatusBadRequest,
+		},
+		{
+			desc:   "admin enables user",
+			userID: mocks.AdminUserID,
+			method: http.MethodPost,
+			path:   "/admin/users/" + mocks.DisabledUserID + "/enable",
+			want:   http.StatusOK,
+		},
+		{
+			desc:   "admin views sessions",
+			userID: mocks.AdminUserID,
+			method: http.MethodGet,
+			path:   "/admin/users/" + adminTargetUserID + "/sessions",
+			want:   http.StatusOK,
+		},
+		{
+			desc:   "admin views sessions of not existing user",
+			userID: mocks.AdminUserID,
+			method: http.MethodGet,
+			path:   "/admin/users/notfound/sessions",
+			want:   http.StatusNotFound,
+		},
+		{
+			desc:   "admin logs user out",
+			userID: mocks.AdminUserID,
+			method: http.MethodPost,
+			path:   "/admin/users/" + adminTargetUserID + "/logout",
+			want:   http.StatusNoContent,
+		},
+		{
+			desc:   "user logs user out",
+			userID: mocks.UserID,
+			method: http.MethodPost,
+			path:   "/admin/users/" + mocks.AdminUserID + "/logout",
+			want:   http.StatusForbidden,
+		},
+		{
+			desc:   "user disables user",
+			userID: mocks.UserID,
+			method: http.MethodPost,
+			path:   "/admin/users/" + mocks.AdminUserID + "/disable",
+			want:   http.StatusForbidden,
+		},
+		{
+			desc:   "admin changes role",
+			userID: mocks.AdminUserID,
+			method: http.MethodPut,
+			path:   "/admin/users/" + mocks.UserID + "/role",
+			body:   `{"role":"coach"}`,
+			want:   http.StatusOK,
+		},
+		{
+			desc:   "admin changes role to unknown one",
+			userID: mocks.AdminUserID,
+			method: http.MethodPut,
+			path:   "/admin/users/" + mocks.UserID + "/role",
+			body:   `{"role":"superuser"}`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			desc:   "admin changes own role",
+			userID: mocks.AdminUserID,
+			method: http.MethodPut,
+			path:   "/admin/users/" + mocks.AdminUserID + "/role",
+			body:   `{"role":"user"}`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			desc:   "admin changes role of not existing user",
+			userID: mocks.AdminUserID,
+			method: http.MethodPut,
+			path:   "/admin/users/notfound/role",
+			body:   `{"role":"coach"}`,
+			want:   http.StatusNotFound,
+		},
+		{
+			desc:   "coach changes role",
+			userID: mocks.CoachUserID,
+			method: http.MethodPut,
+			path:   "/admin/users/" + mocks.UserID + "/role",
+			body:   `{"role":"admin"}`,
+			want:   http.StatusForbidden,
+		},
+		{
+			desc:   "user changes role",
+			userID: mocks.UserID,
+			method: http.MethodPut,
+			path:   "/admin/users/" + mocks.UserID + "/role",
+			body:   `{"role":"admin"}`,
+			want:   http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			res := executeRequestAs(t, tc.userID, req)
+			checkResponseCode(t, tc.want, res.StatusCode)
+		})
+	}
+}
+
+func TestAdminGetUsers(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/admin/users", nil)
+	res := executeRequestAs(t, mocks.AdminUserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	users := []entities.User{}
+	err := json.NewDecoder(res.Body).Decode(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != mocks.ExampleUser.ID || users[0].Role != entities.RoleUser {
+		t.Errorf("want users [%v], got %v", mocks.ExampleUser, users)
+	}
+}
+
+func TestAdminSearchUsers(t *testing.T) {
+	testCases := []struct {
+		query string
+		want  int
+	}{
+		{query: "JOHN", want: 1},
+		{query: "silver@email", want: 1},
+		{query: "nobody", want: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/admin/users?q="+url.QueryEscape(tc.query), nil)
+			res := executeRequestAs(t, mocks.AdminUserID, req)
+			checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+			users := []entities.User{}
+			err := json.NewDecoder(res.Body).Decode(&users)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != tc.want {
+				t.Errorf("want %d users, got %v", tc.want, users)
+			}
+		})
+	}
+}
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/admin/users/"+adminTargetUserID+"/disable", nil)
+	req.Header.Set("User-Agent", "audit test")
+	res := executeRequestAs(t, mocks.AdminUserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	events := auditRepo.Events()
+	if len(events) == 0 {
+		t.Fatal("want audit event of the admin action")
+	}
+	e := events[len(events)-1]
+	if e.Action != entities.AuditActionAdminDisableUser || e.ActorID != mocks.AdminUserID ||
+		e.UserID != adminTargetUserID || e.UserAgent != "audit test" {
+		t.Errorf("want disable event of %q by %q, got %+v", adminTargetUserID, mocks.AdminUserID, e)
+	}
+}
+
+func TestDisabledAccountRejected(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/sessions", nil)
+	res := executeRequestAs(t, mocks.DisabledUserID, req)
+	checkResponseCode(t, http.StatusForbidden, res.StatusCode)
+
+	payload, _ := json.Marshal(map[string]string{
+		"emailAddress": mocks.DisabledEmail,
+		"password":     string(mocks.Password),
+	})
+	req, _ = http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+	response := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	if c := getCookie(response, cookieJwtTokenName); c != nil && c.Value != "" {
+		t.Errorf("want no %q cookie", cookieJwtTokenName)
+	}
+}
+
+func TestAdminRejectsAPIKey(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/admin/users", nil)
+	res := executeRequestWithAPIKey(req, "gymm_whatever")
+	checkResponseCode(t, http.StatusUnauthorized, res.Code)
+}
+
+func TestModerateExercise(t *testing.T) {
+	createdBy := mocks.ExampleExercise.CreatedBy
+	mocks.ExampleExercise.CreatedBy = mocks.NonexistingUserID
+	defer func() { mocks.ExampleExercise.CreatedBy = createdBy }()
+
+	req, _ := http.NewRequest(http.MethodPatch, "/exercises/"+mocks.ExampleExercise.ID,
+		bytes.NewBufferString(`{"name":"DL"}`))
+	res := executeRequestAs(t, mocks.AdminUserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/exercises/"+mocks.ExampleExercise.ID,
+		bytes.NewBufferString(`{"name":"DL"}`))
+	res = executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+}
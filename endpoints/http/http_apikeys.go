@@ -0,0 +1,138 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"github.com/unnamedxaer/gymm-api/validation"
+)
+
+func validateAPIKeyInput(validate *validator.Validate, input *usecases.APIKeyInput) error {
+	formattedErrors := make(map[string]string)
+
+	errs := validate.Struct(input)
+	if errs != nil {
+		validateErrs, ok := errs.(validator.ValidationErrors)
+		if !ok {
+			return errs
+		}
+
+		for _, err := range validateErrs {
+			fieldName := err.Field()
+			// the scopes are validated one by one, eg. "Scopes[1]" becomes "scopes[1]"
+			structField, index := err.StructField(), ""
+			if i := strings.IndexByte(structField, '['); i != -1 {
+				structField, index = structField[:i], structField[i:]
+			}
+			fn, ok := validation.GetFieldJSONTag(input, structField)
+			if ok {
+				fieldName = fn + index
+			}
+			formattedErrors[fieldName] += getErrorTranslation(&err, fieldName)
+		}
+	}
+
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		formattedErrors["expiresAt"] += "The 'expiresAt' has to be in the future. "
+	}
+
+	if len(formattedErrors) > 0 {
+		return validation.NewStructValidError(formattedErrors)
+	}
+	return nil
+}
+
+// GetAPIKeys returns the user's API keys without their plain values
+func (app *App) GetAPIKeys(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	keys, err := app.apiKeyUsecases.GetAPIKeys(ctx, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, keys)
+}
+
+// CreateAPIKey generates new API key, its plain value is returned only in this response
+func (app *App) CreateAPIKey(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	var input usecases.APIKeyInput
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer req.Body.Close()
+
+	input.Name = strings.TrimSpace(input.Name)
+
+	err = validateAPIKeyInput(app.Validate, &input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		if svErr, ok := err.(*validation.StructValidError); ok {
+			responseWithJSON(w, http.StatusNotAcceptable, svErr.Format())
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	key, err := app.apiKeyUsecases.CreateAPIKey(ctx, userID, &input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusCreated, key)
+}
+
+// RevokeAPIKey removes the user's API key, the requests with it are rejected immediately
+func (app *App) RevokeAPIKey(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	err := app.apiKeyUsecases.RevokeAPIKey(ctx, userID, mux.Vars(req)["keyID"])
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var idErr *usecases.InvalidIDError
+		if errors.As(err, &idErr) {
+			responseWithError(w, http.StatusBadRequest, idErr)
+			return
+		}
+		var rneErr *usecases.RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			responseWithError(w, http.StatusNotFound, rneErr)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+)
+
+func createTestAPIKey(t *testing.T, scopes ...entities.APIKeyScope) entities.APIKey {
+	t.Helper()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"name":   "spreadsheet",
+		"scopes": scopes,
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/api-keys", bytes.NewBuffer(payload))
+	response := executeRequestWithSession(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var key entities.APIKey
+	err := json.NewDecoder(response.Body).Decode(&key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID == "" || key.Key == "" {
+		t.Fatalf("want created key with its plain value, got %+v", key)
+	}
+	return key
+}
+
+func executeRequestWithAPIKey(req *http.Request, key string) *httptest.ResponseRecorder {
+	req.Header.Set(headerAuthorization, "Bearer "+key)
+	return executeRequestWithoutJWT(req)
+}
+
+func TestAPIKeys(t *testing.T) {
+	key := createTestAPIKey(t, entities.APIKeyScopeTrainingsRead)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api-keys", nil)
+	response := executeRequestWithSession(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var keys []entities.APIKey
+	json.NewDecoder(response.Body).Decode(&keys)
+	found := false
+	for _, k := range keys {
+		if k.ID == key.ID {
+			found = k.Key == "" && k.Prefix == key.Prefix
+		}
+	}
+	if !found {
+		t.Errorf("want key %q listed without its plain value, got %+v", key.ID, keys)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/trainings", nil)
+	response = executeRequestWithAPIKey(req, key.Key)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	// not granted scope
+	req, _ = http.NewRequest(http.MethodPost, "/trainings", bytes.NewBufferString("{}"))
+	response = executeRequestWithAPIKey(req, key.Key)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	// endpoints without a scope accept only the jwt
+	req, _ = http.NewRequest(http.MethodGet, "/api-keys", nil)
+	response = executeRequestWithAPIKey(req, key.Key)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/api-keys/"+key.ID, nil)
+	response = executeRequestWithSession(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/trainings", nil)
+	response = executeRequestWithAPIKey(req, key.Key)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/api-keys/"+key.ID, nil)
+	response = executeRequestWithSession(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		payload map[string]interface{}
+		field   string
+	}{
+		{
+			desc:    "missing name",
+			payload: map[string]interface{}{"scopes": []string{"exercises"}},
+			field:   "name",
+		},
+		{
+			desc:    "unknown scope",
+			payload: map[string]interface{}{"name": "key", "scopes": []string{"exercises", "admin"}},
+			field:   "scopes[1]",
+		},
+		{
+			desc:    "no scopes",
+			payload: map[string]interface{}{"name": "key", "scopes": []string{}},
+			field:   "scopes",
+		},
+		{
+			desc: "expired",
+			payload: map[string]interface{}{
+				"name":      "key",
+				"scopes":    []string{"exercises"},
+				"expiresAt": time.Now().Add(-time.Minute),
+			},
+			field: "expiresAt",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			payload, _ := json.Marshal(tc.payload)
+			req, _ := http.NewRequest(http.MethodPost, "/api-keys", bytes.NewBuffer(payload))
+			response := executeRequestWithSession(t, mocks.UserID, req)
+			checkResponseCode(t, http.StatusNotAcceptable, response.Code)
+
+			var body struct {
+				Errors map[string]string `json:"errors"`
+			}
+			json.NewDecoder(response.Body).Decode(&body)
+			if body.Errors[tc.field] == "" {
+				t.Errorf("want error for %q, got %v", tc.field, body.Errors)
+			}
+		})
+	}
+}
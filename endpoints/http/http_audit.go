@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+const (
+	securityEventsDefaultLimit = 50
+	securityEventsMaxLimit     = 100
+)
+
+// GetSecurityEvents returns a page of the security events of the logged user, the newest first,
+// the next page starts before the last event's ID given with the "before" query parameter
+func (app *App) GetSecurityEvents(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	limit, err := pageLimit(req, securityEventsDefaultLimit, securityEventsMaxLimit)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	events, err := app.auditUsecases.GetSecurityEvents(ctx, userID, req.URL.Query().Get("before"), limit)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var idErr *usecases.InvalidIDError
+		if errors.As(err, &idErr) {
+			responseWithError(w, http.StatusBadRequest, idErr)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, events)
+}
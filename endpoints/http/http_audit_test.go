@@ -0,0 +1,65 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+)
+
+func TestGetSecurityEvents(t *testing.T) {
+	for _, e := range []entities.AuditEvent{
+		{Action: entities.AuditActionLoginSucceeded, UserID: mocks.UserID, ActorID: mocks.UserID, IP: "10.0.0.1"},
+		{Action: entities.AuditActionAdminLogoutUser, UserID: mocks.UserID, ActorID: mocks.AdminUserID, IP: "10.0.0.2"},
+	} {
+		e := e
+		_, err := auditRepo.InsertAuditEvent(context.TODO(), &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/me/security-events?limit=2", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	var events []entities.AuditEvent
+	err := json.NewDecoder(res.Body).Decode(&events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("want 2 events, got %+v", events)
+	}
+	if events[0].Action != entities.AuditActionAdminLogoutUser || events[0].ActorID != "" || events[0].IP != "" {
+		t.Errorf("want the admin's logout event without the admin's details, got %+v", events[0])
+	}
+	if events[1].Action != entities.AuditActionLoginSucceeded || events[1].IP != "10.0.0.1" {
+		t.Errorf("want the user's login with the IP address, got %+v", events[1])
+	}
+
+	testCases := []struct {
+		desc  string
+		query string
+	}{
+		{desc: "invalid before", query: "?before=INVALIDID"},
+		{desc: "limit too low", query: "?limit=0"},
+		{desc: "limit too high", query: "?limit=101"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/me/security-events"+tc.query, nil)
+			res := executeRequestAs(t, mocks.UserID, req)
+			checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+		})
+	}
+}
+
+func TestGetSecurityEventsRejectsAPIKey(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/me/security-events", nil)
+	res := executeRequestWithAPIKey(req, "gymm_whatever")
+	checkResponseCode(t, http.StatusUnauthorized, res.Code)
+}
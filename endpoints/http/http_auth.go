@@ -2,18 +2,26 @@ package http
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
 	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-playground/validator/v10"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
 	"github.com/unnamedxaer/gymm-api/usecases"
 	"github.com/unnamedxaer/gymm-api/validation"
 )
@@ -21,12 +29,33 @@ import (
 type Claims struct {
 	ID string `json:"id"`
 	// IssuedAt is here to make the tokens unique by different payload
-	IssuedAt               int64 `json:"createdAt"`
-	*entities.RefreshToken `json:"r"`
+	IssuedAt int64 `json:"createdAt"`
 	jwt.StandardClaims
 }
 
-const cookieJwtTokenName = "__HOST-token"
+const (
+	cookieJwtTokenName = "__HOST-token"
+	// cookieRefreshTokenName is sent only to the refresh endpoint
+	cookieRefreshTokenName = "refresh-token"
+	headerAuthorization    = "Authorization"
+	bearerPrefix           = "Bearer "
+	// authModeToken is a value of the "mode" query parameter of login and register
+	// that makes them return the tokens in the response body instead of the cookies
+	authModeToken = "token"
+	// queryKeepSession is a query parameter of the password change
+	// that keeps the caller logged in while the other sessions are revoked
+	queryKeepSession = "keepSession"
+	// headerDeviceID identifies the client's device, the sessions are kept per device,
+	// the clients without it get a new ID from the login
+	headerDeviceID = "X-Device-ID"
+	// cookieDeviceIDName keeps the device ID of the browsers
+	cookieDeviceIDName   = "device-id"
+	cookieDeviceIDMaxAge = 400 * 24 * 60 * 60
+)
+
+// deviceIDPattern accepts the generated device IDs and the UUIDs,
+// the minimal length keeps the clients from choosing the guessable ones
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
 
 // Login validates input and login the user
 func (app *App) Login(w http.ResponseWriter, req *http.Request) {
@@ -43,7 +72,25 @@ func (app *App) Login(w http.ResponseWriter, req *http.Request) {
 
 	ctx := req.Context()
 
-	user, err := app.authUsecases.Login(ctx, ui)
+	user, err := app.authUsecases.Login(ctx, app.mailer, ui, app.clientIP(req))
+	var llErr *usecases.LoginLockedError
+	if errors.As(err, &llErr) {
+		logDebugError(app.l, req, err)
+		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
+		retryAfter := int64(math.Ceil(llErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		responseWithErrorTxt(w, http.StatusTooManyRequests, llErr.Error())
+		return
+	}
+	var adErr *usecases.AccountDisabledError
+	if errors.As(err, &adErr) {
+		logDebugError(app.l, req, err)
+		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
+		responseWithError(w, http.StatusForbidden, adErr)
+		return
+	}
 	if err != nil && errors.Is(err, &usecases.IncorrectCredentialsError{}) {
 		logDebugError(app.l, req, err)
 		responseWithInternalError(w)
@@ -57,18 +104,40 @@ func (app *App) Login(w http.ResponseWriter, req *http.Request) {
 	if user == nil {
 		output["error"] = "incorrect credentials"
 		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
 		responseWithJSON(w, http.StatusOK, output)
 		return
 	}
 
-	device := req.UserAgent() // @todo: improve, mb send some info from client
-	err = app.login(ctx, w, user.ID, device, req.Method, req.RequestURI)
+	if user.TwoFactorEnabled {
+		// the auth tokens are issued after the second step, see LoginTwoFactor
+		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
+		challenge, err := createTwoFactorChallenge(user.ID, app.jwtKeys)
+		if err != nil {
+			logDebugError(app.l, req, err)
+			responseWithInternalError(w)
+			return
+		}
+		responseWithJSON(w, http.StatusOK, map[string]interface{}{
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+		})
+		return
+	}
+
+	tokenMode := isTokenAuthMode(req)
+	ut, rt, err := app.login(ctx, w, user.ID, requestDeviceID(req), tokenMode)
 	if err != nil {
 		logDebugError(app.l, req, err)
 		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
 		responseWithInternalError(w)
 		return
 	}
+	if tokenMode {
+		setAuthTokensOutput(output, ut, rt)
+	}
 
 	responseWithJSON(w, http.StatusOK, output)
 }
@@ -113,33 +182,54 @@ func (app *App) Register(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// the user can ask for another email if this one fails
+	err = app.authUsecases.SendEmailVerification(ctx, app.mailer, user.ID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+	}
+
 	// login user
 
 	output := map[string]interface{}{
 		"user": user,
 	}
 
-	err = app.login(ctx, w, user.ID, req.UserAgent(), req.Method, req.RequestURI)
+	tokenMode := isTokenAuthMode(req)
+	ut, rt, err := app.login(ctx, w, user.ID, requestDeviceID(req), tokenMode)
 	if err != nil {
 		logDebugError(app.l, req, err)
 		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
 		responseWithInternalError(w)
 		return
 	}
+	if tokenMode {
+		setAuthTokensOutput(output, ut, rt)
+	}
 
 	responseWithJSON(w, http.StatusCreated, output)
 }
 
 // Logout logouts the user, removes token from cookies & storage
 func (app *App) Logout(w http.ResponseWriter, req *http.Request) {
-	cookie, err := req.Cookie(cookieJwtTokenName)
+	token, _, err := getAuthToken(req)
 	var n int64
-	if cookie != nil {
+	if err == nil {
 		ctx := req.Context()
+		// the refresh token cookie is not sent to this endpoint,
+		// so the refresh token of the session is found by the device of the jwt
+		userID, device, sErr := app.tokenSession(ctx, token)
+		if sErr == nil && device != "" {
+			_, sErr = app.authUsecases.DeleteRefreshToken(ctx, userID, device)
+		}
+		if sErr != nil {
+			logDebugError(app.l, req, sErr)
+		}
+
 		n, err = app.authUsecases.DeleteJWT(
 			ctx,
 			&entities.UserToken{
-				Token: cookie.Value,
+				Token: token,
 			})
 
 	}
@@ -147,12 +237,45 @@ func (app *App) Logout(w http.ResponseWriter, req *http.Request) {
 		logDebugError(app.l, req, err)
 	} else if n == 0 {
 		logDebugError(app.l, req, fmt.Errorf(
-			"JWT was not deleted for cookie.value: %s", cookie.Value))
+			"JWT was not deleted for token: %s", token))
+	}
+
+	if cookie, err := req.Cookie(cookieRefreshTokenName); err == nil {
+		_, err = app.authUsecases.RevokeRefreshToken(req.Context(), cookie.Value)
+		if err != nil {
+			logDebugError(app.l, req, err)
+		}
 	}
 	clearCookieJWTAuthToken(w)
+	clearCookieRefreshToken(w)
 	w.WriteHeader(http.StatusOK)
 }
 
+// tokenSession returns the user and the device of the session the jwt belongs to,
+// the expired jwt still identifies its session. The device is empty if the session is not found
+func (app *App) tokenSession(ctx context.Context, token string) (userID, device string, err error) {
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(token, claims, app.jwtKeys.Keyfunc)
+	var vErr *jwt.ValidationError
+	if err != nil && !(errors.As(err, &vErr) && vErr.Errors == jwt.ValidationErrorExpired) {
+		return "", "", err
+	}
+	if claims.ID == "" || claims.Audience != "" {
+		return "", "", nil
+	}
+
+	tokens, err := app.authUsecases.GetUserJWTs(ctx, claims.ID, entities.All)
+	if err != nil {
+		return "", "", err
+	}
+	for _, t := range tokens {
+		if t.Token == token {
+			return claims.ID, t.Device, nil
+		}
+	}
+	return claims.ID, "", nil
+}
+
 // GetSessions returns all user sessions
 func (app *App) GetSessions(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
@@ -194,29 +317,46 @@ func (app *App) LogoutSession(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if ut.ID == "" && ut.Token == "" && ut.Device == "" {
+		// logout from all devices is done by the logout-all endpoint
+		responseWithErrorTxt(w, http.StatusBadRequest, "missing session id, token or device")
+		return
+	}
 	ut.UserID = userID
 
-	cookie, _ := req.Cookie(cookieJwtTokenName)
-	if cookie != nil {
-		// determine if user want to delete current token
-		// and logout his in that case
-		if ut.Token != "" {
-			if ut.Token == cookie.Value {
-				clearCookieJWTAuthToken(w)
-			}
-		} else {
-			storedTokens, err := app.authUsecases.GetUserJWTs(
-				ctx, userID, entities.NotExpired)
-			if err != nil {
-				logDebugError(app.l, req, err)
-			}
+	storedTokens, err := app.authUsecases.GetUserJWTs(ctx, userID, entities.All)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithInternalError(w)
+		return
+	}
 
-			for _, t := range storedTokens {
-				if t.Token == cookie.Value {
-					clearCookieJWTAuthToken(w)
-					break
-				}
-			}
+	// the device of the session is needed to revoke its refresh token
+	device := ut.Device
+	currentToken, usesCookie, _ := getAuthToken(req)
+	isCurrent := false
+	for _, t := range storedTokens {
+		if !sessionMatches(&t, &ut) {
+			continue
+		}
+		if device == "" {
+			device = t.Device
+		}
+		isCurrent = isCurrent || t.Token == currentToken
+	}
+
+	// logout the user if he wants to delete current session
+	if usesCookie && isCurrent {
+		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
+	}
+
+	if device != "" {
+		_, err = app.authUsecases.DeleteRefreshToken(ctx, userID, device)
+		if err != nil {
+			logDebugError(app.l, req, err)
+			responseWithInternalError(w)
+			return
 		}
 	}
 
@@ -243,7 +383,15 @@ func (app *App) LogoutSession(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-// LogoutSession logouts the user, from the device/browser
+// sessionMatches checks whether the stored token matches the session
+// identified by non empty fields of the given one
+func sessionMatches(stored, session *entities.UserToken) bool {
+	return (session.ID == "" || session.ID == stored.ID) &&
+		(session.Token == "" || session.Token == stored.Token) &&
+		(session.Device == "" || session.Device == stored.Device)
+}
+
+// LogoutAllSessions logouts the user from all devices/browsers
 func (app *App) LogoutAllSessions(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	userID, ok := ctx.Value(contextKeyUserID).(string)
@@ -264,6 +412,7 @@ func (app *App) LogoutAllSessions(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	clearCookieJWTAuthToken(w)
+	clearCookieRefreshToken(w)
 	if n == 0 {
 		responseWithJSON(
 			w, http.StatusOK, map[string]string{"warning": "no records were deleted"})
@@ -316,7 +465,13 @@ func (app *App) ChangePassword(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = app.authUsecases.ChangePassword(ctx, userID, body["oldPassword"], body["password"])
+	keepSession := req.URL.Query().Get(queryKeepSession) == "true"
+	device := ""
+	if keepSession {
+		device = app.currentSessionDevice(req, userID)
+	}
+
+	err = app.authUsecases.ChangePassword(ctx, app.mailer, userID, body["oldPassword"], body["password"])
 	if err != nil {
 		logDebugError(app.l, req, err)
 		if errors.Is(err, usecases.IncorrectCredentialsError{}) {
@@ -328,9 +483,75 @@ func (app *App) ChangePassword(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if !keepSession {
+		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// the current session was revoked together with the others, so it is replaced by a new one
+	tokenMode := isTokenAuthMode(req)
+	ut, rt, err := app.login(ctx, w, userID, device, tokenMode)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
+		responseWithInternalError(w)
+		return
+	}
+
+	if tokenMode {
+		output := map[string]interface{}{}
+		setAuthTokensOutput(output, ut, rt)
+		responseWithJSON(w, http.StatusOK, output)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
+// currentSessionDevice returns the device of the session the request is authenticated with
+func (app *App) currentSessionDevice(req *http.Request, userID string) string {
+	current, _, err := getAuthToken(req)
+	if err == nil {
+		var tokens []entities.UserToken
+		tokens, err = app.authUsecases.GetUserJWTs(req.Context(), userID, entities.All)
+		for _, t := range tokens {
+			if t.Token == current {
+				return t.Device
+			}
+		}
+	}
+	if err != nil {
+		logDebugError(app.l, req, err)
+	}
+
+	return requestDeviceID(req)
+}
+
+// requestDeviceID returns the device ID sent by the client in the header or the cookie,
+// empty string is returned if there is no valid one
+func requestDeviceID(req *http.Request) string {
+	if id := req.Header.Get(headerDeviceID); deviceIDPattern.MatchString(id) {
+		return id
+	}
+	if c, err := req.Cookie(cookieDeviceIDName); err == nil && deviceIDPattern.MatchString(c.Value) {
+		return c.Value
+	}
+	return ""
+}
+
+// newDeviceID generates the random ID of the device that did not send its own
+func newDeviceID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func (app *App) AddResetPasswordRequest(w http.ResponseWriter, req *http.Request) {
 
 	input := usecases.UserInput{}
@@ -388,9 +609,10 @@ func (app *App) UpdatePasswordOnResetRequest(w http.ResponseWriter, req *http.Re
 	// clean it in case another account was logged in
 	// to not mess it up.
 	clearCookieJWTAuthToken(w)
-	reqID, ok := mux.Vars(req)["requestID"]
+	clearCookieRefreshToken(w)
+	token, ok := mux.Vars(req)["token"]
 	if !ok {
-		err := errors.New("missign request id query parameter")
+		err := errors.New("missign token query parameter")
 		logDebugError(app.l, req, err)
 		responseWithError(w, http.StatusBadRequest, err)
 		return
@@ -437,7 +659,7 @@ func (app *App) UpdatePasswordOnResetRequest(w http.ResponseWriter, req *http.Re
 	}
 
 	ctx := req.Context()
-	err = app.authUsecases.UpdatePasswordForResetRequest(ctx, reqID, input.Password)
+	err = app.authUsecases.UpdatePasswordForResetRequest(ctx, app.mailer, token, input.Password)
 	if err != nil {
 		logDebugError(app.l, req, err)
 		var rnfErr *usecases.RecordNotExistsError
@@ -453,40 +675,121 @@ func (app *App) UpdatePasswordOnResetRequest(w http.ResponseWriter, req *http.Re
 	w.WriteHeader(http.StatusOK)
 
 }
+
+// Refresh exchanges the refresh token for the new jwt and refresh token.
+// The refresh token is read from the request body, in which case
+// the new tokens are sent back in the response body, or from the cookie.
 func (app *App) Refresh(w http.ResponseWriter, req *http.Request) {
-	w.WriteHeader(http.StatusOK)
+	var input struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	tokenMode := false
+	if req.ContentLength != 0 {
+		err := json.NewDecoder(req.Body).Decode(&input)
+		if err != nil && err != io.EOF {
+			logDebugError(app.l, req, err)
+			responseWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		tokenMode = input.RefreshToken != ""
+	}
+	if !tokenMode {
+		cookie, err := req.Cookie(cookieRefreshTokenName)
+		if err != nil {
+			logDebugError(app.l, req, err)
+			responseWithUnauthorized(w, "no refresh token provided")
+			return
+		}
+		input.RefreshToken = cookie.Value
+	}
+
+	ctx := req.Context()
+	rt, err := app.authUsecases.RotateRefreshToken(ctx, input.RefreshToken)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var irtErr *usecases.InvalidRefreshTokenError
+		var rtrErr *usecases.RefreshTokenReusedError
+		if errors.As(err, &irtErr) || errors.As(err, &rtrErr) {
+			clearCookieJWTAuthToken(w)
+			clearCookieRefreshToken(w)
+			responseWithUnauthorized(w, err)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	// the new jwt belongs to the same device session as the refresh token
+	ut, err := createJWTAuth(ctx, rt.UserID, rt.Device, app.jwtKeys, app.authUsecases.SaveJWT)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithInternalError(w)
+		return
+	}
+
+	output := make(map[string]interface{}, 4)
+	if tokenMode {
+		setAuthTokensOutput(output, ut, rt)
+	} else {
+		setCookieJWTAuthToken(w, ut.Token, ut.ExpiresAt)
+		setCookieRefreshToken(w, rt.Token, rt.ExpiresAt)
+		output["expiresAt"] = ut.ExpiresAt
+	}
+
+	responseWithJSON(w, http.StatusOK, output)
 }
 
 // login make user authenticated by
-// creating tokens and setting them in user response as a cookie
-// tokens are also stored in db
+// creating tokens and setting them in user response as cookies,
+// in the token mode the cookies are not set and the caller should send the tokens
+// tokens are also stored in db,
+// the device without ID gets a new one which is returned in the X-Device-ID header
 func (app *App) login(
 	ctx context.Context,
 	w http.ResponseWriter,
-	userID, device, method, reqURI string) error {
-	rt, err := app.authUsecases.GetRefreshToken(ctx, userID)
-	if err != nil {
-		app.l.Debug().Msgf("[%s %s]: error: %v", method, reqURI, err)
-		// the retrive of the refresh token has failed for some reason,
-		// but we can try to create new refresh token.
-	}
-
-	if rt == nil || time.Until(rt.ExpiresAt) <= 0 {
-		rt, err = createRefreshToken(
-			ctx, userID, app.authUsecases.SaveRefreshToken)
+	userID, device string,
+	tokenMode bool) (*entities.UserToken, *entities.RefreshToken, error) {
+	var err error
+	if device == "" {
+		device, err = newDeviceID()
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 	}
 
+	rt, err := app.authUsecases.CreateRefreshToken(ctx, userID, device)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	token, err := createJWTAuth(
-		ctx, userID, device, rt, app.jwtKey, app.authUsecases.SaveJWT)
+		ctx, userID, device, app.jwtKeys, app.authUsecases.SaveJWT)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	setCookieJWTAuthToken(w, token.Token, token.ExpiresAt)
-	return nil
+	w.Header().Set(headerDeviceID, device)
+	if !tokenMode {
+		setCookieJWTAuthToken(w, token.Token, token.ExpiresAt)
+		setCookieRefreshToken(w, rt.Token, rt.ExpiresAt)
+		setCookieDeviceID(w, device)
+	}
+	return token, rt, nil
+}
+
+// setAuthTokensOutput adds tokens to the response of the token mode
+func setAuthTokensOutput(output map[string]interface{}, ut *entities.UserToken, rt *entities.RefreshToken) {
+	output["token"] = ut.Token
+	output["expiresAt"] = ut.ExpiresAt
+	output["refreshToken"] = rt.Token
+	output["refreshTokenExpiresAt"] = rt.ExpiresAt
+	output["deviceId"] = rt.Device
+}
+
+// isTokenAuthMode checks whether the client wants to receive the jwt
+// in the response body to use it with the "Authorization: Bearer" header
+func isTokenAuthMode(req *http.Request) bool {
+	return req.URL.Query().Get("mode") == authModeToken
 }
 
 // sets a cookie with jwt
@@ -510,13 +813,48 @@ func clearCookieJWTAuthToken(w http.ResponseWriter) {
 	})
 }
 
+// sets a cookie with refresh token, the cookie is sent only to the refresh endpoint
+func setCookieRefreshToken(w http.ResponseWriter, token string, expTime time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieRefreshTokenName,
+		Value:    token,
+		Expires:  expTime,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		// Secure:   true,
+		Path: "/refresh",
+	})
+}
+
+// sets -1 to the refresh token cookie max age to force its removal
+func clearCookieRefreshToken(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   cookieRefreshTokenName,
+		MaxAge: -1, // remove cookie
+		Path:   "/refresh",
+	})
+}
+
+// sets a cookie with the device ID, it outlives the sessions so the next login replaces the device's one,
+// it is lax to reach the OpenID Connect callback, the ID alone does not authenticate
+func setCookieDeviceID(w http.ResponseWriter, id string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieDeviceIDName,
+		Value:    id,
+		MaxAge:   cookieDeviceIDMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		// Secure:   true,
+		Path: "/",
+	})
+}
+
 // generate new jwt for given user and saves it in storage
 func createJWTAuth(
 	ctx context.Context,
 	userID string,
 	device string,
-	rt *entities.RefreshToken,
-	jwtKey []byte,
+	jwtKeys *jwtkeys.KeySet,
 	saveFunc func(
 		ctx context.Context,
 		userID string,
@@ -528,16 +866,14 @@ func createJWTAuth(
 	expirationTime := now.Add(time.Second * 60 * 5) // @todo: configurable time
 
 	claims := Claims{
-		ID:           userID,
-		RefreshToken: rt,
-		IssuedAt:     now.UnixNano(),
+		ID:       userID,
+		IssuedAt: now.UnixNano(),
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 			IssuedAt:  now.Unix(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
-	tokenStr, err := token.SignedString(jwtKey)
+	tokenStr, err := jwtKeys.Sign(&claims)
 	if err != nil {
 		return nil, err
 	}
@@ -545,30 +881,44 @@ func createJWTAuth(
 	return saveFunc(ctx, userID, device, tokenStr, expirationTime)
 }
 
-// generate new refresh token for given user and saves it in storage
-func createRefreshToken(
-	ctx context.Context,
-	userID string,
-	saveFunc func(
-		ctx context.Context,
-		userID string,
-		token string,
-		expiresAt time.Time) (*entities.RefreshToken, error)) (*entities.RefreshToken, error) {
-
-	refreshVal, err := uuid.NewRandom()
+// clientIP returns the IP address of the request's sender,
+// the X-Forwarded-For header is read only when the request comes from a trusted proxy
+// as otherwise it can be set by the client
+func (app *App) clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
 	if err != nil {
-		return nil, err
+		host = req.RemoteAddr
+	}
+	if !app.isTrustedProxy(host) {
+		return host
 	}
-	return saveFunc(ctx, userID, refreshVal.String(), time.Now().AddDate(1, 0, 0))
+
+	// every proxy appends the address it got the request from,
+	// the first untrusted one from the right is the client
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(addr) == nil {
+			break
+		}
+		host = addr
+		if !app.isTrustedProxy(addr) {
+			break
+		}
+	}
+	return host
 }
 
-// it returns nil error if token is valid
-func validateRefreshToken(rt *entities.RefreshToken, clientRefToken string) error {
-	if rt == nil || time.Until(rt.ExpiresAt) <= 0 {
-		return errors.New("token & refresh token expired")
+// isTrustedProxy tells if the address belongs to one of the trusted proxies
+func (app *App) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
 	}
-	if rt.Token != clientRefToken {
-		return errors.New("invalid refresh token")
+	for _, network := range app.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
 	}
-	return nil
+	return false
 }
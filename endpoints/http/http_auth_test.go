@@ -2,10 +2,15 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/unnamedxaer/gymm-api/entities"
 	"github.com/unnamedxaer/gymm-api/mocks"
@@ -67,6 +72,283 @@ func TestLogin(t *testing.T) {
 
 }
 
+func TestLoginTokenMode(t *testing.T) {
+	u := usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	}
+
+	uJSON, err := json.Marshal(&u)
+	if err != nil {
+		t.Fatalf("could not marshal login payload: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/login?mode=token", bytes.NewBuffer(uJSON))
+	response := executeRequestWithoutJWT(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	for _, c := range response.Result().Cookies() {
+		if c.Name == cookieJwtTokenName {
+			t.Errorf("want no token cookie in token mode, got %v", c)
+		}
+	}
+
+	var got struct {
+		Token     string
+		ExpiresAt time.Time
+		User      *entities.User
+	}
+	err = json.NewDecoder(response.Body).Decode(&got)
+	if err != nil {
+		t.Fatalf("could not decode login response: %v", err)
+	}
+
+	if got.User == nil || got.Token == "" || got.ExpiresAt.IsZero() {
+		t.Errorf("want user, token and its expiration time, got %#v", got)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	type tokens struct {
+		Token        string
+		RefreshToken string
+	}
+	refresh := func(t *testing.T, refreshToken string) (*httptest.ResponseRecorder, tokens) {
+		payload, _ := json.Marshal(map[string]string{"refreshToken": refreshToken})
+		req, _ := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBuffer(payload))
+		res := executeRequestWithoutJWT(req)
+
+		got := tokens{}
+		if res.Code == http.StatusOK {
+			err := json.NewDecoder(res.Body).Decode(&got)
+			if err != nil {
+				t.Fatalf("could not decode refresh response: %v", err)
+			}
+		}
+		return res, got
+	}
+
+	payload, _ := json.Marshal(&usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/login?mode=token", bytes.NewBuffer(payload))
+	res := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	login := tokens{}
+	err := json.NewDecoder(res.Body).Decode(&login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.RefreshToken == "" {
+		t.Fatalf("want refresh token in login response, got none")
+	}
+
+	res, rotated := refresh(t, login.RefreshToken)
+	checkResponseCode(t, http.StatusOK, res.Code)
+	if rotated.Token == "" || rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("want new jwt and refresh token, got %+v", rotated)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/trainings", nil)
+	req.Header.Set("Authorization", "Bearer "+rotated.Token)
+	checkResponseCode(t, http.StatusOK, executeRequestWithoutJWT(req).Code)
+
+	// reuse of the rotated token revokes the token family
+	res, _ = refresh(t, login.RefreshToken)
+	checkResponseCode(t, http.StatusUnauthorized, res.Code)
+
+	res, _ = refresh(t, rotated.RefreshToken)
+	checkResponseCode(t, http.StatusUnauthorized, res.Code)
+}
+
+func TestRefreshCookie(t *testing.T) {
+	payload, _ := json.Marshal(&usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+	res := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	var refreshCookie *http.Cookie
+	for _, c := range res.Result().Cookies() {
+		if c.Name == cookieRefreshTokenName {
+			refreshCookie = c
+		}
+	}
+	if refreshCookie == nil || refreshCookie.Value == "" {
+		t.Fatalf("want refresh token cookie, got none")
+	}
+	if refreshCookie.Path != "/refresh" || !refreshCookie.HttpOnly {
+		t.Errorf("want HttpOnly refresh token cookie limited to the refresh path, got %v", refreshCookie)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/refresh", nil)
+	req.AddCookie(refreshCookie)
+	res = executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	got := make(map[string]string, 2)
+	for _, c := range res.Result().Cookies() {
+		got[c.Name] = c.Value
+	}
+	if got[cookieJwtTokenName] == "" {
+		t.Errorf("want new jwt cookie, got %v", got)
+	}
+	if got[cookieRefreshTokenName] == "" || got[cookieRefreshTokenName] == refreshCookie.Value {
+		t.Errorf("want new refresh token cookie, got %v", got)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/refresh", nil)
+	res = executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusUnauthorized, res.Code)
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	payload, _ := json.Marshal(&usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+	res := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	tokenCookie := getCookie(res, cookieJwtTokenName)
+	refreshCookie := getCookie(res, cookieRefreshTokenName)
+	if tokenCookie == nil || refreshCookie == nil {
+		t.Fatalf("want token and refresh token cookies, got %v, %v", tokenCookie, refreshCookie)
+	}
+
+	// the browser sends only the token cookie, the refresh token one is limited to its path
+	req, _ = http.NewRequest(http.MethodGet, "/logout", nil)
+	req.AddCookie(tokenCookie)
+	res = executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/refresh", nil)
+	req.AddCookie(refreshCookie)
+	res = executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusUnauthorized, res.Code)
+}
+
+func TestLogoutSessionRevokesDeviceRefreshToken(t *testing.T) {
+	type tokens struct {
+		Token        string
+		RefreshToken string
+	}
+	login := func(device string) tokens {
+		payload, _ := json.Marshal(&usecases.UserInput{
+			EmailAddress: mocks.ExampleUser.EmailAddress,
+			Password:     string(mocks.Password),
+		})
+		req, _ := http.NewRequest(http.MethodPost, "/login?mode=token", bytes.NewBuffer(payload))
+		req.Header.Set(headerDeviceID, device)
+		res := executeRequestWithoutJWT(req)
+		checkResponseCode(t, http.StatusOK, res.Code)
+
+		got := tokens{}
+		err := json.NewDecoder(res.Body).Decode(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	refresh := func(refreshToken string) int {
+		payload, _ := json.Marshal(map[string]string{"refreshToken": refreshToken})
+		req, _ := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBuffer(payload))
+		return executeRequestWithoutJWT(req).Code
+	}
+
+	phone := login("logout-session-phone")
+	laptop := login("logout-session-laptop")
+
+	req, _ := http.NewRequest(http.MethodPost, "/logout-session",
+		bytes.NewBufferString(`{"device":"logout-session-phone"}`))
+	req.Header.Set("Authorization", "Bearer "+laptop.Token)
+	res := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	checkResponseCode(t, http.StatusUnauthorized, refresh(phone.RefreshToken))
+	checkResponseCode(t, http.StatusOK, refresh(laptop.RefreshToken))
+
+	req, _ = http.NewRequest(http.MethodPost, "/logout-session", bytes.NewBufferString(`{}`))
+	req.Header.Set("Authorization", "Bearer "+laptop.Token)
+	res = executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusBadRequest, res.Code)
+}
+
+func TestLoginDeviceID(t *testing.T) {
+	type tokens struct {
+		RefreshToken string
+		DeviceID     string
+	}
+	payload, _ := json.Marshal(&usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	})
+	login := func(deviceID string) tokens {
+		req, _ := http.NewRequest(http.MethodPost, "/login?mode=token", bytes.NewBuffer(payload))
+		req.Header.Set("User-Agent", "device id phone")
+		if deviceID != "" {
+			req.Header.Set(headerDeviceID, deviceID)
+		}
+		res := executeRequestWithoutJWT(req)
+		checkResponseCode(t, http.StatusOK, res.Code)
+
+		got := tokens{}
+		err := json.NewDecoder(res.Body).Decode(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.DeviceID == "" || res.Header().Get(headerDeviceID) != got.DeviceID {
+			t.Fatalf("want device id in the body and the header, got %q and %q",
+				got.DeviceID, res.Header().Get(headerDeviceID))
+		}
+		return got
+	}
+	refresh := func(refreshToken string) int {
+		body, _ := json.Marshal(map[string]string{"refreshToken": refreshToken})
+		req, _ := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBuffer(body))
+		return executeRequestWithoutJWT(req).Code
+	}
+
+	// the same phones do not log each other out
+	first := login("")
+	second := login("")
+	if first.DeviceID == second.DeviceID {
+		t.Errorf("want different device ids, got %q twice", first.DeviceID)
+	}
+	checkResponseCode(t, http.StatusOK, refresh(first.RefreshToken))
+	checkResponseCode(t, http.StatusOK, refresh(second.RefreshToken))
+
+	// the device's next login replaces its session
+	again := login(first.DeviceID)
+	if again.DeviceID != first.DeviceID {
+		t.Errorf("want device id %q, got %q", first.DeviceID, again.DeviceID)
+	}
+
+	invalid := login("short")
+	if invalid.DeviceID == "short" {
+		t.Errorf("want invalid device id to be replaced")
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+	res := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+	var deviceCookie *http.Cookie
+	for _, c := range res.Result().Cookies() {
+		if c.Name == cookieDeviceIDName {
+			deviceCookie = c
+		}
+	}
+	if deviceCookie == nil || deviceCookie.Value != res.Header().Get(headerDeviceID) || !deviceCookie.HttpOnly {
+		t.Errorf("want http only device id cookie, got %v", deviceCookie)
+	}
+}
+
 func TestRegister(t *testing.T) {
 	u := correctUser
 
@@ -105,6 +387,10 @@ func TestRegisterValidationFail(t *testing.T) {
 	checkResponseCode(t, http.StatusNotAcceptable, response.Code)
 }
 
+// passwordUserID is the user whose password is changed, the change ends the user's sessions,
+// so it is not the user of the other tests
+const passwordUserID = "6072d3206144644984a54fe7"
+
 func TestChangePassword(t *testing.T) {
 	newPassword := string(mocks.Password) + "X"
 
@@ -155,7 +441,7 @@ func TestChangePassword(t *testing.T) {
 			req, _ := http.NewRequest(http.MethodPost, "/password/change", bytes.NewBuffer(b))
 			req.Header.Set("Content-Type", "application/json")
 
-			res := executeRequest(req)
+			res := executeRequestWithSession(t, passwordUserID, req)
 
 			checkResponseCode(t, tC.code, res.Code)
 
@@ -174,6 +460,65 @@ func TestChangePassword(t *testing.T) {
 	}
 }
 
+func TestChangePasswordKeepSession(t *testing.T) {
+	payload, _ := json.Marshal(map[string]string{
+		"oldPassword": string(mocks.Password),
+		"password":    string(mocks.Password) + "X",
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/password/change", bytes.NewBuffer(payload))
+	res := executeRequestWithSession(t, passwordUserID, req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+	cleared := false
+	for _, c := range res.Result().Cookies() {
+		cleared = cleared || (c.Name == cookieJwtTokenName && c.MaxAge < 0)
+	}
+	if !cleared {
+		t.Errorf("want token cookie to be removed with the revoked session")
+	}
+
+	req, _ = http.NewRequest(
+		http.MethodPost, "/password/change?keepSession=true&mode=token", bytes.NewBuffer(payload))
+	res = executeRequestWithSession(t, passwordUserID, req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	var got struct {
+		Token        string
+		RefreshToken string
+	}
+	err := json.NewDecoder(res.Body).Decode(&got)
+	if err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if got.Token == "" || got.RefreshToken == "" {
+		t.Errorf("want new tokens of the kept session, got %+v", got)
+	}
+}
+
+func TestChangePasswordRevokesBearerToken(t *testing.T) {
+	ut, err := createJWTAuth(context.TODO(), passwordUserID, "stolen device", app.jwtKeys, app.authUsecases.SaveJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendWithOldToken := func() int {
+		req, _ := http.NewRequest(http.MethodGet, "/sessions", nil)
+		req.Header.Set(headerAuthorization, "Bearer "+ut.Token)
+		return executeRequestWithoutJWT(req).Code
+	}
+	checkResponseCode(t, http.StatusOK, sendWithOldToken())
+
+	payload, _ := json.Marshal(map[string]string{
+		"oldPassword": string(mocks.Password),
+		"password":    string(mocks.Password) + "X",
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/password/change", bytes.NewBuffer(payload))
+	res := executeRequestWithSession(t, passwordUserID, req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	// the token is not expired yet, but its session has ended
+	checkResponseCode(t, http.StatusUnauthorized, sendWithOldToken())
+}
+
 func TestAddResetPasswordRequest(t *testing.T) {
 	testCases := []struct {
 		desc         string
@@ -210,7 +555,7 @@ func TestAddResetPasswordRequest(t *testing.T) {
 			req, _ := http.NewRequest(http.MethodPost, "/password/reset", bytes.NewBuffer(b))
 			req.Header.Set("Content-Type", "application/json")
 
-			res := executeRequest(req)
+			res := executeRequestWithSession(t, passwordUserID, req)
 
 			checkResponseCode(t, tC.code, res.Code)
 
@@ -239,7 +584,7 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 	}{
 		{
 			desc:   "missing pasword",
-			reqID:  mocks.ExampleResetPwdReq.ID,
+			reqID:  mocks.ExampleResetPwdReq.Token,
 			errTxt: "'password' field value is required",
 			code:   http.StatusBadRequest,
 		},
@@ -257,14 +602,14 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 		},
 		{
 			desc:     "invalid password",
-			reqID:    mocks.ExampleResetPwdReq.ID,
+			reqID:    mocks.ExampleResetPwdReq.Token,
 			password: "aaa",
 			errTxt:   "validation failed",
 			code:     http.StatusBadRequest,
 		},
 		{
 			desc:     "correct",
-			reqID:    mocks.ExampleResetPwdReq.ID,
+			reqID:    mocks.ExampleResetPwdReq.Token,
 			password: string(mocks.Password),
 			code:     http.StatusOK,
 		},
@@ -281,7 +626,7 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 			req, _ := http.NewRequest(http.MethodPatch, "/password/reset/"+tC.reqID, bytes.NewBuffer(b))
 			req.Header.Set("Content-Type", "application/json")
 
-			res := executeRequest(req)
+			res := executeRequestWithSession(t, passwordUserID, req)
 
 			checkResponseCode(t, tC.code, res.Code)
 
@@ -299,3 +644,93 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginLocked(t *testing.T) {
+	// own email address, so the other login tests are not locked
+	payload, _ := json.Marshal(&usecases.UserInput{
+		EmailAddress: "lockedlogin@email.com",
+		Password:     "wrong password",
+	})
+
+	var response *httptest.ResponseRecorder
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+		response = executeRequestWithoutJWT(req)
+	}
+
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+
+	retryAfter, err := strconv.Atoi(response.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 {
+		t.Errorf("want Retry-After header with seconds, got %q", response.Header().Get("Retry-After"))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trustingApp := &App{trustedProxies: []*net.IPNet{proxies}}
+
+	testCases := []struct {
+		desc         string
+		app          *App
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{
+			desc:         "no proxies trusted",
+			app:          &App{},
+			remoteAddr:   "10.0.0.1:4000",
+			forwardedFor: "1.2.3.4",
+			want:         "10.0.0.1",
+		},
+		{
+			desc:         "untrusted sender",
+			app:          trustingApp,
+			remoteAddr:   "5.6.7.8:4000",
+			forwardedFor: "1.2.3.4",
+			want:         "5.6.7.8",
+		},
+		{
+			desc:         "trusted proxy",
+			app:          trustingApp,
+			remoteAddr:   "10.0.0.1:4000",
+			forwardedFor: "1.2.3.4",
+			want:         "1.2.3.4",
+		},
+		{
+			desc:         "spoofed address before the client",
+			app:          trustingApp,
+			remoteAddr:   "10.0.0.1:4000",
+			forwardedFor: "9.9.9.9, 1.2.3.4, 10.0.0.2",
+			want:         "1.2.3.4",
+		},
+		{
+			desc:       "trusted proxy without header",
+			app:        trustingApp,
+			remoteAddr: "10.0.0.1:4000",
+			want:       "10.0.0.1",
+		},
+		{
+			desc:         "malformed header",
+			app:          trustingApp,
+			remoteAddr:   "10.0.0.1:4000",
+			forwardedFor: "not an ip",
+			want:         "10.0.0.1",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tC.remoteAddr
+			if tC.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tC.forwardedFor)
+			}
+
+			if got := tC.app.clientIP(req); got != tC.want {
+				t.Errorf("want %q, got %q", tC.want, got)
+			}
+		})
+	}
+}
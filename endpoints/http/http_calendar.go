@@ -0,0 +1,184 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+const (
+	// icsTimeLayout is the UTC date-time of the iCalendar format
+	icsTimeLayout = "20060102T150405Z"
+	// icsLineLength is the maximum number of octets in the iCalendar line, the longer lines are folded
+	icsLineLength = 75
+	// calendarFeedRefreshInterval tells the calendar apps how often to download the feed
+	calendarFeedRefreshInterval = "PT1H"
+)
+
+// icsTextEscaper escapes the iCalendar TEXT values
+var icsTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// CreateCalendarFeed generates new secret address of the user's training calendar,
+// the previous address stops working and the new secret is returned only in this response
+func (app *App) CreateCalendarFeed(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	feed, err := app.calendarUsecases.CreateCalendarFeed(ctx, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithCalendarFeedError(w, err)
+		return
+	}
+
+	feed.URL = calendarFeedURL(req, feed.Token)
+	responseWithJSON(w, http.StatusCreated, feed)
+}
+
+// RevokeCalendarFeed turns the user's calendar feed off, the calendar apps stop getting the trainings
+func (app *App) RevokeCalendarFeed(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	err := app.calendarUsecases.RevokeCalendarFeed(ctx, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithCalendarFeedError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCalendar renders the completed trainings of the feed owner as iCalendar,
+// it is authenticated by the feed secret in the "token" parameter as the calendar apps cannot send the cookies
+func (app *App) GetCalendar(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	user, events, err := app.calendarUsecases.GetCalendarEvents(ctx, req.URL.Query().Get("token"))
+	if err != nil {
+		// the request uri carries the feed secret, so it is not logged
+		app.l.Debug().Msgf("[%s %s]: error: %v", req.Method, req.URL.Path, err)
+		var tokenErr *usecases.InvalidCalendarFeedTokenError
+		if errors.As(err, &tokenErr) {
+			responseWithError(w, http.StatusUnauthorized, tokenErr)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="trainings.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=0")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(renderCalendar(user, events, time.Now()))
+	if err != nil {
+		app.l.Debug().Msgf("[%s %s]: error: %v", req.Method, req.URL.Path, err)
+	}
+}
+
+func responseWithCalendarFeedError(w http.ResponseWriter, err error) {
+	var idErr *usecases.InvalidIDError
+	if errors.As(err, &idErr) {
+		responseWithError(w, http.StatusBadRequest, idErr)
+		return
+	}
+	var rneErr *usecases.RecordNotExistsError
+	if errors.As(err, &rneErr) {
+		// removed in the meantime
+		responseWithUnauthorized(w)
+		return
+	}
+	responseWithInternalError(w)
+}
+
+// calendarFeedURL returns the absolute address of the feed at the host the request was sent to
+func calendarFeedURL(req *http.Request, token string) string {
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     req.Host,
+		Path:     "/calendar.ics",
+		RawQuery: url.Values{"token": {token}}.Encode(),
+	}
+	return u.String()
+}
+
+// renderCalendar writes the events as iCalendar (RFC 5545) published at now
+func renderCalendar(user *entities.User, events []entities.CalendarEvent, now time.Time) []byte {
+	var b bytes.Buffer
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:-//gymm-api//Trainings//EN")
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+	writeICSLine(&b, "METHOD:PUBLISH")
+	writeICSLine(&b, "X-WR-CALNAME:"+icsTextEscaper.Replace("Trainings of "+user.Username))
+	writeICSLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:"+calendarFeedRefreshInterval)
+	writeICSLine(&b, "X-PUBLISHED-TTL:"+calendarFeedRefreshInterval)
+
+	for _, e := range events {
+		stamp := e.UpdatedAt
+		if stamp.IsZero() {
+			stamp = now
+		}
+
+		writeICSLine(&b, "BEGIN:VEVENT")
+		writeICSLine(&b, "UID:"+e.TrainingID+"@gymm-api")
+		writeICSLine(&b, "DTSTAMP:"+stamp.UTC().Format(icsTimeLayout))
+		writeICSLine(&b, "DTSTART:"+e.StartTime.UTC().Format(icsTimeLayout))
+		writeICSLine(&b, "DTEND:"+e.EndTime.UTC().Format(icsTimeLayout))
+		writeICSLine(&b, "SUMMARY:"+icsTextEscaper.Replace(e.Summary))
+		if e.Description != "" {
+			writeICSLine(&b, "DESCRIPTION:"+icsTextEscaper.Replace(e.Description))
+		}
+		writeICSLine(&b, "END:VEVENT")
+	}
+
+	writeICSLine(&b, "END:VCALENDAR")
+	return b.Bytes()
+}
+
+// writeICSLine writes the content line ended with CRLF, the line longer than icsLineLength octets
+// is folded into the lines starting with a space, the utf-8 characters are not split
+func writeICSLine(b *bytes.Buffer, line string) {
+	limit := icsLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space of the continuation counts to the length
+		limit = icsLineLength - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
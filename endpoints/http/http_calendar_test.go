@@ -0,0 +1,114 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestCreateCalendarFeed(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/me/calendar-feed", nil)
+	req.Host = "api.example.com"
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusCreated, res.StatusCode)
+
+	var feed entities.CalendarFeed
+	err := json.NewDecoder(res.Body).Decode(&feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(feed.Token, usecases.CalendarFeedTokenPrefix) {
+		t.Errorf("want feed secret, got %q", feed.Token)
+	}
+	want := "http://api.example.com/calendar.ics?token=" + url.QueryEscape(feed.Token)
+	if feed.URL != want {
+		t.Errorf("want url %q, got %q", want, feed.URL)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/me/calendar-feed", nil)
+	response := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestRevokeCalendarFeed(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodDelete, "/me/calendar-feed", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusNoContent, res.StatusCode)
+}
+
+func TestGetCalendar(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/calendar.ics?token="+url.QueryEscape(mocks.CalendarFeedToken), nil)
+	response := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if ct := response.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("want text/calendar, got %q", ct)
+	}
+	body := response.Body.String()
+	if !strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(body, "END:VCALENDAR\r\n") {
+		t.Errorf("want iCalendar, got %q", body)
+	}
+
+	for _, token := range []string{"", "gymmcal_wrong"} {
+		req, _ = http.NewRequest(http.MethodGet, "/calendar.ics?token="+token, nil)
+		response = executeRequestWithoutJWT(req)
+		checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	}
+}
+
+func TestRenderCalendar(t *testing.T) {
+	start := time.Date(2021, 3, 14, 9, 5, 0, 0, time.UTC)
+	events := []entities.CalendarEvent{
+		{
+			TrainingID:  "607443ceb40d9ea8602803e7",
+			Summary:     "Training",
+			Description: "legs; heavy, short\nSquat: 5 × 100 kg, 5 × 105 kg, 5 × 110 kg, 5 × 115 kg, 5 × 120 kg",
+			StartTime:   start,
+			EndTime:     start.Add(time.Hour),
+			UpdatedAt:   start.Add(2 * time.Hour),
+		},
+	}
+
+	ics := string(renderCalendar(&mocks.ExampleUser, events, start))
+
+	for _, want := range []string{
+		"UID:607443ceb40d9ea8602803e7@gymm-api\r\n",
+		"DTSTAMP:20210314T110500Z\r\n",
+		"DTSTART:20210314T090500Z\r\n",
+		"DTEND:20210314T100500Z\r\n",
+		"SUMMARY:Training\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("want %q in %q", want, ics)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n")
+	var description bytes.Buffer
+	for i, line := range lines {
+		if len(line) > icsLineLength {
+			t.Errorf("line %d longer than %d octets: %q", i, icsLineLength, line)
+		}
+		if strings.HasPrefix(line, "DESCRIPTION:") {
+			description.WriteString(line)
+			for _, next := range lines[i+1:] {
+				if !strings.HasPrefix(next, " ") {
+					break
+				}
+				description.WriteString(next[1:])
+			}
+		}
+	}
+	want := `DESCRIPTION:legs\; heavy\, short\nSquat: 5 × 100 kg\, 5 × 105 kg\, 5 × 110 kg\, ` +
+		`5 × 115 kg\, 5 × 120 kg`
+	if description.String() != want {
+		t.Errorf("want unfolded %q, got %q", want, description.String())
+	}
+}
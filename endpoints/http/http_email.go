@@ -0,0 +1,67 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+// VerifyEmail marks the user's email address as verified or replaces it with the pending one,
+// the token comes from the link sent in the verification email
+func (app *App) VerifyEmail(w http.ResponseWriter, req *http.Request) {
+	token, ok := mux.Vars(req)["token"]
+	if !ok {
+		err := errors.New("missing token")
+		logDebugError(app.l, req, err)
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := req.Context()
+	user, err := app.authUsecases.VerifyEmail(ctx, token)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var ievtErr *usecases.InvalidEmailVerificationTokenError
+		if errors.As(err, &ievtErr) {
+			responseWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		var eiuErr *usecases.EmailAddressInUseError
+		if errors.As(err, &eiuErr) {
+			responseWithErrorTxt(w, http.StatusConflict, "email address already in use")
+			return
+		}
+
+		responseWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, user)
+}
+
+// ResendEmailVerification sends a new verification email to the logged in user
+func (app *App) ResendEmailVerification(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	err := app.authUsecases.SendEmailVerification(ctx, app.mailer, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var eavErr *usecases.EmailAlreadyVerifiedError
+		if errors.As(err, &eavErr) {
+			responseWithError(w, http.StatusConflict, err)
+			return
+		}
+
+		responseWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
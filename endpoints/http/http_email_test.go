@@ -0,0 +1,25 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/mocks"
+)
+
+func TestResendEmailVerification(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/email/verification", nil)
+	res := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusUnauthorized, res.Code)
+
+	// the email address of the example user is verified already
+	req, _ = http.NewRequest(http.MethodPost, "/email/verification", nil)
+	res = executeRequestWithSession(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusConflict, res.Code)
+}
+
+func TestVerifyEmailInvalidToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/email/verify/not-issued-token", nil)
+	res := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusBadRequest, res.Code)
+}
@@ -177,7 +177,9 @@ func (app *App) UpdateExercise(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if curExercise == nil || (curExercise.CreatedBy != userID) {
+	// the moderators edit the shared exercises of the other users
+	if curExercise == nil ||
+		(curExercise.CreatedBy != userID && !hasPermission(ctx, entities.PermissionModerateExercises)) {
 		err = formatUnauthorizedError("exercise")
 		logDebugError(app.l, req, err)
 
@@ -192,6 +194,7 @@ func (app *App) UpdateExercise(w http.ResponseWriter, req *http.Request) {
 			Name:        input.Name,
 			Description: input.Description,
 			SetUnit:     input.SetUnit,
+			Aliases:     input.Aliases,
 		})
 	if err != nil {
 		logDebugError(app.l, req, err)
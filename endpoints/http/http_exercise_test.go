@@ -172,6 +172,35 @@ func TestUpdateExercise(t *testing.T) {
 	checkResponseCode(t, http.StatusOK, res.Code)
 }
 
+func TestUpdateExerciseAliases(t *testing.T) {
+	payload := []byte(`{"aliases":["Deadlift (Barbell)","  Conventional   Deadlift "]}`)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/exercises/"+mocks.ExampleExercise.ID, bytes.NewBuffer(payload))
+
+	res := executeRequestAs(t, mocks.UserID, req)
+
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	var ex entities.Exercise
+	err := json.NewDecoder(res.Body).Decode(&ex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ex.Aliases) != 2 || ex.Aliases[1] != "Conventional Deadlift" {
+		t.Errorf("want trimmed aliases, got %q", ex.Aliases)
+	}
+}
+
+func TestUpdateExerciseInvalidAliases(t *testing.T) {
+	payload := []byte(`{"aliases":["D"]}`)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/exercises/"+mocks.ExampleExercise.ID, bytes.NewBuffer(payload))
+
+	res := executeRequestAs(t, mocks.UserID, req)
+
+	checkResponseCode(t, http.StatusNotAcceptable, res.StatusCode)
+}
+
 func TestUpdateExerciseUnauthorized(t *testing.T) {
 	payload := []byte(`{"name":"DL"}`)
 
@@ -193,6 +222,17 @@ func TestUpdateExerciseDifferentUserUnauthorized(t *testing.T) {
 	checkResponseCode(t, http.StatusUnauthorized, res.Code)
 }
 
+func TestUpdateExerciseDifferentUserByCoach(t *testing.T) {
+	payload := []byte(`{"name":"DL"}`)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/exercises/"+mocks.ExampleExercise.ID, bytes.NewBuffer(payload))
+
+	mocks.ExampleExercise.CreatedBy += "1"
+	res := executeRequestAs(t, mocks.CoachUserID, req)
+	mocks.ExampleExercise.CreatedBy = mocks.UserID[:len(mocks.UserID)-1]
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+}
+
 func TestUpdateExerciseMalformedData(t *testing.T) {
 	payload := []byte(`{"name:"DL"}`)
 
@@ -38,7 +38,7 @@ func validateExerciseInput(validate *validator.Validate, exercise *usecases.Exer
 func validateExerciseInput4Update(validate *validator.Validate, exercise *usecases.ExerciseInput) error {
 	formattedErrors := make(map[string]string)
 	v := reflect.ValueOf(exercise).Elem()
-	for _, fieldName := range []string{"Name", "Description", "SetUnit"} {
+	for _, fieldName := range []string{"Name", "Description", "SetUnit", "Aliases"} {
 		validateExerciseField(validate, &v, exercise, fieldName, formattedErrors)
 	}
 
@@ -74,6 +74,8 @@ func validateExerciseField(
 		val = strFldVal.String()
 	case reflect.Int8:
 		val = strFldVal.Int()
+	case reflect.Slice:
+		val = strFldVal.Interface()
 	default:
 		_, ok := formattedErrors["more"]
 		if ok {
@@ -129,6 +131,8 @@ func getErrorTranslation(err *validator.FieldError, fieldName string) string {
 		}
 
 		return fmt.Sprintf("The '%s' has to be at max %s %s long. ", fieldName, (*err).Param(), objLengthUnit)
+	case "api_key_scope":
+		return fmt.Sprintf("The '%s' is incorrect, allowed are: 'trainings:read', 'trainings:write', 'exercises'. ", fieldName)
 	case "ex_name_chars":
 		return fmt.Sprintf("The '%s' is incorrect, allowed are: letters and numbers. ", fieldName)
 	case "printascii":
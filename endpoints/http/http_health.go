@@ -12,10 +12,10 @@ func (app *App) Health(w http.ResponseWriter, req *http.Request) {
 
 	defer logDebug(app.l, req, output)
 
-	cookie, err := req.Cookie(cookieJwtTokenName)
+	tokenStr, _, err := getAuthToken(req)
 	if err != nil {
 		if err == http.ErrNoCookie {
-			output["token"] = "no cookie"
+			output["token"] = "no token"
 		} else {
 			output["token"] = "could not retrieve"
 		}
@@ -26,9 +26,7 @@ func (app *App) Health(w http.ResponseWriter, req *http.Request) {
 
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(cookie.Value, claims, func(t *jwt.Token) (interface{}, error) {
-		return app.jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, claims, app.jwtKeys.Keyfunc)
 	if err != nil {
 		output["token"] = "corrupted"
 		output["error"] = err.Error()
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
 
 	"github.com/rs/zerolog"
 	"github.com/unnamedxaer/gymm-api/helpers"
@@ -16,6 +17,20 @@ func responseWithError(w http.ResponseWriter, code int, err error) {
 	responseWithJSON(w, code, map[string]string{"error": err.Error()})
 }
 
+// pageLimit returns the value of the "limit" query parameter or defaultLimit if it is not set
+func pageLimit(req *http.Request, defaultLimit, maxLimit int64) (int64, error) {
+	l := req.URL.Query().Get("limit")
+	if l == "" {
+		return defaultLimit, nil
+	}
+
+	n, err := strconv.ParseInt(l, 10, 64)
+	if err != nil || n < 1 || n > maxLimit {
+		return 0, fmt.Errorf("the 'limit' parameter has to be a number between 1 and %d", maxLimit)
+	}
+	return n, nil
+}
+
 // sends error response with code 500 - Internal Server Error
 func responseWithInternalError(w http.ResponseWriter) {
 	responseWithJSON(w, http.StatusInternalServerError,
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"github.com/unnamedxaer/gymm-api/validation"
+)
+
+// maxImportFileSize is the largest training log that can be uploaded
+const maxImportFileSize = 8 << 20
+
+// CreateImport reads the csv training log sent as the request body and returns the import with the report
+// of what would be imported, the timezone and units default to the user's preferences.
+// Nothing is imported until the import is committed
+func (app *App) CreateImport(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	user, ok := ctx.Value(contextKeyUser).(*entities.User)
+	if !ok {
+		clearCookieJWTAuthToken(w)
+		responseWithUnauthorized(w)
+		return
+	}
+
+	q := req.URL.Query()
+	input := usecases.ImportInput{
+		Source:   entities.ImportSource(q.Get("source")),
+		Timezone: q.Get("timezone"),
+		Units:    entities.UnitSystem(q.Get("units")),
+	}
+	if input.Timezone == "" {
+		input.Timezone = user.Preferences.Timezone
+	}
+	if input.Units == "" {
+		input.Units = user.Preferences.Units
+	}
+
+	err := validateImportInput(app.Validate, &input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		if svErr, ok := err.(*validation.StructValidError); ok {
+			responseWithJSON(w, http.StatusNotAcceptable, svErr.Format())
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxImportFileSize))
+	if err != nil {
+		logDebugError(app.l, req, err)
+		if err.Error() == "http: request body too large" {
+			responseWithErrorTxt(w, http.StatusRequestEntityTooLarge, "the file must not be larger than 8 MB")
+			return
+		}
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer req.Body.Close()
+
+	job, err := app.trainingImportUsecases.CreateImport(ctx, user.ID, &input, data)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var fileErr *usecases.InvalidImportFileError
+		if errors.As(err, &fileErr) {
+			responseWithError(w, http.StatusBadRequest, fileErr)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusCreated, job)
+}
+
+// GetImport returns the user's import with its report and progress
+func (app *App) GetImport(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		clearCookieJWTAuthToken(w)
+		responseWithUnauthorized(w)
+		return
+	}
+
+	job, err := app.trainingImportUsecases.GetImport(ctx, userID, mux.Vars(req)["importID"])
+	if err != nil {
+		app.responseWithImportError(w, req, err)
+		return
+	}
+	if job == nil {
+		responseWithError(w, http.StatusNotFound, usecases.NewErrorRecordNotExists("import"))
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, job)
+}
+
+// CommitImport queues the reviewed import, it runs in the background
+// and its progress is returned by GetImport
+func (app *App) CommitImport(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		clearCookieJWTAuthToken(w)
+		responseWithUnauthorized(w)
+		return
+	}
+
+	job, err := app.trainingImportUsecases.CommitImport(ctx, userID, mux.Vars(req)["importID"])
+	if err != nil {
+		app.responseWithImportError(w, req, err)
+		return
+	}
+
+	responseWithJSON(w, http.StatusAccepted, job)
+}
+
+func (app *App) responseWithImportError(w http.ResponseWriter, req *http.Request, err error) {
+	logDebugError(app.l, req, err)
+	var idErr *usecases.InvalidIDError
+	if errors.As(err, &idErr) {
+		responseWithError(w, http.StatusBadRequest, idErr)
+		return
+	}
+	var rneErr *usecases.RecordNotExistsError
+	if errors.As(err, &rneErr) {
+		responseWithError(w, http.StatusNotFound, rneErr)
+		return
+	}
+	responseWithInternalError(w)
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const hevyImportFile = `"title","start_time","end_time","exercise_title","weight_kg","reps","duration_seconds"
+"Pull","14 Mar 2021, 10:05","14 Mar 2021, 11:10","Deadlift","100","5",""
+"Pull","14 Mar 2021, 10:05","14 Mar 2021, 11:10","Lat Pulldown (Cable)","50","10",""
+`
+
+func createTestImport(t *testing.T) *entities.ImportJob {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "/imports?source=hevy", strings.NewReader(hevyImportFile))
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusCreated, res.StatusCode)
+
+	var job entities.ImportJob
+	err := json.NewDecoder(res.Body).Decode(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job
+}
+
+func TestCreateImport(t *testing.T) {
+	job := createTestImport(t)
+	if job.Status != entities.ImportStatusReview {
+		t.Errorf("want import under review, got %q", job.Status)
+	}
+	// the defaults are the user's preferences
+	if job.Timezone != entities.DefaultUserPreferences.Timezone || job.Units != entities.DefaultUserPreferences.Units {
+		t.Errorf("want timezone and units of the user, got %q, %q", job.Timezone, job.Units)
+	}
+	if job.Report.Sets != 2 || len(job.Report.UnmatchedExercises) != 1 {
+		t.Errorf("want 2 sets with 1 unmatched exercise, got %+v", job.Report)
+	}
+}
+
+func TestCreateImportInvalid(t *testing.T) {
+	testCases := []struct {
+		desc string
+		path string
+		body []byte
+		want int
+	}{
+		{"unknown source", "/imports?source=excel", []byte(hevyImportFile), http.StatusNotAcceptable},
+		{"unknown timezone", "/imports?source=hevy&timezone=Mars/Olympus", []byte(hevyImportFile), http.StatusNotAcceptable},
+		{"file of the other app", "/imports?source=strong", []byte(hevyImportFile), http.StatusBadRequest},
+		{"too large file", "/imports?source=hevy", bytes.Repeat([]byte("a"), maxImportFileSize+1), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, tc.path, bytes.NewReader(tc.body))
+			res := executeRequestAs(t, mocks.UserID, req)
+			checkResponseCode(t, tc.want, res.StatusCode)
+		})
+	}
+}
+
+func TestGetImport(t *testing.T) {
+	job := createTestImport(t)
+
+	req, _ := http.NewRequest(http.MethodGet, "/imports/"+job.ID, nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodGet, "/imports/"+primitive.NewObjectID().Hex(), nil)
+	res = executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusNotFound, res.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodGet, "/imports/INVALIDID", nil)
+	res = executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestCommitImport(t *testing.T) {
+	job := createTestImport(t)
+
+	req, _ := http.NewRequest(http.MethodPost, "/imports/"+job.ID+"/commit", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusAccepted, res.StatusCode)
+
+	var committed entities.ImportJob
+	err := json.NewDecoder(res.Body).Decode(&committed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed.Status != entities.ImportStatusQueued {
+		t.Errorf("want queued import, got %q", committed.Status)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/imports/"+primitive.NewObjectID().Hex()+"/commit", nil)
+	res = executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusNotFound, res.StatusCode)
+}
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"github.com/unnamedxaer/gymm-api/validation"
+)
+
+func validateImportInput(validate *validator.Validate, input *usecases.ImportInput) error {
+	errs := validate.Struct(input)
+	if errs == nil {
+		return nil
+	}
+
+	validErrs, ok := errs.(validator.ValidationErrors)
+	if !ok {
+		return errs
+	}
+
+	formatedErrors := make(map[string]string, len(validErrs))
+	var errText, txt string
+	for _, err := range validErrs {
+		fieldName, found := validation.GetFieldJSONTag(input, err.StructField())
+		if !found {
+			fieldName = err.StructField()
+		}
+
+		txt = getErrorTranslation4User(&err, fieldName)
+		errText += txt
+		formatedErrors[fieldName] = txt
+	}
+
+	return validation.NewStructValidError(formatedErrors, errText)
+}
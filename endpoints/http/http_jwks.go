@@ -0,0 +1,12 @@
+package http
+
+import (
+	"net/http"
+)
+
+// JWKS returns public keys that verify our tokens, so other services
+// can check them without knowing the signing secrets
+func (app *App) JWKS(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	responseWithJSON(w, http.StatusOK, app.jwtKeys.JWKS())
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
+)
+
+func TestJWKS(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	res := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+
+	got := jwtkeys.JWKSet{}
+	err := json.NewDecoder(res.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the test server uses only the shared secret which must not be exposed
+	if got.Keys == nil || len(got.Keys) != 0 {
+		t.Errorf("want empty key set, got %+v", got)
+	}
+}
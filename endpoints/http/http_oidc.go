@@ -0,0 +1,213 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
+	"github.com/unnamedxaer/gymm-api/oidc"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+const (
+	// oidcStateAudience distinguishes the state tokens from the auth tokens
+	oidcStateAudience = "oidc"
+	// oidcStateTTL is the time the user has to sign in at the provider
+	oidcStateTTL = 10 * time.Minute
+	// cookieOIDCStateName is the name of the cookie that keeps the state of the sign in at the provider
+	cookieOIDCStateName = "oidc_state"
+	cookieOIDCStatePath = "/oidc"
+)
+
+// error codes passed to the client's login page
+const (
+	oidcErrFailed           = "oidc_failed"
+	oidcErrEmailNotVerified = "oidc_email_not_verified"
+	oidcErrEmailInUse       = "oidc_email_in_use"
+	oidcErrAccountDisabled  = "oidc_account_disabled"
+)
+
+// OIDCStateClaims are claims of the token that binds the callback from the provider
+// to the browser which started the sign in, the verifier never leaves our cookie
+type OIDCStateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.StandardClaims
+}
+
+func createOIDCState(provider string, jwtKeys *jwtkeys.KeySet) (*OIDCStateClaims, string, error) {
+	claims := OIDCStateClaims{Provider: provider}
+	for _, v := range []*string{&claims.State, &claims.Nonce, &claims.Verifier} {
+		token, err := oidc.RandomToken()
+		if err != nil {
+			return nil, "", err
+		}
+		*v = token
+	}
+
+	now := time.Now().UTC()
+	claims.StandardClaims = jwt.StandardClaims{
+		Audience:  oidcStateAudience,
+		ExpiresAt: now.Add(oidcStateTTL).Unix(),
+		IssuedAt:  now.Unix(),
+	}
+
+	token, err := jwtKeys.Sign(&claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return &claims, token, nil
+}
+
+func parseOIDCState(token string, jwtKeys *jwtkeys.KeySet) (*OIDCStateClaims, error) {
+	claims := &OIDCStateClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, jwtKeys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.State == "" || claims.Verifier == "" || !claims.VerifyAudience(oidcStateAudience, true) {
+		return nil, errors.New("invalid oidc state")
+	}
+	return claims, nil
+}
+
+// OIDCLogin redirects the user to sign in at the OpenID Connect provider
+func (app *App) OIDCLogin(w http.ResponseWriter, req *http.Request) {
+	provider, ok := app.oidcProviders[mux.Vars(req)["provider"]]
+	if !ok {
+		responseWithErrorTxt(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	claims, token, err := createOIDCState(provider.Name(), app.jwtKeys)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithInternalError(w)
+		return
+	}
+
+	// lax, so the cookie comes back with the redirect from the provider
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieOIDCStateName,
+		Value:    token,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		// Secure:   true,
+		Path: cookieOIDCStatePath,
+	})
+
+	http.Redirect(w, req, provider.AuthCodeURL(claims.State, claims.Nonce, claims.Verifier), http.StatusFound)
+}
+
+// OIDCCallback completes the sign in at the OpenID Connect provider,
+// it logs the user in and redirects to the client
+func (app *App) OIDCCallback(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	// the state is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:   cookieOIDCStateName,
+		MaxAge: -1, // remove cookie
+		Path:   cookieOIDCStatePath,
+	})
+
+	provider, ok := app.oidcProviders[mux.Vars(req)["provider"]]
+	if !ok {
+		responseWithErrorTxt(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	q := req.URL.Query()
+	if q.Get("error") != "" {
+		// eg. the user has denied the access
+		logDebug(app.l, req, "provider error: "+q.Get("error"))
+		app.redirectOIDCError(w, req, oidcErrFailed)
+		return
+	}
+
+	cookie, err := req.Cookie(cookieOIDCStateName)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		app.redirectOIDCError(w, req, oidcErrFailed)
+		return
+	}
+
+	claims, err := parseOIDCState(cookie.Value, app.jwtKeys)
+	if err != nil || claims.Provider != provider.Name() || claims.State != q.Get("state") {
+		logDebugError(app.l, req, errors.New("oidc state mismatch"))
+		app.redirectOIDCError(w, req, oidcErrFailed)
+		return
+	}
+
+	idClaims, err := provider.Exchange(ctx, q.Get("code"), claims.Verifier, claims.Nonce)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		app.redirectOIDCError(w, req, oidcErrFailed)
+		return
+	}
+
+	user, err := app.authUsecases.LoginWithExternalIdentity(ctx, &entities.ExternalIdentity{
+		Issuer:        provider.Issuer(),
+		Subject:       idClaims.Subject,
+		EmailAddress:  idClaims.Email,
+		EmailVerified: idClaims.EmailVerified,
+		Name:          idClaims.Name,
+	})
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var enErr *usecases.ExternalEmailNotVerifiedError
+		var eiuErr *usecases.EmailAddressInUseError
+		var adErr *usecases.AccountDisabledError
+		switch {
+		case errors.As(err, &enErr):
+			app.redirectOIDCError(w, req, oidcErrEmailNotVerified)
+		case errors.As(err, &eiuErr):
+			app.redirectOIDCError(w, req, oidcErrEmailInUse)
+		case errors.As(err, &adErr):
+			app.redirectOIDCError(w, req, oidcErrAccountDisabled)
+		default:
+			app.redirectOIDCError(w, req, oidcErrFailed)
+		}
+		return
+	}
+
+	clientURL := os.Getenv("CLIENT_URL")
+	if user.TwoFactorEnabled {
+		// the provider replaces only the password, the second step is still required
+		challenge, err := createTwoFactorChallenge(user.ID, app.jwtKeys)
+		if err != nil {
+			logDebugError(app.l, req, err)
+			app.redirectOIDCError(w, req, oidcErrFailed)
+			return
+		}
+		fragment := url.Values{"challengeToken": {challenge}}
+		http.Redirect(w, req, clientURL+"/login/two-factor#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	_, _, err = app.login(ctx, w, user.ID, requestDeviceID(req), false)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
+		app.redirectOIDCError(w, req, oidcErrFailed)
+		return
+	}
+
+	http.Redirect(w, req, clientURL+"/", http.StatusFound)
+}
+
+// redirectOIDCError sends the user back to the client's login page with the error code
+func (app *App) redirectOIDCError(w http.ResponseWriter, req *http.Request, code string) {
+	q := url.Values{"error": {code}}
+	http.Redirect(w, req, os.Getenv("CLIENT_URL")+"/login?"+q.Encode(), http.StatusFound)
+}
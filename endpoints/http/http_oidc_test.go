@@ -0,0 +1,164 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/oidc/oidctest"
+)
+
+// startOIDCLogin starts the sign in and returns the state cookie
+// and the url the provider redirects back with
+func startOIDCLogin(t *testing.T, identity oidctest.Identity) (*http.Cookie, *url.URL) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "/oidc/fake/login", nil)
+	response := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusFound, response.Code)
+
+	stateCookie := getCookie(response, cookieOIDCStateName)
+	if stateCookie == nil || stateCookie.Value == "" {
+		t.Fatalf("want %q cookie", cookieOIDCStateName)
+	}
+
+	redirect, err := fakeOIDC.Authorize(response.Header().Get("Location"), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stateCookie, callback
+}
+
+func executeOIDCCallback(callback *url.URL, stateCookie *http.Cookie) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	if stateCookie != nil {
+		req.AddCookie(stateCookie)
+	}
+	return executeRequestWithoutJWT(req)
+}
+
+func getCookie(response *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range response.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	stateCookie, callback := startOIDCLogin(t, oidctest.Identity{
+		Subject:       "oidc-login",
+		Email:         mocks.ExampleUser.EmailAddress,
+		EmailVerified: true,
+	})
+
+	response := executeOIDCCallback(callback, stateCookie)
+	checkResponseCode(t, http.StatusFound, response.Code)
+
+	location, _ := url.Parse(response.Header().Get("Location"))
+	if location.Query().Get("error") != "" {
+		t.Fatalf("want redirect to the client, got %q", location)
+	}
+	if c := getCookie(response, cookieJwtTokenName); c == nil || c.Value == "" {
+		t.Errorf("want %q cookie", cookieJwtTokenName)
+	}
+	if c := getCookie(response, cookieRefreshTokenName); c == nil || c.Value == "" {
+		t.Errorf("want %q cookie", cookieRefreshTokenName)
+	}
+	if c := getCookie(response, cookieOIDCStateName); c == nil || c.MaxAge >= 0 {
+		t.Errorf("want %q cookie to be removed", cookieOIDCStateName)
+	}
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	identity := oidctest.Identity{
+		Subject:       "oidc-errors",
+		Email:         mocks.ExampleUser.EmailAddress,
+		EmailVerified: true,
+	}
+
+	testCases := []struct {
+		desc     string
+		prepare  func(stateCookie *http.Cookie, callback *url.URL) (*http.Cookie, *url.URL)
+		identity oidctest.Identity
+		errCode  string
+	}{
+		{
+			desc: "missing state cookie",
+			prepare: func(stateCookie *http.Cookie, callback *url.URL) (*http.Cookie, *url.URL) {
+				return nil, callback
+			},
+			identity: identity,
+			errCode:  oidcErrFailed,
+		},
+		{
+			desc: "state mismatch",
+			prepare: func(stateCookie *http.Cookie, callback *url.URL) (*http.Cookie, *url.URL) {
+				q := callback.Query()
+				q.Set("state", "other state")
+				callback.RawQuery = q.Encode()
+				return stateCookie, callback
+			},
+			identity: identity,
+			errCode:  oidcErrFailed,
+		},
+		{
+			desc: "provider error",
+			prepare: func(stateCookie *http.Cookie, callback *url.URL) (*http.Cookie, *url.URL) {
+				callback.RawQuery = url.Values{"error": {"access_denied"}}.Encode()
+				return stateCookie, callback
+			},
+			identity: identity,
+			errCode:  oidcErrFailed,
+		},
+		{
+			desc: "email not verified by provider",
+			identity: oidctest.Identity{
+				Subject: "oidc-not-verified",
+				Email:   mocks.ExampleUser.EmailAddress,
+			},
+			errCode: oidcErrEmailNotVerified,
+		},
+		{
+			desc: "existing user with not verified email",
+			identity: oidctest.Identity{
+				Subject:       "oidc-unverified",
+				Email:         "unverified@email.com",
+				EmailVerified: true,
+			},
+			errCode: oidcErrEmailInUse,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			stateCookie, callback := startOIDCLogin(t, tc.identity)
+			if tc.prepare != nil {
+				stateCookie, callback = tc.prepare(stateCookie, callback)
+			}
+
+			response := executeOIDCCallback(callback, stateCookie)
+			checkResponseCode(t, http.StatusFound, response.Code)
+
+			location, _ := url.Parse(response.Header().Get("Location"))
+			if got := location.Query().Get("error"); got != tc.errCode {
+				t.Errorf("want error %q, got %q", tc.errCode, got)
+			}
+			if c := getCookie(response, cookieJwtTokenName); c != nil && c.Value != "" {
+				t.Errorf("want no %q cookie", cookieJwtTokenName)
+			}
+		})
+	}
+}
+
+func TestOIDCUnknownProvider(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/oidc/unknown/login", nil)
+	response := executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+// Sync is a handler that applies trainings recorded offline by the client
+// and responds with the trainings changed since client's last sync
+func (app *App) Sync(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		clearCookieJWTAuthToken(w)
+		responseWithUnauthorized(w)
+		return
+	}
+
+	var input usecases.SyncInput
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+
+		ok, err := formatParseErrors(err)
+		if ok {
+			responseWithError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		responseWithErrorTxt(w, http.StatusBadRequest, getErrOfMalformedInput(&input, nil))
+		return
+	}
+	defer req.Body.Close()
+
+	result, err := app.trainingUsecases.Sync(ctx, userID, &input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var idErr *usecases.InvalidIDError
+		if errors.As(err, &idErr) {
+			responseWithError(w, http.StatusBadRequest, idErr)
+			return
+		}
+		var tokenErr *usecases.InvalidSyncTokenError
+		if errors.As(err, &tokenErr) {
+			responseWithError(w, http.StatusBadRequest, tokenErr)
+			return
+		}
+		var recordErr *usecases.InvalidSyncRecordError
+		if errors.As(err, &recordErr) {
+			responseWithError(w, http.StatusBadRequest, recordErr)
+			return
+		}
+		var rneErr *usecases.RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			responseWithError(w, http.StatusNotFound, rneErr)
+			return
+		}
+		var cmErr *usecases.ConcurrentModificationError
+		if errors.As(err, &cmErr) {
+			responseWithError(w, http.StatusConflict, cmErr)
+			return
+		}
+
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, result)
+}
@@ -24,21 +24,14 @@ func (app *App) StartTraining(w http.ResponseWriter, req *http.Request) {
 
 	tr, err := app.trainingUsecases.StartTraining(ctx, userID)
 	if err != nil {
-		logDebugError(app.l, req, err)
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, e)
-			return
-		}
-
-		responseWithInternalError(w)
+		app.responseWithTrainingError(w, req, err)
 		return
 	}
 
 	responseWithJSON(w, http.StatusCreated, &tr)
 }
 
-// EndTraining is a handler that trigger starting of a new training for logged in user.
+// EndTraining is a handler that ends the training of logged in user.
 func (app *App) EndTraining(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	userID, ok := ctx.Value(contextKeyUserID).(string)
@@ -50,41 +43,9 @@ func (app *App) EndTraining(w http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	trainingID := vars["trainingID"]
-	tr, err := app.trainingUsecases.GetTrainingByID(ctx, trainingID)
+	tr, err := app.trainingUsecases.EndTraining(ctx, userID, trainingID)
 	if err != nil {
-		logDebugError(app.l, req, err)
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, e)
-			return
-		}
-
-		responseWithInternalError(w)
-		return
-	}
-
-	if tr == nil || tr.UserID != userID {
-		err = formatUnauthorizedError("training")
-		logDebugError(app.l, req, err)
-		responseWithError(w, http.StatusUnauthorized, err)
-	}
-
-	if !tr.EndTime.IsZero() {
-		err := fmt.Errorf("training already completed")
-		logDebugError(app.l, req, err)
-		responseWithError(w, http.StatusConflict, err)
-	}
-
-	tr, err = app.trainingUsecases.EndTraining(ctx, trainingID)
-	if err != nil {
-		logDebugError(app.l, req, err)
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, e)
-			return
-		}
-
-		responseWithInternalError(w)
+		app.responseWithTrainingError(w, req, err)
 		return
 	}
 
@@ -103,25 +64,12 @@ func (app *App) GetTrainingByID(w http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	trainingID := vars["trainingID"]
-	tr, err := app.trainingUsecases.GetTrainingByID(ctx, trainingID)
+	tr, err := app.trainingUsecases.GetTrainingByID(ctx, userID, trainingID)
 	if err != nil {
-		logDebugError(app.l, req, err)
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, e)
-			return
-		}
-
-		responseWithInternalError(w)
+		app.responseWithTrainingError(w, req, err)
 		return
 	}
 
-	if tr != nil && tr.UserID != userID {
-		err = formatUnauthorizedError("training")
-		logDebugError(app.l, req, err)
-		responseWithError(w, http.StatusUnauthorized, err)
-	}
-
 	responseWithJSON(w, http.StatusOK, &tr)
 }
 
@@ -187,28 +135,6 @@ func (app *App) StartTrainingExercise(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	vars := mux.Vars(req)
-	trainingID := vars["trainingID"]
-	tr, err := app.trainingUsecases.GetTrainingByID(ctx, trainingID)
-	if err != nil {
-		logDebugError(app.l, req, err)
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, e)
-			return
-		}
-
-		responseWithInternalError(w)
-		return
-	}
-
-	if tr == nil || tr.UserID != userID {
-		err = formatUnauthorizedError("training")
-		logDebugError(app.l, req, err)
-		responseWithError(w, http.StatusUnauthorized, err)
-		return
-	}
-
 	exercise, err := app.exerciseUsecases.GetExerciseByID(ctx, exID)
 	if err != nil {
 		logDebugError(app.l, req, err)
@@ -234,16 +160,11 @@ func (app *App) StartTrainingExercise(w http.ResponseWriter, req *http.Request)
 		ExerciseID: exID,
 	}
 
-	te, err = app.trainingUsecases.StartExercise(ctx, tr.ID, te)
+	vars := mux.Vars(req)
+	trainingID := vars["trainingID"]
+	te, err = app.trainingUsecases.StartExercise(ctx, userID, trainingID, te)
 	if err != nil {
-		logDebugError(app.l, req, err)
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, e)
-			return
-		}
-
-		responseWithInternalError(w)
+		app.responseWithTrainingError(w, req, err)
 		return
 	}
 
@@ -265,20 +186,7 @@ func (app *App) EndTrainingExercise(w http.ResponseWriter, req *http.Request) {
 
 	te, err := app.trainingUsecases.EndExercise(ctx, userID, teID, time.Now())
 	if err != nil {
-		logDebugError(app.l, req, err)
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, e)
-			return
-		}
-
-		responseWithInternalError(w)
-		return
-	}
-	if te == nil {
-		err = formatUnauthorizedError("training exercise")
-		logDebugError(app.l, req, err)
-		responseWithError(w, http.StatusUnauthorized, err)
+		app.responseWithTrainingError(w, req, err)
 		return
 	}
 
@@ -309,16 +217,53 @@ func (app *App) AddTrainingSetExercise(w http.ResponseWriter, req *http.Request)
 
 	ts, err := app.trainingUsecases.AddSet(ctx, userID, teID, &set)
 	if err != nil {
-		logDebugError(app.l, req, err)
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, e)
-			return
-		}
-
-		responseWithInternalError(w)
+		app.responseWithTrainingError(w, req, err)
 		return
 	}
 
 	responseWithJSON(w, http.StatusCreated, ts)
 }
+
+// responseWithTrainingError sends response with status code matching
+// the error returned by the training usecases
+func (app *App) responseWithTrainingError(w http.ResponseWriter, req *http.Request, err error) {
+	logDebugError(app.l, req, err)
+
+	var idErr *usecases.InvalidIDError
+	if errors.As(err, &idErr) {
+		responseWithError(w, http.StatusBadRequest, idErr)
+		return
+	}
+
+	var rneErr *usecases.RecordNotExistsError
+	if errors.As(err, &rneErr) {
+		responseWithError(w, http.StatusNotFound, rneErr)
+		return
+	}
+
+	var ownerErr *usecases.NotOwnerError
+	if errors.As(err, &ownerErr) {
+		responseWithError(w, http.StatusUnauthorized, ownerErr)
+		return
+	}
+
+	var trCompletedErr *usecases.TrainingCompletedError
+	if errors.As(err, &trCompletedErr) {
+		responseWithError(w, http.StatusConflict, trCompletedErr)
+		return
+	}
+
+	var teCompletedErr *usecases.TrainingExerciseCompletedError
+	if errors.As(err, &teCompletedErr) {
+		responseWithError(w, http.StatusConflict, teCompletedErr)
+		return
+	}
+
+	var inProgressErr *usecases.TrainingInProgressError
+	if errors.As(err, &inProgressErr) {
+		responseWithError(w, http.StatusConflict, inProgressErr)
+		return
+	}
+
+	responseWithInternalError(w)
+}
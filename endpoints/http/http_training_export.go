@@ -0,0 +1,221 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+// trainingExportDateLayout is the layout of the export range given as the date only
+const trainingExportDateLayout = "2006-01-02"
+
+var trainingExportCSVHeader = []string{
+	"training_id",
+	"training_start_time",
+	"training_end_time",
+	"exercise_id",
+	"exercise_name",
+	"set_unit",
+	"set_number",
+	"reps",
+	"load",
+	"set_time",
+}
+
+// ExportTrainings streams the sets of the user trainings as csv or, with format=json, as json array,
+// the optional from and to limit the trainings start time and are either RFC 3339 times or dates,
+// the date of "to" is included
+func (app *App) ExportTrainings(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		clearCookieJWTAuthToken(w)
+		responseWithUnauthorized(w)
+		return
+	}
+
+	q := req.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		responseWithErrorTxt(w, http.StatusBadRequest, `format must be one of "csv", "json"`)
+		return
+	}
+
+	from, err := parseTrainingExportTime(q.Get("from"), false)
+	if err != nil {
+		responseWithErrorTxt(w, http.StatusBadRequest, "from: "+err.Error())
+		return
+	}
+	to, err := parseTrainingExportTime(q.Get("to"), true)
+	if err != nil {
+		responseWithErrorTxt(w, http.StatusBadRequest, "to: "+err.Error())
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		responseWithErrorTxt(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	var exp trainingExportWriter
+	if format == "json" {
+		exp = &jsonTrainingExportWriter{w: w}
+	} else {
+		exp = &csvTrainingExportWriter{w: csv.NewWriter(w)}
+	}
+
+	// the headers are sent with the first row, so the failed lookup can still get the error status
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", exp.contentType())
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=%q", "trainings."+format))
+		w.WriteHeader(http.StatusOK)
+		return exp.begin()
+	}
+
+	err = app.trainingExportUsecases.ExportTrainings(ctx, userID, from, to, func(row *entities.TrainingExportRow) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return exp.write(row)
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err != nil {
+		logDebugError(app.l, req, err)
+		if started {
+			// the status is already sent, the client gets the truncated export
+			return
+		}
+		var idErr *usecases.InvalidIDError
+		if errors.As(err, &idErr) {
+			responseWithError(w, http.StatusBadRequest, idErr)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	err = exp.end()
+	if err != nil {
+		logDebugError(app.l, req, err)
+	}
+}
+
+// parseTrainingExportTime parses the RFC 3339 time or the date, the date is
+// moved to the next day if it is the inclusive end of the range
+func parseTrainingExportTime(v string, end bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse(trainingExportDateLayout, v)
+	if err != nil {
+		return time.Time{}, errors.New("want RFC 3339 time or YYYY-MM-DD date")
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// trainingExportWriter writes the export rows in a single format
+type trainingExportWriter interface {
+	contentType() string
+	begin() error
+	write(row *entities.TrainingExportRow) error
+	end() error
+}
+
+type csvTrainingExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvTrainingExportWriter) contentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (e *csvTrainingExportWriter) begin() error {
+	return e.w.Write(trainingExportCSVHeader)
+}
+
+func (e *csvTrainingExportWriter) write(row *entities.TrainingExportRow) error {
+	return e.w.Write([]string{
+		row.TrainingID,
+		formatTrainingExportTime(row.TrainingStartTime),
+		formatTrainingExportTime(row.TrainingEndTime),
+		row.ExerciseID,
+		row.ExerciseName,
+		row.SetUnit.String(),
+		strconv.Itoa(row.SetNumber),
+		strconv.Itoa(row.Reps),
+		strconv.FormatFloat(row.Load, 'f', -1, 64),
+		formatTrainingExportTime(row.SetTime),
+	})
+}
+
+func (e *csvTrainingExportWriter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func formatTrainingExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+type jsonTrainingExportWriter struct {
+	w    http.ResponseWriter
+	rows int
+}
+
+func (e *jsonTrainingExportWriter) contentType() string {
+	return "application/json"
+}
+
+func (e *jsonTrainingExportWriter) begin() error {
+	_, err := e.w.Write([]byte("["))
+	return err
+}
+
+func (e *jsonTrainingExportWriter) write(row *entities.TrainingExportRow) error {
+	if e.rows > 0 {
+		if _, err := e.w.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	e.rows++
+
+	b, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonTrainingExportWriter) end() error {
+	_, err := e.w.Write([]byte("]\n"))
+	return err
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+)
+
+func TestExportTrainingsCSV(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/trainings/export?from=2000-01-01", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sets := mocks.ExampleTrainingExercise.Sets
+	if len(records) != len(sets)+1 {
+		t.Fatalf("want header and %d rows, got %v", len(sets), records)
+	}
+	if records[0][4] != "exercise_name" || records[0][8] != "load" {
+		t.Errorf("want csv header, got %v", records[0])
+	}
+	first := records[1]
+	if first[4] != mocks.ExampleExercise.Name || first[5] != "weight" ||
+		first[7] != strconv.Itoa(sets[0].Reps) || first[8] != "100" {
+		t.Errorf("want row of the first set, got %v", first)
+	}
+}
+
+func TestExportTrainingsJSON(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/trainings/export?format=json", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	var rows []entities.TrainingExportRow
+	err := json.NewDecoder(res.Body).Decode(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(mocks.ExampleTrainingExercise.Sets) {
+		t.Errorf("want row per set, got %v", rows)
+	}
+}
+
+func TestExportTrainingsEmptyRange(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/trainings/export?format=json&from=2100-01-01T00:00:00Z", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	var rows []entities.TrainingExportRow
+	err := json.NewDecoder(res.Body).Decode(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("want empty array, got %v", rows)
+	}
+}
+
+func TestExportTrainingsInvalidQuery(t *testing.T) {
+	for _, query := range []string{
+		"format=xlsx",
+		"from=yesterday",
+		"from=2021-05-02&to=2021-05-01",
+	} {
+		t.Run(query, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/trainings/export?"+query, nil)
+			res := executeRequestAs(t, mocks.UserID, req)
+			checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+		})
+	}
+}
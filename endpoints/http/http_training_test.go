@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/unnamedxaer/gymm-api/mocks"
 )
@@ -44,6 +45,10 @@ func TestTrainingHandlersUnauthorized(t *testing.T) {
 		{"end training",
 			"/trainings/" + mocks.ExampleTraining.ID + "/end",
 			http.MethodPatch},
+
+		{"sync",
+			"/sync",
+			http.MethodPost},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
@@ -125,14 +130,14 @@ func TestEndExercise(t *testing.T) {
 
 	req, _ := http.NewRequest(http.MethodPatch,
 		fmt.Sprintf("/trainings/%s/exercises/%s/end",
-			mocks.ExampleTraining.ID, mocks.ExampleTraining.Exercises[0].ID),
+			mocks.ExampleTraining.ID, mocks.ExampleTraining.Exercises[1].ID),
 		nil)
 
 	res := executeRequest(req)
 
 	checkResponseCode(t, http.StatusOK, res.Code)
 
-	if !strings.Contains(res.Body.String(), mocks.ExampleTraining.Exercises[0].ID) {
+	if !strings.Contains(res.Body.String(), mocks.ExampleTraining.Exercises[1].ID) {
 		t.Errorf("want receive ended exercise, got %s", res.Body.String())
 	}
 }
@@ -147,7 +152,7 @@ func TestAddSet(t *testing.T) {
 
 	req, _ := http.NewRequest(http.MethodPost,
 		fmt.Sprintf("/trainings/%s/exercises/%s/sets",
-			mocks.ExampleTraining.ID, mocks.ExampleTraining.Exercises[0].ID),
+			mocks.ExampleTraining.ID, mocks.ExampleTraining.Exercises[1].ID),
 		&payload)
 
 	res := executeRequest(req)
@@ -161,3 +166,102 @@ func TestAddSet(t *testing.T) {
 		t.Errorf("want receive added set, got %s", got)
 	}
 }
+
+func TestTrainingStateConflicts(t *testing.T) {
+	endedTrainingID := mocks.ExampleTraining.ID + "ended"
+	endedExerciseID := mocks.ExampleTraining.Exercises[0].ID
+
+	testCases := []struct {
+		desc   string
+		url    string
+		method string
+		body   string
+		want   int
+	}{
+		{"end ended training",
+			"/trainings/" + endedTrainingID + "/end",
+			http.MethodPatch, "",
+			http.StatusConflict},
+
+		{"end not existing training",
+			"/trainings/notfound/end",
+			http.MethodPatch, "",
+			http.StatusNotFound},
+
+		{"start exercise in ended training",
+			"/trainings/" + endedTrainingID + "/exercises",
+			http.MethodPost, fmt.Sprintf(`{"exerciseId":%q}`, mocks.ExampleExercise.ID),
+			http.StatusConflict},
+
+		{"add set to ended exercise",
+			"/trainings/" + mocks.ExampleTraining.ID + "/exercises/" + endedExerciseID + "/sets",
+			http.MethodPost, `{"reps":10}`,
+			http.StatusConflict},
+
+		{"end ended exercise",
+			"/trainings/" + mocks.ExampleTraining.ID + "/exercises/" + endedExerciseID + "/end",
+			http.MethodPatch, "",
+			http.StatusConflict},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req, _ := http.NewRequest(tC.method, tC.url, strings.NewReader(tC.body))
+			res := executeRequestWithSession(t, mocks.UserID, req)
+			checkResponseCode(t, tC.want, res.Code)
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		payload string
+		code    int
+	}{
+		{
+			desc:    "first sync",
+			payload: `{"token": "", "trainings": []}`,
+			code:    http.StatusOK,
+		},
+		{
+			desc: "new training",
+			payload: fmt.Sprintf(`{"trainings": [{"clientId": "f3b1c8a2-7c1e-4a57-b3f4-2a9d1e6c0b11", "startTime": %q}]}`,
+				mocks.Now.Format(time.RFC3339)),
+			code: http.StatusOK,
+		},
+		{
+			desc: "training modified concurrently",
+			payload: fmt.Sprintf(`{"trainings": [{"id": %q, "startTime": %q, "comment": "edited offline", "updatedAt": %q}]}`,
+				mocks.ExampleTraining.ID+"modified", mocks.ExampleTraining.StartTime.Format(time.RFC3339),
+				mocks.Now.Format(time.RFC3339)),
+			code: http.StatusConflict,
+		},
+		{
+			desc: "training in the future",
+			payload: fmt.Sprintf(`{"trainings": [{"clientId": "f3b1c8a2-7c1e-4a57-b3f4-2a9d1e6c0b11", "startTime": %q}]}`,
+				mocks.Now.Add(time.Hour).Format(time.RFC3339)),
+			code: http.StatusBadRequest,
+		},
+		{
+			desc:    "invalid token",
+			payload: `{"token": "-1"}`,
+			code:    http.StatusBadRequest,
+		},
+		{
+			desc:    "malformed payload",
+			payload: `{"trainings": {}}`,
+			code:    http.StatusBadRequest,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/sync", strings.NewReader(tC.payload))
+			res := executeRequestWithSession(t, mocks.UserID, req)
+			checkResponseCode(t, tC.code, res.Code)
+
+			if tC.code == http.StatusOK && !strings.Contains(res.Body.String(), `"token"`) {
+				t.Errorf("want sync token in response, got %s", res.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+const (
+	// twoFactorChallengeAudience distinguishes the challenge tokens from the auth tokens
+	twoFactorChallengeAudience = "two-factor"
+	// twoFactorChallengeTTL is the time the user has to give the second factor after the password
+	twoFactorChallengeTTL = 5 * time.Minute
+)
+
+// ChallengeClaims are claims of the token proving that the user has given correct password,
+// it is exchanged for the auth tokens together with the second factor
+type ChallengeClaims struct {
+	UserID string `json:"challengeFor"`
+	jwt.StandardClaims
+}
+
+type twoFactorCodeInput struct {
+	Code string `json:"code"`
+}
+
+type disableTwoFactorInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func createTwoFactorChallenge(userID string, jwtKeys *jwtkeys.KeySet) (string, error) {
+	// the ID limits the attempts made with the challenge
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	claims := ChallengeClaims{
+		UserID: userID,
+		StandardClaims: jwt.StandardClaims{
+			Id:        base64.RawURLEncoding.EncodeToString(id),
+			Audience:  twoFactorChallengeAudience,
+			ExpiresAt: now.Add(twoFactorChallengeTTL).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+	}
+	return jwtKeys.Sign(&claims)
+}
+
+// parseTwoFactorChallenge returns ID of the user that the challenge was issued for and ID of the challenge
+func parseTwoFactorChallenge(token string, jwtKeys *jwtkeys.KeySet) (userID string, challengeID string, err error) {
+	claims := &ChallengeClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, jwtKeys.Keyfunc)
+	if err != nil {
+		return "", "", err
+	}
+
+	if claims.UserID == "" || claims.Id == "" || !claims.VerifyAudience(twoFactorChallengeAudience, true) {
+		return "", "", errors.New("invalid challenge token")
+	}
+	return claims.UserID, claims.Id, nil
+}
+
+// LoginTwoFactor is the second step of the login of the user with two-factor authentication,
+// it exchanges the challenge token and TOTP or recovery code for the auth tokens
+func (app *App) LoginTwoFactor(w http.ResponseWriter, req *http.Request) {
+	var input struct {
+		ChallengeToken string `json:"challengeToken"`
+		twoFactorCodeInput
+	}
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	userID, challengeID, err := parseTwoFactorChallenge(input.ChallengeToken, app.jwtKeys)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithUnauthorized(w, "invalid challenge token")
+		return
+	}
+
+	ctx := req.Context()
+	err = app.authUsecases.VerifyTwoFactor(ctx, app.mailer, userID, challengeID, input.Code, app.clientIP(req))
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var llErr *usecases.LoginLockedError
+		if errors.As(err, &llErr) {
+			retryAfter := int64(math.Ceil(llErr.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			responseWithErrorTxt(w, http.StatusTooManyRequests, llErr.Error())
+			return
+		}
+		var itfcErr *usecases.InvalidTwoFactorChallengeError
+		if errors.As(err, &itfcErr) {
+			responseWithUnauthorized(w, "invalid challenge token")
+			return
+		}
+		var tfneErr *usecases.TwoFactorNotEnabledError
+		if errors.Is(err, usecases.IncorrectCredentialsError{}) || errors.As(err, &tfneErr) {
+			responseWithUnauthorized(w, "incorrect code")
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	user, err := app.userUsecases.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		logDebugError(app.l, req, errors.WithMessage(err, "get user after two-factor login"))
+		responseWithInternalError(w)
+		return
+	}
+
+	output := map[string]interface{}{
+		"user": user,
+	}
+
+	tokenMode := isTokenAuthMode(req)
+	ut, rt, err := app.login(ctx, w, user.ID, requestDeviceID(req), tokenMode)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		clearCookieJWTAuthToken(w)
+		clearCookieRefreshToken(w)
+		responseWithInternalError(w)
+		return
+	}
+	if tokenMode {
+		setAuthTokensOutput(output, ut, rt)
+	}
+
+	responseWithJSON(w, http.StatusOK, output)
+}
+
+// SetupTwoFactor generates new TOTP secret for the logged in user
+func (app *App) SetupTwoFactor(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	setup, err := app.authUsecases.SetupTwoFactor(ctx, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var tfaeErr *usecases.TwoFactorAlreadyEnabledError
+		if errors.As(err, &tfaeErr) {
+			responseWithError(w, http.StatusConflict, err)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, setup)
+}
+
+// EnableTwoFactor confirms the setup with the code from the authenticator app,
+// the recovery codes are returned only here
+func (app *App) EnableTwoFactor(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	var input twoFactorCodeInput
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	recoveryCodes, err := app.authUsecases.EnableTwoFactor(ctx, userID, input.Code)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		if errors.Is(err, usecases.IncorrectCredentialsError{}) {
+			responseWithErrorTxt(w, http.StatusBadRequest, "incorrect code")
+			return
+		}
+		var tfaeErr *usecases.TwoFactorAlreadyEnabledError
+		var tfneErr *usecases.TwoFactorNotEnabledError
+		if errors.As(err, &tfaeErr) || errors.As(err, &tfneErr) {
+			responseWithError(w, http.StatusConflict, err)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, map[string]interface{}{
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// DisableTwoFactor turns off the two-factor authentication, it requires the password and TOTP or recovery code
+func (app *App) DisableTwoFactor(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	var input disableTwoFactorInput
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = app.authUsecases.DisableTwoFactor(ctx, app.mailer, userID, input.Password, input.Code, app.clientIP(req))
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var llErr *usecases.LoginLockedError
+		if errors.As(err, &llErr) {
+			retryAfter := int64(math.Ceil(llErr.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			responseWithErrorTxt(w, http.StatusTooManyRequests, llErr.Error())
+			return
+		}
+		if errors.Is(err, usecases.IncorrectCredentialsError{}) {
+			responseWithErrorTxt(w, http.StatusBadRequest, "incorrect password or code")
+			return
+		}
+		var tfneErr *usecases.TwoFactorNotEnabledError
+		if errors.As(err, &tfneErr) {
+			responseWithError(w, http.StatusConflict, err)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
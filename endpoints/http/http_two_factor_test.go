@@ -0,0 +1,113 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/totp"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	ctx := context.TODO()
+	ut, err := createJWTAuth(ctx, mocks.TwoFactorUserID, "two-factor device", app.jwtKeys, app.authUsecases.SaveJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized := func(path string, body interface{}) *http.Request {
+		payload, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(payload))
+		req.Header.Set("Authorization", "Bearer "+ut.Token)
+		return req
+	}
+
+	res := executeRequestWithoutJWT(authorized("/two-factor/setup", nil))
+	checkResponseCode(t, http.StatusOK, res.Code)
+	setup := usecases.TwoFactorSetup{}
+	err = json.NewDecoder(res.Body).Decode(&setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := totp.Code(setup.Secret, totp.Step(time.Now())-1)
+	res = executeRequestWithoutJWT(authorized("/two-factor/enable", map[string]string{"code": code}))
+	checkResponseCode(t, http.StatusOK, res.Code)
+	enabled := struct {
+		RecoveryCodes []string
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&enabled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(enabled.RecoveryCodes) == 0 {
+		t.Fatal("want recovery codes, got none")
+	}
+
+	payload, _ := json.Marshal(&usecases.UserInput{
+		EmailAddress: mocks.TwoFactorEmail,
+		Password:     string(mocks.Password),
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+	res = executeRequestWithoutJWT(req)
+	checkResponseCode(t, http.StatusOK, res.Code)
+	for _, c := range res.Result().Cookies() {
+		if c.Value != "" {
+			t.Errorf("want no auth cookies before the second step, got %q", c.Name)
+		}
+	}
+	challenge := struct {
+		TwoFactorRequired bool
+		ChallengeToken    string
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("want two-factor challenge, got %+v", challenge)
+	}
+
+	// the challenge is not an auth token
+	req, _ = http.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Authorization", "Bearer "+challenge.ChallengeToken)
+	checkResponseCode(t, http.StatusUnauthorized, executeRequestWithoutJWT(req).Code)
+
+	secondStep := func(code string) *http.Request {
+		payload, _ := json.Marshal(map[string]string{
+			"challengeToken": challenge.ChallengeToken,
+			"code":           code,
+		})
+		req, _ := http.NewRequest(http.MethodPost, "/login/two-factor?mode=token", bytes.NewBuffer(payload))
+		return req
+	}
+
+	// the code has been used to enable the two-factor authentication
+	checkResponseCode(t, http.StatusUnauthorized, executeRequestWithoutJWT(secondStep(code)).Code)
+
+	res = executeRequestWithoutJWT(secondStep(enabled.RecoveryCodes[0]))
+	checkResponseCode(t, http.StatusOK, res.Code)
+	tokens := struct {
+		Token string
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.Token == "" {
+		t.Errorf("want auth token after the second step")
+	}
+
+	// the challenge is used up by the login
+	checkResponseCode(t, http.StatusUnauthorized, executeRequestWithoutJWT(secondStep(enabled.RecoveryCodes[2])).Code)
+
+	res = executeRequestWithoutJWT(authorized("/two-factor/disable", map[string]string{
+		"password": string(mocks.Password),
+		"code":     enabled.RecoveryCodes[1],
+	}))
+	checkResponseCode(t, http.StatusOK, res.Code)
+}
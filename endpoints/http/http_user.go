@@ -1,34 +1,143 @@
 package http
 
 import (
-	"errors"
+	"encoding/json"
 	"net/http"
+	"reflect"
 
-	"github.com/gorilla/mux"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/helpers"
 	"github.com/unnamedxaer/gymm-api/usecases"
+	"github.com/unnamedxaer/gymm-api/validation"
 )
 
-func (app *App) GetUserById(w http.ResponseWriter, req *http.Request) {
+// GetMe returns the profile of the logged user
+func (app *App) GetMe(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	u, err := app.userUsecases.GetUserByID(ctx, userID)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithInternalError(w)
+		return
+	}
 
-	vars := mux.Vars(req)
-	id := vars["id"]
-	logDebug(app.l, req, id)
-	if id == "" {
-		responseWithError(w, http.StatusUnprocessableEntity, errors.New("missign 'ID'"))
+	if u == nil {
+		// removed in the meantime
+		responseWithUnauthorized(w)
 		return
 	}
 
+	responseWithJSON(w, http.StatusOK, u)
+}
+
+// UpdateMe changes the username and preferences of the logged user, the fields missing in the body are not changed
+func (app *App) UpdateMe(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
 
-	u, err := app.userUsecases.GetUserByID(ctx, id)
+	var input usecases.UserProfileInput
+	err := json.NewDecoder(req.Body).Decode(&input)
 	if err != nil {
-		var e *usecases.InvalidIDError
-		if errors.As(err, &e) {
-			responseWithError(w, http.StatusBadRequest, err)
+		logDebugError(app.l, req, err)
+		responseWithError(w, http.StatusBadRequest, errors.New(getErrOfMalformedInput(&input, nil)))
+		return
+	}
+	defer req.Body.Close()
+
+	if input.Username != nil {
+		username := helpers.TrimWhiteSpaces(*input.Username)
+		input.Username = &username
+	}
+
+	err = validateUserProfileInput(app.Validate, &input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		if svErr, ok := err.(*validation.StructValidError); ok {
+			responseWithJSON(w, http.StatusNotAcceptable, svErr.Format())
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	u, err := app.userUsecases.UpdateUserProfile(ctx, userID, &input)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		var rneErr *usecases.RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			responseWithUnauthorized(w)
 			return
 		}
+		responseWithInternalError(w)
+		return
+	}
+
+	responseWithJSON(w, http.StatusOK, u)
+}
+
+// ChangeEmailAddress sets the pending email address of the logged user after checking the password,
+// the verification link that makes it the user's address is sent to the new address
+func (app *App) ChangeEmailAddress(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userID, ok := ctx.Value(contextKeyUserID).(string)
+	if !ok {
+		responseWithUnauthorized(w)
+		return
+	}
+
+	body := make(map[string]string, 2)
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		logDebugError(app.l, req, err)
+		responseWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer req.Body.Close()
+
+	fieldName := "emailAddress"
+	srf, _ := reflect.TypeOf(usecases.UserInput{}).FieldByName("EmailAddress")
+	err = app.Validate.Var(body[fieldName], srf.Tag.Get("validate"))
+	if err != nil {
+		logDebugError(app.l, req, err)
+		formattedErrors := make(map[string]string, 1)
+		validateErrs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			formattedErrors[fieldName] = err.Error()
+		}
+
+		for _, err := range validateErrs {
+			formattedErrors[fieldName] += getErrorTranslation4User(&err, fieldName)
+		}
+
+		vErrs := validation.NewStructValidError(formattedErrors)
+		responseWithJSON(w, http.StatusBadRequest, vErrs.Format())
+		return
+	}
 
-		responseWithError(w, http.StatusInternalServerError, err)
+	u, err := app.authUsecases.ChangeEmailAddress(ctx, app.mailer, userID, body["password"], body[fieldName])
+	if err != nil {
+		logDebugError(app.l, req, err)
+		if errors.Is(err, usecases.IncorrectCredentialsError{}) {
+			responseWithError(w, http.StatusUnauthorized, err)
+			return
+		}
+		var eiuErr *usecases.EmailAddressInUseError
+		if errors.As(err, &eiuErr) {
+			responseWithErrorTxt(w, http.StatusConflict, "email address already in use")
+			return
+		}
+		responseWithInternalError(w)
 		return
 	}
 
@@ -1,5 +1,16 @@
 package http
 
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+)
+
 // func TestGetUserByID(t *testing.T) {
 // 	id := "1sadf3245df3245"
 
@@ -59,3 +70,119 @@ package http
 // 		t.Fatalf("want response to be like {\"error\": \"%s\"}, got %s", expectedErr.Error(), string(b))
 // 	}
 // }
+
+func TestGetMe(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+	res := executeRequestAs(t, mocks.UserID, req)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	var user entities.User
+	err := json.NewDecoder(res.Body).Decode(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != mocks.UserID {
+		t.Errorf("want user %q, got %+v", mocks.UserID, user)
+	}
+}
+
+func TestUpdateMe(t *testing.T) {
+	testCases := []struct {
+		desc string
+		body string
+		want int
+	}{
+		{
+			desc: "username and preferences",
+			body: `{"userName": "  Long John Silver ", "theme": "dark", "timezone": "Europe/Warsaw", "units": "imperial"}`,
+			want: http.StatusOK,
+		},
+		{
+			desc: "unknown time zone",
+			body: `{"timezone": "Mars/Olympus_Mons"}`,
+			want: http.StatusNotAcceptable,
+		},
+		{
+			desc: "unknown units",
+			body: `{"units": "stones"}`,
+			want: http.StatusNotAcceptable,
+		},
+		{
+			desc: "too short username",
+			body: `{"userName": "J"}`,
+			want: http.StatusNotAcceptable,
+		},
+		{
+			desc: "malformed",
+			body: `{"theme": 1}`,
+			want: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPatch, "/me", strings.NewReader(tc.body))
+			res := executeRequestAs(t, mocks.UserID, req)
+			checkResponseCode(t, tc.want, res.StatusCode)
+			if tc.want != http.StatusOK {
+				return
+			}
+
+			var user entities.User
+			err := json.NewDecoder(res.Body).Decode(&user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := entities.UserPreferences{Theme: entities.ThemeDark, Timezone: "Europe/Warsaw", Units: entities.UnitsImperial}
+			if user.Username != "Long John Silver" || user.Preferences != want {
+				t.Errorf("want trimmed username and preferences %+v, got %+v", want, user)
+			}
+		})
+	}
+}
+
+func TestChangeEmailAddress(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		email    string
+		password string
+		want     int
+	}{
+		{
+			desc:     "new address",
+			email:    "new" + mocks.ExampleUser.EmailAddress,
+			password: string(mocks.Password),
+			want:     http.StatusOK,
+		},
+		{
+			desc:     "address of another user",
+			email:    mocks.InUseEmail,
+			password: string(mocks.Password),
+			want:     http.StatusConflict,
+		},
+		{
+			desc:     "incorrect password",
+			email:    "new" + mocks.ExampleUser.EmailAddress,
+			password: string(mocks.Password) + "X",
+			want:     http.StatusUnauthorized,
+		},
+		{
+			desc:     "invalid address",
+			email:    "not an email",
+			password: string(mocks.Password),
+			want:     http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			payload, _ := json.Marshal(map[string]string{
+				"emailAddress": tc.email,
+				"password":     tc.password,
+			})
+			req, _ := http.NewRequest(http.MethodPost, "/me/email", bytes.NewBuffer(payload))
+			res := executeRequestAs(t, mocks.UserID, req)
+			checkResponseCode(t, tc.want, res.StatusCode)
+		})
+	}
+}
@@ -41,12 +41,43 @@ func validateUserInput(validate *validator.Validate, u *usecases.UserInput) erro
 	return nil
 }
 
+func validateUserProfileInput(validate *validator.Validate, p *usecases.UserProfileInput) error {
+	errs := validate.Struct(p)
+	if errs == nil {
+		return nil
+	}
+
+	validErrs, ok := errs.(validator.ValidationErrors)
+	if !ok {
+		return errs
+	}
+
+	formatedErrors := make(map[string]string, len(validErrs))
+	var errText, txt string
+	for _, err := range validErrs {
+		fieldName, found := validation.GetFieldJSONTag(p, err.StructField())
+		if !found {
+			fieldName = err.StructField()
+		}
+
+		txt = getErrorTranslation4User(&err, fieldName)
+		errText += txt
+		formatedErrors[fieldName] = txt
+	}
+
+	return validation.NewStructValidError(formatedErrors, errText)
+}
+
 func getErrorTranslation4User(err *validator.FieldError, fieldName string) string {
 	switch (*err).Tag() {
 	case "pwd":
 		return fmt.Sprintf("The '%s' is not strong enough", fieldName)
 	case "email":
 		return fmt.Sprintf("The '%s' is not a valid email address", fieldName)
+	case "oneof":
+		return fmt.Sprintf("The '%s' is incorrect, allowed are: %s", fieldName, (*err).Param())
+	case "timezone":
+		return fmt.Sprintf("The '%s' is not a known time zone name", fieldName)
 	case "required":
 		return fmt.Sprintf("The '%s' field value is required and cannot be empty", fieldName)
 	case "min":
@@ -8,6 +8,9 @@ import (
 func trimWhitespacesOnExerciseInput(e *usecases.ExerciseInput) {
 	e.Name = helpers.TrimWhiteSpaces(e.Name)
 	e.Description = helpers.TrimWhiteSpaces(e.Description)
+	for i := range e.Aliases {
+		e.Aliases[i] = helpers.TrimWhiteSpaces(e.Aliases[i])
+	}
 }
 
 func trimWhitespacesOnUserInput(u *usecases.UserInput) {
@@ -1,15 +1,24 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+	idempotencyKeyMaxLength  = 255
 )
 
 type middleware func(http.HandlerFunc) http.HandlerFunc
@@ -30,104 +39,307 @@ func chainMiddlewares(h http.HandlerFunc, middlewares ...middleware) http.Handle
 
 func (app *App) checkAuthenticated(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(cookieJwtTokenName)
+		tokenStr, usesCookie, err := getAuthToken(r)
 		if err != nil {
 			logDebugError(app.l, r, err)
 			if err == http.ErrNoCookie {
 				responseWithUnauthorized(w, "no token provided")
 				return
 			}
-			responseWithError(w, http.StatusInternalServerError, err)
+			responseWithUnauthorized(w, err)
+			return
+		}
+
+		if !usesCookie && strings.HasPrefix(tokenStr, usecases.APIKeyPrefix) {
+			app.checkAPIKey(w, r, tokenStr, next)
 			return
 		}
 
-		cookieVal := cookie.Value
 		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(
-			cookieVal, claims,
-			func(t *jwt.Token) (interface{}, error) {
-				return app.jwtKey, nil
-			})
+		_, err = jwt.ParseWithClaims(tokenStr, claims, app.jwtKeys.Keyfunc)
 		if err != nil {
+			logDebugError(app.l, r, err)
 			var vErr *jwt.ValidationError
-			if !(errors.As(err, &vErr) &&
-				// verify that only expiration time is not valid
-				// @thought: maybe validate time manually eg. by using IssuedAt + "max age"
-				// instead of expiration time, this way there will be no need of asserting
-				// the error (if exptime will be zero value)
-				(vErr.Errors == jwt.ValidationErrorExpired)) ||
-				claims.ID == "" ||
-				claims.StandardClaims.ExpiresAt == 0 {
-				logDebugError(app.l, r, err)
+			if errors.As(err, &vErr) && vErr.Errors == jwt.ValidationErrorExpired {
+				// keep the cookie, the client is expected to call the refresh endpoint
+				responseWithUnauthorized(w, "token expired")
+				return
+			}
+			clearCookieJWTAuthToken(w)
+			responseWithUnauthorized(w)
+			return
+		}
+
+		// auth tokens have no audience, it keeps eg. the two-factor challenge from being used instead
+		if claims.ID == "" || claims.StandardClaims.ExpiresAt == 0 || claims.Audience != "" {
+			clearCookieJWTAuthToken(w)
+			responseWithUnauthorized(w)
+			return
+		}
+
+		// the token of the ended session is rejected before it expires
+		active, err := app.authUsecases.IsSessionActive(r.Context(), claims.ID, tokenStr)
+		if err != nil {
+			logDebugError(app.l, r, err)
+			var idErr *usecases.InvalidIDError
+			if errors.As(err, &idErr) {
 				clearCookieJWTAuthToken(w)
 				responseWithUnauthorized(w)
 				return
 			}
+			responseWithInternalError(w)
+			return
+		}
+		if !active {
+			clearCookieJWTAuthToken(w)
+			responseWithUnauthorized(w, "session ended")
+			return
 		}
 
-		ctx := r.Context()
+		app.serveAuthenticated(w, r, claims.ID, next)
+	})
+}
 
-		if claims.StandardClaims.ExpiresAt < time.Now().Add(30*time.Second).Unix() {
-			device := r.UserAgent() // @todo: improve, mb send some info from client
-			ut := entities.UserToken{
-				UserID: claims.UserID,
-				Token:  cookie.Value,
-				Device: device,
-			}
-			n, err := app.authUsecases.DeleteJWT(ctx, &ut)
-			if err != nil {
-				// we can ignore this error for because we are going to create new token anyway
-				// if next calls fail we will return error to the client
-				logDebugError(app.l, r, err)
-			} else if n == 0 {
-				logDebugError(app.l, r, fmt.Errorf("JWT was not deleted for: %v", ut))
-			}
+// serveAuthenticated passes the request of the user on to the next handler
+// unless the user's account does not exist anymore or is disabled
+func (app *App) serveAuthenticated(w http.ResponseWriter, r *http.Request, userID string, next http.HandlerFunc) {
+	ctx := r.Context()
+	user, err := app.userUsecases.GetUserByID(ctx, userID)
+	if err != nil {
+		logDebugError(app.l, r, err)
+		responseWithInternalError(w)
+		return
+	}
 
-			rt, err := app.authUsecases.GetRefreshToken(ctx, claims.ID)
-			if err != nil {
-				logDebugError(app.l, r, err)
-				clearCookieJWTAuthToken(w)
-				responseWithInternalError(w)
+	if user == nil {
+		clearCookieJWTAuthToken(w)
+		responseWithUnauthorized(w)
+		return
+	}
+
+	if user.Disabled {
+		// the sessions were ended with the disabling, the token is just not expired yet
+		clearCookieJWTAuthToken(w)
+		responseWithError(w, http.StatusForbidden, usecases.NewErrorAccountDisabled())
+		return
+	}
+
+	ctx = context.WithValue(ctx, contextKeyUserID, user.ID)
+	ctx = context.WithValue(ctx, contextKeyUser, user)
+	ctx = usecases.WithAuditActor(ctx, app.requestAuditActor(r, user.ID))
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// auditActorMiddleware makes the client of the request the actor of the audited actions,
+// checkAuthenticated adds the user to it
+func (app *App) auditActorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := usecases.WithAuditActor(r.Context(), app.requestAuditActor(r, ""))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *App) requestAuditActor(r *http.Request, userID string) *usecases.AuditActor {
+	return &usecases.AuditActor{
+		UserID:    userID,
+		IP:        app.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// requirePermission lets only the users whose role grants the permission use the endpoint,
+// it has to be chained after checkAuthenticated
+func (app *App) requirePermission(p entities.Permission) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Value(contextKeyUser).(*entities.User); !ok {
+				responseWithUnauthorized(w)
 				return
 			}
 
-			// if refresh token not exists, expired or is different than
-			// provided by client the user must login again
-
-			err = validateRefreshToken(rt, claims.Token)
-			if err != nil {
-				logDebugError(app.l, r, err)
-				// @todo: handle return
-				_, err = app.authUsecases.DeleteRefreshToken(ctx, claims.ID)
-				if err != nil {
-					logDebugError(app.l, r, err)
-				}
-				clearCookieJWTAuthToken(w)
-				responseWithUnauthorized(w, err)
+			if !hasPermission(r.Context(), p) {
+				responseWithErrorTxt(w, http.StatusForbidden, fmt.Sprintf("missing the %q permission", p))
 				return
 			}
 
-			newToken, err := createJWTAuth(ctx, claims.ID, device, rt, app.jwtKey, app.authUsecases.SaveJWT)
-			if err != nil {
-				logDebugError(app.l, r, err)
-				responseWithInternalError(w)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasPermission tells whether the role of the authenticated user grants the permission,
+// the user is read on every request, so the role's change takes effect immediately
+func hasPermission(ctx context.Context, p entities.Permission) bool {
+	user, ok := ctx.Value(contextKeyUser).(*entities.User)
+	return ok && user.Role.Can(p)
+}
+
+// acceptAPIKey lets the API keys with the scope use the endpoint,
+// it has to be chained before checkAuthenticated, the endpoints without it accept only the jwt
+func (app *App) acceptAPIKey(scope entities.APIKeyScope) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), contextKeyAPIKeyScope, scope)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// checkAPIKey authenticates the request sent with the API key instead of the jwt
+func (app *App) checkAPIKey(w http.ResponseWriter, r *http.Request, key string, next http.HandlerFunc) {
+	ctx := r.Context()
+	scope, ok := ctx.Value(contextKeyAPIKeyScope).(entities.APIKeyScope)
+	if !ok {
+		responseWithUnauthorized(w, "api keys are not accepted by this endpoint")
+		return
+	}
+
+	apiKey, err := app.apiKeyUsecases.AuthenticateAPIKey(ctx, key)
+	if err != nil {
+		logDebugError(app.l, r, err)
+		var iakErr *usecases.InvalidAPIKeyError
+		if errors.As(err, &iakErr) {
+			responseWithUnauthorized(w, iakErr)
+			return
+		}
+		responseWithInternalError(w)
+		return
+	}
+
+	if !apiKey.HasScope(scope) {
+		responseWithErrorTxt(w, http.StatusForbidden, fmt.Sprintf("api key is missing the %q scope", scope))
+		return
+	}
+
+	app.serveAuthenticated(w, r, apiKey.UserID, next)
+}
+
+// idempotent processes the request sent with the "Idempotency-Key" header only once,
+// retries of the request get the stored response of the first one.
+// Keys are scoped per user so it has to be chained after checkAuthenticated
+// for the endpoints that require authentication.
+func (app *App) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(headerIdempotencyKey)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > idempotencyKeyMaxLength {
+			responseWithErrorTxt(w, http.StatusBadRequest,
+				fmt.Sprintf("%q header is too long", headerIdempotencyKey))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logDebugError(app.l, r, err)
+			responseWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		ctx := r.Context()
+		userID, _ := ctx.Value(contextKeyUserID).(string)
+
+		rec, err := app.idempotencyUsecases.Begin(
+			ctx, userID, key, r.Method, r.URL.Path, hash[:])
+		if err != nil {
+			logDebugError(app.l, r, err)
+			var mismatchErr *usecases.IdempotencyKeyMismatchError
+			if errors.As(err, &mismatchErr) {
+				responseWithError(w, http.StatusUnprocessableEntity, mismatchErr)
 				return
 			}
-			setCookieJWTAuthToken(w, newToken.Token, newToken.ExpiresAt)
-		} else {
-			if err = token.Claims.Valid(); err != nil {
-				clearCookieJWTAuthToken(w)
-				responseWithUnauthorized(w, err)
+			var inProgressErr *usecases.IdempotencyKeyInProgressError
+			if errors.As(err, &inProgressErr) {
+				responseWithError(w, http.StatusConflict, inProgressErr)
 				return
 			}
+			responseWithInternalError(w)
+			return
 		}
 
-		ctx = context.WithValue(ctx, contextKeyUserID, claims.ID)
-		r = r.WithContext(ctx)
-		next.ServeHTTP(w, r)
+		if rec != nil {
+			for k, v := range rec.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(headerIdempotentReplayed, "true")
+			w.WriteHeader(rec.StatusCode)
+			w.Write(rec.Body)
+			return
+		}
+
+		rw := &responseRecorder{ResponseWriter: w}
+		served := false
+		// deferred, so the key is released also when the handler panics
+		defer func() {
+			// the client may be already gone, that's the case we want to cover,
+			// so the request context cannot be used
+			ctx := context.Background()
+			var err error
+			if !served || rw.statusCode() >= http.StatusInternalServerError {
+				// let the client retry the failed request
+				err = app.idempotencyUsecases.Abandon(ctx, userID, key)
+			} else {
+				err = app.idempotencyUsecases.Complete(
+					ctx, userID, key, rw.statusCode(), storableHeader(w.Header()), rw.body.Bytes())
+			}
+			if err != nil {
+				logDebugError(app.l, r, err)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+		served = true
 	})
 }
 
+// responseRecorder writes the response to the client and keeps its copy
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	if rw.code == 0 {
+		rw.code = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.code == 0 {
+		rw.code = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *responseRecorder) statusCode() int {
+	if rw.code == 0 {
+		return http.StatusOK
+	}
+	return rw.code
+}
+
+// storableHeader returns copy of the response header without cookies,
+// the session could be changed by the time of the replay
+func storableHeader(h http.Header) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		if k == "Set-Cookie" {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
 func suffixMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
@@ -136,3 +348,21 @@ func suffixMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// getAuthToken returns jwt sent with the request, the "Authorization: Bearer"
+// header takes precedence over the cookie. usesCookie tells whether
+// the token has been read from the cookie.
+func getAuthToken(r *http.Request) (token string, usesCookie bool, err error) {
+	if h := r.Header.Get(headerAuthorization); h != "" {
+		if len(h) <= len(bearerPrefix) || !strings.EqualFold(h[:len(bearerPrefix)], bearerPrefix) {
+			return "", false, errors.New("unsupported authorization scheme, expected bearer token")
+		}
+		return strings.TrimSpace(h[len(bearerPrefix):]), false, nil
+	}
+
+	cookie, err := r.Cookie(cookieJwtTokenName)
+	if err != nil {
+		return "", true, err
+	}
+	return cookie.Value, true, nil
+}
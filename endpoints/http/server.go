@@ -1,11 +1,17 @@
 package http
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
+	"github.com/unnamedxaer/gymm-api/oidc"
 	"github.com/unnamedxaer/gymm-api/usecases"
 )
 
@@ -13,18 +19,34 @@ type contextKey int
 
 const (
 	contextKeyUserID contextKey = iota
+	// contextKeyAPIKeyScope is the scope the API key needs to be accepted by the endpoint
+	contextKeyAPIKeyScope
+	// contextKeyUser is the authenticated *entities.User
+	contextKeyUser
 )
 
 type App struct {
-	l                *zerolog.Logger
-	authUsecases     usecases.IAuthUsecases
-	userUsecases     usecases.IUserUseCases
-	exerciseUsecases usecases.IExerciseUseCases
-	trainingUsecases usecases.ITrainingUsecases
-	Router           *mux.Router
-	Validate         *validator.Validate
-	jwtKey           []byte
-	mailer           usecases.Mailer
+	l                      *zerolog.Logger
+	authUsecases           usecases.IAuthUsecases
+	userUsecases           usecases.IUserUseCases
+	exerciseUsecases       usecases.IExerciseUseCases
+	trainingUsecases       usecases.ITrainingUsecases
+	idempotencyUsecases    usecases.IIdempotencyUsecases
+	apiKeyUsecases         usecases.IAPIKeyUsecases
+	adminUsecases          usecases.IAdminUsecases
+	auditUsecases          usecases.IAuditUsecases
+	accountUsecases        usecases.IAccountUsecases
+	trainingExportUsecases usecases.ITrainingExportUsecases
+	trainingImportUsecases usecases.ITrainingImportUsecases
+	calendarUsecases       usecases.ICalendarUsecases
+	Router                 *mux.Router
+	Validate               *validator.Validate
+	jwtKeys                *jwtkeys.KeySet
+	oidcProviders          map[string]*oidc.Provider
+	mailer                 usecases.Mailer
+	srv                    *http.Server
+	// trustedProxies are the networks of the reverse proxies allowed to set X-Forwarded-For
+	trustedProxies []*net.IPNet
 }
 
 func NewServer(
@@ -33,92 +55,223 @@ func NewServer(
 	userRepo usecases.UserRepo,
 	exerciseRepo usecases.ExerciseRepo,
 	trainingRepo usecases.TrainingRepo,
+	idempotencyRepo usecases.IdempotencyRepo,
+	apiKeyRepo usecases.APIKeyRepo,
+	auditRepo usecases.AuditRepo,
+	importRepo usecases.ImportRepo,
 	validate *validator.Validate,
-	jwtKey []byte,
+	jwtKeys *jwtkeys.KeySet,
+	secrets usecases.SecretCipher,
+	hasher usecases.PasswordHasher,
+	oidcProviders []*oidc.Provider,
+	importParsers map[entities.ImportSource]usecases.TrainingImportParser,
 	mailer usecases.Mailer,
+	accountDeletionGracePeriod time.Duration,
+	trustedProxies []*net.IPNet,
 ) *App {
 
-	var authUsecases usecases.IAuthUsecases = usecases.NewAuthUsecases(logger, authRepo)
-	var userUsecases usecases.IUserUseCases = usecases.NewUserUseCases(userRepo)
-	var exerciseUsecases usecases.IExerciseUseCases = usecases.NewExerciseUseCases(exerciseRepo)
-	var trainingUsecases usecases.ITrainingUsecases = usecases.NewTrainingUseCases(trainingRepo)
+	var authUsecases usecases.IAuthUsecases = usecases.NewAuthUsecases(logger, authRepo, auditRepo, secrets, hasher)
+	var userUsecases usecases.IUserUseCases = usecases.NewUserUseCases(userRepo, hasher)
+	var exerciseUsecases usecases.IExerciseUseCases = usecases.NewExerciseUseCases(logger, exerciseRepo, auditRepo)
+	var trainingUsecases usecases.ITrainingUsecases = usecases.NewTrainingUseCases(trainingRepo, exerciseRepo)
+	var idempotencyUsecases usecases.IIdempotencyUsecases = usecases.NewIdempotencyUsecases(idempotencyRepo)
+	var apiKeyUsecases usecases.IAPIKeyUsecases = usecases.NewAPIKeyUsecases(logger, apiKeyRepo)
+	var adminUsecases usecases.IAdminUsecases = usecases.NewAdminUsecases(logger, userRepo, authRepo, auditRepo)
+	var auditUsecases usecases.IAuditUsecases = usecases.NewAuditUsecases(auditRepo)
+	var trainingExportUsecases usecases.ITrainingExportUsecases = usecases.NewTrainingExportUsecases(trainingRepo, exerciseRepo)
+	var trainingImportUsecases usecases.ITrainingImportUsecases = usecases.NewTrainingImportUsecases(
+		logger, importRepo, trainingRepo, exerciseRepo, auditRepo, importParsers)
+	var calendarUsecases usecases.ICalendarUsecases = usecases.NewCalendarUsecases(userRepo, trainingRepo, exerciseRepo)
+	var accountUsecases usecases.IAccountUsecases = usecases.NewAccountUsecases(
+		logger, userRepo, authRepo, exerciseRepo, trainingRepo, apiKeyRepo, importRepo, auditRepo, accountDeletionGracePeriod)
+
+	providers := make(map[string]*oidc.Provider, len(oidcProviders))
+	for _, p := range oidcProviders {
+		providers[p.Name()] = p
+	}
 
 	router := mux.NewRouter()
 	router.StrictSlash(true)
 
 	app := App{
-		l:                logger,
-		authUsecases:     authUsecases,
-		userUsecases:     userUsecases,
-		exerciseUsecases: exerciseUsecases,
-		trainingUsecases: trainingUsecases,
-		Router:           router,
-		Validate:         validate,
-		jwtKey:           jwtKey,
-		mailer:           mailer,
+		l:                      logger,
+		authUsecases:           authUsecases,
+		userUsecases:           userUsecases,
+		exerciseUsecases:       exerciseUsecases,
+		trainingUsecases:       trainingUsecases,
+		idempotencyUsecases:    idempotencyUsecases,
+		apiKeyUsecases:         apiKeyUsecases,
+		adminUsecases:          adminUsecases,
+		auditUsecases:          auditUsecases,
+		accountUsecases:        accountUsecases,
+		trainingExportUsecases: trainingExportUsecases,
+		trainingImportUsecases: trainingImportUsecases,
+		calendarUsecases:       calendarUsecases,
+		Router:                 router,
+		Validate:               validate,
+		jwtKeys:                jwtKeys,
+		oidcProviders:          providers,
+		mailer:                 mailer,
+		trustedProxies:         trustedProxies,
 	}
 	return &app
 }
 
 func (app *App) AddHandlers() {
+	app.Router.Use(app.auditActorMiddleware)
+
+	// login and register are not idempotent on purpose, every call creates new session,
+	// the replayed response would lack the auth cookie and the stored one would keep the tokens
 	app.Router.HandleFunc("/login", app.Login).Methods(http.MethodPost)
 	app.Router.HandleFunc("/logout", app.Logout).Methods(http.MethodGet)
+	app.Router.HandleFunc("/login/two-factor", app.LoginTwoFactor).Methods(http.MethodPost)
+	app.Router.HandleFunc("/refresh", app.Refresh).Methods(http.MethodPost)
+	app.Router.HandleFunc("/.well-known/jwks.json", app.JWKS).Methods(http.MethodGet)
 	app.Router.HandleFunc("/register", app.Register).Methods(http.MethodPost)
 	app.Router.HandleFunc("/sessions", chainMiddlewares(app.GetSessions, app.checkAuthenticated)).Methods(http.MethodGet)
-	app.Router.HandleFunc("/logout-session", chainMiddlewares(app.LogoutSession, app.checkAuthenticated)).Methods(http.MethodPost)
-	app.Router.HandleFunc("/logout-all", chainMiddlewares(app.LogoutAllSessions, app.checkAuthenticated)).Methods(http.MethodPost)
+	app.Router.HandleFunc("/logout-session", chainMiddlewares(app.LogoutSession, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
+	app.Router.HandleFunc("/logout-all", chainMiddlewares(app.LogoutAllSessions, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
+
+	// profile of the logged user
+	meRouter := app.Router.PathPrefix("/me").Subrouter()
+	meRouter.HandleFunc("", chainMiddlewares(app.GetMe, app.checkAuthenticated)).Methods(http.MethodGet)
+	meRouter.HandleFunc("", chainMiddlewares(app.UpdateMe, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPatch)
+	// the request with the password is not stored by the idempotency middleware
+	meRouter.HandleFunc("/email", chainMiddlewares(app.ChangeEmailAddress, app.checkAuthenticated)).Methods(http.MethodPost)
+	meRouter.HandleFunc("/security-events", chainMiddlewares(app.GetSecurityEvents, app.checkAuthenticated)).Methods(http.MethodGet)
+	meRouter.HandleFunc("/export", chainMiddlewares(app.ExportMe, app.checkAuthenticated)).Methods(http.MethodGet)
+	meRouter.HandleFunc("", chainMiddlewares(app.DeleteMe, app.checkAuthenticated, app.idempotent)).Methods(http.MethodDelete)
+	meRouter.HandleFunc("/deletion/cancel", chainMiddlewares(app.CancelDeleteMe, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
+	// the response with the new feed secret is not stored by the idempotency middleware
+	meRouter.HandleFunc("/calendar-feed", chainMiddlewares(app.CreateCalendarFeed, app.checkAuthenticated)).Methods(http.MethodPost)
+	meRouter.HandleFunc("/calendar-feed", chainMiddlewares(app.RevokeCalendarFeed, app.checkAuthenticated, app.idempotent)).Methods(http.MethodDelete)
+
+	// read-only feed of the trainings authenticated by its secret, the calendar apps cannot send the cookies
+	app.Router.HandleFunc("/calendar.ics", app.GetCalendar).Methods(http.MethodGet)
 
 	app.Router.HandleFunc("/health", chainMiddlewares(app.Health, app.checkAuthenticated)).Methods(http.MethodGet)
 
-	// password
+	// password, the requests with the passwords and the responses with the tokens
+	// are not stored by the idempotency middleware
 	passwordRouter := app.Router.PathPrefix("/password").Subrouter()
 	passwordRouter.HandleFunc("/change", chainMiddlewares(app.ChangePassword, app.checkAuthenticated)).Methods(http.MethodPost)
-	passwordRouter.HandleFunc("/reset/{requestID:[0-9a-zA-Z]+}", app.UpdatePasswordOnResetRequest).Methods(http.MethodPatch)
+	passwordRouter.HandleFunc("/reset/{token:[0-9a-zA-Z_-]+}", app.UpdatePasswordOnResetRequest).Methods(http.MethodPatch)
 	passwordRouter.HandleFunc("/reset", app.AddResetPasswordRequest).Methods(http.MethodPost)
 
+	// sign in with the OpenID Connect providers
+	oidcRouter := app.Router.PathPrefix("/oidc/{provider:[0-9a-z_-]+}").Subrouter()
+	oidcRouter.HandleFunc("/login", app.OIDCLogin).Methods(http.MethodGet)
+	oidcRouter.HandleFunc("/callback", app.OIDCCallback).Methods(http.MethodGet)
+
+	// email
+	emailRouter := app.Router.PathPrefix("/email").Subrouter()
+	emailRouter.HandleFunc("/verification", chainMiddlewares(app.ResendEmailVerification, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
+	emailRouter.HandleFunc("/verify/{token:[0-9a-zA-Z_-]+}", app.VerifyEmail).Methods(http.MethodPost)
+
+	// two-factor, responses with the secrets and requests with the password
+	// are not stored by the idempotency middleware
+	twoFactorRouter := app.Router.PathPrefix("/two-factor").Subrouter()
+	twoFactorRouter.HandleFunc("/setup", chainMiddlewares(app.SetupTwoFactor, app.checkAuthenticated)).Methods(http.MethodPost)
+	twoFactorRouter.HandleFunc("/enable", chainMiddlewares(app.EnableTwoFactor, app.checkAuthenticated)).Methods(http.MethodPost)
+	twoFactorRouter.HandleFunc("/disable", chainMiddlewares(app.DisableTwoFactor, app.checkAuthenticated)).Methods(http.MethodPost)
+
+	// api keys, the response with the new key is not stored by the idempotency middleware
+	apiKeysRouter := app.Router.PathPrefix("/api-keys").Subrouter()
+	apiKeysRouter.HandleFunc("", chainMiddlewares(app.GetAPIKeys, app.checkAuthenticated)).Methods(http.MethodGet)
+	apiKeysRouter.HandleFunc("", chainMiddlewares(app.CreateAPIKey, app.checkAuthenticated)).Methods(http.MethodPost)
+	apiKeysRouter.HandleFunc("/{keyID:[0-9a-zA-Z]+}", chainMiddlewares(app.RevokeAPIKey, app.checkAuthenticated, app.idempotent)).Methods(http.MethodDelete)
+
+	// admin, the API keys are never accepted
+	manageUsers := app.requirePermission(entities.PermissionManageUsers)
+	adminRouter := app.Router.PathPrefix("/admin").Subrouter()
+	adminRouter.HandleFunc("/users", chainMiddlewares(app.GetUsers, app.checkAuthenticated, manageUsers)).Methods(http.MethodGet)
+	adminRouter.HandleFunc(
+		"/users/{userID:[0-9a-zA-Z]+}/sessions",
+		chainMiddlewares(app.GetUserSessions, app.checkAuthenticated, manageUsers)).Methods(http.MethodGet)
+	adminRouter.HandleFunc(
+		"/users/{userID:[0-9a-zA-Z]+}/logout",
+		chainMiddlewares(app.LogoutUser, app.checkAuthenticated, manageUsers, app.idempotent)).Methods(http.MethodPost)
+	adminRouter.HandleFunc(
+		"/users/{userID:[0-9a-zA-Z]+}/disable",
+		chainMiddlewares(app.DisableUser, app.checkAuthenticated, manageUsers, app.idempotent)).Methods(http.MethodPost)
+	adminRouter.HandleFunc(
+		"/users/{userID:[0-9a-zA-Z]+}/enable",
+		chainMiddlewares(app.EnableUser, app.checkAuthenticated, manageUsers, app.idempotent)).Methods(http.MethodPost)
+	adminRouter.HandleFunc(
+		"/users/{userID:[0-9a-zA-Z]+}/role",
+		chainMiddlewares(
+			app.ChangeUserRole,
+			app.checkAuthenticated,
+			app.requirePermission(entities.PermissionManageRoles),
+			app.idempotent)).Methods(http.MethodPut)
+
+	// the endpoints below accept the API keys with the scope as well as the jwt
+	exercisesScope := app.acceptAPIKey(entities.APIKeyScopeExercises)
+	trainingsRead := app.acceptAPIKey(entities.APIKeyScopeTrainingsRead)
+	trainingsWrite := app.acceptAPIKey(entities.APIKeyScopeTrainingsWrite)
+
 	exercisesRouter := app.Router.PathPrefix("/exercises").Subrouter()
 	exercisesRouter.HandleFunc(
 		"/{exerciseID:[0-9a-zA-Z]+}",
-		chainMiddlewares(app.GetExerciseByID, app.checkAuthenticated)).Methods(http.MethodGet)
+		chainMiddlewares(app.GetExerciseByID, exercisesScope, app.checkAuthenticated)).Methods(http.MethodGet)
 	exercisesRouter.HandleFunc(
 		"",
-		chainMiddlewares(app.GetExercisesByName, app.checkAuthenticated)).Methods(http.MethodGet)
+		chainMiddlewares(app.GetExercisesByName, exercisesScope, app.checkAuthenticated)).Methods(http.MethodGet)
 	exercisesRouter.HandleFunc(
 		"/{exerciseID:[0-9a-zA-Z]+}",
-		chainMiddlewares(app.UpdateExercise, app.checkAuthenticated)).Methods(http.MethodPatch)
+		chainMiddlewares(app.UpdateExercise, exercisesScope, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPatch)
 	exercisesRouter.HandleFunc(
 		"",
-		chainMiddlewares(app.CreateExercise, app.checkAuthenticated)).Methods(http.MethodPost)
+		chainMiddlewares(app.CreateExercise, exercisesScope, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
 
 	// training
 	trainingRouter := app.Router.PathPrefix("/trainings").Subrouter()
 	trainingRouter.HandleFunc(
 		"",
-		chainMiddlewares(app.GetUserTrainings, app.checkAuthenticated)).Methods(http.MethodGet)
+		chainMiddlewares(app.GetUserTrainings, trainingsRead, app.checkAuthenticated)).Methods(http.MethodGet)
 	trainingRouter.HandleFunc(
 		"",
-		chainMiddlewares(app.StartTraining, app.checkAuthenticated)).Methods(http.MethodPost)
+		chainMiddlewares(app.StartTraining, trainingsWrite, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
+	// registered before the training ID route that would match it as well
+	trainingRouter.HandleFunc(
+		"/export",
+		chainMiddlewares(app.ExportTrainings, trainingsRead, app.checkAuthenticated)).Methods(http.MethodGet)
 	trainingRouter.HandleFunc(
 		"/{trainingID:[0-9a-zA-Z]+}",
-		chainMiddlewares(app.GetTrainingByID, app.checkAuthenticated)).Methods(http.MethodGet)
+		chainMiddlewares(app.GetTrainingByID, trainingsRead, app.checkAuthenticated)).Methods(http.MethodGet)
 	trainingRouter.HandleFunc(
 		"/{trainingID:[0-9a-zA-Z]+}/end",
-		chainMiddlewares(app.EndTraining, app.checkAuthenticated)).Methods(http.MethodPatch)
+		chainMiddlewares(app.EndTraining, trainingsWrite, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPatch)
 
 	// training exercise
 	trainingExerciseRouter := trainingRouter.PathPrefix("/{trainingID:[0-9a-zA-Z]+}/exercises").Subrouter()
 	trainingExerciseRouter.HandleFunc(
 		"",
-		chainMiddlewares(app.StartTrainingExercise, app.checkAuthenticated)).Methods(http.MethodPost)
+		chainMiddlewares(app.StartTrainingExercise, trainingsWrite, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
 	trainingExerciseRouter.HandleFunc(
 		"/{exerciseID:[0-9a-zA-Z]+}/end",
-		chainMiddlewares(app.EndTrainingExercise, app.checkAuthenticated)).Methods(http.MethodPatch)
+		chainMiddlewares(app.EndTrainingExercise, trainingsWrite, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPatch)
 
 	// training set
 	trainingSetRouter := trainingExerciseRouter.PathPrefix("/{exerciseID:[0-9a-zA-Z]+}/sets").Subrouter()
 	trainingSetRouter.HandleFunc(
 		"",
-		chainMiddlewares(app.AddTrainingSetExercise, app.checkAuthenticated)).Methods(http.MethodPost)
+		chainMiddlewares(app.AddTrainingSetExercise, trainingsWrite, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
+
+	// import of the other apps' training logs, the upload is not stored by the idempotency middleware
+	importsRouter := app.Router.PathPrefix("/imports").Subrouter()
+	importsRouter.HandleFunc(
+		"",
+		chainMiddlewares(app.CreateImport, trainingsWrite, app.checkAuthenticated)).Methods(http.MethodPost)
+	importsRouter.HandleFunc(
+		"/{importID:[0-9a-zA-Z]+}",
+		chainMiddlewares(app.GetImport, trainingsWrite, app.checkAuthenticated)).Methods(http.MethodGet)
+	importsRouter.HandleFunc(
+		"/{importID:[0-9a-zA-Z]+}/commit",
+		chainMiddlewares(app.CommitImport, trainingsWrite, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
+
+	// offline sync
+	app.Router.HandleFunc("/sync", chainMiddlewares(app.Sync, trainingsWrite, app.checkAuthenticated, app.idempotent)).Methods(http.MethodPost)
 
 	app.Router.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
 		logDebug(app.l, r, nil)
@@ -126,11 +279,24 @@ func (app *App) AddHandlers() {
 	})
 }
 
+// Run starts the server, it blocks until the server fails or is shut down
 func (app *App) Run(addr string) {
-	srv := &http.Server{
+	app.srv = &http.Server{
 		Addr:    addr,
 		Handler: suffixMiddleware(app.Router),
 	}
 	app.l.Info().Msg("server is up and running at " + addr)
-	app.l.Error().Stack().Err(srv.ListenAndServe()).Msg("")
+	err := app.srv.ListenAndServe()
+	if err != http.ErrServerClosed {
+		app.l.Error().Stack().Err(err).Msg("")
+	}
+}
+
+// Shutdown stops the server gracefully, waiting for the active requests
+// to complete until the ctx is done
+func (app *App) Shutdown(ctx context.Context) error {
+	if app.srv == nil {
+		return nil
+	}
+	return app.srv.Shutdown(ctx)
 }
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -8,16 +10,24 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/importers"
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
 	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/oidc"
+	"github.com/unnamedxaer/gymm-api/oidc/oidctest"
 	"github.com/unnamedxaer/gymm-api/testhelpers"
+	"github.com/unnamedxaer/gymm-api/totp"
 	"github.com/unnamedxaer/gymm-api/usecases"
 	"github.com/unnamedxaer/gymm-api/validation"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	app       *App
 	validate  *validator.Validate
 	jwtCookie *http.Cookie
+	fakeOIDC  *oidctest.Provider
+	auditRepo *mocks.MockAuditRepo
 	wrongUser usecases.UserInput = usecases.UserInput{
 		Username:     "1",
 		EmailAddress: "email.at.no.address",
@@ -40,20 +50,65 @@ func TestMain(m *testing.M) {
 	if len(jwtKey) < 10 {
 		panic("missing or too short jwt key")
 	}
+	hmacKey, err := jwtkeys.NewHMACKey("default", jwtKey)
+	if err != nil {
+		panic(err)
+	}
+	jwtKeys, err := jwtkeys.NewKeySet(hmacKey.ID, hmacKey.ID, hmacKey)
+	if err != nil {
+		panic(err)
+	}
+
+	secrets, err := totp.NewCipher(bytes.Repeat([]byte{7}, totp.KeySize))
+	if err != nil {
+		panic(err)
+	}
+
+	// the mocked users' hashes have the min cost, so they are not rehashed
+	passwordHasher, err := usecases.NewBcryptHasher(bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+
+	fakeOIDC, err = oidctest.NewProvider("gymm", "client secret")
+	if err != nil {
+		panic(err)
+	}
+	oidcProvider, err := oidc.Discover(context.Background(), fakeOIDC.Client(), oidc.Config{
+		Name:         "fake",
+		Issuer:       fakeOIDC.Issuer(),
+		ClientID:     fakeOIDC.ClientID,
+		ClientSecret: fakeOIDC.ClientSecret,
+		RedirectURL:  "http://localhost:8080/oidc/fake/callback",
+	})
+	if err != nil {
+		panic(err)
+	}
 
 	aMockRepo := &mocks.MockAuthRepo{}
 	uMockRepo := &mocks.MockUserRepo{}
 	eMockRepo := &mocks.MockExerciseRepo{}
 	tMockRepo := &mocks.MockTrainingRepo{}
+	auditRepo = &mocks.MockAuditRepo{}
 	app = NewServer(
 		&loggerMock,
 		aMockRepo,
 		uMockRepo,
 		eMockRepo,
 		tMockRepo,
+		&mocks.MockIdempotencyRepo{},
+		&mocks.MockAPIKeyRepo{},
+		auditRepo,
+		&mocks.MockImportRepo{},
 		validate,
-		jwtKey,
-		&mocks.MockMailer{})
+		jwtKeys,
+		secrets,
+		passwordHasher,
+		[]*oidc.Provider{oidcProvider},
+		importers.Parsers(),
+		&mocks.MockMailer{},
+		usecases.DefaultAccountDeletionGracePeriod,
+		nil)
 	app.AddHandlers()
 
 	jwtCookie = &http.Cookie{
@@ -63,7 +118,9 @@ func TestMain(m *testing.M) {
 		HttpOnly: true,
 	}
 
-	os.Exit(m.Run())
+	code := m.Run()
+	fakeOIDC.Close()
+	os.Exit(code)
 }
 
 func executeRequest(req *http.Request) *httptest.ResponseRecorder {
@@ -75,6 +132,22 @@ func executeRequest(req *http.Request) *httptest.ResponseRecorder {
 	return rr
 }
 
+// executeRequestWithSession sends the request with the cookie of the new session of the user,
+// it is used by the tests that end the user's sessions
+func executeRequestWithSession(t *testing.T, userID string, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	ut, err := createJWTAuth(context.TODO(), userID, "session test device", app.jwtKeys, app.authUsecases.SaveJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: cookieJwtTokenName, Value: ut.Token})
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	return rr
+}
+
 // uses to check if checkAuth middleware is applayed to the tested endpoint
 func executeRequestWithoutJWT(req *http.Request) *httptest.ResponseRecorder {
 	req.Header.Set("Content-Type", "application/json")
@@ -0,0 +1,45 @@
+package entities
+
+import "time"
+
+// APIKeyScope grants the API key access to a part of the user's data
+type APIKeyScope string
+
+const (
+	APIKeyScopeTrainingsRead  APIKeyScope = "trainings:read"
+	APIKeyScopeTrainingsWrite APIKeyScope = "trainings:write"
+	APIKeyScopeExercises      APIKeyScope = "exercises"
+)
+
+// APIKeyScopes are all of the scopes that can be granted to the API key
+var APIKeyScopes = []APIKeyScope{
+	APIKeyScopeTrainingsRead,
+	APIKeyScopeTrainingsWrite,
+	APIKeyScopeExercises,
+}
+
+// APIKey lets the user's scripts and integrations access the api without the login
+type APIKey struct {
+	ID     string        `json:"id"`
+	UserID string        `json:"-"`
+	Name   string        `json:"name"`
+	Scopes []APIKeyScope `json:"scopes"`
+	// Key is the plain key, it is available only in the response to the key creation
+	Key string `json:"key,omitempty"`
+	// Prefix is the beginning of the key that lets the user recognize it
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is nil if the key never expires
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// HasScope tells whether the key is granted the scope
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package entities
+
+import "time"
+
+// AuditAction names the audited action
+type AuditAction string
+
+const (
+	AuditActionLoginSucceeded     AuditAction = "auth.login.succeeded"
+	AuditActionLoginFailed        AuditAction = "auth.login.failed"
+	AuditActionPasswordChanged    AuditAction = "auth.password.changed"
+	AuditActionPasswordReset      AuditAction = "auth.password.reset"
+	AuditActionSessionRevoked     AuditAction = "auth.session.revoked"
+	AuditActionAllSessionsRevoked AuditAction = "auth.sessions.revoked"
+	AuditActionEmailChanged       AuditAction = "auth.email.changed"
+
+	AuditActionAccountDeletionScheduled AuditAction = "account.deletion.scheduled"
+	AuditActionAccountDeletionCancelled AuditAction = "account.deletion.cancelled"
+	AuditActionAccountDeleted           AuditAction = "account.deleted"
+
+	AuditActionExerciseCreated AuditAction = "exercise.created"
+	AuditActionExerciseUpdated AuditAction = "exercise.updated"
+
+	AuditActionAdminViewSessions AuditAction = "admin.user.view_sessions"
+	AuditActionAdminLogoutUser   AuditAction = "admin.user.logout"
+	AuditActionAdminDisableUser  AuditAction = "admin.user.disable"
+	AuditActionAdminEnableUser   AuditAction = "admin.user.enable"
+	AuditActionAdminChangeRole   AuditAction = "admin.user.change_role"
+)
+
+// SecurityAuditActions are the actions the users see in their security events
+var SecurityAuditActions = []AuditAction{
+	AuditActionLoginSucceeded,
+	AuditActionLoginFailed,
+	AuditActionPasswordChanged,
+	AuditActionPasswordReset,
+	AuditActionSessionRevoked,
+	AuditActionAllSessionsRevoked,
+	AuditActionEmailChanged,
+	AuditActionAccountDeletionScheduled,
+	AuditActionAccountDeletionCancelled,
+	AuditActionAdminLogoutUser,
+	AuditActionAdminDisableUser,
+	AuditActionAdminEnableUser,
+	AuditActionAdminChangeRole,
+}
+
+// AuditEvent is the record of the action, the events are never changed once stored
+type AuditEvent struct {
+	ID     string      `json:"id"`
+	Action AuditAction `json:"action"`
+	// ActorID is the user who performed the action, it is empty if the actor is not known,
+	// eg. for the failed login
+	ActorID string `json:"actorId,omitempty"`
+	// UserID is the user whose account or data the action concerns
+	UserID string `json:"userId"`
+	// RecordID identifies the changed data, eg. the exercise, it is empty for the account's actions
+	RecordID  string `json:"recordId,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	// Before and After are the changed fields of the data, the values outside of them did not change
+	Before    map[string]interface{} `json:"before,omitempty"`
+	After     map[string]interface{} `json:"after,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
@@ -21,6 +21,31 @@ const (
 type AuthUser struct {
 	User
 	Password []byte
+	// TwoFactor is nil if the user has never started the two-factor setup
+	TwoFactor *TwoFactor
+}
+
+// TwoFactor is the TOTP second factor of the user
+type TwoFactor struct {
+	// Secret is encrypted
+	Secret []byte
+	// Enabled is false until the user confirms the setup with a code
+	Enabled bool
+	// LastUsedStep is the TOTP step of the last accepted code, it prevents reusing the code
+	LastUsedStep int64
+	// RecoveryCodes are hashes of the not used recovery codes
+	RecoveryCodes []string
+}
+
+// ExternalIdentity is the user's account at the OpenID Connect provider
+type ExternalIdentity struct {
+	// Issuer identifies the provider
+	Issuer string
+	// Subject identifies the account at the provider
+	Subject       string
+	EmailAddress  string
+	EmailVerified bool
+	Name          string
 }
 
 type UserToken struct {
@@ -33,8 +58,10 @@ type UserToken struct {
 }
 
 type RefreshToken struct {
-	ID        string    `json:"-"`
-	UserID    string    `json:"-"`
+	ID     string `json:"-"`
+	UserID string `json:"-"`
+	// Device is the device of the session which the token belongs to
+	Device    string    `json:"-"`
 	Token     string    `json:"token"`
 	CreatedAt time.Time `json:"-"`
 	ExpiresAt time.Time `json:"-"`
@@ -46,4 +73,18 @@ type ResetPwdReq struct {
 	Status       ResetPwdStatus `json:"status"`
 	ExpiresAt    time.Time      `json:"expiresAt"`
 	CreatedAt    time.Time      `json:"createdAt"`
+	// Token is sent in the reset link, only its hash is stored
+	// so it is set only on the newly created request
+	Token string `json:"-"`
+}
+
+// LoginAttempts are the failed login attempts for the email or IP address
+type LoginAttempts struct {
+	// Key identifies the email or IP address, eg. "email:john@email.com"
+	Key      string
+	Failures int
+	// LockedUntil is the time before which next attempts are rejected
+	LockedUntil time.Time
+	// ExpiresAt is the time after which the failures are forgotten
+	ExpiresAt time.Time
 }
@@ -0,0 +1,22 @@
+package entities
+
+import "time"
+
+// CalendarFeed is the secret address the calendar apps subscribe to, to show the user's trainings
+type CalendarFeed struct {
+	// Token is the plain feed secret, it is available only in the response to the feed creation
+	Token string `json:"token"`
+	// URL is the address of the feed with the secret
+	URL string `json:"url"`
+}
+
+// CalendarEvent is the completed training shown in the user's calendar
+type CalendarEvent struct {
+	TrainingID string
+	Summary    string
+	// Description lists the exercises of the training with their sets
+	Description string
+	StartTime   time.Time
+	EndTime     time.Time
+	UpdatedAt   time.Time
+}
@@ -16,4 +16,16 @@ type Exercise struct {
 	SetUnit     SetUnit   `json:"setUnit"`
 	CreatedAt   time.Time `json:"createdAt"`
 	CreatedBy   string    `json:"createdBy"`
+	// Aliases are the other names of the exercise, eg. used by the other apps
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+func (u SetUnit) String() string {
+	switch u {
+	case Weight:
+		return "weight"
+	case Time:
+		return "time"
+	}
+	return ""
 }
@@ -0,0 +1,25 @@
+package entities
+
+import "time"
+
+// IdempotencyRecord keeps the response of the request sent with an idempotency key,
+// so the retried request can be answered without doing the work again
+type IdempotencyRecord struct {
+	ID     string
+	Key    string
+	UserID string
+	Method string
+	Path   string
+	// RequestHash is a fingerprint of the request body,
+	// the key cannot be reused for a different payload
+	RequestHash []byte
+	// StatusCode is zero as long as the original request is in progress
+	StatusCode int
+	// LockedUntil is the end of the lease of the request in progress,
+	// the retry takes the key over after it as the request is considered lost
+	LockedUntil time.Time
+	Header      map[string][]string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
@@ -0,0 +1,82 @@
+package entities
+
+import "time"
+
+// ImportSource is the app whose training log is imported
+type ImportSource string
+
+const (
+	ImportSourceStrong   ImportSource = "strong"
+	ImportSourceHevy     ImportSource = "hevy"
+	ImportSourceFitNotes ImportSource = "fitnotes"
+)
+
+// ImportStatus is the stage of the import
+type ImportStatus string
+
+const (
+	// ImportStatusReview is the import waiting for the user to check the report, nothing is imported yet
+	ImportStatusReview    ImportStatus = "review"
+	ImportStatusQueued    ImportStatus = "queued"
+	ImportStatusRunning   ImportStatus = "running"
+	ImportStatusCompleted ImportStatus = "completed"
+	ImportStatusFailed    ImportStatus = "failed"
+)
+
+// ImportedSet is a single set read from the training log of the other app
+type ImportedSet struct {
+	// Row is the line of the file the set was read from
+	Row int
+	// TrainingStart identifies the training the set belongs to
+	TrainingStart time.Time
+	// TrainingEnd is zero if the app does not keep it
+	TrainingEnd  time.Time
+	TrainingName string
+	ExerciseName string
+	Reps         int
+	// Load is the weight in kilograms
+	Load float64
+	// Seconds is the duration of the time set
+	Seconds int
+}
+
+// ImportRowError tells why the row of the file was skipped
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportReport describes what the import does before anything is stored
+type ImportReport struct {
+	Rows      int `json:"rows"`
+	Trainings int `json:"trainings"`
+	Sets      int `json:"sets"`
+	// UnmatchedExercises are the names that match neither the name nor the alias of any exercise,
+	// the import creates them
+	UnmatchedExercises []string `json:"unmatchedExercises"`
+	// RowErrors are the first of the skipped rows
+	RowErrors []ImportRowError `json:"rowErrors"`
+	// RowErrorsCount is number of all skipped rows
+	RowErrorsCount int `json:"rowErrorsCount"`
+}
+
+// ImportJob is the import of the training log that runs in the background once the user commits it
+type ImportJob struct {
+	ID     string       `json:"id"`
+	UserID string       `json:"-"`
+	Source ImportSource `json:"source"`
+	Status ImportStatus `json:"status"`
+	// Timezone is the location of the times without the offset in the file
+	Timezone string `json:"timezone"`
+	// Units are the units of the weights without the unit in the file
+	Units  UnitSystem   `json:"units"`
+	Report ImportReport `json:"report"`
+	// ImportedTrainings is number of trainings already stored, the interrupted import resumes after them
+	ImportedTrainings int `json:"importedTrainings"`
+	CreatedExercises  int `json:"createdExercises"`
+	// Attempts is number of times the import was started
+	Attempts  int       `json:"-"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,44 @@
+package entities
+
+// Role decides what the user can do besides managing their own data
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleCoach Role = "coach"
+	RoleAdmin Role = "admin"
+)
+
+// Permission is an action on the data of the other users
+type Permission string
+
+const (
+	// PermissionManageUsers allows listing and disabling the users
+	PermissionManageUsers Permission = "users:manage"
+	// PermissionModerateExercises allows editing the exercises created by anyone
+	PermissionModerateExercises Permission = "exercises:moderate"
+	// PermissionManageRoles allows changing the roles of the other users
+	PermissionManageRoles Permission = "roles:manage"
+)
+
+// rolePermissions are the permissions granted to the roles,
+// the users manage only their own data and the coaches curate the shared exercises
+var rolePermissions = map[Role][]Permission{
+	RoleCoach: {PermissionModerateExercises},
+	RoleAdmin: {PermissionManageUsers, PermissionManageRoles, PermissionModerateExercises},
+}
+
+// Can tells whether the role is granted the permission
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid tells whether the role is one of the known roles
+func (r Role) IsValid() bool {
+	return r == RoleUser || r == RoleCoach || r == RoleAdmin
+}
@@ -0,0 +1,45 @@
+package entities
+
+type SyncEntity uint8
+
+const (
+	SyncEntityTraining SyncEntity = iota + 1
+	SyncEntityExercise
+	SyncEntitySet
+)
+
+type SyncResolution uint8
+
+const (
+	// SyncResolutionServerWins means the client change was older than
+	// the stored one and it was discarded
+	SyncResolutionServerWins SyncResolution = iota + 1
+	// SyncResolutionClientWins means the client change overwrote a change
+	// made on the server after the client's last sync
+	SyncResolutionClientWins
+	// SyncResolutionRejected means the client's new record breaks the training rules
+	// and it was discarded, eg. the second training in progress or a set of the ended exercise
+	SyncResolutionRejected
+)
+
+// SyncConflict describes a record that was modified on both the client
+// and the server since the client's last sync or that could not be applied
+type SyncConflict struct {
+	Entity     SyncEntity     `json:"entity"`
+	ID         string         `json:"id"`
+	ClientID   string         `json:"clientId"`
+	Resolution SyncResolution `json:"resolution"`
+}
+
+// SyncResult keeps the outcome of the client's sync request
+type SyncResult struct {
+	// Token marks the point in time the client is up to date with,
+	// it should be sent back with the next sync request
+	Token string `json:"token"`
+	// Trainings contains user trainings changed since the last sync
+	Trainings []Training     `json:"trainings"`
+	Conflicts []SyncConflict `json:"conflicts"`
+	// HasMore tells that not all changed trainings fit in the response,
+	// the client should sync again with the token to get the rest
+	HasMore bool `json:"hasMore"`
+}
@@ -5,29 +5,53 @@ import "time"
 // Training keeps an informations about set of executed exercises for given user at given time
 type Training struct {
 	ID        string             `json:"id"`
+	ClientID  string             `json:"clientId,omitempty"`
 	UserID    string             `json:"userId"`
 	StartTime time.Time          `json:"startTime"`
 	EndTime   time.Time          `json:"endTime,omitempty"`
 	Exercises []TrainingExercise `json:"exercises"`
 	Comment   string             `json:"comment"`
 	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
 }
 
 // TrainingExercise keeps information about an exercise in the training
 type TrainingExercise struct {
 	ID         string        `json:"id"`
+	ClientID   string        `json:"clientId,omitempty"`
 	ExerciseID string        `json:"exerciseId"`
 	StartTime  time.Time     `json:"startTime"`
 	EndTime    time.Time     `json:"endTime,omitempty"`
 	Sets       []TrainingSet `json:"sets"`
 	Comment    string        `json:"comment"`
 	CreatedAt  time.Time     `json:"createdAt"`
+	UpdatedAt  time.Time     `json:"updatedAt"`
 }
 
 // TrainingSet keeps information about a sets in the training
 type TrainingSet struct {
-	ID        string    `json:"id"`
-	Time      time.Time `json:"time"`
-	Reps      int       `json:"reps"`
+	ID       string    `json:"id"`
+	ClientID string    `json:"clientId,omitempty"`
+	Time     time.Time `json:"time"`
+	Reps     int       `json:"reps"`
+	// Load is the weight lifted in kilograms, it is zero for the body weight and time sets
+	Load      float64   `json:"load,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TrainingExportRow is a single set of the training in the exported training history
+type TrainingExportRow struct {
+	TrainingID        string    `json:"trainingId"`
+	TrainingStartTime time.Time `json:"trainingStartTime"`
+	TrainingEndTime   time.Time `json:"trainingEndTime,omitempty"`
+	ExerciseID        string    `json:"exerciseId"`
+	// ExerciseName is empty if the exercise no longer exists
+	ExerciseName string  `json:"exerciseName"`
+	SetUnit      SetUnit `json:"setUnit"`
+	// SetNumber is the position of the set in the training exercise, starting at 1
+	SetNumber int       `json:"setNumber"`
+	Reps      int       `json:"reps"`
+	Load      float64   `json:"load"`
+	SetTime   time.Time `json:"setTime"`
 }
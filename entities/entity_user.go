@@ -4,8 +4,35 @@ import "time"
 
 // User represents a person that uses the service
 type User struct {
-	ID           string    `json:"id"`
-	Username     string    `json:"userName"`
-	EmailAddress string    `json:"emailAddress"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID           string `json:"id"`
+	Username     string `json:"userName"`
+	EmailAddress string `json:"emailAddress"`
+	// EmailVerified is false until the user follows the link sent to the email address
+	EmailVerified bool `json:"emailVerified"`
+	// PendingEmailAddress replaces the EmailAddress once the user follows the link sent to it
+	PendingEmailAddress string `json:"pendingEmailAddress,omitempty"`
+	// TwoFactorEnabled requires the user to give TOTP code at login
+	TwoFactorEnabled bool `json:"twoFactorEnabled"`
+	Role             Role `json:"role"`
+	// Disabled accounts cannot log in
+	Disabled    bool            `json:"disabled"`
+	Preferences UserPreferences `json:"preferences"`
+	// DeletionScheduledAt is the time the account gets deleted at, nil if the deletion was not requested
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty"`
+	// CalendarFeedEnabled tells if the user's trainings can be subscribed to in the calendar apps
+	CalendarFeedEnabled bool      `json:"calendarFeedEnabled"`
+	CreatedAt           time.Time `json:"createdAt"`
+}
+
+// UserDataExport is everything stored about the user
+type UserDataExport struct {
+	Profile User `json:"profile"`
+	// Sessions are without their tokens
+	Sessions  []UserToken `json:"sessions"`
+	Exercises []Exercise  `json:"exercises"`
+	Trainings []Training  `json:"trainings"`
+	APIKeys   []APIKey    `json:"apiKeys"`
+	Imports   []ImportJob `json:"imports"`
+	// ExportedAt is the time the data were read at
+	ExportedAt time.Time `json:"exportedAt"`
 }
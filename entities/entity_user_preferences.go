@@ -0,0 +1,35 @@
+package entities
+
+// Theme is the look of the client app
+type Theme string
+
+const (
+	// ThemeSystem follows the setting of the user's device
+	ThemeSystem Theme = "system"
+	ThemeLight  Theme = "light"
+	ThemeDark   Theme = "dark"
+)
+
+// UnitSystem is the system of units the user sees the weights and distances in,
+// the stored values do not depend on it
+type UnitSystem string
+
+const (
+	UnitsMetric   UnitSystem = "metric"
+	UnitsImperial UnitSystem = "imperial"
+)
+
+// UserPreferences are the user's settings of the data presentation
+type UserPreferences struct {
+	Theme Theme `json:"theme"`
+	// Timezone is the IANA time zone name, eg. "Europe/Warsaw"
+	Timezone string     `json:"timezone"`
+	Units    UnitSystem `json:"units"`
+}
+
+// DefaultUserPreferences are the preferences of the user who has not set them
+var DefaultUserPreferences = UserPreferences{
+	Theme:    ThemeSystem,
+	Timezone: "UTC",
+	Units:    UnitsMetric,
+}
@@ -0,0 +1,114 @@
+package importers
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+// fitNotesDateLayout is the layout of the training day in the FitNotes export
+const fitNotesDateLayout = "2006-01-02"
+
+// FitNotesParser reads the "Export Workout Data" csv of the FitNotes app,
+// the app keeps only the day of the training so every day is imported as a single training
+type FitNotesParser struct{}
+
+func (p *FitNotesParser) Parse(
+	r io.Reader,
+	loc *time.Location,
+	units entities.UnitSystem) ([]entities.ImportedSet, []entities.ImportRowError, error) {
+	t, err := readTable(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = t.require("Date", "Exercise", "Reps")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the weight column is named after the unit the user has chosen in the app
+	weightCol := "Weight (kgs)"
+	units = entities.UnitsMetric
+	if !t.has(weightCol) {
+		weightCol = "Weight (lbs)"
+		units = entities.UnitsImperial
+		if !t.has(weightCol) {
+			return nil, nil, usecases.NewErrorInvalidImportFile(`missing column "Weight (kgs)"`)
+		}
+	}
+
+	var sets []entities.ImportedSet
+	var rowErrs []entities.ImportRowError
+	for i, rec := range t.records {
+		if isBlank(rec) {
+			continue
+		}
+
+		s, err := p.parseRecord(t, rec, loc, weightCol, units)
+		if err != nil {
+			rowErrs = append(rowErrs, entities.ImportRowError{Row: row(i), Error: err.Error()})
+			continue
+		}
+		s.Row = row(i)
+		sets = append(sets, *s)
+	}
+	return sets, rowErrs, nil
+}
+
+func (p *FitNotesParser) parseRecord(
+	t *table,
+	rec []string,
+	loc *time.Location,
+	weightCol string,
+	units entities.UnitSystem) (*entities.ImportedSet, error) {
+	day, err := parseTime(t.value(rec, "Date"), loc, fitNotesDateLayout)
+	if err != nil {
+		return nil, err
+	}
+
+	s := entities.ImportedSet{
+		TrainingStart: day,
+		ExerciseName:  t.value(rec, "Exercise"),
+	}
+
+	s.Load, err = parseLoad(t.value(rec, weightCol), units)
+	if err != nil {
+		return nil, err
+	}
+	s.Reps, err = parseWhole(t.value(rec, "Reps"))
+	if err != nil {
+		return nil, err
+	}
+	s.Seconds, err = parseFitNotesTime(t.value(rec, "Time"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, checkSet(&s)
+}
+
+// parseFitNotesTime parses the duration of the set like "1:30" or "0:01:30" to seconds
+func parseFitNotesTime(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	secs := 0
+	parts := strings.Split(v, ":")
+	if len(parts) > 3 {
+		return 0, errors.Errorf("invalid time %q", v)
+	}
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, errors.Errorf("invalid time %q", v)
+		}
+		secs = secs*60 + n
+	}
+	return secs, nil
+}
@@ -0,0 +1,97 @@
+package importers
+
+import (
+	"io"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+// hevyTimeLayouts are the layouts of the training times in the Hevy export
+var hevyTimeLayouts = []string{"2 Jan 2006, 15:04", "2006-01-02 15:04:05", time.RFC3339}
+
+// HevyParser reads the "Export Workouts" csv of the Hevy app
+type HevyParser struct{}
+
+func (p *HevyParser) Parse(
+	r io.Reader,
+	loc *time.Location,
+	units entities.UnitSystem) ([]entities.ImportedSet, []entities.ImportRowError, error) {
+	t, err := readTable(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = t.require("title", "start_time", "exercise_title", "reps")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the weight column is named after the unit the user has chosen in the app
+	weightCol := "weight_kg"
+	units = entities.UnitsMetric
+	if !t.has(weightCol) {
+		weightCol = "weight_lbs"
+		units = entities.UnitsImperial
+		if !t.has(weightCol) {
+			return nil, nil, usecases.NewErrorInvalidImportFile(`missing column "weight_kg"`)
+		}
+	}
+
+	var sets []entities.ImportedSet
+	var rowErrs []entities.ImportRowError
+	for i, rec := range t.records {
+		if isBlank(rec) {
+			continue
+		}
+
+		s, err := p.parseRecord(t, rec, loc, weightCol, units)
+		if err != nil {
+			rowErrs = append(rowErrs, entities.ImportRowError{Row: row(i), Error: err.Error()})
+			continue
+		}
+		s.Row = row(i)
+		sets = append(sets, *s)
+	}
+	return sets, rowErrs, nil
+}
+
+func (p *HevyParser) parseRecord(
+	t *table,
+	rec []string,
+	loc *time.Location,
+	weightCol string,
+	units entities.UnitSystem) (*entities.ImportedSet, error) {
+	start, err := parseTime(t.value(rec, "start_time"), loc, hevyTimeLayouts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := entities.ImportedSet{
+		TrainingStart: start,
+		TrainingName:  t.value(rec, "title"),
+		ExerciseName:  t.value(rec, "exercise_title"),
+	}
+
+	if v := t.value(rec, "end_time"); v != "" {
+		s.TrainingEnd, err = parseTime(v, loc, hevyTimeLayouts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.Load, err = parseLoad(t.value(rec, weightCol), units)
+	if err != nil {
+		return nil, err
+	}
+	s.Reps, err = parseWhole(t.value(rec, "reps"))
+	if err != nil {
+		return nil, err
+	}
+	s.Seconds, err = parseWhole(t.value(rec, "duration_seconds"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, checkSet(&s)
+}
@@ -0,0 +1,168 @@
+// Package importers reads the training logs exported as csv from the other workout apps
+package importers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+// kgPerLb is the number of kilograms in one pound
+const kgPerLb = 0.45359237
+
+// Parsers returns parsers of all of the supported apps
+func Parsers() map[entities.ImportSource]usecases.TrainingImportParser {
+	return map[entities.ImportSource]usecases.TrainingImportParser{
+		entities.ImportSourceStrong:   &StrongParser{},
+		entities.ImportSourceHevy:     &HevyParser{},
+		entities.ImportSourceFitNotes: &FitNotesParser{},
+	}
+}
+
+// table is the csv file with the columns found by the header names
+type table struct {
+	columns map[string]int
+	records [][]string
+}
+
+// readTable reads the whole csv file, the delimiter is either comma or semicolon,
+// whichever is more common in the header
+func readTable(r io.Reader) (*table, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, errors.WithMessage(err, "read file")
+	}
+	head = bytes.TrimPrefix(head, []byte("\ufeff"))
+	if i := bytes.IndexByte(head, '\n'); i != -1 {
+		head = head[:i]
+	}
+
+	cr := csv.NewReader(br)
+	if bytes.Count(head, []byte(";")) > bytes.Count(head, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, usecases.NewErrorInvalidImportFile(err.Error())
+	}
+	if len(records) == 0 {
+		return nil, usecases.NewErrorInvalidImportFile("the file is empty")
+	}
+
+	t := &table{
+		columns: make(map[string]int, len(records[0])),
+		records: records[1:],
+	}
+	for i, name := range records[0] {
+		name = strings.TrimPrefix(name, "\ufeff")
+		t.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return t, nil
+}
+
+// has tells if the file has the column
+func (t *table) has(name string) bool {
+	_, ok := t.columns[strings.ToLower(name)]
+	return ok
+}
+
+// require returns the error naming the first of the columns missing in the file
+func (t *table) require(names ...string) error {
+	for _, name := range names {
+		if !t.has(name) {
+			return usecases.NewErrorInvalidImportFile("missing column " + strconv.Quote(name))
+		}
+	}
+	return nil
+}
+
+// value returns the trimmed value of the column in the record, empty if there is no such column
+func (t *table) value(record []string, name string) string {
+	i, ok := t.columns[strings.ToLower(name)]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// row returns the number of the record in the file, the header is row 1
+func row(i int) int {
+	return i + 2
+}
+
+// isBlank tells if the record is an empty line
+func isBlank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNumber parses the decimal number, the decimal comma is accepted too, the empty value is 0
+func parseNumber(v string) (float64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, errors.Errorf("invalid number %q", v)
+	}
+	return f, nil
+}
+
+// parseWhole parses the number that is expected to be whole, eg. "8" or "8.0"
+func parseWhole(v string) (int, error) {
+	f, err := parseNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round(f)), nil
+}
+
+// parseLoad parses the weight and converts it to kilograms
+func parseLoad(v string, units entities.UnitSystem) (float64, error) {
+	w, err := parseNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	if units == entities.UnitsImperial {
+		w *= kgPerLb
+	}
+	return math.Round(w*1000) / 1000, nil
+}
+
+// parseTime parses the time in one of the layouts, the times without offset are in loc
+func parseTime(v string, loc *time.Location, layouts ...string) (time.Time, error) {
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, v, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("invalid time %q", v)
+}
+
+// checkSet returns the error if the set has nothing to import
+func checkSet(s *entities.ImportedSet) error {
+	if s.ExerciseName == "" {
+		return errors.New("missing exercise name")
+	}
+	if s.Reps == 0 && s.Seconds == 0 {
+		return errors.New("the set has neither reps nor time")
+	}
+	return nil
+}
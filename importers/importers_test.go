@@ -0,0 +1,120 @@
+package importers
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+var warsaw, _ = time.LoadLocation("Europe/Warsaw")
+
+func TestStrongParser(t *testing.T) {
+	file := "Date;Workout Name;Duration;Exercise Name;Set Order;Weight;Reps;Distance;Seconds;Notes;Workout Notes;RPE\n" +
+		"2021-03-14 10:05:12;Morning;1h 5m;Bench Press (Barbell);1;135;8;0;0;;;\n" +
+		"2021-03-14 10:05:12;Morning;1h 5m;Bench Press (Barbell);Rest Timer;0;0;0;90;;;\n" +
+		"2021-03-14 10:05:12;Morning;1h 5m;Plank;1;0;0;0;60;;;\n" +
+		"2021-03-14 10:05:12;Morning;1h 5m;Bench Press (Barbell);2;abc;8;0;0;;;\n"
+
+	sets, rowErrs, err := (&StrongParser{}).Parse(strings.NewReader(file), warsaw, entities.UnitsImperial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sets) != 2 {
+		t.Fatalf("want 2 sets, got %+v", sets)
+	}
+	wantStart := time.Date(2021, 3, 14, 10, 5, 12, 0, warsaw)
+	if !sets[0].TrainingStart.Equal(wantStart) {
+		t.Errorf("want training start %v, got %v", wantStart, sets[0].TrainingStart)
+	}
+	if want := wantStart.Add(65 * time.Minute); !sets[0].TrainingEnd.Equal(want) {
+		t.Errorf("want training end %v, got %v", want, sets[0].TrainingEnd)
+	}
+	if sets[0].Row != 2 || sets[0].ExerciseName != "Bench Press (Barbell)" || sets[0].Reps != 8 {
+		t.Errorf("want the bench press set from row 2, got %+v", sets[0])
+	}
+	if math.Abs(sets[0].Load-61.235) > 0.001 {
+		t.Errorf("want 135 lbs converted to kilograms, got %v", sets[0].Load)
+	}
+	if sets[1].Seconds != 60 || sets[1].Row != 4 {
+		t.Errorf("want the time set from row 4, got %+v", sets[1])
+	}
+
+	if len(rowErrs) != 1 || rowErrs[0].Row != 5 {
+		t.Errorf("want error of row 5, got %+v", rowErrs)
+	}
+}
+
+func TestHevyParser(t *testing.T) {
+	file := `"title","start_time","end_time","description","exercise_title","superset_id","exercise_notes","set_index","set_type","weight_lbs","reps","distance_miles","duration_seconds","rpe"
+"Push","14 Mar 2021, 10:05","14 Mar 2021, 11:10","","Bench Press (Barbell)","","","0","normal","100","10","","",""
+"Push","14 Mar 2021, 10:05","14 Mar 2021, 11:10","","","","","1","normal","100","10","","",""
+`
+
+	sets, rowErrs, err := (&HevyParser{}).Parse(strings.NewReader(file), time.UTC, entities.UnitsMetric)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sets) != 1 {
+		t.Fatalf("want 1 set, got %+v", sets)
+	}
+	if want := time.Date(2021, 3, 14, 11, 10, 0, 0, time.UTC); !sets[0].TrainingEnd.Equal(want) {
+		t.Errorf("want training end %v, got %v", want, sets[0].TrainingEnd)
+	}
+	if sets[0].TrainingName != "Push" || sets[0].Reps != 10 {
+		t.Errorf("want set of the Push training, got %+v", sets[0])
+	}
+	// the unit of the column wins over the given one
+	if math.Abs(sets[0].Load-45.359) > 0.001 {
+		t.Errorf("want 100 lbs converted to kilograms, got %v", sets[0].Load)
+	}
+
+	if len(rowErrs) != 1 || rowErrs[0].Row != 3 {
+		t.Errorf("want error of the row without exercise, got %+v", rowErrs)
+	}
+}
+
+func TestFitNotesParser(t *testing.T) {
+	file := "Date,Exercise,Category,Weight (kgs),Reps,Distance,Distance Unit,Time,Comment\n" +
+		"2021-03-14,Flat Barbell Bench Press,Chest,60.0,8,,,,\n" +
+		"2021-03-14,Plank,Abs,,,,,0:01:30,\n" +
+		"14/03/2021,Plank,Abs,,,,,0:01:30,\n"
+
+	sets, rowErrs, err := (&FitNotesParser{}).Parse(strings.NewReader(file), warsaw, entities.UnitsImperial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sets) != 2 {
+		t.Fatalf("want 2 sets, got %+v", sets)
+	}
+	wantStart := time.Date(2021, 3, 14, 0, 0, 0, 0, warsaw)
+	if !sets[0].TrainingStart.Equal(wantStart) || !sets[1].TrainingStart.Equal(wantStart) {
+		t.Errorf("want sets of the day %v, got %+v", wantStart, sets)
+	}
+	if sets[0].Load != 60 {
+		t.Errorf("want 60 kg, got %v", sets[0].Load)
+	}
+	if sets[1].Seconds != 90 {
+		t.Errorf("want 90 seconds, got %d", sets[1].Seconds)
+	}
+	if len(rowErrs) != 1 || rowErrs[0].Row != 4 {
+		t.Errorf("want error of the row with invalid date, got %+v", rowErrs)
+	}
+}
+
+func TestParseInvalidFile(t *testing.T) {
+	for source, p := range Parsers() {
+		_, _, err := p.Parse(strings.NewReader("foo,bar\n1,2\n"), time.UTC, entities.UnitsMetric)
+		var fileErr *usecases.InvalidImportFileError
+		if !errors.As(err, &fileErr) {
+			t.Errorf("%s: want InvalidImportFileError, got %v", source, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package importers
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// strongTimeLayouts are the layouts of the training start in the Strong export
+var strongTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// StrongParser reads the "Export Strong data" csv of the Strong app
+type StrongParser struct{}
+
+func (p *StrongParser) Parse(
+	r io.Reader,
+	loc *time.Location,
+	units entities.UnitSystem) ([]entities.ImportedSet, []entities.ImportRowError, error) {
+	t, err := readTable(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = t.require("Date", "Workout Name", "Exercise Name", "Weight", "Reps")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sets []entities.ImportedSet
+	var rowErrs []entities.ImportRowError
+	for i, rec := range t.records {
+		if isBlank(rec) {
+			continue
+		}
+		// the rest timers and the notes are kept as the rows between the sets
+		switch strings.ToLower(t.value(rec, "Set Order")) {
+		case "rest timer", "note":
+			continue
+		}
+
+		s, err := p.parseRecord(t, rec, loc, units)
+		if err != nil {
+			rowErrs = append(rowErrs, entities.ImportRowError{Row: row(i), Error: err.Error()})
+			continue
+		}
+		s.Row = row(i)
+		sets = append(sets, *s)
+	}
+	return sets, rowErrs, nil
+}
+
+func (p *StrongParser) parseRecord(
+	t *table,
+	rec []string,
+	loc *time.Location,
+	units entities.UnitSystem) (*entities.ImportedSet, error) {
+	start, err := parseTime(t.value(rec, "Date"), loc, strongTimeLayouts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := entities.ImportedSet{
+		TrainingStart: start,
+		TrainingName:  t.value(rec, "Workout Name"),
+		ExerciseName:  t.value(rec, "Exercise Name"),
+	}
+
+	if d := t.value(rec, "Duration"); d != "" {
+		duration, err := parseStrongDuration(d)
+		if err != nil {
+			return nil, err
+		}
+		if duration > 0 {
+			s.TrainingEnd = start.Add(duration)
+		}
+	}
+
+	// the older exports keep the unit of every set
+	switch strings.ToLower(t.value(rec, "Weight Unit")) {
+	case "kg", "kgs":
+		units = entities.UnitsMetric
+	case "lb", "lbs":
+		units = entities.UnitsImperial
+	}
+	s.Load, err = parseLoad(t.value(rec, "Weight"), units)
+	if err != nil {
+		return nil, err
+	}
+	s.Reps, err = parseWhole(t.value(rec, "Reps"))
+	if err != nil {
+		return nil, err
+	}
+	s.Seconds, err = parseWhole(t.value(rec, "Seconds"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, checkSet(&s)
+}
+
+// parseStrongDuration parses the training duration like "1h 5m", "45m" or number of seconds
+func parseStrongDuration(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+
+	var d time.Duration
+	for _, f := range strings.Fields(v) {
+		n, err := strconv.Atoi(f[:len(f)-1])
+		if err != nil || n < 0 {
+			return 0, errors.Errorf("invalid duration %q", v)
+		}
+		switch f[len(f)-1] {
+		case 'h':
+			d += time.Duration(n) * time.Hour
+		case 'm':
+			d += time.Duration(n) * time.Minute
+		case 's':
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, errors.Errorf("invalid duration %q", v)
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,129 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKSet is a set of the public keys in the JSON Web Key Set format
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns public keys of the asymmetric keys sorted by id,
+// shared secrets are never exposed
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		jwk := JWK{
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.Method.Alg(),
+		}
+
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+	return set
+}
+
+// Key creates the key from the public JWK, it can only verify tokens
+func (jwk JWK) Key() (*Key, error) {
+	if jwk.KeyID == "" {
+		return nil, errors.New("missing key id")
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return nil, errors.Errorf("key %q: unsupported use %q", jwk.KeyID, jwk.Use)
+	}
+
+	k := &Key{ID: jwk.KeyID}
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "key %q: modulus", jwk.KeyID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.Errorf("key %q: invalid exponent", jwk.KeyID)
+		}
+
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, errors.Errorf("key %q: RSA key must have at least %d bits", jwk.KeyID, minRSAKeyBits)
+		}
+		k.Method, k.verifyKey = jwt.SigningMethodRS256, pub
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if jwk.Curve != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("key %q: invalid Ed25519 key", jwk.KeyID)
+		}
+		k.Method, k.verifyKey = SigningMethodEdDSA, ed25519.PublicKey(x)
+	default:
+		return nil, errors.Errorf("key %q: unsupported key type %q", jwk.KeyID, jwk.KeyType)
+	}
+
+	if jwk.Algorithm != "" && jwk.Algorithm != k.Method.Alg() {
+		return nil, errors.Errorf("key %q: unsupported algorithm %q", jwk.KeyID, jwk.Algorithm)
+	}
+
+	return k, nil
+}
+
+// NewKeySetFromJWKS creates the key set that verifies tokens with the public keys,
+// eg. of the external identity provider, the keys of not supported types are skipped
+func NewKeySetFromJWKS(set JWKSet) (*KeySet, error) {
+	keys := make([]*Key, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		k, err := jwk.Key()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no supported keys in the key set")
+	}
+
+	return NewKeySet("", "", keys...)
+}
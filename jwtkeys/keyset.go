@@ -0,0 +1,205 @@
+// Package jwtkeys manages the keys used to sign and verify jwt,
+// it allows to rotate them without invalidating already issued tokens
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// minRSAKeyBits is the smallest accepted size of the RSA keys
+const minRSAKeyBits = 2048
+
+// Key is a single key identified by the "kid" header of the tokens
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// signKey is nil for keys that are only used to verify tokens
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign checks whether the key can be used to sign tokens
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// NewHMACKey creates HS256 key from the shared secret
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("missing key id")
+	}
+	if len(secret) == 0 {
+		return nil, errors.Errorf("key %q: empty secret", id)
+	}
+
+	return &Key{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}, nil
+}
+
+// ParsePEMKey creates RS256 or EdDSA key from the PEM encoded private or public key,
+// key created from the public key can only verify tokens
+func ParsePEMKey(id string, data []byte) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("missing key id")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("key %q: no PEM data found", id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.Errorf("key %q: unsupported PEM block type %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "key %q", id)
+	}
+
+	k := &Key{ID: id}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.Method, k.signKey, k.verifyKey = jwt.SigningMethodRS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.Method, k.verifyKey = jwt.SigningMethodRS256, key
+	case ed25519.PrivateKey:
+		k.Method, k.signKey, k.verifyKey = SigningMethodEdDSA, key, key.Public()
+	case ed25519.PublicKey:
+		k.Method, k.verifyKey = SigningMethodEdDSA, key
+	default:
+		return nil, errors.Errorf("key %q: unsupported key type %T", id, parsed)
+	}
+
+	if pub, ok := k.verifyKey.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSAKeyBits {
+		return nil, errors.Errorf("key %q: RSA key must have at least %d bits", id, minRSAKeyBits)
+	}
+
+	return k, nil
+}
+
+// LoadKeyFiles reads PEM keys from the files given as comma separated
+// list of "kid=path" pairs
+func LoadKeyFiles(spec string) ([]*Key, error) {
+	keys := []*Key{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid key file entry %q, want kid=path", entry)
+		}
+
+		data, err := os.ReadFile(parts[1])
+		if err != nil {
+			return nil, errors.WithMessagef(err, "key %q", parts[0])
+		}
+
+		k, err := ParsePEMKey(parts[0], data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// KeySet signs tokens with the active key and verifies them with any of its keys
+type KeySet struct {
+	active *Key
+	// legacy verifies tokens issued before the "kid" header was introduced
+	legacy *Key
+	keys   map[string]*Key
+}
+
+// NewKeySet creates the key set, the active key must be able to sign tokens,
+// the set with empty activeID can only verify tokens.
+// Tokens without "kid" header are verified by the legacy key or rejected if legacyID is empty.
+func NewKeySet(activeID, legacyID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{
+		keys: make(map[string]*Key, len(keys)),
+	}
+	for _, k := range keys {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, errors.Errorf("duplicated key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+
+	if activeID != "" {
+		ks.active = ks.keys[activeID]
+		if ks.active == nil {
+			return nil, errors.Errorf("active key %q not found", activeID)
+		}
+		if !ks.active.CanSign() {
+			return nil, errors.Errorf("active key %q cannot sign tokens", activeID)
+		}
+	}
+
+	if legacyID != "" {
+		ks.legacy = ks.keys[legacyID]
+		if ks.legacy == nil {
+			return nil, errors.Errorf("legacy key %q not found", legacyID)
+		}
+	}
+
+	return ks, nil
+}
+
+// Sign creates token signed with the active key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.active == nil {
+		return "", errors.New("no active key to sign the token")
+	}
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.signKey)
+}
+
+// Keyfunc returns the key to verify the token with, it is meant to be passed to the jwt.Parse functions
+func (ks *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	k := ks.legacy
+	if kid, ok := t.Header["kid"]; ok {
+		id, _ := kid.(string)
+		k = ks.keys[id]
+		if k == nil {
+			return nil, fmt.Errorf("unknown key id %v", kid)
+		}
+	}
+	if k == nil {
+		return nil, errors.New("missing key id")
+	}
+
+	// do not let the token choose the algorithm, eg. verify RSA public key as HMAC secret
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", t.Method.Alg(), k.ID)
+	}
+
+	return k.verifyKey, nil
+}
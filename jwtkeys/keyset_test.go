@@ -0,0 +1,304 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func newRSAPEM(t *testing.T, bits int) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+}
+
+func newEd25519PEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
+
+func mustHMACKey(t *testing.T, id string, secret string) *Key {
+	t.Helper()
+	k, err := NewHMACKey(id, []byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func mustPEMKey(t *testing.T, id string, data []byte) *Key {
+	t.Helper()
+	k, err := ParsePEMKey(id, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func newClaims() *jwt.StandardClaims {
+	return &jwt.StandardClaims{
+		Subject:   "6072d3206144644984a54fa1",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func parse(ks *KeySet, token string) error {
+	_, err := jwt.ParseWithClaims(token, &jwt.StandardClaims{}, ks.Keyfunc)
+	return err
+}
+
+func TestSignAndVerify(t *testing.T) {
+	edPriv, _ := newEd25519PEM(t)
+	keys := []*Key{
+		mustHMACKey(t, "hs", "the secretest secret"),
+		mustPEMKey(t, "rs", newRSAPEM(t, 2048)),
+		mustPEMKey(t, "ed", edPriv),
+	}
+
+	wantAlg := map[string]string{"hs": "HS256", "rs": "RS256", "ed": "EdDSA"}
+	for _, k := range keys {
+		t.Run(k.ID, func(t *testing.T) {
+			ks, err := NewKeySet(k.ID, "", keys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := ks.Sign(newClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, _, _ := new(jwt.Parser).ParseUnverified(token, &jwt.StandardClaims{})
+			if parsed.Header["kid"] != k.ID || parsed.Header["alg"] != wantAlg[k.ID] {
+				t.Errorf("want kid %q and alg %q, got %v", k.ID, wantAlg[k.ID], parsed.Header)
+			}
+
+			if err = parse(ks, token); err != nil {
+				t.Errorf("want valid token, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := mustHMACKey(t, "old", "the secretest secret")
+	edPriv, edPub := newEd25519PEM(t)
+	current := mustPEMKey(t, "current", edPriv)
+
+	before, err := NewKeySet(old.ID, old.ID, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	noKidToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims()).SignedString([]byte("the secretest secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewKeySet(current.ID, old.ID, old, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = parse(after, oldToken); err != nil {
+		t.Errorf("want token signed with the previous key to be valid, got %v", err)
+	}
+	if err = parse(after, noKidToken); err != nil {
+		t.Errorf("want token without kid to be verified with the legacy key, got %v", err)
+	}
+
+	newToken, err := after.Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// other service knowing only the public key
+	publicOnly := mustPEMKey(t, current.ID, edPub)
+	if publicOnly.CanSign() {
+		t.Errorf("want key from the public PEM to not sign tokens")
+	}
+	_, err = NewKeySet(publicOnly.ID, "", publicOnly)
+	if err == nil {
+		t.Errorf("want error for the active key that cannot sign")
+	}
+
+	verifier, err := NewKeySet("", "", publicOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = parse(verifier, newToken); err != nil {
+		t.Errorf("want valid token, got %v", err)
+	}
+	if err = parse(verifier, oldToken); err == nil {
+		t.Errorf("want token signed with the unknown key to be rejected")
+	}
+	if err = parse(verifier, noKidToken); err == nil {
+		t.Errorf("want token without kid to be rejected when there is no legacy key")
+	}
+	if _, err = verifier.Sign(newClaims()); err == nil {
+		t.Errorf("want error when signing with verify only key set")
+	}
+}
+
+func TestKeyfuncRejects(t *testing.T) {
+	rsaPEM := newRSAPEM(t, 2048)
+	rs := mustPEMKey(t, "rs", rsaPEM)
+	ks, err := NewKeySet(rs.ID, "", rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims())
+	unknown.Header["kid"] = "unknown"
+	unknownToken, _ := unknown.SignedString([]byte("the secretest secret"))
+
+	// HS256 token "signed" with the public key of the RSA key
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims())
+	confused.Header["kid"] = rs.ID
+	pubDER := x509.MarshalPKCS1PublicKey(rs.verifyKey.(*rsa.PublicKey))
+	confusedToken, _ := confused.SignedString(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: pubDER}))
+
+	for desc, token := range map[string]string{
+		"unknown kid":         unknownToken,
+		"algorithm confusion": confusedToken,
+	} {
+		if err = parse(ks, token); err == nil {
+			t.Errorf("%s: want error, got nil", desc)
+		}
+	}
+}
+
+func TestParsePEMKeyErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data []byte
+	}{
+		{desc: "not a PEM", data: []byte("secret")},
+		{desc: "too small RSA key", data: newRSAPEM(t, 1024)},
+		{desc: "unsupported block", data: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}})},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := ParsePEMKey("k", tC.data)
+			if err == nil {
+				t.Errorf("want error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoadKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	edPriv, _ := newEd25519PEM(t)
+	path := filepath.Join(dir, "ed.pem")
+	err := os.WriteFile(path, edPriv, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadKeyFiles(" ed=" + path + ", ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != "ed" || keys[0].Method != SigningMethodEdDSA {
+		t.Errorf("want one EdDSA key %q, got %v", "ed", keys)
+	}
+
+	for _, spec := range []string{"ed", "=" + path, "ed=" + filepath.Join(dir, "missing.pem")} {
+		_, err = LoadKeyFiles(spec)
+		if err == nil {
+			t.Errorf("want error for %q, got nil", spec)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	edPriv, _ := newEd25519PEM(t)
+	ks, err := NewKeySet("hs", "",
+		mustHMACKey(t, "hs", "the secretest secret"),
+		mustPEMKey(t, "rs", newRSAPEM(t, 2048)),
+		mustPEMKey(t, "ed", edPriv),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := ks.JWKS().Keys
+	if len(got) != 2 {
+		t.Fatalf("want only public keys of %d asymmetric keys, got %v", 2, got)
+	}
+	if got[0].KeyID != "ed" || got[0].KeyType != "OKP" || got[0].Curve != "Ed25519" || got[0].X == "" {
+		t.Errorf("want Ed25519 key, got %+v", got[0])
+	}
+	if got[1].KeyID != "rs" || got[1].KeyType != "RSA" || got[1].N == "" || got[1].E != "AQAB" {
+		t.Errorf("want RSA key, got %+v", got[1])
+	}
+}
+
+func TestNewKeySetFromJWKS(t *testing.T) {
+	edPriv, _ := newEd25519PEM(t)
+	signer, err := NewKeySet("rs", "",
+		mustPEMKey(t, "rs", newRSAPEM(t, 2048)),
+		mustPEMKey(t, "ed", edPriv),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := signer.JWKS()
+	set.Keys = append(set.Keys, JWK{KeyID: "ec", KeyType: "EC", Use: "sig"})
+	verifier, err := NewKeySetFromJWKS(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signer.Sign(&jwt.StandardClaims{Subject: "someone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &jwt.StandardClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, verifier.Keyfunc)
+	if err != nil || claims.Subject != "someone" {
+		t.Errorf("want token verified with the public key, got %v, %+v", err, claims)
+	}
+
+	if _, err = verifier.Sign(&jwt.StandardClaims{}); err == nil {
+		t.Errorf("want key set from JWKS to be unable to sign")
+	}
+
+	_, err = NewKeySetFromJWKS(JWKSet{Keys: []JWK{{KeyID: "ec", KeyType: "EC"}}})
+	if err == nil {
+		t.Errorf("want error for key set without supported keys")
+	}
+}
@@ -1,21 +1,55 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	nethttp "net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/rs/zerolog"
 	"github.com/unnamedxaer/gymm-api/endpoints/http"
+	"github.com/unnamedxaer/gymm-api/importers"
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
 	"github.com/unnamedxaer/gymm-api/mailer"
+	"github.com/unnamedxaer/gymm-api/oidc"
 	"github.com/unnamedxaer/gymm-api/repositories"
+	"github.com/unnamedxaer/gymm-api/repositories/apikeys"
+	"github.com/unnamedxaer/gymm-api/repositories/audit"
 	"github.com/unnamedxaer/gymm-api/repositories/auth"
 	"github.com/unnamedxaer/gymm-api/repositories/exercises"
+	"github.com/unnamedxaer/gymm-api/repositories/idempotency"
+	"github.com/unnamedxaer/gymm-api/repositories/imports"
 	"github.com/unnamedxaer/gymm-api/repositories/trainings"
 	"github.com/unnamedxaer/gymm-api/repositories/users"
+	"github.com/unnamedxaer/gymm-api/scheduler"
+	"github.com/unnamedxaer/gymm-api/totp"
+	"github.com/unnamedxaer/gymm-api/usecases"
 	"github.com/unnamedxaer/gymm-api/validation"
 )
 
+const (
+	// abandonedTrainingsCheckInterval is how often the trainings with no activity are looked for
+	abandonedTrainingsCheckInterval = 15 * time.Minute
+	// expiredAuthDataCleanupInterval is how often the expired tokens and reset password requests are removed
+	expiredAuthDataCleanupInterval = time.Hour
+	// scheduledAccountsDeletionInterval is how often the accounts whose grace period has passed are deleted
+	scheduledAccountsDeletionInterval = time.Hour
+	// importsProcessingInterval is how often the committed imports are started and the interrupted ones resumed
+	importsProcessingInterval = time.Minute
+	// shutdownTimeout is a time given to the server and background jobs to finish their work
+	shutdownTimeout = 30 * time.Second
+	// oidcRequestTimeout limits the requests to the OpenID Connect providers
+	oidcRequestTimeout = 10 * time.Second
+)
+
 func main() {
 	logger := zerolog.New(os.Stdout)
 	logger.Info().Msg(time.Now().Local().String() + "-> App starts, env = " + os.Getenv("ENV"))
@@ -33,9 +67,47 @@ func main() {
 	if mongoURI == "" {
 		panic("environment variable 'MONGO_URI' is not set")
 	}
-	jwtKey := []byte(os.Getenv("JWT_KEY"))
-	if len(jwtKey) < 10 {
-		panic("environment variable 'JWT_KEY' is not set or is too short")
+	jwtKeys, err := loadJWTKeys()
+	if err != nil {
+		panic(err)
+	}
+	secretCipher, err := loadSecretCipher()
+	if err != nil {
+		panic(err)
+	}
+	if secretCipher == nil {
+		logger.Warn().Msg("environment variable 'TOTP_ENCRYPTION_KEY' is not set, two-factor authentication cannot be set up")
+	}
+	bcryptCost, err := getEnvInt("BCRYPT_COST", usecases.DefaultBcryptCost)
+	if err != nil {
+		panic(err)
+	}
+	passwordHasher, err := usecases.NewBcryptHasher(bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+	oidcProviders := loadOIDCProviders(&logger)
+	abandonedTrainingAfter, err := getEnvDuration("ABANDONED_TRAINING_AFTER", 12*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	abandonedTrainingNotify, err := getEnvBool("ABANDONED_TRAINING_NOTIFY", false)
+	if err != nil {
+		panic(err)
+	}
+	expiredAuthDataRetention, err := getEnvDuration("EXPIRED_AUTH_DATA_RETENTION", 7*24*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+
+	accountDeletionGracePeriod, err := getEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", usecases.DefaultAccountDeletionGracePeriod)
+	if err != nil {
+		panic(err)
+	}
+
+	trustedProxies, err := trustedProxyNetworks()
+	if err != nil {
+		panic(err)
 	}
 
 	db, err := repositories.GetDatabase(&logger, mongoURI, dbName)
@@ -51,9 +123,10 @@ func main() {
 	tokensCol := repositories.GetCollection(&logger, db, repositories.TokensCollectionName)
 	refTokensCol := repositories.GetCollection(&logger, db, repositories.RefreshTokensCollectionName)
 	resPwdReqsCol := repositories.GetCollection(&logger, db, repositories.ResPwdReqCollectionName)
+	loginAttemptsCol := repositories.GetCollection(&logger, db, repositories.LoginAttemptsCollectionName)
 	usersRepo := users.NewRepository(&logger, usersCol)
 
-	authRepo := auth.NewRepository(&logger, usersCol, tokensCol, refTokensCol, resPwdReqsCol)
+	authRepo := auth.NewRepository(&logger, usersCol, tokensCol, refTokensCol, resPwdReqsCol, loginAttemptsCol)
 
 	exercisesCol := repositories.GetCollection(&logger, db, repositories.ExercisesCollectionName)
 	exercisesRepo := exercises.NewRepository(&logger, exercisesCol)
@@ -61,6 +134,25 @@ func main() {
 	trainingsCol := repositories.GetCollection(&logger, db, repositories.TrainingsCollectionName)
 	trainingsRepo := trainings.NewRepository(&logger, trainingsCol)
 
+	idempotencyCol := repositories.GetCollection(&logger, db, repositories.IdempotencyCollectionName)
+	idempotencyRepo := idempotency.NewRepository(&logger, idempotencyCol)
+
+	apiKeysCol := repositories.GetCollection(&logger, db, repositories.APIKeysCollectionName)
+	apiKeysRepo := apikeys.NewRepository(&logger, apiKeysCol)
+
+	auditEventsCol := repositories.GetCollection(&logger, db, repositories.AuditEventsCollectionName)
+	auditRepo := audit.NewRepository(&logger, auditEventsCol)
+
+	importJobsCol := repositories.GetCollection(&logger, db, repositories.ImportJobsCollectionName)
+	importRepo := imports.NewRepository(&logger, importJobsCol)
+	importParsers := importers.Parsers()
+
+	err = usecases.NewAdminUsecases(&logger, usersRepo, authRepo, auditRepo).
+		GrantAdminRole(context.Background(), adminEmailAddresses())
+	if err != nil {
+		logger.Panic().Msg(err.Error())
+	}
+
 	validate := validation.New()
 
 	mailer := mailer.NewMailer(&logger, func(err error) {
@@ -73,12 +165,304 @@ func main() {
 		usersRepo,
 		exercisesRepo,
 		trainingsRepo,
+		idempotencyRepo,
+		apiKeysRepo,
+		auditRepo,
+		importRepo,
 		validate,
-		jwtKey,
+		jwtKeys,
+		secretCipher,
+		passwordHasher,
+		oidcProviders,
+		importParsers,
 		mailer,
+		accountDeletionGracePeriod,
+		trustedProxies,
 	)
 
 	app.AddHandlers()
 
-	app.Run("localhost:" + os.Getenv("PORT"))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var notifyMailer usecases.Mailer
+	if abandonedTrainingNotify {
+		notifyMailer = mailer
+	}
+	jobs := scheduler.NewScheduler(&logger)
+	err = jobs.Add(
+		"close abandoned trainings",
+		abandonedTrainingsCheckInterval,
+		usecases.NewCloseAbandonedTrainingsJob(
+			&logger,
+			usecases.NewTrainingUseCases(trainingsRepo, exercisesRepo),
+			usersRepo,
+			notifyMailer,
+			abandonedTrainingAfter,
+		),
+	)
+	if err != nil {
+		logger.Panic().Msg(err.Error())
+	}
+	err = jobs.Add(
+		"cleanup expired auth data",
+		expiredAuthDataCleanupInterval,
+		usecases.NewCleanupExpiredAuthDataJob(
+			&logger,
+			authRepo,
+			expiredAuthDataRetention,
+			&usecases.AuthCleanupMetrics{},
+		),
+	)
+	if err != nil {
+		logger.Panic().Msg(err.Error())
+	}
+	err = jobs.Add(
+		"delete scheduled accounts",
+		scheduledAccountsDeletionInterval,
+		usecases.NewDeleteScheduledAccountsJob(
+			&logger,
+			usecases.NewAccountUsecases(
+				&logger,
+				usersRepo,
+				authRepo,
+				exercisesRepo,
+				trainingsRepo,
+				apiKeysRepo,
+				importRepo,
+				auditRepo,
+				accountDeletionGracePeriod,
+			),
+		),
+	)
+	if err != nil {
+		logger.Panic().Msg(err.Error())
+	}
+	err = jobs.Add(
+		"process imports",
+		importsProcessingInterval,
+		usecases.NewProcessImportsJob(
+			&logger,
+			usecases.NewTrainingImportUsecases(
+				&logger,
+				importRepo,
+				trainingsRepo,
+				exercisesRepo,
+				auditRepo,
+				importParsers,
+			),
+		),
+	)
+	if err != nil {
+		logger.Panic().Msg(err.Error())
+	}
+	jobs.Start()
+
+	go func() {
+		app.Run("localhost:" + os.Getenv("PORT"))
+		// the server failed, there is nothing to wait for
+		stop()
+	}()
+
+	<-ctx.Done()
+	logger.Info().Msg("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err = app.Shutdown(shutdownCtx); err != nil {
+		logger.Err(err).Send()
+	}
+	if err = jobs.Stop(shutdownCtx); err != nil {
+		logger.Err(err).Send()
+	}
+}
+
+// getEnvDuration reads the duration (e.g. "90m") from the environment variable,
+// def is returned if the variable is not set
+func getEnvDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("environment variable %q has invalid duration: %q", name, v)
+	}
+	return d, nil
+}
+
+// getEnvBool reads the bool from the environment variable,
+// def is returned if the variable is not set
+func getEnvBool(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("environment variable %q has invalid bool value: %q", name, v)
+	}
+	return b, nil
+}
+
+// getEnvInt reads the int from the environment variable,
+// def is returned if the variable is not set
+func getEnvInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("environment variable %q has invalid int value: %q", name, v)
+	}
+	return i, nil
+}
+
+// loadJWTKeys creates the jwt key set from the HS256 secret in JWT_KEY
+// and PEM keys listed in JWT_KEY_FILES as "kid=path" pairs,
+// JWT_ACTIVE_KEY chooses the key used to sign new tokens
+func loadJWTKeys() (*jwtkeys.KeySet, error) {
+	keys := []*jwtkeys.Key{}
+	activeID := os.Getenv("JWT_ACTIVE_KEY")
+	legacyID := ""
+
+	if secret := os.Getenv("JWT_KEY"); secret != "" {
+		if len(secret) < 10 {
+			return nil, fmt.Errorf("environment variable 'JWT_KEY' is too short")
+		}
+		id := os.Getenv("JWT_KEY_ID")
+		if id == "" {
+			id = "default"
+		}
+		k, err := jwtkeys.NewHMACKey(id, []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		// tokens issued before the key ids were introduced are signed with this secret
+		legacyID = id
+		if activeID == "" {
+			activeID = id
+		}
+	}
+
+	fileKeys, err := jwtkeys.LoadKeyFiles(os.Getenv("JWT_KEY_FILES"))
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, fileKeys...)
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("environment variable 'JWT_KEY' or 'JWT_KEY_FILES' is not set")
+	}
+	if activeID == "" {
+		activeID = keys[0].ID
+	}
+
+	return jwtkeys.NewKeySet(activeID, legacyID, keys...)
+}
+
+// loadSecretCipher creates the cipher of the two-factor secrets from the base64 encoded,
+// 32 bytes long key in TOTP_ENCRYPTION_KEY, it returns nil if the variable is not set
+func loadSecretCipher() (usecases.SecretCipher, error) {
+	v := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if v == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("environment variable 'TOTP_ENCRYPTION_KEY' is not valid base64")
+	}
+
+	c, err := totp.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// adminEmailAddresses returns the comma separated email addresses from ADMIN_EMAILS,
+// the users with these addresses are made admins at the start
+func adminEmailAddresses() []string {
+	addresses := []string{}
+	for _, address := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// trustedProxyNetworks reads the comma separated IP addresses and CIDR ranges
+// of the reverse proxies from TRUSTED_PROXIES, only these proxies can set the X-Forwarded-For header
+func trustedProxyNetworks() ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, v := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("environment variable %q has invalid IP address: %q", "TRUSTED_PROXIES", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("environment variable %q has invalid CIDR range: %q", "TRUSTED_PROXIES", v)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// loadOIDCProviders discovers the OpenID Connect providers listed in OIDC_PROVIDERS by their names,
+// every provider is configured by OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET
+// and OIDC_<NAME>_REDIRECT_URL, the provider that cannot be discovered is skipped
+func loadOIDCProviders(logger *zerolog.Logger) []*oidc.Provider {
+	providers := []*oidc.Provider{}
+	client := &nethttp.Client{Timeout: oidcRequestTimeout}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		cfg := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+		p, err := oidc.Discover(ctx, client, cfg)
+		cancel()
+		if err != nil {
+			logger.Error().Err(err).Msgf("OpenID Connect provider %q skipped", name)
+			continue
+		}
+		providers = append(providers, p)
+	}
+
+	return providers
 }
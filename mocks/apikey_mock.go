@@ -0,0 +1,105 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MockAPIKeyRepo keeps the keys in memory,
+// the zero value is ready to use
+type MockAPIKeyRepo struct {
+	mu sync.Mutex
+	// keys are the API keys by their hashes
+	keys map[string]*entities.APIKey
+}
+
+func (r *MockAPIKeyRepo) CreateAPIKey(
+	ctx context.Context,
+	key *entities.APIKey,
+	keyHash string) (*entities.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.keys == nil {
+		r.keys = make(map[string]*entities.APIKey)
+	}
+
+	if _, ok := r.keys[keyHash]; ok {
+		return nil, mongo.WriteException{
+			WriteErrors: []mongo.WriteError{{Code: 11000, Message: "duplicate key"}},
+		}
+	}
+
+	stored := *key
+	stored.ID = primitive.NewObjectID().Hex()
+	stored.Key = ""
+	r.keys[keyHash] = &stored
+
+	out := stored
+	return &out, nil
+}
+
+func (r *MockAPIKeyRepo) GetAPIKeys(
+	ctx context.Context,
+	userID string) ([]entities.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []entities.APIKey{}
+	for _, k := range r.keys {
+		if k.UserID == userID {
+			keys = append(keys, *k)
+		}
+	}
+	return keys, nil
+}
+
+func (r *MockAPIKeyRepo) GetAPIKeyByHash(
+	ctx context.Context,
+	keyHash string) (*entities.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[keyHash]
+	if !ok {
+		return nil, nil
+	}
+	out := *k
+	return &out, nil
+}
+
+func (r *MockAPIKeyRepo) DeleteAPIKey(
+	ctx context.Context,
+	userID string,
+	keyID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, k := range r.keys {
+		if k.ID == keyID && k.UserID == userID {
+			delete(r.keys, hash)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (r *MockAPIKeyRepo) UpdateAPIKeyLastUsed(
+	ctx context.Context,
+	keyID string,
+	usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.ID == keyID {
+			k.LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package mocks
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockAuditRepo keeps the events in memory,
+// the zero value is ready to use
+type MockAuditRepo struct {
+	mu     sync.Mutex
+	events []entities.AuditEvent
+}
+
+func (r *MockAuditRepo) InsertAuditEvent(
+	ctx context.Context,
+	event *entities.AuditEvent) (*entities.AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *event
+	stored.ID = primitive.NewObjectID().Hex()
+	r.events = append(r.events, stored)
+
+	out := stored
+	return &out, nil
+}
+
+func (r *MockAuditRepo) GetAuditEvents(
+	ctx context.Context,
+	userID string,
+	actions []entities.AuditAction,
+	beforeID string,
+	limit int64) ([]entities.AuditEvent, error) {
+	if strings.Contains(beforeID, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(beforeID, "audit event")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []entities.AuditEvent{}
+	// the newest first
+	for i := len(r.events) - 1; i >= 0 && int64(len(events)) < limit; i-- {
+		e := r.events[i]
+		if beforeID != "" && e.ID >= beforeID {
+			continue
+		}
+		for _, a := range actions {
+			if e.UserID == userID && e.Action == a {
+				events = append(events, e)
+				break
+			}
+		}
+	}
+	return events, nil
+}
+
+// Events returns copy of the stored events in the order they were inserted
+func (r *MockAuditRepo) Events() []entities.AuditEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]entities.AuditEvent(nil), r.events...)
+}
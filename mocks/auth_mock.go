@@ -2,7 +2,10 @@ package mocks
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/unnamedxaer/gymm-api/entities"
@@ -33,10 +36,36 @@ var (
 		Status:       entities.ResetPwdStatusNoActionYet,
 		ExpiresAt:    Now.Add(time.Minute * 15),
 		CreatedAt:    Now,
+		Token:        "n3Kq8Yb1y0pZ5Cw2Vd7Xg4Rt6Ls9Hm0Jf3Ae1Uk8Qo",
 	}
 )
 
-type MockAuthRepo struct{}
+// MockAuthRepo keeps refresh tokens in memory to allow testing their rotation,
+// the zero value is ready to use
+type MockAuthRepo struct {
+	mu sync.Mutex
+	// jwts are the saved jwt tokens by their value
+	jwts map[string]entities.UserToken
+	// refreshTokens are the token families by the user ID and device
+	refreshTokens map[[2]string]*mockRefreshTokenFamily
+	// emailVerifications are the hashed email verification tokens by the user ID
+	emailVerifications map[string]string
+	// emailChanges are the pending email addresses and their hashed tokens by the user ID
+	emailChanges map[string][2]string
+	// twoFactors are the two-factor states by the user ID
+	twoFactors map[string]*entities.TwoFactor
+	// loginAttempts are the failed login attempts by the key
+	loginAttempts map[string]*entities.LoginAttempts
+	// resetPwdReqs are the reset password requests by the token hash
+	resetPwdReqs map[string]*entities.ResetPwdReq
+	// externalIdentities are the linked user IDs by the issuer and subject
+	externalIdentities map[[2]string]string
+}
+
+type mockRefreshTokenFamily struct {
+	rt   entities.RefreshToken
+	used []string
+}
 
 func (r *MockAuthRepo) GetUserByEmailAddress(
 	ctx context.Context,
@@ -50,10 +79,21 @@ func (r *MockAuthRepo) GetUserByEmailAddress(
 		return nil, err
 	}
 
-	return &entities.AuthUser{
-		User:     ExampleUser,
+	u := ExampleUser
+	u.EmailVerified = !strings.Contains(emailAddress, "unverified")
+	if strings.Contains(emailAddress, "twofactor") {
+		u.ID = TwoFactorUserID
+		u.EmailAddress = emailAddress
+	}
+	if strings.Contains(emailAddress, "disabled") {
+		u.ID = DisabledUserID
+		u.EmailAddress = emailAddress
+		u.Disabled = true
+	}
+	return r.withTwoFactor(&entities.AuthUser{
+		User:     u,
 		Password: pwd,
-	}, nil
+	}), nil
 }
 
 func (r *MockAuthRepo) GetUserByID(ctx context.Context, id string) (*entities.AuthUser, error) {
@@ -67,10 +107,17 @@ func (r *MockAuthRepo) GetUserByID(ctx context.Context, id string) (*entities.Au
 		return nil, err
 	}
 
-	return &entities.AuthUser{
-		User:     ExampleUser,
+	u := ExampleUser
+	u.ID = id
+	r.mu.Lock()
+	_, pending := r.emailVerifications[id]
+	r.mu.Unlock()
+	u.EmailVerified = !pending && !strings.Contains(id, "unverified")
+	u.Disabled = id == DisabledUserID
+	return r.withTwoFactor(&entities.AuthUser{
+		User:     u,
 		Password: pwd,
-	}, nil
+	}), nil
 }
 
 func (r *MockAuthRepo) ChangePassword(
@@ -80,35 +127,91 @@ func (r *MockAuthRepo) ChangePassword(
 	return nil
 }
 
+func (r *MockAuthRepo) ReplacePasswordHash(
+	ctx context.Context,
+	userID string,
+	oldHash,
+	newHash []byte) (bool, error) {
+	return true, nil
+}
+
 func (r *MockAuthRepo) AddResetPasswordRequest(
 	ctx context.Context,
 	emailaddress string,
+	tokenHash string,
 	expiresAt time.Time) (*entities.ResetPwdReq, error) {
 
-	if len(emailaddress) == 0 || strings.Contains(emailaddress, "notfound") {
+	if len(emailaddress) == 0 ||
+		strings.Contains(emailaddress, "notfound") ||
+		strings.Contains(emailaddress, "unverified") {
 		return nil, usecases.NewErrorRecordNotExists("user")
 	}
 
 	out := ExampleResetPwdReq
 	out.EmailAddress = emailaddress
 	out.ExpiresAt = expiresAt
+	out.CreatedAt = time.Now()
+	out.Token = ""
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resetPwdReqs == nil {
+		r.resetPwdReqs = make(map[string]*entities.ResetPwdReq)
+	}
+	stored := out
+	r.resetPwdReqs[tokenHash] = &stored
+
 	return &out, nil
 }
 
+func (r *MockAuthRepo) CountResetPasswordRequests(
+	ctx context.Context,
+	emailaddress string,
+	since time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, req := range r.resetPwdReqs {
+		if strings.EqualFold(req.EmailAddress, emailaddress) && !req.CreatedAt.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// UpdatePasswordForResetRequest accepts the token of ExampleResetPwdReq
+// and the tokens of the requests added before
 func (r *MockAuthRepo) UpdatePasswordForResetRequest(
 	ctx context.Context,
-	reqID string,
-	pwdHash []byte) error {
+	tokenHash string,
+	pwdHash []byte) (*entities.User, error) {
 
-	if strings.Contains(reqID, "notfound") {
-		return usecases.NewErrorRecordNotExists("reset password request")
+	if len(tokenHash) == 0 {
+		return nil, usecases.NewErrorInvalidID(tokenHash, "reset password request")
 	}
 
-	if len(reqID) == 0 {
-		return usecases.NewErrorInvalidID(reqID, "reset password request")
+	u := ExampleUser
+	if tokenHash == hashMockToken(ExampleResetPwdReq.Token) {
+		u.ID = ResetPwdUserID
+		return &u, nil
 	}
 
-	return nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	req, ok := r.resetPwdReqs[tokenHash]
+	if !ok || req.Status != entities.ResetPwdStatusNoActionYet || req.ExpiresAt.Before(time.Now()) {
+		return nil, usecases.NewErrorRecordNotExists("reset password request")
+	}
+	req.Status = entities.ResetPwdStatusCompleted
+
+	u.EmailAddress = req.EmailAddress
+	return &u, nil
+}
+
+// hashMockToken hashes the token the same way as the usecases do
+func hashMockToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func (r *MockAuthRepo) GetUserJWTs(
@@ -131,7 +234,7 @@ func (r *MockAuthRepo) GetUserJWTs(
 		expirationTime = time.Now().AddDate(0, 0, -1)
 	}
 
-	return []entities.UserToken{
+	tokens := []entities.UserToken{
 		{
 			ID:        ExampleUser.ID,
 			UserID:    userID,
@@ -140,7 +243,17 @@ func (r *MockAuthRepo) GetUserJWTs(
 			CreatedAt: ExampleUserToken.CreatedAt,
 			ExpiresAt: expirationTime,
 		},
-	}, nil
+	}
+
+	// the saved tokens follow the example one, so their sessions can be found
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ut := range r.jwts {
+		if ut.UserID == userID {
+			tokens = append(tokens, ut)
+		}
+	}
+	return tokens, nil
 }
 
 func (r *MockAuthRepo) SaveJWT(
@@ -158,38 +271,114 @@ func (r *MockAuthRepo) SaveJWT(
 		ExpiresAt: expiresAt,
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.jwts == nil {
+		r.jwts = make(map[string]entities.UserToken)
+	}
+	r.jwts[token] = *out
+
 	return out, nil
 }
 
+func (r *MockAuthRepo) IsJWTStored(
+	ctx context.Context,
+	userID string,
+	token string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ut, ok := r.jwts[token]
+	return ok && ut.UserID == userID, nil
+}
+
 func (r *MockAuthRepo) DeleteJWT(
 	ctx context.Context,
 	token *entities.UserToken) (int64, error) {
+	// the saved tokens share the example ID, so they are removed only by their value or device
+	if token.Token == "" && token.Device == "" {
+		return 1, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, ut := range r.jwts {
+		if (token.Token == "" || token.Token == ut.Token) &&
+			(token.Device == "" || token.Device == ut.Device) &&
+			(token.UserID == "" || token.UserID == ut.UserID) {
+			delete(r.jwts, k)
+		}
+	}
 
 	return 1, nil
 }
 
+// deleteUserJWTs removes the saved jwt tokens of the user, the caller holds the lock
+func (r *MockAuthRepo) deleteUserJWTs(userID string) {
+	for k, ut := range r.jwts {
+		if ut.UserID == userID {
+			delete(r.jwts, k)
+		}
+	}
+}
+
 func (r *MockAuthRepo) SaveRefreshToken(
 	ctx context.Context,
 	userID string,
+	device string,
 	token string,
+	previous string,
 	expiresAt time.Time) (*entities.RefreshToken, error) {
-	out := &entities.RefreshToken{
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refreshTokens == nil {
+		r.refreshTokens = make(map[[2]string]*mockRefreshTokenFamily)
+	}
+
+	var f *mockRefreshTokenFamily
+	if previous == "" {
+		f = &mockRefreshTokenFamily{}
+		r.refreshTokens[[2]string{userID, device}] = f
+	} else {
+		for k, family := range r.refreshTokens {
+			if k[0] == userID && family.rt.Token == previous {
+				f = family
+				device = k[1]
+			}
+		}
+		if f == nil || !f.rt.ExpiresAt.After(time.Now()) {
+			return nil, nil
+		}
+		f.used = append(f.used, previous)
+	}
+
+	f.rt = entities.RefreshToken{
 		ID:        ExampleRefreshToken.ID,
 		UserID:    userID,
+		Device:    device,
 		Token:     token,
-		CreatedAt: ExampleRefreshToken.CreatedAt,
+		CreatedAt: time.Now(),
 		ExpiresAt: expiresAt,
 	}
 
-	return out, nil
+	out := f.rt
+	return &out, nil
 }
 
 func (r *MockAuthRepo) GetRefreshToken(
 	ctx context.Context,
-	userID string) (*entities.RefreshToken, error) {
+	userID string,
+	device string) (*entities.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.refreshTokens[[2]string{userID, device}]; ok {
+		out := f.rt
+		return &out, nil
+	}
+
 	out := &entities.RefreshToken{
 		ID:        ExampleRefreshToken.ID,
 		UserID:    userID,
+		Device:    device,
 		Token:     ExampleRefreshToken.Token,
 		CreatedAt: ExampleRefreshToken.CreatedAt,
 		ExpiresAt: ExampleRefreshToken.ExpiresAt,
@@ -198,9 +387,32 @@ func (r *MockAuthRepo) GetRefreshToken(
 	return out, nil
 }
 
+func (r *MockAuthRepo) GetRefreshTokenByToken(
+	ctx context.Context,
+	token string) (*entities.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.refreshTokens {
+		match := f.rt.Token == token
+		for _, used := range f.used {
+			match = match || used == token
+		}
+		if match {
+			out := f.rt
+			return &out, nil
+		}
+	}
+
+	return nil, nil
+}
+
 func (r *MockAuthRepo) DeleteRefreshToken(
 	ctx context.Context,
-	userID string) (n int64, err error) {
+	userID string,
+	device string) (n int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.refreshTokens, [2]string{userID, device})
 
 	return 1, nil
 }
@@ -208,6 +420,347 @@ func (r *MockAuthRepo) DeleteRefreshToken(
 func (r *MockAuthRepo) DeleteRefreshTokenAndAllTokens(
 	ctx context.Context,
 	userID string) (n int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.refreshTokens {
+		if k[0] == userID {
+			delete(r.refreshTokens, k)
+		}
+	}
+	r.deleteUserJWTs(userID)
 
 	return 2, nil
 }
+
+func (r *MockAuthRepo) DeleteUserAccount(
+	ctx context.Context,
+	userID string,
+	scheduledBefore time.Time) error {
+	if strings.Contains(userID, "INVALIDID") {
+		return usecases.NewErrorInvalidID(userID, "user")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.refreshTokens {
+		if k[0] == userID {
+			delete(r.refreshTokens, k)
+		}
+	}
+	r.deleteUserJWTs(userID)
+	delete(r.emailVerifications, userID)
+	delete(r.twoFactors, userID)
+
+	return nil
+}
+
+func (r *MockAuthRepo) DeleteExpiredJWTs(
+	ctx context.Context,
+	before time.Time) (int64, error) {
+	if ExampleUserToken.ExpiresAt.Before(before) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (r *MockAuthRepo) DeleteExpiredRefreshTokens(
+	ctx context.Context,
+	before time.Time) (int64, error) {
+	if ExampleRefreshToken.ExpiresAt.Before(before) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (r *MockAuthRepo) DeleteExpiredResetPasswordRequests(
+	ctx context.Context,
+	before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *MockAuthRepo) SaveEmailVerificationToken(
+	ctx context.Context,
+	userID string,
+	token string,
+	expiresAt time.Time) error {
+	if strings.Contains(userID, "INVALIDID") {
+		return usecases.NewErrorInvalidID(userID, "user")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, pending := r.emailVerifications[userID]
+	if !pending && !strings.Contains(userID, "unverified") {
+		return usecases.NewErrorRecordNotExists("email verification")
+	}
+
+	if r.emailVerifications == nil {
+		r.emailVerifications = make(map[string]string)
+	}
+	r.emailVerifications[userID] = token
+	return nil
+}
+
+func (r *MockAuthRepo) VerifyEmailAddress(
+	ctx context.Context,
+	token string) (*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for userID, t := range r.emailVerifications {
+		if t == token {
+			delete(r.emailVerifications, userID)
+			u := ExampleUser
+			u.ID = userID
+			u.EmailVerified = true
+			return &u, nil
+		}
+	}
+
+	for userID, change := range r.emailChanges {
+		if change[1] == token {
+			if change[0] == ClaimedEmail {
+				return nil, usecases.NewErrorEmailAddressInUse()
+			}
+
+			delete(r.emailChanges, userID)
+			delete(r.emailVerifications, userID)
+			u := ExampleUser
+			u.ID = userID
+			u.EmailAddress = change[0]
+			u.EmailVerified = true
+			return &u, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *MockAuthRepo) ChangeEmailAddress(
+	ctx context.Context,
+	userID string,
+	emailAddress string,
+	token string,
+	expiresAt time.Time) (*entities.User, error) {
+	if strings.Contains(userID, "notfound") {
+		return nil, nil
+	}
+
+	if strings.Contains(userID, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(userID, "user")
+	}
+
+	if emailAddress == InUseEmail {
+		return nil, usecases.NewErrorEmailAddressInUse()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.emailChanges == nil {
+		r.emailChanges = make(map[string][2]string)
+	}
+	r.emailChanges[userID] = [2]string{emailAddress, token}
+
+	u := ExampleUser
+	u.ID = userID
+	u.PendingEmailAddress = emailAddress
+	return &u, nil
+}
+
+// withTwoFactor sets the two-factor state kept for the user
+func (r *MockAuthRepo) withTwoFactor(u *entities.AuthUser) *entities.AuthUser {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tf, ok := r.twoFactors[u.ID]; ok {
+		copied := *tf
+		copied.RecoveryCodes = append([]string{}, tf.RecoveryCodes...)
+		u.TwoFactor = &copied
+		u.TwoFactorEnabled = tf.Enabled
+	}
+	return u
+}
+
+func (r *MockAuthRepo) SaveTwoFactorSecret(
+	ctx context.Context,
+	userID string,
+	secret []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.twoFactors == nil {
+		r.twoFactors = make(map[string]*entities.TwoFactor)
+	}
+	if tf, ok := r.twoFactors[userID]; ok && tf.Enabled {
+		return usecases.NewErrorRecordNotExists("two-factor setup")
+	}
+
+	r.twoFactors[userID] = &entities.TwoFactor{Secret: secret}
+	return nil
+}
+
+func (r *MockAuthRepo) EnableTwoFactor(
+	ctx context.Context,
+	userID string,
+	step int64,
+	recoveryCodes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tf, ok := r.twoFactors[userID]
+	if !ok || tf.Enabled {
+		return usecases.NewErrorRecordNotExists("two-factor setup")
+	}
+
+	tf.Enabled = true
+	tf.LastUsedStep = step
+	tf.RecoveryCodes = recoveryCodes
+	return nil
+}
+
+func (r *MockAuthRepo) UseTwoFactorStep(
+	ctx context.Context,
+	userID string,
+	step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tf, ok := r.twoFactors[userID]
+	if !ok || !tf.Enabled || tf.LastUsedStep >= step {
+		return false, nil
+	}
+
+	tf.LastUsedStep = step
+	return true, nil
+}
+
+func (r *MockAuthRepo) UseRecoveryCode(
+	ctx context.Context,
+	userID string,
+	code string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tf, ok := r.twoFactors[userID]
+	if !ok || !tf.Enabled {
+		return false, nil
+	}
+
+	for i, c := range tf.RecoveryCodes {
+		if c == code {
+			tf.RecoveryCodes = append(tf.RecoveryCodes[:i:i], tf.RecoveryCodes[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MockAuthRepo) DeleteTwoFactor(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.twoFactors, userID)
+	return nil
+}
+
+func (r *MockAuthRepo) GetLoginAttempts(
+	ctx context.Context,
+	keys []string) ([]entities.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []entities.LoginAttempts{}
+	for _, key := range keys {
+		if a, ok := r.loginAttempts[key]; ok && a.ExpiresAt.After(time.Now()) {
+			out = append(out, *a)
+		}
+	}
+	return out, nil
+}
+
+func (r *MockAuthRepo) AddLoginFailure(
+	ctx context.Context,
+	key string,
+	expiresAt time.Time) (*entities.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loginAttempts == nil {
+		r.loginAttempts = make(map[string]*entities.LoginAttempts)
+	}
+
+	a, ok := r.loginAttempts[key]
+	if !ok || !a.ExpiresAt.After(time.Now()) {
+		a = &entities.LoginAttempts{Key: key}
+		r.loginAttempts[key] = a
+	}
+	a.Failures++
+	a.ExpiresAt = expiresAt
+
+	out := *a
+	return &out, nil
+}
+
+func (r *MockAuthRepo) LockLogin(
+	ctx context.Context,
+	key string,
+	until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if a, ok := r.loginAttempts[key]; ok {
+		a.LockedUntil = until
+		if a.ExpiresAt.Before(until) {
+			a.ExpiresAt = until
+		}
+	}
+	return nil
+}
+
+func (r *MockAuthRepo) DeleteLoginAttempts(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.loginAttempts, key)
+	return nil
+}
+
+func (r *MockAuthRepo) GetUserByExternalIdentity(
+	ctx context.Context,
+	issuer string,
+	subject string) (*entities.AuthUser, error) {
+	r.mu.Lock()
+	userID, ok := r.externalIdentities[[2]string{issuer, subject}]
+	r.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	return r.GetUserByID(ctx, userID)
+}
+
+func (r *MockAuthRepo) LinkExternalIdentity(
+	ctx context.Context,
+	userID string,
+	issuer string,
+	subject string) error {
+	if strings.Contains(userID, "notfound") {
+		return usecases.NewErrorRecordNotExists("user")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.externalIdentities == nil {
+		r.externalIdentities = make(map[[2]string]string)
+	}
+	r.externalIdentities[[2]string{issuer, subject}] = userID
+	return nil
+}
+
+func (r *MockAuthRepo) CreateUserWithExternalIdentity(
+	ctx context.Context,
+	username string,
+	emailAddress string,
+	passwordHash []byte,
+	issuer string,
+	subject string) (*entities.User, error) {
+	u := ExampleUser
+	u.Username = username
+	u.EmailAddress = emailAddress
+	u.EmailVerified = true
+
+	err := r.LinkExternalIdentity(ctx, u.ID, issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
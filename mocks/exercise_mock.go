@@ -95,6 +95,71 @@ func (er *MockExerciseRepo) UpdateExercise(
 	if ex.SetUnit != 0 {
 		out.SetUnit = ex.SetUnit
 	}
+	if ex.Aliases != nil {
+		out.Aliases = ex.Aliases
+	}
 
 	return &out, nil
 }
+
+func (er *MockExerciseRepo) GetExercisesCreatedBy(
+	ctx context.Context,
+	userID string) ([]entities.Exercise, error) {
+	if userID != ExampleExercise.CreatedBy {
+		return []entities.Exercise{}, nil
+	}
+
+	return []entities.Exercise{ExampleExercise}, nil
+}
+
+func (er *MockExerciseRepo) DeleteExercise(
+	ctx context.Context,
+	id string) (int64, error) {
+	_, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, usecases.NewErrorInvalidID(id, "exercise")
+	}
+
+	return 1, nil
+}
+
+func (er *MockExerciseRepo) AnonymiseExercise(
+	ctx context.Context,
+	id string) error {
+	_, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return usecases.NewErrorInvalidID(id, "exercise")
+	}
+
+	return nil
+}
+
+func (er *MockExerciseRepo) GetExercisesByIDs(
+	ctx context.Context,
+	ids []string) ([]entities.Exercise, error) {
+	out := []entities.Exercise{}
+	for _, id := range ids {
+		_, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, usecases.NewErrorInvalidID(id, "exercise")
+		}
+
+		if id == ExampleExercise.ID {
+			out = append(out, ExampleExercise)
+		}
+	}
+	return out, nil
+}
+
+func (er *MockExerciseRepo) GetExercisesByNames(
+	ctx context.Context,
+	names []string) ([]entities.Exercise, error) {
+	out := []entities.Exercise{}
+	for _, name := range names {
+		if strings.EqualFold(name, ExampleExercise.Name) {
+			out = append(out, ExampleExercise)
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MockIdempotencyRepo keeps the records in memory,
+// the zero value is ready to use
+type MockIdempotencyRepo struct {
+	mu      sync.Mutex
+	records map[string]entities.IdempotencyRecord
+}
+
+func (r *MockIdempotencyRepo) CreateIdempotencyRecord(
+	ctx context.Context,
+	rec *entities.IdempotencyRecord) (*entities.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.records == nil {
+		r.records = make(map[string]entities.IdempotencyRecord)
+	}
+
+	if _, ok := r.records[rec.UserID+rec.Key]; ok {
+		return nil, mongo.WriteException{
+			WriteErrors: []mongo.WriteError{{Code: 11000, Message: "duplicate key"}},
+		}
+	}
+
+	r.records[rec.UserID+rec.Key] = *rec
+	out := *rec
+	return &out, nil
+}
+
+func (r *MockIdempotencyRepo) GetIdempotencyRecord(
+	ctx context.Context,
+	userID, key string) (*entities.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.records[userID+key]
+	if !ok || rec.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (r *MockIdempotencyRepo) ReplaceExpiredIdempotencyRecord(
+	ctx context.Context,
+	rec *entities.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.records == nil {
+		r.records = make(map[string]entities.IdempotencyRecord)
+	}
+
+	if stored, ok := r.records[rec.UserID+rec.Key]; ok && !stored.ExpiresAt.Before(time.Now()) {
+		return mongo.WriteException{
+			WriteErrors: []mongo.WriteError{{Code: 11000, Message: "duplicate key"}},
+		}
+	}
+
+	r.records[rec.UserID+rec.Key] = *rec
+	return nil
+}
+
+func (r *MockIdempotencyRepo) LockIdempotencyRecord(
+	ctx context.Context,
+	userID, key string,
+	lockedUntil time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	rec, ok := r.records[userID+key]
+	if !ok || rec.StatusCode != 0 || rec.LockedUntil.After(now) || rec.ExpiresAt.Before(now) {
+		return false, nil
+	}
+	rec.LockedUntil = lockedUntil
+	r.records[userID+key] = rec
+	return true, nil
+}
+
+func (r *MockIdempotencyRepo) SaveIdempotencyResponse(
+	ctx context.Context,
+	userID, key string,
+	statusCode int,
+	header map[string][]string,
+	body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec := r.records[userID+key]
+	rec.StatusCode = statusCode
+	rec.Header = header
+	rec.Body = body
+	r.records[userID+key] = rec
+	return nil
+}
+
+func (r *MockIdempotencyRepo) DeleteIdempotencyRecord(
+	ctx context.Context,
+	userID, key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.records[userID+key]; !ok {
+		return 0, nil
+	}
+	delete(r.records, userID+key)
+	return 1, nil
+}
@@ -0,0 +1,197 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type mockImportJob struct {
+	job         entities.ImportJob
+	data        []byte
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+// MockImportRepo keeps the import jobs in memory,
+// the zero value is ready to use
+type MockImportRepo struct {
+	mu   sync.Mutex
+	jobs []*mockImportJob
+}
+
+func (r *MockImportRepo) find(id string) *mockImportJob {
+	for _, j := range r.jobs {
+		if j.job.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (r *MockImportRepo) CreateImportJob(
+	ctx context.Context,
+	job *entities.ImportJob,
+	data []byte,
+	expiresAt time.Time) (*entities.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := mockImportJob{job: *job, data: data, expiresAt: expiresAt}
+	stored.job.ID = primitive.NewObjectID().Hex()
+	r.jobs = append(r.jobs, &stored)
+
+	out := stored.job
+	return &out, nil
+}
+
+func (r *MockImportRepo) GetImportJob(
+	ctx context.Context,
+	userID, id string) (*entities.ImportJob, error) {
+	_, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, usecases.NewErrorInvalidID(id, "import")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j := r.find(id)
+	if j == nil || j.job.UserID != userID {
+		return nil, nil
+	}
+	out := j.job
+	return &out, nil
+}
+
+func (r *MockImportRepo) GetImportJobData(
+	ctx context.Context,
+	id string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j := r.find(id)
+	if j == nil {
+		return nil, nil
+	}
+	return j.data, nil
+}
+
+func (r *MockImportRepo) QueueImportJob(
+	ctx context.Context,
+	userID, id string) (*entities.ImportJob, error) {
+	_, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, usecases.NewErrorInvalidID(id, "import")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j := r.find(id)
+	if j == nil || j.job.UserID != userID || j.job.Status != entities.ImportStatusReview {
+		return nil, nil
+	}
+	j.job.Status = entities.ImportStatusQueued
+	j.expiresAt = time.Time{}
+	out := j.job
+	return &out, nil
+}
+
+func (r *MockImportRepo) ClaimImportJob(
+	ctx context.Context,
+	now, lockedUntil time.Time) (*entities.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, j := range r.jobs {
+		if j.job.Status == entities.ImportStatusQueued ||
+			(j.job.Status == entities.ImportStatusRunning && !j.lockedUntil.After(now)) {
+			j.job.Status = entities.ImportStatusRunning
+			j.job.Attempts++
+			j.lockedUntil = lockedUntil
+			out := j.job
+			return &out, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *MockImportRepo) UpdateImportJobProgress(
+	ctx context.Context,
+	id string,
+	importedTrainings, createdExercises int,
+	lockedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if j := r.find(id); j != nil {
+		j.job.ImportedTrainings = importedTrainings
+		j.job.CreatedExercises = createdExercises
+		j.lockedUntil = lockedUntil
+	}
+	return nil
+}
+
+func (r *MockImportRepo) FinishImportJob(
+	ctx context.Context,
+	id string,
+	status entities.ImportStatus,
+	errTxt string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if j := r.find(id); j != nil {
+		j.job.Status = status
+		j.job.Error = errTxt
+		j.data = nil
+		j.lockedUntil = time.Time{}
+	}
+	return nil
+}
+
+// ExpireImportLocks releases the locks of the running imports as if their runner had stopped
+func (r *MockImportRepo) ExpireImportLocks() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, j := range r.jobs {
+		j.lockedUntil = time.Time{}
+	}
+}
+
+func (r *MockImportRepo) GetUserImportJobs(
+	ctx context.Context,
+	userID string) ([]entities.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobs := []entities.ImportJob{}
+	for i := len(r.jobs) - 1; i >= 0; i-- {
+		if r.jobs[i].job.UserID == userID {
+			jobs = append(jobs, r.jobs[i].job)
+		}
+	}
+	return jobs, nil
+}
+
+func (r *MockImportRepo) DeleteUserImportJobs(
+	ctx context.Context,
+	userID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.jobs[:0]
+	for _, j := range r.jobs {
+		if j.job.UserID != userID {
+			kept = append(kept, j)
+		}
+	}
+	n := int64(len(r.jobs) - len(kept))
+	r.jobs = kept
+	return n, nil
+}
@@ -7,8 +7,30 @@ var (
 	NonexistingUserID = UserID[:len(UserID)-1] + "a"
 
 	NonexistingEmail = "notfound@example.com"
-	Password         = []byte("TheSecretestPasswordEver123$%^")
-	PasswordHash     = []byte("$2a$04$d0sgKcu9y.h8grIpktLj9OAdcv7pGy5CZ9aaz5zqPAkPyqlxLGF5W")
+	// TwoFactorEmail is the email address of the user with TwoFactorUserID,
+	// the user does not share the two-factor state with the ExampleUser
+	TwoFactorEmail  = "twofactor@email.com"
+	TwoFactorUserID = "6072d3206144644984a54fb2"
+	// AdminUserID is the ID of the user with the admin role
+	AdminUserID = "6072d3206144644984a54fc3"
+	// CoachUserID is the ID of the user with the coach role
+	CoachUserID = "6072d3206144644984a54fc4"
+	// DisabledEmail is the email address of the user with DisabledUserID, the account is disabled
+	DisabledEmail  = "disabled@email.com"
+	DisabledUserID = "6072d3206144644984a54fd4"
+	// ResetPwdUserID is the user of the ExampleResetPwdReq, the reset ends the sessions of the user
+	ResetPwdUserID = "6072d3206144644984a54fe8"
+	// InUseEmail is the email address of another user, it cannot be taken
+	InUseEmail = "inuse@email.com"
+	// ClaimedEmail is free when the user asks for it, but another user takes it before it gets verified
+	ClaimedEmail = "claimed@email.com"
+
+	Password     = []byte("TheSecretestPasswordEver123$%^")
+	PasswordHash = []byte("$2a$04$d0sgKcu9y.h8grIpktLj9OAdcv7pGy5CZ9aaz5zqPAkPyqlxLGF5W")
+
+	// CalendarFeedToken is the calendar feed secret of the ExampleUser, stored as CalendarFeedTokenHash
+	CalendarFeedToken     = "gymmcal_mockedCalendarFeedSecret"
+	CalendarFeedTokenHash = "1d4cc579e54a115dd24877005a9a44c5fbc129a2c42c9c924e2f9aa075e318cf"
 
 	Now = time.Now().UTC()
 )
@@ -7,11 +7,13 @@ import (
 
 	"github.com/unnamedxaer/gymm-api/entities"
 	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
 	ExampleTraining = entities.Training{
 		ID:        "607443ceb40d9ea8602803e7",
+		ClientID:  "0b8a3d51-2c0b-4b8e-9d0c-5f1f3a8b9e21",
 		UserID:    UserID,
 		StartTime: Now.Add(-2 * time.Hour),
 		Exercises: []entities.TrainingExercise{
@@ -25,11 +27,13 @@ var (
 						ID:   "60740f289ee8e963adb5412a",
 						Time: Now.Add(-110 * time.Minute),
 						Reps: 12,
+						Load: 100,
 					},
 					{
 						ID:   "60740f289ee8e963adb5412d",
 						Time: Now.Add(-107 * time.Minute),
 						Reps: 10,
+						Load: 110,
 					},
 					{
 						ID:   "60740f289ee8e963adb5412c",
@@ -46,11 +50,18 @@ var (
 			},
 		},
 		// EndTime: time.Now(),
-		Comment: "too long, too heavy",
+		Comment:   "too long, too heavy",
+		UpdatedAt: Now.Add(-100 * time.Minute),
 	}
 
 	ExampleTrainingExercise = ExampleTraining.Exercises[0]
 	ExampleTrainingSet      = ExampleTrainingExercise.Sets[0]
+
+	// UserIDWithOpenTraining is an id of the user that has training in progress
+	UserIDWithOpenTraining = "6072d3206144644984a54fb2"
+	// UserIDStartingTrainingConcurrently is an id of the user whose other training
+	// is started between the open training check and the insert
+	UserIDStartingTrainingConcurrently = "6072d3206144644984a54fe9"
 )
 
 type MockTrainingRepo struct {
@@ -70,6 +81,9 @@ func (tr *MockTrainingRepo) GetTrainingByID(
 
 	out := ExampleTraining
 	out.ID = id
+	if strings.Contains(id, "ended") {
+		out.EndTime = Now
+	}
 	return &out, nil
 }
 
@@ -77,6 +91,10 @@ func (tr *MockTrainingRepo) StartTraining(
 	ctx context.Context,
 	userID string,
 	startTime time.Time) (*entities.Training, error) {
+	if userID == UserIDStartingTrainingConcurrently {
+		return nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+	}
+
 	return &entities.Training{
 		ID:        ExampleTraining.ID,
 		UserID:    userID,
@@ -146,3 +164,140 @@ func (tr *MockTrainingRepo) EndExercise(
 	out.EndTime = endTime
 	return &out, nil
 }
+
+func (tr *MockTrainingRepo) GetTrainingByClientID(
+	ctx context.Context,
+	userID, clientID string) (*entities.Training, error) {
+
+	if clientID != ExampleTraining.ClientID {
+		return nil, nil
+	}
+
+	out := ExampleTraining
+	out.UserID = userID
+	return &out, nil
+}
+
+func (tr *MockTrainingRepo) CreateTraining(
+	ctx context.Context,
+	t *entities.Training) (*entities.Training, error) {
+	out := *t
+	out.ID = ExampleTraining.ID
+	return &out, nil
+}
+
+func (tr *MockTrainingRepo) ReplaceTraining(
+	ctx context.Context,
+	t *entities.Training,
+	lastUpdatedAt time.Time) (*entities.Training, error) {
+	if strings.Contains(t.ID, "notfound") || strings.Contains(t.ID, "modified") {
+		return nil, nil
+	}
+
+	out := *t
+	return &out, nil
+}
+
+func (tr *MockTrainingRepo) GetUserTrainingsChangedSince(
+	ctx context.Context,
+	userID string,
+	since time.Time,
+	afterID string,
+	limit int64) ([]entities.Training, error) {
+	out := []entities.Training{ExampleTraining}
+	out[0].UserID = userID
+	return out, nil
+}
+
+func (tr *MockTrainingRepo) GetUserOpenTraining(
+	ctx context.Context,
+	userID string) (*entities.Training, error) {
+	if userID != UserIDWithOpenTraining {
+		return nil, nil
+	}
+
+	out := ExampleTraining
+	out.UserID = userID
+	return &out, nil
+}
+
+func (tr *MockTrainingRepo) GetTrainingByExerciseID(
+	ctx context.Context,
+	teID string) (*entities.Training, error) {
+
+	if strings.Contains(teID, "notfound") {
+		return nil, nil
+	}
+
+	if strings.Contains(teID, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(teID, "training exercise")
+	}
+
+	out := ExampleTraining
+	out.Exercises = make([]entities.TrainingExercise, len(ExampleTraining.Exercises))
+	copy(out.Exercises, ExampleTraining.Exercises)
+	for _, te := range out.Exercises {
+		if te.ID == teID {
+			return &out, nil
+		}
+	}
+
+	// unknown exercise is treated as the one in progress
+	out.Exercises[len(out.Exercises)-1].ID = teID
+	return &out, nil
+}
+
+func (tr *MockTrainingRepo) GetInactiveTrainings(
+	ctx context.Context,
+	before time.Time) ([]entities.Training, error) {
+	out := []entities.Training{ExampleTraining}
+	if !ExampleTraining.UpdatedAt.Before(before) {
+		return []entities.Training{}, nil
+	}
+	return out, nil
+}
+
+func (tr *MockTrainingRepo) CloseInactiveTraining(
+	ctx context.Context,
+	t *entities.Training,
+	lastUpdatedAt time.Time) (*entities.Training, error) {
+	if strings.Contains(t.ID, "modified") {
+		return nil, nil
+	}
+
+	out := *t
+	return &out, nil
+}
+
+func (tr *MockTrainingRepo) DeleteUserTrainings(
+	ctx context.Context,
+	userID string) (int64, error) {
+	if strings.Contains(userID, "INVALIDID") {
+		return 0, usecases.NewErrorInvalidID(userID, "user")
+	}
+
+	return 1, nil
+}
+
+func (tr *MockTrainingRepo) IsExerciseUsed(
+	ctx context.Context,
+	exerciseID string) (bool, error) {
+	return exerciseID == ExampleExercise.ID, nil
+}
+
+func (tr *MockTrainingRepo) ForEachUserTraining(
+	ctx context.Context,
+	userID string,
+	from, to time.Time,
+	fn func(t *entities.Training) error) error {
+	if strings.Contains(userID, "INVALIDID") {
+		return usecases.NewErrorInvalidID(userID, "user")
+	}
+
+	t := ExampleTraining
+	t.UserID = userID
+	if (!from.IsZero() && t.StartTime.Before(from)) || (!to.IsZero() && !t.StartTime.Before(to)) {
+		return nil
+	}
+	return fn(&t)
+}
@@ -3,6 +3,7 @@ package mocks
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/unnamedxaer/gymm-api/entities"
 	"github.com/unnamedxaer/gymm-api/usecases"
@@ -10,10 +11,13 @@ import (
 
 var (
 	ExampleUser = entities.User{
-		ID:           UserID,
-		Username:     "John Silver",
-		EmailAddress: "johnsilver@email.com",
-		CreatedAt:    Now,
+		ID:            UserID,
+		Username:      "John Silver",
+		EmailAddress:  "johnsilver@email.com",
+		EmailVerified: true,
+		Role:          entities.RoleUser,
+		Preferences:   entities.DefaultUserPreferences,
+		CreatedAt:     Now,
 	}
 )
 
@@ -33,9 +37,26 @@ func (ur MockUserRepo) GetUserByID(
 		return nil, usecases.NewErrorInvalidID(id, "user")
 	}
 
-	return &entities.User{
-		ID: id,
-	}, nil
+	role := entities.RoleUser
+	switch id {
+	case AdminUserID:
+		role = entities.RoleAdmin
+	case CoachUserID:
+		role = entities.RoleCoach
+	}
+
+	u := entities.User{
+		ID:          id,
+		Role:        role,
+		Disabled:    id == DisabledUserID,
+		Preferences: entities.DefaultUserPreferences,
+	}
+	if strings.Contains(id, "deleting") {
+		// the deletion was scheduled earlier
+		deleteAt := Now.Add(usecases.DefaultAccountDeletionGracePeriod)
+		u.DeletionScheduledAt = &deleteAt
+	}
+	return &u, nil
 }
 
 func (ur MockUserRepo) CreateUser(
@@ -45,5 +66,172 @@ func (ur MockUserRepo) CreateUser(
 	u := ExampleUser
 	u.Username = username
 	u.EmailAddress = email
+	u.EmailVerified = false
+	return &u, nil
+}
+
+func (ur MockUserRepo) GetUsers(
+	ctx context.Context,
+	query string,
+	afterID string,
+	limit int64) ([]entities.User, error) {
+	if strings.Contains(afterID, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(afterID, "user")
+	}
+
+	users := []entities.User{ExampleUser}
+	q := strings.ToLower(query)
+	matches := strings.Contains(strings.ToLower(ExampleUser.EmailAddress), q) ||
+		strings.Contains(strings.ToLower(ExampleUser.Username), q)
+	if !matches || afterID != "" || limit < int64(len(users)) {
+		return []entities.User{}, nil
+	}
+	return users, nil
+}
+
+func (ur MockUserRepo) SetUserDisabled(
+	ctx context.Context,
+	id string,
+	disabled bool) (*entities.User, error) {
+	if strings.Contains(id, "notfound") {
+		return nil, nil
+	}
+
+	if strings.Contains(id, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(id, "user")
+	}
+
+	u := ExampleUser
+	u.ID = id
+	u.Disabled = disabled
+	return &u, nil
+}
+
+func (ur MockUserRepo) SetUserRole(
+	ctx context.Context,
+	id string,
+	role entities.Role) (*entities.User, error) {
+	if strings.Contains(id, "notfound") {
+		return nil, nil
+	}
+
+	if strings.Contains(id, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(id, "user")
+	}
+
+	u := ExampleUser
+	u.ID = id
+	u.Role = role
+	return &u, nil
+}
+
+func (ur MockUserRepo) UpdateUserProfile(
+	ctx context.Context,
+	id string,
+	profile *usecases.UserProfileInput) (*entities.User, error) {
+	if strings.Contains(id, "notfound") {
+		return nil, nil
+	}
+
+	if strings.Contains(id, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(id, "user")
+	}
+
+	u := ExampleUser
+	u.ID = id
+	if profile.Username != nil {
+		u.Username = *profile.Username
+	}
+	if profile.Theme != nil {
+		u.Preferences.Theme = *profile.Theme
+	}
+	if profile.Timezone != nil {
+		u.Preferences.Timezone = *profile.Timezone
+	}
+	if profile.Units != nil {
+		u.Preferences.Units = *profile.Units
+	}
+	return &u, nil
+}
+
+func (ur MockUserRepo) SetUserDeletionTime(
+	ctx context.Context,
+	id string,
+	at *time.Time) (*entities.User, error) {
+	if strings.Contains(id, "notfound") {
+		return nil, nil
+	}
+
+	if strings.Contains(id, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(id, "user")
+	}
+
+	u := ExampleUser
+	u.ID = id
+	u.DeletionScheduledAt = at
+	return &u, nil
+}
+
+func (ur MockUserRepo) StartUserDeletion(
+	ctx context.Context,
+	id string,
+	before time.Time) (*entities.User, error) {
+	if strings.Contains(id, "notfound") {
+		return nil, nil
+	}
+
+	if strings.Contains(id, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(id, "user")
+	}
+
+	scheduledAt := Now
+	u := ExampleUser
+	u.ID = id
+	u.DeletionScheduledAt = &scheduledAt
+	return &u, nil
+}
+
+func (ur MockUserRepo) GetUsersToDelete(
+	ctx context.Context,
+	before time.Time,
+	limit int64) ([]entities.User, error) {
+	scheduledAt := Now
+	if scheduledAt.After(before) || limit < 1 {
+		return []entities.User{}, nil
+	}
+
+	u := ExampleUser
+	u.DeletionScheduledAt = &scheduledAt
+	return []entities.User{u}, nil
+}
+
+func (ur MockUserRepo) SetCalendarFeedToken(
+	ctx context.Context,
+	id string,
+	tokenHash string) (*entities.User, error) {
+	if strings.Contains(id, "notfound") {
+		return nil, nil
+	}
+
+	if strings.Contains(id, "INVALIDID") {
+		return nil, usecases.NewErrorInvalidID(id, "user")
+	}
+
+	u := ExampleUser
+	u.ID = id
+	u.CalendarFeedEnabled = tokenHash != ""
+	return &u, nil
+}
+
+func (ur MockUserRepo) GetUserByCalendarFeedToken(
+	ctx context.Context,
+	tokenHash string) (*entities.User, error) {
+	// the feed of the example user has the secret CalendarFeedToken
+	if tokenHash != CalendarFeedTokenHash {
+		return nil, nil
+	}
+
+	u := ExampleUser
+	u.CalendarFeedEnabled = true
 	return &u, nil
 }
@@ -0,0 +1,315 @@
+// Package oidc implements the client side of the OpenID Connect
+// authorization code flow with PKCE (RFC 7636)
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
+)
+
+const (
+	// scopes are requested from every provider, "email" is needed to link the accounts
+	scopes = "openid email profile"
+	// leeway is the allowed clock difference between us and the provider
+	leeway = time.Minute
+	// maxResponseSize limits the responses read from the provider
+	maxResponseSize = 1 << 20
+)
+
+// Config describes the provider and the client registered there
+type Config struct {
+	// Name identifies the provider in our urls, eg. "google"
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is our callback url registered at the provider
+	RedirectURL string
+}
+
+// Provider is the OpenID Connect provider configured from its discovery document
+type Provider struct {
+	cfg                   Config
+	client                *http.Client
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+
+	mu sync.Mutex
+	// keys verify the ID tokens, they are fetched again when the provider rotates them
+	keys *jwtkeys.KeySet
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover creates the provider from the discovery document published under the issuer url
+func Discover(ctx context.Context, client *http.Client, cfg Config) (*Provider, error) {
+	if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.Errorf("oidc: provider %q: missing name, issuer, client id or redirect url", cfg.Name)
+	}
+
+	doc := discoveryDocument{}
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	err := getJSON(ctx, client, wellKnown, &doc)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "oidc: provider %q: discovery", cfg.Name)
+	}
+
+	// the tokens are verified against the configured issuer, so it must be the one the provider uses
+	if doc.Issuer != cfg.Issuer {
+		return nil, errors.Errorf("oidc: provider %q: issuer %q does not match %q", cfg.Name, doc.Issuer, cfg.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.Errorf("oidc: provider %q: incomplete discovery document", cfg.Name)
+	}
+
+	return &Provider{
+		cfg:                   cfg,
+		client:                client,
+		authorizationEndpoint: doc.AuthorizationEndpoint,
+		tokenEndpoint:         doc.TokenEndpoint,
+		jwksURI:               doc.JWKSURI,
+	}, nil
+}
+
+// Name returns the name of the provider used in our urls
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// Issuer returns the issuer of the ID tokens
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// AuthCodeURL returns the url the user is redirected to, to sign in at the provider,
+// the verifier is kept by us and sent only with the code exchange
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challengeS256(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange trades the authorization code for the ID token
+// and returns its claims once the token is verified
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.WithMessage(err, "oidc: exchange")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "oidc: exchange")
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&body)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "oidc: exchange: status %d", res.StatusCode)
+	}
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, errors.Errorf("oidc: exchange: status %d: %s %s", res.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("oidc: exchange: missing id token")
+	}
+
+	return p.verifyIDToken(ctx, body.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(t *jwt.Token) (interface{}, error) {
+		return p.keyfunc(ctx, t)
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "oidc: id token")
+	}
+
+	if claims.Issuer != p.cfg.Issuer {
+		return nil, errors.Errorf("oidc: id token: unexpected issuer %q", claims.Issuer)
+	}
+	if !claims.Audience.contains(p.cfg.ClientID) {
+		return nil, errors.New("oidc: id token: not issued for this client")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, errors.New("oidc: id token: not authorized for this client")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("oidc: id token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc: id token: missing subject")
+	}
+
+	return claims, nil
+}
+
+// keyfunc returns the provider's key for the token,
+// the keys are fetched again once if the token is signed with unknown one
+func (p *Provider) keyfunc(ctx context.Context, t *jwt.Token) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil {
+		key, err := p.keys.Keyfunc(t)
+		if err == nil {
+			return key, nil
+		}
+	}
+
+	set := jwtkeys.JWKSet{}
+	err := getJSON(ctx, p.client, p.jwksURI, &set)
+	if err != nil {
+		return nil, errors.WithMessage(err, "fetch keys")
+	}
+
+	keys, err := jwtkeys.NewKeySetFromJWKS(set)
+	if err != nil {
+		return nil, errors.WithMessage(err, "fetch keys")
+	}
+	p.keys = keys
+
+	return p.keys.Keyfunc(t)
+}
+
+// Claims are the claims of the ID token
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// Valid checks the time claims, it is called by the jwt parser
+func (c *Claims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return errors.New("token is expired")
+	}
+	if now.Add(leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("token used before issued")
+	}
+	return nil
+}
+
+// audience is the "aud" claim which is either a single string or an array
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RandomToken returns new random url safe value for the state, nonce or PKCE verifier
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// challengeS256 returns the PKCE code challenge of the verifier
+func challengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", u, res.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(v)
+}
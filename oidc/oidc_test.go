@@ -0,0 +1,109 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/oidc"
+	"github.com/unnamedxaer/gymm-api/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/oidc/fake/callback"
+
+func newProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	fake, err := oidctest.NewProvider("gymm", "client secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+
+	p, err := oidc.Discover(context.Background(), fake.Client(), oidc.Config{
+		Name:         "fake",
+		Issuer:       fake.Issuer(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+		RedirectURL:  redirectURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, p
+}
+
+// authorize returns the code the provider redirects back with
+func authorize(t *testing.T, fake *oidctest.Provider, authURL string, identity oidctest.Identity) string {
+	t.Helper()
+	redirect, err := fake.Authorize(authURL, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newProvider(t)
+	identity := oidctest.Identity{
+		Subject:       "1234567890",
+		Email:         "someone@email.com",
+		EmailVerified: true,
+		Name:          "Someone",
+	}
+
+	verifier, _ := oidc.RandomToken()
+	authURL := p.AuthCodeURL("the state", "the nonce", verifier)
+	q, _ := url.ParseQuery(authURL[len(fake.Issuer()+"/authorize?"):])
+	if q.Get("code_challenge") == verifier || q.Get("redirect_uri") != redirectURL {
+		t.Errorf("want S256 challenge instead of the verifier and our redirect url, got %q", authURL)
+	}
+
+	code := authorize(t, fake, authURL, identity)
+	claims, err := p.Exchange(ctx, code, verifier, "the nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != identity.Subject || claims.Email != identity.Email || !claims.EmailVerified {
+		t.Errorf("want claims of %+v, got %+v", identity, claims)
+	}
+
+	_, err = p.Exchange(ctx, code, verifier, "the nonce")
+	if err == nil {
+		t.Errorf("want the code to be single use")
+	}
+
+	code = authorize(t, fake, p.AuthCodeURL("the state", "the nonce", verifier), identity)
+	_, err = p.Exchange(ctx, code, "other verifier", "the nonce")
+	if err == nil {
+		t.Errorf("want error for wrong code verifier")
+	}
+
+	code = authorize(t, fake, p.AuthCodeURL("the state", "the nonce", verifier), identity)
+	_, err = p.Exchange(ctx, code, verifier, "other nonce")
+	if err == nil {
+		t.Errorf("want error for wrong nonce")
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	fake, err := oidctest.NewProvider("gymm", "client secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+
+	_, err = oidc.Discover(context.Background(), fake.Client(), oidc.Config{
+		Name:        "fake",
+		Issuer:      fake.Issuer() + "/",
+		ClientID:    fake.ClientID,
+		RedirectURL: redirectURL,
+	})
+	if err == nil {
+		t.Errorf("want error for issuer other than the one in the discovery document")
+	}
+}
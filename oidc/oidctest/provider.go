@@ -0,0 +1,233 @@
+// Package oidctest provides an in-process OpenID Connect provider for the tests
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/jwtkeys"
+)
+
+// Identity is the account of the user signing in at the provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is the fake provider, it issues ID tokens for the identities
+// passed to Authorize without any user interaction
+type Provider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	keys *jwtkeys.KeySet
+
+	mu sync.Mutex
+	// codes are the issued authorization codes, each can be exchanged once
+	codes map[string]authorization
+}
+
+type authorization struct {
+	identity      Identity
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// NewProvider starts the provider, it must be closed when no longer needed
+func NewProvider(clientID, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	k, err := jwtkeys.ParsePEMKey("fake-key", pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := jwtkeys.NewKeySet(k.ID, "", k)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		keys:         keys,
+		codes:        make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+
+	return p, nil
+}
+
+// Issuer returns the issuer url of the provider
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// Client returns the http client that can reach the provider
+func (p *Provider) Client() *http.Client {
+	return p.Server.Client()
+}
+
+// Close stops the provider
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// Authorize plays the part of the user signing in at the provider:
+// it validates the authorization url and returns the redirect url with the code and state
+func (p *Provider) Authorize(authURL string, identity Identity) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+
+	switch {
+	case q.Get("response_type") != "code":
+		return "", errors.New("response_type must be code")
+	case q.Get("client_id") != p.ClientID:
+		return "", errors.New("unknown client_id")
+	case q.Get("redirect_uri") == "":
+		return "", errors.New("missing redirect_uri")
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		return "", errors.New("missing S256 code_challenge")
+	}
+
+	code, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		identity:      identity,
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		return "", err
+	}
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+
+	return redirect.String(), nil
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Issuer(),
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, p.keys.JWKS())
+}
+
+func (p *Provider) token(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the credentials are form encoded before the basic auth encoding (RFC 6749 2.3.1)
+	clientID, clientSecret, ok := req.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if !ok || clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := req.PostFormValue("code")
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(req.PostFormValue("code_verifier")))
+	switch {
+	case req.PostFormValue("grant_type") != "authorization_code" || !ok:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case req.PostFormValue("redirect_uri") != auth.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid_grant", "error_description": "code_verifier mismatch"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.keys.Sign(jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"sub":            auth.identity.Subject,
+		"aud":            p.ClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.identity.Email,
+		"email_verified": auth.identity.EmailVerified,
+		"name":           auth.identity.Name,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": code,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
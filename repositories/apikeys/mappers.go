@@ -0,0 +1,31 @@
+package apikeys
+
+import "github.com/unnamedxaer/gymm-api/entities"
+
+func mapAPIKeyToEntity(data *apiKeyData) *entities.APIKey {
+	key := entities.APIKey{
+		ID:        data.ID.Hex(),
+		UserID:    data.UserID.Hex(),
+		Name:      data.Name,
+		Scopes:    data.Scopes,
+		Prefix:    data.Prefix,
+		CreatedAt: data.CreatedAt.UTC(),
+	}
+	if data.ExpiresAt != nil {
+		expiresAt := data.ExpiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+	if data.LastUsedAt != nil {
+		lastUsedAt := data.LastUsedAt.UTC()
+		key.LastUsedAt = &lastUsedAt
+	}
+	return &key
+}
+
+func mapAPIKeysToEntities(data []apiKeyData) []entities.APIKey {
+	keys := make([]entities.APIKey, len(data))
+	for i := range data {
+		keys[i] = *mapAPIKeyToEntity(&data[i])
+	}
+	return keys
+}
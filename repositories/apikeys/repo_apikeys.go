@@ -0,0 +1,146 @@
+package apikeys
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type apiKeyData struct {
+	ID     primitive.ObjectID     `bson:"_id,omitempty"`
+	UserID primitive.ObjectID     `bson:"user_id,omitempty"`
+	Name   string                 `bson:"name"`
+	Scopes []entities.APIKeyScope `bson:"scopes"`
+	// KeyHash is the sha256 of the key, the plain key is never stored
+	KeyHash    string     `bson:"key_hash,omitempty"`
+	Prefix     string     `bson:"prefix"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty"`
+}
+
+func (repo *APIKeyRepository) CreateAPIKey(
+	ctx context.Context,
+	key *entities.APIKey,
+	keyHash string) (*entities.APIKey, error) {
+	uOID, err := primitive.ObjectIDFromHex(key.UserID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(key.UserID, "user"), "apiKeyRepo.CreateAPIKey")
+	}
+
+	data := apiKeyData{
+		UserID:    uOID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		KeyHash:   keyHash,
+		Prefix:    key.Prefix,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+	}
+
+	result, err := repo.col.InsertOne(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "apiKeyRepo.CreateAPIKey")
+	}
+
+	var ok bool
+	data.ID, ok = result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("apiKeyRepo.CreateAPIKey: ID assert failed")
+	}
+
+	return mapAPIKeyToEntity(&data), nil
+}
+
+func (repo *APIKeyRepository) GetAPIKeys(
+	ctx context.Context,
+	userID string) ([]entities.APIKey, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "apiKeyRepo.GetAPIKeys")
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := repo.col.Find(ctx, bson.M{"user_id": uOID}, opts)
+	if err != nil {
+		return nil, errors.WithMessage(err, "apiKeyRepo.GetAPIKeys")
+	}
+
+	data := []apiKeyData{}
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "apiKeyRepo.GetAPIKeys")
+	}
+
+	return mapAPIKeysToEntities(data), nil
+}
+
+func (repo *APIKeyRepository) GetAPIKeyByHash(
+	ctx context.Context,
+	keyHash string) (*entities.APIKey, error) {
+	if keyHash == "" {
+		return nil, nil
+	}
+
+	var data apiKeyData
+	err := repo.col.FindOne(ctx, bson.M{"key_hash": keyHash}).Decode(&data)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "apiKeyRepo.GetAPIKeyByHash")
+	}
+
+	return mapAPIKeyToEntity(&data), nil
+}
+
+func (repo *APIKeyRepository) DeleteAPIKey(
+	ctx context.Context,
+	userID string,
+	keyID string) (int64, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "apiKeyRepo.DeleteAPIKey")
+	}
+
+	kOID, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return 0, errors.WithMessage(
+			usecases.NewErrorInvalidID(keyID, "api key"), "apiKeyRepo.DeleteAPIKey")
+	}
+
+	result, err := repo.col.DeleteOne(ctx, bson.M{"_id": kOID, "user_id": uOID})
+	if err != nil {
+		return 0, errors.WithMessage(err, "apiKeyRepo.DeleteAPIKey")
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (repo *APIKeyRepository) UpdateAPIKeyLastUsed(
+	ctx context.Context,
+	keyID string,
+	usedAt time.Time) error {
+	kOID, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(keyID, "api key"), "apiKeyRepo.UpdateAPIKeyLastUsed")
+	}
+
+	_, err = repo.col.UpdateOne(ctx, bson.M{"_id": kOID}, bson.M{"$set": bson.M{"last_used_at": usedAt}})
+	if err != nil {
+		return errors.WithMessage(err, "apiKeyRepo.UpdateAPIKeyLastUsed")
+	}
+
+	return nil
+}
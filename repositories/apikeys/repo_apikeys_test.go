@@ -0,0 +1,119 @@
+package apikeys
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/repositories"
+	"github.com/unnamedxaer/gymm-api/testhelpers"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+var (
+	apiKeyRepo usecases.APIKeyRepo
+)
+
+func TestMain(m *testing.M) {
+	testhelpers.EnsureTestEnv()
+	loggerMock := zerolog.New(nil)
+
+	dbName := os.Getenv("DB_NAME")
+	if dbName == "" {
+		log.Fatalln("environment variable 'DB_NAME' is not set")
+	}
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Fatalln("environment variable 'MONGO_URI' is not set")
+	}
+	db, err := repositories.GetDatabase(&loggerMock, mongoURI, dbName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = repositories.CreateCollections(&loggerMock, db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer testhelpers.DisconnectDB(&loggerMock, db)
+
+	col := db.Collection(repositories.APIKeysCollectionName)
+	apiKeyRepo = NewRepository(&loggerMock, col)
+
+	os.Exit(m.Run())
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	expiresAt := now.Add(time.Hour)
+	keyHash := fmt.Sprintf("key-hash-%d", now.UnixNano())
+
+	created, err := apiKeyRepo.CreateAPIKey(ctx, &entities.APIKey{
+		UserID:    mocks.UserID,
+		Name:      "spreadsheet",
+		Scopes:    []entities.APIKeyScope{entities.APIKeyScopeTrainingsRead},
+		Prefix:    "gymm_abcdef",
+		CreatedAt: now,
+		ExpiresAt: &expiresAt,
+	}, keyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.UserID != mocks.UserID || !created.HasScope(entities.APIKeyScopeTrainingsRead) {
+		t.Errorf("want created key of user %q, got %+v", mocks.UserID, created)
+	}
+
+	_, err = apiKeyRepo.CreateAPIKey(ctx, &entities.APIKey{UserID: mocks.UserID}, keyHash)
+	if !usecases.IsDuplicatedError(err) {
+		t.Errorf("want duplicated error for the same key hash, got %v", err)
+	}
+
+	got, err := apiKeyRepo.GetAPIKeyByHash(ctx, keyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ID != created.ID || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("want key %+v, got %+v", created, got)
+	}
+
+	err = apiKeyRepo.UpdateAPIKeyLastUsed(ctx, created.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := apiKeyRepo.GetAPIKeys(ctx, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, k := range keys {
+		if k.ID == created.ID {
+			found = k.LastUsedAt != nil && k.LastUsedAt.Equal(now)
+		}
+	}
+	if !found {
+		t.Errorf("want key %q used at %v in %+v", created.ID, now, keys)
+	}
+
+	n, err := apiKeyRepo.DeleteAPIKey(ctx, mocks.NonexistingUserID, created.ID)
+	if err != nil || n != 0 {
+		t.Errorf("want key of other user to be kept, got %d deleted, %v", n, err)
+	}
+
+	n, err = apiKeyRepo.DeleteAPIKey(ctx, mocks.UserID, created.ID)
+	if err != nil || n != 1 {
+		t.Errorf("want 1 deleted key, got %d, %v", n, err)
+	}
+
+	got, err = apiKeyRepo.GetAPIKeyByHash(ctx, keyHash)
+	if err != nil || got != nil {
+		t.Errorf("want nil after the key is deleted, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,18 @@
+package apikeys
+
+import (
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type APIKeyRepository struct {
+	col *mongo.Collection
+	l   *zerolog.Logger
+}
+
+func NewRepository(logger *zerolog.Logger, collection *mongo.Collection) *APIKeyRepository {
+	return &APIKeyRepository{
+		col: collection,
+		l:   logger,
+	}
+}
@@ -0,0 +1,23 @@
+package audit
+
+import "github.com/unnamedxaer/gymm-api/entities"
+
+func mapAuditEventToEntity(data *auditEventData) *entities.AuditEvent {
+	e := entities.AuditEvent{
+		ID:        data.ID.Hex(),
+		Action:    entities.AuditAction(data.Action),
+		RecordID:  data.RecordID,
+		IP:        data.IP,
+		UserAgent: data.UserAgent,
+		Before:    data.Before,
+		After:     data.After,
+		CreatedAt: data.CreatedAt.UTC(),
+	}
+	if !data.ActorID.IsZero() {
+		e.ActorID = data.ActorID.Hex()
+	}
+	if !data.UserID.IsZero() {
+		e.UserID = data.UserID.Hex()
+	}
+	return &e
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type auditEventData struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	Action  string             `bson:"action"`
+	ActorID primitive.ObjectID `bson:"actor_id,omitempty"`
+	UserID  primitive.ObjectID `bson:"user_id,omitempty"`
+	// RecordID is kept as a string, the changed data does not have to be identified by the ObjectID
+	RecordID  string                 `bson:"record_id,omitempty"`
+	IP        string                 `bson:"ip,omitempty"`
+	UserAgent string                 `bson:"user_agent,omitempty"`
+	Before    map[string]interface{} `bson:"before,omitempty"`
+	After     map[string]interface{} `bson:"after,omitempty"`
+	CreatedAt time.Time              `bson:"created_at"`
+}
+
+// optionalObjectID converts the ID which may be missing, eg. the actor of the anonymous request
+func optionalObjectID(id string) (primitive.ObjectID, error) {
+	if id == "" {
+		return primitive.NilObjectID, nil
+	}
+	oID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, usecases.NewErrorInvalidID(id, "user")
+	}
+	return oID, nil
+}
+
+// InsertAuditEvent appends the event, there is no way to change or remove the stored events
+func (repo *AuditRepository) InsertAuditEvent(
+	ctx context.Context,
+	event *entities.AuditEvent) (*entities.AuditEvent, error) {
+	actorOID, err := optionalObjectID(event.ActorID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "auditRepo.InsertAuditEvent")
+	}
+	userOID, err := optionalObjectID(event.UserID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "auditRepo.InsertAuditEvent")
+	}
+
+	data := auditEventData{
+		Action:    string(event.Action),
+		ActorID:   actorOID,
+		UserID:    userOID,
+		RecordID:  event.RecordID,
+		IP:        event.IP,
+		UserAgent: event.UserAgent,
+		Before:    event.Before,
+		After:     event.After,
+		CreatedAt: event.CreatedAt,
+	}
+
+	result, err := repo.col.InsertOne(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "auditRepo.InsertAuditEvent")
+	}
+
+	var ok bool
+	data.ID, ok = result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("auditRepo.InsertAuditEvent: ID assert failed")
+	}
+
+	return mapAuditEventToEntity(&data), nil
+}
+
+func (repo *AuditRepository) GetAuditEvents(
+	ctx context.Context,
+	userID string,
+	actions []entities.AuditAction,
+	beforeID string,
+	limit int64) ([]entities.AuditEvent, error) {
+	userOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "auditRepo.GetAuditEvents")
+	}
+
+	filter := bson.M{"user_id": userOID, "action": bson.M{"$in": actions}}
+	if beforeID != "" {
+		beforeOID, err := primitive.ObjectIDFromHex(beforeID)
+		if err != nil {
+			return nil, errors.WithMessage(
+				usecases.NewErrorInvalidID(beforeID, "audit event"), "auditRepo.GetAuditEvents")
+		}
+		filter["_id"] = bson.M{"$lt": beforeOID}
+	}
+
+	// the IDs grow with the insertion time, so they are the stable order of the pages
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit)
+	cursor, err := repo.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.WithMessage(err, "auditRepo.GetAuditEvents")
+	}
+
+	data := []auditEventData{}
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "auditRepo.GetAuditEvents")
+	}
+
+	events := make([]entities.AuditEvent, len(data))
+	for i := range data {
+		events[i] = *mapAuditEventToEntity(&data[i])
+	}
+	return events, nil
+}
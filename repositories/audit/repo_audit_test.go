@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/repositories"
+	"github.com/unnamedxaer/gymm-api/testhelpers"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	auditRepo usecases.AuditRepo
+)
+
+func TestMain(m *testing.M) {
+	testhelpers.EnsureTestEnv()
+	loggerMock := zerolog.New(nil)
+
+	dbName := os.Getenv("DB_NAME")
+	if dbName == "" {
+		log.Fatalln("environment variable 'DB_NAME' is not set")
+	}
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Fatalln("environment variable 'MONGO_URI' is not set")
+	}
+	db, err := repositories.GetDatabase(&loggerMock, mongoURI, dbName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = repositories.CreateCollections(&loggerMock, db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer testhelpers.DisconnectDB(&loggerMock, db)
+
+	col := db.Collection(repositories.AuditEventsCollectionName)
+	auditRepo = NewRepository(&loggerMock, col)
+
+	os.Exit(m.Run())
+}
+
+func TestInsertAuditEvent(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	event := entities.AuditEvent{
+		Action:    entities.AuditActionAdminDisableUser,
+		ActorID:   mocks.AdminUserID,
+		UserID:    mocks.UserID,
+		IP:        "127.0.0.1",
+		UserAgent: "repo test",
+		Before:    map[string]interface{}{"disabled": false},
+		After:     map[string]interface{}{"disabled": true},
+		CreatedAt: now,
+	}
+	got, err := auditRepo.InsertAuditEvent(ctx, &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID == "" || got.ActorID != event.ActorID || got.UserID != event.UserID ||
+		got.Action != event.Action || !got.CreatedAt.Equal(now) {
+		t.Errorf("want stored event like %+v, got %+v", event, got)
+	}
+
+	// the anonymous actor, eg. of the failed login
+	event.ActorID = ""
+	got, err = auditRepo.InsertAuditEvent(ctx, &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ActorID != "" {
+		t.Errorf("want event without actor, got %q", got.ActorID)
+	}
+
+	event.UserID = "INVALIDID"
+	_, err = auditRepo.InsertAuditEvent(ctx, &event)
+	var idErr *usecases.InvalidIDError
+	if !errors.As(err, &idErr) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorInvalidID(event.UserID, "user"), err)
+	}
+}
+
+func TestGetAuditEvents(t *testing.T) {
+	ctx := context.TODO()
+	// a new user, so the events of the other tests do not interfere
+	userID := primitive.NewObjectID().Hex()
+
+	stored := make([]*entities.AuditEvent, 0, 3)
+	for _, a := range []entities.AuditAction{
+		entities.AuditActionLoginFailed,
+		entities.AuditActionExerciseCreated,
+		entities.AuditActionLoginSucceeded,
+	} {
+		got, err := auditRepo.InsertAuditEvent(ctx, &entities.AuditEvent{
+			Action:    a,
+			UserID:    userID,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored = append(stored, got)
+	}
+
+	events, err := auditRepo.GetAuditEvents(ctx, userID, entities.SecurityAuditActions, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != stored[2].ID || events[1].ID != stored[0].ID {
+		t.Fatalf("want login events, the newest first, got %+v", events)
+	}
+
+	events, err = auditRepo.GetAuditEvents(ctx, userID, entities.SecurityAuditActions, stored[2].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].ID != stored[0].ID {
+		t.Errorf("want the events before %q, got %+v", stored[2].ID, events)
+	}
+
+	_, err = auditRepo.GetAuditEvents(ctx, userID, entities.SecurityAuditActions, "INVALIDID", 10)
+	var idErr *usecases.InvalidIDError
+	if !errors.As(err, &idErr) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorInvalidID("INVALIDID", "audit event"), err)
+	}
+}
@@ -0,0 +1,18 @@
+package audit
+
+import (
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AuditRepository struct {
+	col *mongo.Collection
+	l   *zerolog.Logger
+}
+
+func NewRepository(logger *zerolog.Logger, collection *mongo.Collection) *AuditRepository {
+	return &AuditRepository{
+		col: collection,
+		l:   logger,
+	}
+}
@@ -1,11 +1,33 @@
 package auth
 
-import "github.com/unnamedxaer/gymm-api/entities"
+import (
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/repositories/users"
+)
+
+func mapUserToAuthEntity(ud *users.UserData) *entities.AuthUser {
+	u := &entities.AuthUser{
+		User:     users.MapUserToEntity(ud),
+		Password: ud.Password,
+	}
+
+	if tf := ud.TwoFactor; tf != nil {
+		u.TwoFactor = &entities.TwoFactor{
+			Secret:        tf.Secret,
+			Enabled:       tf.Enabled,
+			LastUsedStep:  tf.LastUsedStep,
+			RecoveryCodes: tf.RecoveryCodes,
+		}
+	}
+
+	return u
+}
 
 func mapRefreshTokenToEntity(data *refreshTokenData) *entities.RefreshToken {
 	return &entities.RefreshToken{
 		ID:        data.ID.Hex(),
 		UserID:    data.UserID.Hex(),
+		Device:    data.Device,
 		Token:     data.Token,
 		CreatedAt: data.CreatedAt.UTC(),
 		ExpiresAt: data.ExpiresAt.UTC(),
@@ -32,3 +54,20 @@ func mapTokensToEntities(data []tokenData) []entities.UserToken {
 	}
 	return tokens
 }
+
+func mapLoginAttemptsToEntity(data *loginAttemptsData) *entities.LoginAttempts {
+	return &entities.LoginAttempts{
+		Key:         data.Key,
+		Failures:    data.Failures,
+		LockedUntil: data.LockedUntil.UTC(),
+		ExpiresAt:   data.ExpiresAt.UTC(),
+	}
+}
+
+func mapLoginAttemptsToEntities(data []loginAttemptsData) []entities.LoginAttempts {
+	attempts := make([]entities.LoginAttempts, len(data))
+	for i := 0; i < len(data); i++ {
+		attempts[i] = *mapLoginAttemptsToEntity(&data[i])
+	}
+	return attempts
+}
@@ -25,16 +25,24 @@ type tokenData struct {
 }
 
 type refreshTokenData struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	UserID    primitive.ObjectID `bson:"user_id,omitempty"`
-	Token     string             `bson:"token,omitempty"`
-	CreatedAt time.Time          `bson:"created_at,omitempty"`
-	ExpiresAt time.Time          `bson:"expires_at,omitempty"`
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	UserID primitive.ObjectID `bson:"user_id,omitempty"`
+	Device string             `bson:"device,omitempty"`
+	Token  string             `bson:"token,omitempty"`
+	// UsedTokens are the tokens of the same family replaced by the rotation
+	UsedTokens []string  `bson:"used_tokens,omitempty"`
+	CreatedAt  time.Time `bson:"created_at,omitempty"`
+	ExpiresAt  time.Time `bson:"expires_at,omitempty"`
 }
 
+// maxUsedRefreshTokens limits the number of rotated tokens kept for the reuse detection,
+// older ones are just not valid anymore
+const maxUsedRefreshTokens = 100
+
 type resetPwdData struct {
 	ID           primitive.ObjectID      `bson:"_id,omitempty"`
 	EmailAddress string                  `bson:"email_address,omitempty"`
+	TokenHash    string                  `bson:"token_hash,omitempty"`
 	Status       entities.ResetPwdStatus `bson:"status,omitempty"`
 	ExpiresAt    time.Time               `bson:"expires_at,omitempty"`
 	CreatedAt    time.Time               `bson:"created_at,omitempty"`
@@ -64,16 +72,7 @@ func (repo *AuthRepository) GetUserByEmailAddress(
 		return nil, errors.WithMessage(err, "authRepo.GetUserByEmailAddress")
 	}
 
-	u := &entities.AuthUser{
-		User: entities.User{
-			ID:           ud.ID.Hex(),
-			EmailAddress: ud.EmailAddress,
-			Username:     ud.Username,
-			CreatedAt:    ud.CreatedAt,
-		},
-		Password: ud.Password,
-	}
-	return u, nil
+	return mapUserToAuthEntity(&ud), nil
 }
 
 func (repo *AuthRepository) GetUserByID(ctx context.Context, id string) (*entities.AuthUser, error) {
@@ -96,16 +95,7 @@ func (repo *AuthRepository) GetUserByID(ctx context.Context, id string) (*entiti
 		return nil, errors.WithMessage(err, "authRepo.GetUserByID")
 	}
 
-	u := &entities.AuthUser{
-		User: entities.User{
-			ID:           ud.ID.Hex(),
-			EmailAddress: ud.EmailAddress,
-			Username:     ud.Username,
-			CreatedAt:    ud.CreatedAt,
-		},
-		Password: ud.Password,
-	}
-	return u, nil
+	return mapUserToAuthEntity(&ud), nil
 }
 
 func (repo *AuthRepository) ChangePassword(ctx context.Context, userID string, newPwd []byte) error {
@@ -138,14 +128,44 @@ func (repo *AuthRepository) ChangePassword(ctx context.Context, userID string, n
 	return nil
 }
 
-func (repo *AuthRepository) AddResetPasswordRequest(ctx context.Context, emailaddress string, expiresAt time.Time) (*entities.ResetPwdReq, error) {
+func (repo *AuthRepository) ReplacePasswordHash(
+	ctx context.Context,
+	userID string,
+	oldHash,
+	newHash []byte) (bool, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.ReplacePasswordHash")
+	}
+
+	// the password changed in the meantime does not match the filter
+	filter := bson.M{"_id": uOID, "password": oldHash}
+	update := bson.M{"$set": bson.M{"password": newHash}}
+
+	result, err := repo.usersCol.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, errors.WithMessage(err, "authRepo.ReplacePasswordHash")
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+func (repo *AuthRepository) AddResetPasswordRequest(
+	ctx context.Context,
+	emailaddress string,
+	tokenHash string,
+	expiresAt time.Time) (*entities.ResetPwdReq, error) {
 	if expiresAt.Before(time.Now()) {
 		return nil, errors.New("expiration time from the past")
 	}
 
 	cb := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// password of not verified email address cannot be reset,
+		// it might have been misspelled and belong to somebody else
 		userFilter := bson.M{
-			"email_address": emailaddress,
+			"email_address":      emailaddress,
+			"email_verification": bson.M{"$exists": false},
 		}
 		countRes, err := repo.usersCol.CountDocuments(sessCtx, userFilter)
 		if err != nil {
@@ -160,6 +180,7 @@ func (repo *AuthRepository) AddResetPasswordRequest(ctx context.Context, emailad
 
 		insert := resetPwdData{
 			EmailAddress: emailaddress,
+			TokenHash:    tokenHash,
 			Status:       entities.ResetPwdStatusNoActionYet,
 			ExpiresAt:    expiresAt,
 			CreatedAt:    time.Now(),
@@ -237,25 +258,45 @@ func (repo *AuthRepository) AddResetPasswordRequest(ctx context.Context, emailad
 	return &resetPwdReq, nil
 }
 
-func (repo *AuthRepository) UpdatePasswordForResetRequest(ctx context.Context, reqID string, pwdHash []byte) error {
+// CountResetPasswordRequests returns the number of reset password requests
+// for the email address created since given time
+func (repo *AuthRepository) CountResetPasswordRequests(
+	ctx context.Context,
+	emailaddress string,
+	since time.Time) (int64, error) {
+	filter := bson.M{
+		"email_address": emailaddress,
+		"created_at":    bson.M{"$gte": since},
+	}
+
+	n, err := repo.resetPwdCol.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, errors.WithMessage(err, "authRepo.CountResetPasswordRequests")
+	}
+	return n, nil
+}
+
+func (repo *AuthRepository) UpdatePasswordForResetRequest(
+	ctx context.Context,
+	tokenHash string,
+	pwdHash []byte) (*entities.User, error) {
 	label := "reset password request"
 	if len(pwdHash) == 0 {
-		return errors.WithMessage(fmt.Errorf("missing password"), label)
+		return nil, errors.WithMessage(fmt.Errorf("missing password"), label)
 	}
 
-	reqOID, err := primitive.ObjectIDFromHex(reqID)
-	if err != nil {
-		return errors.WithMessage(
-			usecases.NewErrorInvalidID(reqID, label), label)
+	if tokenHash == "" {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(tokenHash, label), label)
 	}
 
 	cb := func(sessCtx mongo.SessionContext) (interface{}, error) {
 		reqFilter := bson.M{
-			"_id": reqOID,
+			"token_hash": tokenHash,
 		}
 		// @i: probably we can findOneAndUpdate to not call update later
 		result := repo.resetPwdCol.FindOne(sessCtx, reqFilter)
-		if err = result.Err(); err != nil {
+		if err := result.Err(); err != nil {
 			if err.Error() == "mongo: no documents in result" {
 				return nil, usecases.NewErrorRecordNotExists(label)
 			}
@@ -264,7 +305,7 @@ func (repo *AuthRepository) UpdatePasswordForResetRequest(ctx context.Context, r
 
 		req := resetPwdData{}
 
-		err = result.Decode(&req)
+		err := result.Decode(&req)
 		if err != nil {
 			return nil, err
 		}
@@ -334,30 +375,36 @@ func (repo *AuthRepository) UpdatePasswordForResetRequest(ctx context.Context, r
 			Password: pwdHash,
 		}}
 
-		updateResult, err = repo.usersCol.UpdateOne(sessCtx, userFilter, userUpdate)
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		var ud users.UserData
+		err = repo.usersCol.FindOneAndUpdate(sessCtx, userFilter, userUpdate, opts).Decode(&ud)
 		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, usecases.NewErrorRecordNotExists("users")
+			}
 			return nil, err
 		}
 
-		if updateResult.MatchedCount == 0 {
-			return nil, usecases.NewErrorRecordNotExists("users")
-		}
-
-		return nil, nil
+		return &mapUserToAuthEntity(&ud).User, nil
 	}
 
 	session, err := repo.resetPwdCol.Database().Client().StartSession()
 	if err != nil {
-		return errors.WithMessagef(err, label+": start session")
+		return nil, errors.WithMessagef(err, label+": start session")
 	}
 	defer session.EndSession(ctx)
 
-	_, err = session.WithTransaction(ctx, cb)
+	transactionResult, err := session.WithTransaction(ctx, cb)
 	if err != nil {
-		return errors.WithMessagef(err, label)
+		return nil, errors.WithMessagef(err, label)
 	}
 
-	return nil
+	user, ok := transactionResult.(*entities.User)
+	if !ok {
+		return nil, fmt.Errorf(label + ": session results assertion not of type *entities.User")
+	}
+
+	return user, nil
 }
 
 func (repo *AuthRepository) GetUserJWTs(
@@ -442,6 +489,24 @@ func (repo *AuthRepository) SaveJWT(
 	return out, nil
 }
 
+func (repo *AuthRepository) IsJWTStored(
+	ctx context.Context,
+	userID string,
+	token string) (bool, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.IsJWTStored")
+	}
+
+	filter := bson.M{"user_id": uOID, "token": token}
+	n, err := repo.tokensCol.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, errors.WithMessage(err, "authRepo.IsJWTStored")
+	}
+	return n > 0, nil
+}
+
 func (repo *AuthRepository) DeleteJWT(
 	ctx context.Context,
 	ut *entities.UserToken) (int64, error) {
@@ -486,25 +551,55 @@ func (repo *AuthRepository) DeleteJWT(
 func (repo *AuthRepository) SaveRefreshToken(
 	ctx context.Context,
 	userID string,
+	device string,
 	token string,
+	previous string,
 	expiresAt time.Time) (*entities.RefreshToken, error) {
 	uOID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, errors.WithMessage(err, "authRepo.SaveRefreshToken")
 	}
 
-	filter := bson.M{"user_id": uOID}
-	update := bson.M{"$set": refreshTokenData{
-		UserID:    uOID,
-		Token:     token,
-		CreatedAt: time.Now(),
-		ExpiresAt: expiresAt,
-	}}
-
-	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	filter := bson.M{"user_id": uOID, "device": device}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var update bson.M
+	if previous == "" {
+		// new token family of the device, forget tokens rotated within the previous one
+		update = bson.M{
+			"$set": bson.M{
+				"user_id":    uOID,
+				"device":     device,
+				"token":      token,
+				"created_at": time.Now(),
+				"expires_at": expiresAt,
+			},
+			"$unset": bson.M{"used_tokens": ""},
+		}
+		opts.SetUpsert(true)
+	} else {
+		// rotation succeeds only for the current, not expired token,
+		// the replaced one is kept to detect its reuse
+		delete(filter, "device")
+		filter["token"] = previous
+		filter["expires_at"] = bson.M{"$gt": time.Now()}
+		update = bson.M{
+			"$set": bson.M{
+				"token":      token,
+				"created_at": time.Now(),
+				"expires_at": expiresAt,
+			},
+			"$push": bson.M{"used_tokens": bson.M{
+				"$each":  bson.A{previous},
+				"$slice": -maxUsedRefreshTokens,
+			}},
+		}
+	}
 
-	result := repo.refTokensCol.FindOneAndUpdate(ctx, &filter, &update, opts)
+	result := repo.refTokensCol.FindOneAndUpdate(ctx, filter, update, opts)
 	if err = result.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
 		return nil, errors.WithMessage(err, "authRepo.SaveRefreshToken")
 	}
 
@@ -520,17 +615,19 @@ func (repo *AuthRepository) SaveRefreshToken(
 
 func (repo *AuthRepository) GetRefreshToken(
 	ctx context.Context,
-	userID string) (*entities.RefreshToken, error) {
+	userID string,
+	device string) (*entities.RefreshToken, error) {
 	uOID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, errors.WithMessage(err, "authRepo.GetRefreshToken")
 	}
 
-	filter := refreshTokenData{
-		UserID: uOID,
+	filter := bson.M{
+		"user_id": uOID,
+		"device":  device,
 	}
 
-	result := repo.refTokensCol.FindOne(ctx, &filter)
+	result := repo.refTokensCol.FindOne(ctx, filter)
 	if err = result.Err(); err != nil {
 		if err.Error() == "mongo: no documents in result" {
 			return nil, nil
@@ -548,18 +645,47 @@ func (repo *AuthRepository) GetRefreshToken(
 	return rt, nil
 }
 
+// GetRefreshTokenByToken finds the refresh token family that the token belongs to,
+// the returned token differs from the given one if it has been already rotated
+func (repo *AuthRepository) GetRefreshTokenByToken(
+	ctx context.Context,
+	token string) (*entities.RefreshToken, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"token": token},
+		bson.M{"used_tokens": token},
+	}}
+
+	result := repo.refTokensCol.FindOne(ctx, filter)
+	if err := result.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "authRepo.GetRefreshTokenByToken")
+	}
+
+	data := &refreshTokenData{}
+	err := result.Decode(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "authRepo.GetRefreshTokenByToken: decode")
+	}
+
+	return mapRefreshTokenToEntity(data), nil
+}
+
 func (repo *AuthRepository) DeleteRefreshToken(
 	ctx context.Context,
-	userID string) (n int64, err error) {
+	userID string,
+	device string) (n int64, err error) {
 	uOID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return 0, errors.WithMessage(err, "authRepo.DeleteRefreshToken")
 	}
-	filter := refreshTokenData{
-		UserID: uOID,
+	filter := bson.M{
+		"user_id": uOID,
+		"device":  device,
 	}
 
-	result, err := repo.tokensCol.DeleteMany(ctx, &filter)
+	result, err := repo.refTokensCol.DeleteMany(ctx, &filter)
 	if err != nil {
 		if err.Error() == "mongo: no documents in result" {
 			return result.DeletedCount, nil
@@ -569,8 +695,8 @@ func (repo *AuthRepository) DeleteRefreshToken(
 	}
 
 	repo.l.Debug().Msgf(
-		"authRepo.DeleteRefreshToken userID: %q, deleteCnt: %d",
-		userID, result.DeletedCount)
+		"authRepo.DeleteRefreshToken userID: %q, device: %q, deleteCnt: %d",
+		userID, device, result.DeletedCount)
 
 	return result.DeletedCount, nil
 }
@@ -635,3 +761,585 @@ func (repo *AuthRepository) DeleteRefreshTokenAndAllTokens(
 
 	return n, nil
 }
+
+// DeleteExpiredJWTs removes jwt tokens that expired before given time
+func (repo *AuthRepository) DeleteExpiredJWTs(
+	ctx context.Context,
+	before time.Time) (int64, error) {
+	filter := bson.M{"expires_at": bson.M{"$lt": before}}
+
+	result, err := repo.tokensCol.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, errors.WithMessage(err, "authRepo.DeleteExpiredJWTs")
+	}
+
+	return result.DeletedCount, nil
+}
+
+// DeleteExpiredRefreshTokens removes refresh tokens that expired before given time
+func (repo *AuthRepository) DeleteExpiredRefreshTokens(
+	ctx context.Context,
+	before time.Time) (int64, error) {
+	filter := bson.M{"expires_at": bson.M{"$lt": before}}
+
+	result, err := repo.refTokensCol.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, errors.WithMessage(err, "authRepo.DeleteExpiredRefreshTokens")
+	}
+
+	return result.DeletedCount, nil
+}
+
+// DeleteExpiredResetPasswordRequests removes reset password requests that expired before given time
+func (repo *AuthRepository) DeleteExpiredResetPasswordRequests(
+	ctx context.Context,
+	before time.Time) (int64, error) {
+	filter := bson.M{"expires_at": bson.M{"$lt": before}}
+
+	result, err := repo.resetPwdCol.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, errors.WithMessage(err, "authRepo.DeleteExpiredResetPasswordRequests")
+	}
+
+	return result.DeletedCount, nil
+}
+
+// SaveEmailVerificationToken replaces the pending email verification token of the user,
+// it returns RecordNotExistsError if the user's email address is already verified
+func (repo *AuthRepository) SaveEmailVerificationToken(
+	ctx context.Context,
+	userID string,
+	token string,
+	expiresAt time.Time) error {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.SaveEmailVerificationToken")
+	}
+
+	filter := bson.M{
+		"_id":                uOID,
+		"email_verification": bson.M{"$exists": true},
+	}
+	update := bson.M{"$set": bson.M{"email_verification": users.EmailVerificationData{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}}}
+
+	result, err := repo.usersCol.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.WithMessage(err, "authRepo.SaveEmailVerificationToken")
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.WithMessage(
+			usecases.NewErrorRecordNotExists("email verification"),
+			"authRepo.SaveEmailVerificationToken")
+	}
+
+	return nil
+}
+
+// VerifyEmailAddress marks email address of the user with given, not expired token as verified,
+// the pending email address with the token replaces the current one.
+// It returns EmailAddressInUseError if the pending address was taken in the meantime and nil if there is no such user
+func (repo *AuthRepository) VerifyEmailAddress(
+	ctx context.Context,
+	token string) (*entities.User, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	filter := bson.M{
+		"email_verification.token":      token,
+		"email_verification.expires_at": bson.M{"$gt": time.Now()},
+	}
+	update := bson.M{"$unset": bson.M{"email_verification": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var ud users.UserData
+	err := repo.usersCol.FindOneAndUpdate(ctx, filter, update, opts).Decode(&ud)
+	if err == mongo.ErrNoDocuments {
+		return repo.verifyEmailChange(ctx, token)
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "authRepo.VerifyEmailAddress")
+	}
+
+	return &mapUserToAuthEntity(&ud).User, nil
+}
+
+// verifyEmailChange replaces the user's email address with the pending one with given, not expired token,
+// the unique index on the email addresses refuses the address taken in the meantime
+func (repo *AuthRepository) verifyEmailChange(
+	ctx context.Context,
+	token string) (*entities.User, error) {
+	filter := bson.M{
+		"email_change.token":      token,
+		"email_change.expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	var ud users.UserData
+	err := repo.usersCol.FindOne(ctx, filter).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "authRepo.verifyEmailChange")
+	}
+
+	// the token is checked again as the change could be replaced since the read
+	filter = bson.M{
+		"_id":                ud.ID,
+		"email_change.token": token,
+	}
+	update := bson.M{
+		"$set": bson.M{"email_address": ud.EmailChange.PendingEmailAddress},
+		// the link proves the ownership of the new address
+		"$unset": bson.M{"email_change": "", "email_verification": ""},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var verified users.UserData
+	err = repo.usersCol.FindOneAndUpdate(ctx, filter, update, opts).Decode(&verified)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		if usecases.IsDuplicatedError(err) {
+			return nil, errors.WithMessage(
+				usecases.NewErrorEmailAddressInUse(), "authRepo.verifyEmailChange")
+		}
+		return nil, errors.WithMessage(err, "authRepo.verifyEmailChange")
+	}
+
+	return &mapUserToAuthEntity(&verified).User, nil
+}
+
+// ChangeEmailAddress sets the pending email address of the user with its verification token,
+// the current address is kept until the pending one gets verified.
+// It returns EmailAddressInUseError if the address belongs to another user and nil if there is no such user
+func (repo *AuthRepository) ChangeEmailAddress(
+	ctx context.Context,
+	userID string,
+	emailAddress string,
+	token string,
+	expiresAt time.Time) (*entities.User, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.ChangeEmailAddress")
+	}
+
+	// the address can still be taken before it is verified, the verification checks it again
+	n, err := repo.usersCol.CountDocuments(ctx, bson.M{"email_address": emailAddress})
+	if err != nil {
+		return nil, errors.WithMessage(err, "authRepo.ChangeEmailAddress")
+	}
+	if n > 0 {
+		return nil, errors.WithMessage(
+			usecases.NewErrorEmailAddressInUse(), "authRepo.ChangeEmailAddress")
+	}
+
+	update := bson.M{"$set": bson.M{
+		"email_change": users.EmailChangeData{
+			PendingEmailAddress: emailAddress,
+			Token:               token,
+			ExpiresAt:           expiresAt,
+		},
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var ud users.UserData
+	err = repo.usersCol.FindOneAndUpdate(ctx, bson.M{"_id": uOID}, update, opts).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "authRepo.ChangeEmailAddress")
+	}
+
+	return &mapUserToAuthEntity(&ud).User, nil
+}
+
+// DeleteUserAccount removes the user whose deletion was scheduled before given time together with
+// the user's tokens, refresh tokens and reset password requests, nothing is removed if there is no such user
+func (repo *AuthRepository) DeleteUserAccount(
+	ctx context.Context,
+	userID string,
+	scheduledBefore time.Time) error {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.DeleteUserAccount")
+	}
+
+	filter := bson.M{
+		"_id":                   uOID,
+		"deletion_scheduled_at": bson.M{"$lte": scheduledBefore},
+	}
+
+	cb := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var ud users.UserData
+		err := repo.usersCol.FindOne(sessCtx, filter).Decode(&ud)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, nil
+			}
+			return nil, errors.WithMessage(err, "authRepo.DeleteUserAccount: user")
+		}
+
+		_, err = repo.tokensCol.DeleteMany(sessCtx, bson.M{"user_id": uOID})
+		if err != nil {
+			return nil, errors.WithMessage(err, "authRepo.DeleteUserAccount: tokens")
+		}
+
+		_, err = repo.refTokensCol.DeleteMany(sessCtx, bson.M{"user_id": uOID})
+		if err != nil {
+			return nil, errors.WithMessage(err, "authRepo.DeleteUserAccount: refresh tokens")
+		}
+
+		_, err = repo.resetPwdCol.DeleteMany(sessCtx, bson.M{"email_address": ud.EmailAddress})
+		if err != nil {
+			return nil, errors.WithMessage(err, "authRepo.DeleteUserAccount: reset password requests")
+		}
+
+		_, err = repo.usersCol.DeleteOne(sessCtx, filter)
+		if err != nil {
+			return nil, errors.WithMessage(err, "authRepo.DeleteUserAccount: user")
+		}
+		return nil, nil
+	}
+
+	session, err := repo.usersCol.Database().Client().StartSession()
+	if err != nil {
+		return errors.WithMessage(err, "authRepo.DeleteUserAccount")
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, cb)
+	return err
+}
+
+// SaveTwoFactorSecret starts the two-factor setup of the user with the encrypted secret,
+// it returns RecordNotExistsError if the two-factor authentication is already enabled
+func (repo *AuthRepository) SaveTwoFactorSecret(
+	ctx context.Context,
+	userID string,
+	secret []byte) error {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.SaveTwoFactorSecret")
+	}
+
+	filter := bson.M{
+		"_id":                uOID,
+		"two_factor.enabled": bson.M{"$ne": true},
+	}
+	update := bson.M{"$set": bson.M{"two_factor": users.TwoFactorData{
+		Secret: secret,
+	}}}
+
+	result, err := repo.usersCol.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.WithMessage(err, "authRepo.SaveTwoFactorSecret")
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.WithMessage(
+			usecases.NewErrorRecordNotExists("two-factor setup"), "authRepo.SaveTwoFactorSecret")
+	}
+
+	return nil
+}
+
+// EnableTwoFactor completes the two-factor setup of the user,
+// it returns RecordNotExistsError if there is no setup in progress
+func (repo *AuthRepository) EnableTwoFactor(
+	ctx context.Context,
+	userID string,
+	step int64,
+	recoveryCodes []string) error {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.EnableTwoFactor")
+	}
+
+	filter := bson.M{
+		"_id":                uOID,
+		"two_factor.enabled": false,
+	}
+	update := bson.M{"$set": bson.M{
+		"two_factor.enabled":        true,
+		"two_factor.last_used_step": step,
+		"two_factor.recovery_codes": recoveryCodes,
+	}}
+
+	result, err := repo.usersCol.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.WithMessage(err, "authRepo.EnableTwoFactor")
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.WithMessage(
+			usecases.NewErrorRecordNotExists("two-factor setup"), "authRepo.EnableTwoFactor")
+	}
+
+	return nil
+}
+
+// UseTwoFactorStep marks the TOTP step as used, it returns false
+// if a code of the same or later step has been already used
+func (repo *AuthRepository) UseTwoFactorStep(
+	ctx context.Context,
+	userID string,
+	step int64) (bool, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.UseTwoFactorStep")
+	}
+
+	filter := bson.M{
+		"_id":                       uOID,
+		"two_factor.enabled":        true,
+		"two_factor.last_used_step": bson.M{"$lt": step},
+	}
+	update := bson.M{"$set": bson.M{"two_factor.last_used_step": step}}
+
+	result, err := repo.usersCol.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, errors.WithMessage(err, "authRepo.UseTwoFactorStep")
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// UseRecoveryCode removes the hashed recovery code of the user,
+// it returns false if the user does not have such code
+func (repo *AuthRepository) UseRecoveryCode(
+	ctx context.Context,
+	userID string,
+	code string) (bool, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.UseRecoveryCode")
+	}
+
+	filter := bson.M{
+		"_id":                       uOID,
+		"two_factor.enabled":        true,
+		"two_factor.recovery_codes": code,
+	}
+	update := bson.M{"$pull": bson.M{"two_factor.recovery_codes": code}}
+
+	result, err := repo.usersCol.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, errors.WithMessage(err, "authRepo.UseRecoveryCode")
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// DeleteTwoFactor disables the two-factor authentication of the user and removes its secret
+func (repo *AuthRepository) DeleteTwoFactor(ctx context.Context, userID string) error {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.DeleteTwoFactor")
+	}
+
+	update := bson.M{"$unset": bson.M{"two_factor": ""}}
+	_, err = repo.usersCol.UpdateOne(ctx, bson.M{"_id": uOID}, update)
+	if err != nil {
+		return errors.WithMessage(err, "authRepo.DeleteTwoFactor")
+	}
+
+	return nil
+}
+
+type loginAttemptsData struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Key         string             `bson:"key,omitempty"`
+	Failures    int                `bson:"failures,omitempty"`
+	LockedUntil time.Time          `bson:"locked_until,omitempty"`
+	ExpiresAt   time.Time          `bson:"expires_at,omitempty"`
+}
+
+// GetLoginAttempts returns failed login attempts of the given keys, keys without failures are skipped
+func (repo *AuthRepository) GetLoginAttempts(
+	ctx context.Context,
+	keys []string) ([]entities.LoginAttempts, error) {
+	filter := bson.M{
+		"key": bson.M{"$in": keys},
+		// mongo removes expired documents with a delay
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	cursor, err := repo.loginAttemptsCol.Find(ctx, filter)
+	if err != nil {
+		return nil, errors.WithMessage(err, "authRepo.GetLoginAttempts")
+	}
+
+	data := []loginAttemptsData{}
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "authRepo.GetLoginAttempts")
+	}
+
+	return mapLoginAttemptsToEntities(data), nil
+}
+
+// AddLoginFailure increments the number of failed attempts of the key
+// and postpones forgetting them to expiresAt
+func (repo *AuthRepository) AddLoginFailure(
+	ctx context.Context,
+	key string,
+	expiresAt time.Time) (*entities.LoginAttempts, error) {
+	// expired, not yet removed document starts counting from scratch
+	filter := bson.M{"key": key}
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$expires_at", "$$NOW"}},
+				bson.M{"$add": bson.A{"$failures", 1}},
+				1,
+			}},
+			"expires_at": expiresAt,
+		}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	data := loginAttemptsData{}
+	err := repo.loginAttemptsCol.FindOneAndUpdate(ctx, filter, update, opts).Decode(&data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "authRepo.AddLoginFailure")
+	}
+
+	return mapLoginAttemptsToEntity(&data), nil
+}
+
+// LockLogin rejects login attempts of the key until given time,
+// the failures are not forgotten before the lock ends
+func (repo *AuthRepository) LockLogin(
+	ctx context.Context,
+	key string,
+	until time.Time) error {
+	update := bson.M{
+		"$set": bson.M{"locked_until": until},
+		"$max": bson.M{"expires_at": until},
+	}
+
+	_, err := repo.loginAttemptsCol.UpdateOne(ctx, bson.M{"key": key}, update)
+	if err != nil {
+		return errors.WithMessage(err, "authRepo.LockLogin")
+	}
+
+	return nil
+}
+
+// DeleteLoginAttempts forgets failed login attempts of the key
+func (repo *AuthRepository) DeleteLoginAttempts(ctx context.Context, key string) error {
+	_, err := repo.loginAttemptsCol.DeleteOne(ctx, bson.M{"key": key})
+	if err != nil {
+		return errors.WithMessage(err, "authRepo.DeleteLoginAttempts")
+	}
+
+	return nil
+}
+
+// GetUserByExternalIdentity returns the user with linked account at the OpenID Connect provider,
+// it returns nil if there is no such user
+func (repo *AuthRepository) GetUserByExternalIdentity(
+	ctx context.Context,
+	issuer string,
+	subject string) (*entities.AuthUser, error) {
+	filter := bson.M{
+		"external_identities": bson.M{"$elemMatch": users.ExternalIdentityData{
+			Issuer:  issuer,
+			Subject: subject,
+		}},
+	}
+
+	var ud users.UserData
+	err := repo.usersCol.FindOne(ctx, filter).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "authRepo.GetUserByExternalIdentity")
+	}
+
+	return mapUserToAuthEntity(&ud), nil
+}
+
+// LinkExternalIdentity adds the account at the OpenID Connect provider to the user
+func (repo *AuthRepository) LinkExternalIdentity(
+	ctx context.Context,
+	userID string,
+	issuer string,
+	subject string) error {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "authRepo.LinkExternalIdentity")
+	}
+
+	update := bson.M{"$addToSet": bson.M{"external_identities": users.ExternalIdentityData{
+		Issuer:  issuer,
+		Subject: subject,
+	}}}
+
+	result, err := repo.usersCol.UpdateOne(ctx, bson.M{"_id": uOID}, update)
+	if err != nil {
+		return errors.WithMessage(err, "authRepo.LinkExternalIdentity")
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.WithMessage(
+			usecases.NewErrorRecordNotExists("user"), "authRepo.LinkExternalIdentity")
+	}
+
+	return nil
+}
+
+// CreateUserWithExternalIdentity inserts the user signed up with the OpenID Connect provider,
+// the email address is verified by the provider
+func (repo *AuthRepository) CreateUserWithExternalIdentity(
+	ctx context.Context,
+	username string,
+	emailAddress string,
+	passwordHash []byte,
+	issuer string,
+	subject string) (*entities.User, error) {
+	ud := users.UserData{
+		Username:     username,
+		EmailAddress: emailAddress,
+		Password:     passwordHash,
+		CreatedAt:    time.Now().UTC(),
+		ExternalIdentities: []users.ExternalIdentityData{{
+			Issuer:  issuer,
+			Subject: subject,
+		}},
+	}
+
+	result, err := repo.usersCol.InsertOne(ctx, &ud)
+	if err != nil {
+		if usecases.IsDuplicatedError(err) {
+			return nil, errors.WithMessage(
+				usecases.NewErrorEmailAddressInUse(), "authRepo.CreateUserWithExternalIdentity")
+		}
+		return nil, errors.WithMessage(err, "authRepo.CreateUserWithExternalIdentity")
+	}
+
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("authRepo.CreateUserWithExternalIdentity: ID assert failed")
+	}
+	ud.ID = id
+
+	return &mapUserToAuthEntity(&ud).User, nil
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -53,6 +54,7 @@ func TestMain(m *testing.M) {
 	refTokensCol := db.Collection(repositories.RefreshTokensCollectionName)
 	pwdResReqCol := db.Collection(repositories.ResPwdReqCollectionName)
 	usersCol := db.Collection(repositories.UsersCollectionName)
+	loginAttemptsCol := db.Collection(repositories.LoginAttemptsCollectionName)
 	_, err = usersCol.DeleteOne(context.TODO(), bson.M{"email_address": mocks.NonexistingEmail})
 	if err != nil && err != mongo.ErrNoDocuments {
 		log.Fatalln(err)
@@ -62,12 +64,16 @@ func TestMain(m *testing.M) {
 		mocks.NonexistingUserID = mocks.NonexistingUserID[:len(mocks.NonexistingUserID)-1] + "b"
 	}
 
-	update := bson.M{"$set": users.UserData{
-		Username:     mocks.ExampleUser.Username,
-		EmailAddress: mocks.ExampleUser.EmailAddress,
-		Password:     mocks.PasswordHash,
-		CreatedAt:    time.Now(),
-	}}
+	update := bson.M{
+		"$set": users.UserData{
+			Username:     mocks.ExampleUser.Username,
+			EmailAddress: mocks.ExampleUser.EmailAddress,
+			Password:     mocks.PasswordHash,
+			CreatedAt:    time.Now(),
+		},
+		// password reset is allowed only for the verified email address
+		"$unset": bson.M{"email_verification": ""},
+	}
 
 	result := usersCol.FindOneAndUpdate(context.TODO(),
 		bson.M{"email_address": mocks.ExampleUser.EmailAddress}, update,
@@ -105,7 +111,7 @@ func TestMain(m *testing.M) {
 		mockedUser.Password = data.Password
 	}
 
-	authRepo = NewRepository(&loggerMock, usersCol, tokensCol, refTokensCol, pwdResReqCol)
+	authRepo = NewRepository(&loggerMock, usersCol, tokensCol, refTokensCol, pwdResReqCol, loginAttemptsCol)
 
 	os.Exit(m.Run())
 }
@@ -224,6 +230,39 @@ func TestChangePassword(t *testing.T) {
 	}
 }
 
+func TestReplacePasswordHash(t *testing.T) {
+	ctx := context.TODO()
+	newHash := append([]byte{}, mocks.PasswordHash...)
+	newHash = append(newHash, 'a', 'b')
+
+	_, err := authRepo.ReplacePasswordHash(ctx, mocks.UserID+"🐼", mocks.PasswordHash, newHash)
+	if err == nil || !strings.Contains(err.Error(), usecases.NewErrorInvalidID(mocks.UserID+"🐼", "user").Error()) {
+		t.Errorf("want invalid id error, got %v", err)
+	}
+
+	replaced, err := authRepo.ReplacePasswordHash(ctx, mockedUser.ID, []byte("changed meantime"), newHash)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if replaced {
+		t.Errorf("want the hash not to be replaced if the password has changed")
+	}
+
+	replaced, err = authRepo.ReplacePasswordHash(ctx, mockedUser.ID, mocks.PasswordHash, newHash)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !replaced {
+		t.Errorf("want the verified hash to be replaced")
+	}
+
+	// restore default password
+	err = authRepo.ChangePassword(ctx, mockedUser.ID, mocks.PasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestAddResetPasswordRequest(t *testing.T) {
 	testCases := []struct {
 		desc         string
@@ -269,7 +308,8 @@ func TestAddResetPasswordRequest(t *testing.T) {
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 			ctx := context.TODO()
-			pwdResReq, err = authRepo.AddResetPasswordRequest(ctx, tC.emailAddress, tC.expiresAt)
+			tokenHash := fmt.Sprintf("token-hash-%d", time.Now().UnixNano())
+			pwdResReq, err = authRepo.AddResetPasswordRequest(ctx, tC.emailAddress, tokenHash, tC.expiresAt)
 
 			if tC.errTxt == "" {
 				if err != nil {
@@ -305,18 +345,12 @@ func TestAddResetPasswordRequest(t *testing.T) {
 func TestUpdatePasswordForResetRequest(t *testing.T) {
 	ctx := context.TODO()
 
-	pwdResReq, err := authRepo.AddResetPasswordRequest(ctx, mockedUser.EmailAddress, time.Now().AddDate(0, 0, 1))
+	tokenHash := fmt.Sprintf("token-hash-%d", time.Now().UnixNano())
+	_, err := authRepo.AddResetPasswordRequest(ctx, mockedUser.EmailAddress, tokenHash, time.Now().AddDate(0, 0, 1))
 	if err != nil {
 		t.Fatalf("could not inset mock record %v", err)
 	}
 
-	nonexistingReqID := pwdResReq.ID[:len(pwdResReq.ID)-1]
-	if pwdResReq.ID[len(pwdResReq.ID)-1] == 'f' {
-		nonexistingReqID += "e"
-	} else {
-		nonexistingReqID += "f"
-	}
-
 	testCases := []struct {
 		desc     string
 		password []byte
@@ -325,7 +359,7 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 	}{
 		{
 			desc:   "missing pasword",
-			reqID:  mocks.ExampleResetPwdReq.ID,
+			reqID:  tokenHash,
 			errTxt: "missing password",
 		},
 		{
@@ -335,26 +369,35 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 		},
 		{
 			desc:     "not existing request",
-			reqID:    nonexistingReqID,
+			reqID:    tokenHash + "x",
 			password: mocks.PasswordHash,
 			errTxt:   usecases.NewErrorRecordNotExists("reset password request").Error(),
 		},
 		{
 			desc:     "correct",
 			password: mocks.PasswordHash,
-			reqID:    pwdResReq.ID,
+			reqID:    tokenHash,
 			errTxt:   "",
 		},
+		{
+			desc:     "used request",
+			password: mocks.PasswordHash,
+			reqID:    tokenHash,
+			errTxt:   "is not active anymore",
+		},
 	}
 
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 
-			err := authRepo.UpdatePasswordForResetRequest(ctx, tC.reqID, tC.password)
+			u, err := authRepo.UpdatePasswordForResetRequest(ctx, tC.reqID, tC.password)
 			if tC.errTxt == "" {
 				if err != nil {
 					t.Errorf("want nil error, got %q", err)
 				}
+				if u == nil || u.ID != mockedUser.ID {
+					t.Errorf("want user %q, got %v", mockedUser.ID, u)
+				}
 			} else {
 				if err == nil || !strings.Contains(err.Error(), tC.errTxt) {
 					t.Errorf("want error like %q, got %q", tC.errTxt, err)
@@ -407,3 +450,584 @@ func TestGetUserByEmailAddressEmpty(t *testing.T) {
 		t.Errorf("want nil, got: %v", got)
 	}
 }
+
+func TestDeleteExpiredJWTs(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+
+	expired, err := authRepo.SaveJWT(ctx, mockedUser.ID, "expired device",
+		fmt.Sprintf("expired-token-%d", now.UnixNano()), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := authRepo.SaveJWT(ctx, mockedUser.ID, "valid device",
+		fmt.Sprintf("valid-token-%d", now.UnixNano()), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer authRepo.DeleteJWT(ctx, valid)
+
+	n, err := authRepo.DeleteExpiredJWTs(ctx, now)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if n < 1 {
+		t.Errorf("want at least %d deleted token, got %d", 1, n)
+	}
+
+	tokens, err := authRepo.GetUserJWTs(ctx, mockedUser.ID, entities.All)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	foundValid := false
+	for _, ut := range tokens {
+		if ut.Token == expired.Token {
+			t.Errorf("want expired token %q to be deleted", expired.Token)
+		}
+		if ut.Token == valid.Token {
+			foundValid = true
+		}
+	}
+	if !foundValid {
+		t.Errorf("want not expired token %q to be kept", valid.Token)
+	}
+}
+
+func TestIsJWTStored(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+
+	ut, err := authRepo.SaveJWT(ctx, mockedUser.ID, "stored device",
+		fmt.Sprintf("stored-token-%d", now.UnixNano()), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := authRepo.IsJWTStored(ctx, mockedUser.ID, ut.Token)
+	if err != nil || !stored {
+		t.Fatalf("want stored token, got %v, %v", stored, err)
+	}
+
+	stored, err = authRepo.IsJWTStored(ctx, mocks.NonexistingUserID, ut.Token)
+	if err != nil || stored {
+		t.Errorf("want the token not stored for other user, got %v, %v", stored, err)
+	}
+
+	_, err = authRepo.DeleteJWT(ctx, ut)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err = authRepo.IsJWTStored(ctx, mockedUser.ID, ut.Token)
+	if err != nil || stored {
+		t.Errorf("want the deleted token not stored, got %v, %v", stored, err)
+	}
+}
+
+func TestDeleteExpiredResetPasswordRequests(t *testing.T) {
+	ctx := context.TODO()
+
+	tokenHash := fmt.Sprintf("token-hash-%d", time.Now().UnixNano())
+	req, err := authRepo.AddResetPasswordRequest(ctx, mockedUser.EmailAddress, tokenHash, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := authRepo.DeleteExpiredResetPasswordRequests(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("want not expired request %q to be kept, got %d deleted", req.ID, n)
+	}
+
+	n, err = authRepo.DeleteExpiredResetPasswordRequests(ctx, req.ExpiresAt.Add(time.Second))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if n < 1 {
+		t.Errorf("want at least %d deleted request, got %d", 1, n)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+	first := fmt.Sprintf("first-refresh-token-%d", now.UnixNano())
+	second := fmt.Sprintf("second-refresh-token-%d", now.UnixNano())
+	device := "rotation device"
+	defer authRepo.DeleteRefreshToken(ctx, mockedUser.ID, device)
+
+	rt, err := authRepo.SaveRefreshToken(ctx, mockedUser.ID, device, first, "", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt == nil || rt.Token != first {
+		t.Fatalf("want refresh token %q, got %v", first, rt)
+	}
+
+	rt, err = authRepo.SaveRefreshToken(ctx, mockedUser.ID, device, second, first, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt == nil || rt.Token != second {
+		t.Fatalf("want rotated refresh token %q, got %v", second, rt)
+	}
+
+	// already rotated token cannot be rotated again
+	rt, err = authRepo.SaveRefreshToken(ctx, mockedUser.ID, device, "third", first, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt != nil {
+		t.Errorf("want nil for already rotated token, got %v", rt)
+	}
+
+	for _, token := range []string{first, second} {
+		rt, err = authRepo.GetRefreshTokenByToken(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rt == nil || rt.Token != second {
+			t.Errorf("want token family with current token %q for %q, got %v", second, token, rt)
+		}
+	}
+
+	rt, err = authRepo.GetRefreshTokenByToken(ctx, "not-issued-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt != nil {
+		t.Errorf("want nil for unknown token, got %v", rt)
+	}
+}
+
+func TestRefreshTokensPerDevice(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+	devices := []string{"first device", "second device"}
+
+	for _, device := range devices {
+		defer authRepo.DeleteRefreshToken(ctx, mockedUser.ID, device)
+		token := fmt.Sprintf("%s-refresh-token-%d", device, now.UnixNano())
+		_, err := authRepo.SaveRefreshToken(ctx, mockedUser.ID, device, token, "", now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := authRepo.DeleteRefreshToken(ctx, mockedUser.ID, devices[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want %d deleted token, got %d", 1, n)
+	}
+
+	rt, err := authRepo.GetRefreshToken(ctx, mockedUser.ID, devices[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt == nil || rt.Device != devices[1] {
+		t.Errorf("want refresh token of the device %q to be kept, got %v", devices[1], rt)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+	emailAddress := fmt.Sprintf("verify-%d@email.com", now.UnixNano())
+
+	usersCol := authRepo.(*AuthRepository).usersCol
+	usersRepo := users.NewRepository(&zerolog.Logger{}, usersCol)
+	u, err := usersRepo.CreateUser(ctx, "verify", emailAddress, mocks.PasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer usersCol.DeleteOne(ctx, bson.M{"email_address": emailAddress})
+
+	if u.EmailVerified {
+		t.Errorf("want new user's email address not verified")
+	}
+
+	_, err = authRepo.AddResetPasswordRequest(ctx, emailAddress, "token-hash-"+emailAddress, now.Add(time.Minute))
+	if err == nil || !strings.Contains(err.Error(), usecases.NewErrorRecordNotExists("user").Error()) {
+		t.Errorf("want password reset of not verified email address to be refused, got %v", err)
+	}
+
+	expiredToken := fmt.Sprintf("expired-token-%d", now.UnixNano())
+	err = authRepo.SaveEmailVerificationToken(ctx, u.ID, expiredToken, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := authRepo.VerifyEmailAddress(ctx, expiredToken)
+	if err != nil || got != nil {
+		t.Errorf("want nil user for expired token, got %v, %v", got, err)
+	}
+
+	token := fmt.Sprintf("token-%d", now.UnixNano())
+	err = authRepo.SaveEmailVerificationToken(ctx, u.ID, token, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = authRepo.VerifyEmailAddress(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ID != u.ID || !got.EmailVerified {
+		t.Errorf("want verified user %q, got %v", u.ID, got)
+	}
+
+	authUser, err := authRepo.GetUserByEmailAddress(ctx, emailAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !authUser.EmailVerified {
+		t.Errorf("want email address verified")
+	}
+
+	err = authRepo.SaveEmailVerificationToken(ctx, u.ID, token, now.Add(time.Hour))
+	if err == nil || !strings.Contains(err.Error(), usecases.NewErrorRecordNotExists("email verification").Error()) {
+		t.Errorf("want error for already verified email address, got %v", err)
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	ctx := context.TODO()
+	userID := mockedUser.ID
+	defer authRepo.DeleteTwoFactor(ctx, userID)
+
+	err := authRepo.SaveTwoFactorSecret(ctx, userID, []byte("encrypted secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.TwoFactor == nil || u.TwoFactor.Enabled || u.TwoFactorEnabled {
+		t.Fatalf("want not enabled two-factor setup, got %+v", u.TwoFactor)
+	}
+
+	err = authRepo.EnableTwoFactor(ctx, userID, 10, []string{"first", "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = authRepo.SaveTwoFactorSecret(ctx, userID, []byte("other secret"))
+	if err == nil || !strings.Contains(err.Error(), usecases.NewErrorRecordNotExists("two-factor setup").Error()) {
+		t.Errorf("want error for enabled two-factor authentication, got %v", err)
+	}
+
+	for step, want := range map[int64]bool{10: false, 9: false, 11: true} {
+		used, err := authRepo.UseTwoFactorStep(ctx, userID, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != want {
+			t.Errorf("step %d: want %t, got %t", step, want, used)
+		}
+	}
+
+	for code, want := range map[string]bool{"first": true, "unknown": false} {
+		used, err := authRepo.UseRecoveryCode(ctx, userID, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != want {
+			t.Errorf("recovery code %q: want %t, got %t", code, want, used)
+		}
+	}
+
+	u, err = authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.TwoFactorEnabled || u.TwoFactor.LastUsedStep != 11 || len(u.TwoFactor.RecoveryCodes) != 1 {
+		t.Errorf("want enabled two-factor with step %d and %d recovery code, got %+v", 11, 1, u.TwoFactor)
+	}
+
+	err = authRepo.DeleteTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = authRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.TwoFactor != nil {
+		t.Errorf("want two-factor removed, got %+v", u.TwoFactor)
+	}
+}
+
+func TestLoginAttempts(t *testing.T) {
+	ctx := context.TODO()
+	key := "email:" + mockedUser.EmailAddress
+	expired := "ip:127.0.0.1"
+	defer authRepo.DeleteLoginAttempts(ctx, key)
+	defer authRepo.DeleteLoginAttempts(ctx, expired)
+
+	for i := 1; i <= 2; i++ {
+		a, err := authRepo.AddLoginFailure(ctx, key, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Key != key || a.Failures != i {
+			t.Errorf("want %d failures of %q, got %+v", i, key, a)
+		}
+	}
+
+	// the failures of the expired document start over
+	_, err := authRepo.AddLoginFailure(ctx, expired, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := authRepo.AddLoginFailure(ctx, expired, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Failures != 1 {
+		t.Errorf("want failures of expired attempts to be reset, got %d", a.Failures)
+	}
+
+	lockedUntil := time.Now().Add(2 * time.Hour)
+	err = authRepo.LockLogin(ctx, key, lockedUntil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts, err := authRepo.GetLoginAttempts(ctx, []string{key, expired, "ip:not-failed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("want 2 login attempts, got %+v", attempts)
+	}
+	for _, a := range attempts {
+		if a.Key != key {
+			continue
+		}
+		if a.LockedUntil.Sub(lockedUntil).Abs() > time.Second {
+			t.Errorf("want locked until %v, got %v", lockedUntil, a.LockedUntil)
+		}
+		if a.ExpiresAt.Before(a.LockedUntil) {
+			t.Errorf("want attempts to be kept while locked, expires at %v", a.ExpiresAt)
+		}
+	}
+
+	err = authRepo.DeleteLoginAttempts(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts, err = authRepo.GetLoginAttempts(ctx, []string{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 0 {
+		t.Errorf("want no login attempts after delete, got %+v", attempts)
+	}
+}
+
+func TestCountResetPasswordRequests(t *testing.T) {
+	ctx := context.TODO()
+	since := time.Now()
+
+	tokenHash := fmt.Sprintf("token-hash-%d", time.Now().UnixNano())
+	_, err := authRepo.AddResetPasswordRequest(ctx, mockedUser.EmailAddress, tokenHash, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := authRepo.CountResetPasswordRequests(ctx, strings.ToUpper(mockedUser.EmailAddress), since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want %d request since %v, got %d", 1, since, n)
+	}
+
+	n, err = authRepo.CountResetPasswordRequests(ctx, mockedUser.EmailAddress, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("want no requests in the future, got %d", n)
+	}
+}
+
+func TestExternalIdentity(t *testing.T) {
+	ctx := context.TODO()
+	issuer := "https://accounts.example.com"
+	subject := fmt.Sprintf("subject-%d", time.Now().UnixNano())
+
+	u, err := authRepo.GetUserByExternalIdentity(ctx, issuer, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != nil {
+		t.Fatalf("want nil before the identity is linked, got %v", u)
+	}
+
+	err = authRepo.LinkExternalIdentity(ctx, mockedUser.ID, issuer, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err = authRepo.GetUserByExternalIdentity(ctx, issuer, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u == nil || u.ID != mockedUser.ID {
+		t.Errorf("want user %q, got %v", mockedUser.ID, u)
+	}
+
+	// the identity belongs to one user only
+	email := fmt.Sprintf("external-%d@email.com", time.Now().UnixNano())
+	_, err = authRepo.CreateUserWithExternalIdentity(ctx, "External", email, []byte("hash"), issuer, subject)
+	if err == nil {
+		t.Errorf("want error for identity linked to other user")
+	}
+
+	created, err := authRepo.CreateUserWithExternalIdentity(ctx, "External", email, []byte("hash"), issuer, subject+"-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || !created.EmailVerified || created.EmailAddress != email {
+		t.Errorf("want new verified user with email %q, got %+v", email, created)
+	}
+
+	_, err = authRepo.CreateUserWithExternalIdentity(ctx, "External", email, []byte("hash"), issuer, subject+"-other")
+	if !strings.Contains(fmt.Sprint(err), usecases.NewErrorEmailAddressInUse().Error()) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorEmailAddressInUse(), err)
+	}
+}
+
+func TestChangeEmailAddress(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+	emailAddress := fmt.Sprintf("change-%d@email.com", now.UnixNano())
+	newEmailAddress := "new-" + emailAddress
+
+	usersCol := authRepo.(*AuthRepository).usersCol
+	usersRepo := users.NewRepository(&zerolog.Logger{}, usersCol)
+	u, err := usersRepo.CreateUser(ctx, "change", emailAddress, mocks.PasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer usersCol.DeleteOne(ctx, bson.M{"email_address": newEmailAddress})
+
+	// the address of the other user is taken
+	_, err = authRepo.ChangeEmailAddress(ctx, u.ID, mockedUser.EmailAddress, "token-"+emailAddress, now.Add(time.Hour))
+	if !strings.Contains(fmt.Sprint(err), usecases.NewErrorEmailAddressInUse().Error()) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorEmailAddressInUse(), err)
+	}
+
+	token := "token-" + newEmailAddress
+	got, err := authRepo.ChangeEmailAddress(ctx, u.ID, newEmailAddress, token, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.EmailAddress != emailAddress || got.PendingEmailAddress != newEmailAddress {
+		t.Errorf("want %q kept until %q is verified, got %v", emailAddress, newEmailAddress, got)
+	}
+
+	got, err = authRepo.VerifyEmailAddress(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.EmailAddress != newEmailAddress || got.PendingEmailAddress != "" || !got.EmailVerified {
+		t.Errorf("want verified %q, got %v", newEmailAddress, got)
+	}
+
+	got, err = authRepo.VerifyEmailAddress(ctx, token)
+	if err != nil || got != nil {
+		t.Errorf("want nil user for used token, got %v, %v", got, err)
+	}
+
+	// the pending address is taken by another user before it gets verified
+	claimedEmailAddress := "claimed-" + emailAddress
+	claimedToken := "token-" + claimedEmailAddress
+	_, err = authRepo.ChangeEmailAddress(ctx, u.ID, claimedEmailAddress, claimedToken, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = usersRepo.CreateUser(ctx, "claimed", claimedEmailAddress, mocks.PasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer usersCol.DeleteOne(ctx, bson.M{"email_address": claimedEmailAddress})
+
+	_, err = authRepo.VerifyEmailAddress(ctx, claimedToken)
+	if !strings.Contains(fmt.Sprint(err), usecases.NewErrorEmailAddressInUse().Error()) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorEmailAddressInUse(), err)
+	}
+
+	got, err = authRepo.ChangeEmailAddress(ctx, mocks.NonexistingUserID, newEmailAddress+"x", token, now.Add(time.Hour))
+	if err != nil || got != nil {
+		t.Errorf("want nil user for not existing user, got %v, %v", got, err)
+	}
+}
+
+func TestDeleteUserAccount(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+	emailAddress := fmt.Sprintf("delete-%d@email.com", now.UnixNano())
+
+	usersCol := authRepo.(*AuthRepository).usersCol
+	usersRepo := users.NewRepository(&zerolog.Logger{}, usersCol)
+	u, err := usersRepo.CreateUser(ctx, "delete", emailAddress, mocks.PasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = authRepo.SaveJWT(ctx, u.ID, "delete device", "jwt-"+emailAddress, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = authRepo.SaveRefreshToken(ctx, u.ID, "delete device", "refresh-"+emailAddress, "", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deletion is not scheduled
+	err = authRepo.DeleteUserAccount(ctx, u.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := authRepo.GetUserByID(ctx, u.ID)
+	if err != nil || got == nil {
+		t.Fatalf("want user without scheduled deletion kept, got %v, %v", got, err)
+	}
+
+	deleteAt := now.Add(-time.Minute)
+	_, err = usersRepo.SetUserDeletionTime(ctx, u.ID, &deleteAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = authRepo.DeleteUserAccount(ctx, u.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = authRepo.GetUserByID(ctx, u.ID)
+	if err != nil || got != nil {
+		t.Errorf("want deleted user, got %v, %v", got, err)
+	}
+	jwts, err := authRepo.GetUserJWTs(ctx, u.ID, entities.All)
+	if err != nil || len(jwts) != 0 {
+		t.Errorf("want no jwts of deleted user, got %v, %v", jwts, err)
+	}
+	rt, err := authRepo.GetRefreshTokenByToken(ctx, "refresh-"+emailAddress)
+	if err != nil || rt != nil {
+		t.Errorf("want no refresh token of deleted user, got %v, %v", rt, err)
+	}
+
+	// already deleted
+	err = authRepo.DeleteUserAccount(ctx, u.ID, now)
+	if err != nil {
+		t.Errorf("want nil error for not existing user, got %v", err)
+	}
+}
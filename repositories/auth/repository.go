@@ -10,7 +10,9 @@ type AuthRepository struct {
 	tokensCol    *mongo.Collection
 	refTokensCol *mongo.Collection
 	resetPwdCol  *mongo.Collection
-	l            *zerolog.Logger
+	// loginAttemptsCol keeps failed login attempts, mongo removes the expired ones
+	loginAttemptsCol *mongo.Collection
+	l                *zerolog.Logger
 }
 
 func NewRepository(
@@ -18,12 +20,14 @@ func NewRepository(
 	usersCol,
 	tokensCol,
 	refTokensCol,
-	resetPwdCol *mongo.Collection) *AuthRepository {
+	resetPwdCol,
+	loginAttemptsCol *mongo.Collection) *AuthRepository {
 	return &AuthRepository{
-		usersCol:     usersCol,
-		tokensCol:    tokensCol,
-		refTokensCol: refTokensCol,
-		resetPwdCol:  resetPwdCol,
-		l:            logger,
+		usersCol:         usersCol,
+		tokensCol:        tokensCol,
+		refTokensCol:     refTokensCol,
+		resetPwdCol:      resetPwdCol,
+		loginAttemptsCol: loginAttemptsCol,
+		l:                logger,
 	}
 }
@@ -8,6 +8,7 @@ func mapExerciseToEntity(data *ExerciseData) entities.Exercise {
 		Name:        data.Name,
 		Description: data.Description,
 		SetUnit:     data.SetUnit,
+		Aliases:     data.Aliases,
 		CreatedAt:   data.CreatedAt.UTC(),
 		CreatedBy:   data.CreatedBy,
 	}
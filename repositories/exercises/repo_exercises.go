@@ -18,6 +18,7 @@ type ExerciseData struct {
 	Name        string             `bson:"name,omitempty"`
 	Description string             `bson:"description,omitempty"`
 	SetUnit     entities.SetUnit   `bson:"set_unit,omitempty"`
+	Aliases     []string           `bson:"aliases,omitempty"`
 	CreatedAt   time.Time          `bson:"created_at,omitempty"`
 	CreatedBy   string             `bson:"created_by,omitempty"`
 }
@@ -102,16 +103,19 @@ func (repo *ExerciseRepository) UpdateExercise(
 
 	update := bson.D{}
 	if ex.Name != "" {
-		update = append(update, primitive.E{"name", ex.Name})
+		update = append(update, primitive.E{Key: "name", Value: ex.Name})
 	}
 	if ex.Description != "" {
-		update = append(update, primitive.E{"description", ex.Description})
+		update = append(update, primitive.E{Key: "description", Value: ex.Description})
 	}
 	if ex.SetUnit != 0 {
-		update = append(update, primitive.E{"set_unit", ex.SetUnit})
+		update = append(update, primitive.E{Key: "set_unit", Value: ex.SetUnit})
+	}
+	if ex.Aliases != nil {
+		update = append(update, primitive.E{Key: "aliases", Value: ex.Aliases})
 	}
 
-	update = bson.D{{"$set", update}}
+	update = bson.D{{Key: "$set", Value: update}}
 
 	result := repo.col.FindOneAndUpdate(
 		ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
@@ -160,3 +164,113 @@ func (repo *ExerciseRepository) GetExercisesByName(
 	ex := mapExercisesToEntities(data)
 	return ex, nil
 }
+
+// GetExercisesCreatedBy returns the exercises created by the user
+func (repo *ExerciseRepository) GetExercisesCreatedBy(
+	ctx context.Context,
+	userID string) ([]entities.Exercise, error) {
+	cursor, err := repo.col.Find(ctx, bson.M{"created_by": userID})
+	if err != nil {
+		return nil, errors.WithMessage(err, "get exercises created by")
+	}
+
+	data := []ExerciseData{}
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get exercises created by")
+	}
+
+	return mapExercisesToEntities(data), nil
+}
+
+// DeleteExercise removes the exercise, it returns number of deleted exercises
+func (repo *ExerciseRepository) DeleteExercise(
+	ctx context.Context,
+	id string) (int64, error) {
+	exOID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "exercise"),
+			"delete exercise")
+	}
+
+	result, err := repo.col.DeleteOne(ctx, bson.M{"_id": exOID})
+	if err != nil {
+		return 0, errors.WithMessage(err, "delete exercise")
+	}
+	return result.DeletedCount, nil
+}
+
+// AnonymiseExercise removes the creator of the exercise, the exercise stays available to everyone
+func (repo *ExerciseRepository) AnonymiseExercise(
+	ctx context.Context,
+	id string) error {
+	exOID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "exercise"),
+			"anonymise exercise")
+	}
+
+	_, err = repo.col.UpdateOne(ctx, bson.M{"_id": exOID}, bson.M{"$unset": bson.M{"created_by": ""}})
+	if err != nil {
+		return errors.WithMessage(err, "anonymise exercise")
+	}
+	return nil
+}
+
+// GetExercisesByIDs returns the exercises with given ids, the not existing ones are left out
+func (repo *ExerciseRepository) GetExercisesByIDs(
+	ctx context.Context,
+	ids []string) ([]entities.Exercise, error) {
+	oIDs := make([]primitive.ObjectID, len(ids))
+	for i, id := range ids {
+		exOID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, errors.WithMessage(
+				usecases.NewErrorInvalidID(id, "exercise"),
+				"get exercises by ids")
+		}
+		oIDs[i] = exOID
+	}
+
+	cursor, err := repo.col.Find(ctx, bson.M{"_id": bson.M{"$in": oIDs}})
+	if err != nil {
+		return nil, errors.WithMessage(err, "get exercises by ids")
+	}
+
+	data := make([]ExerciseData, 0, len(ids))
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get exercises by ids")
+	}
+
+	return mapExercisesToEntities(data), nil
+}
+
+// GetExercisesByNames returns the exercises whose name or one of the aliases is one of the names,
+// the names are compared case insensitive by the collection's collation
+func (repo *ExerciseRepository) GetExercisesByNames(
+	ctx context.Context,
+	names []string) ([]entities.Exercise, error) {
+	if len(names) == 0 {
+		return []entities.Exercise{}, nil
+	}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"name": bson.M{"$in": names}},
+		bson.M{"aliases": bson.M{"$in": names}},
+	}}
+	cursor, err := repo.col.Find(ctx, filter)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get exercises by names")
+	}
+
+	data := make([]ExerciseData, 0, len(names))
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get exercises by names")
+	}
+
+	return mapExercisesToEntities(data), nil
+}
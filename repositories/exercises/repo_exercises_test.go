@@ -16,6 +16,7 @@ import (
 	"github.com/unnamedxaer/gymm-api/testhelpers"
 	"github.com/unnamedxaer/gymm-api/usecases"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
@@ -256,3 +257,96 @@ func TestGetExercisesByNameNotExisting(t *testing.T) {
 		t.Errorf("want get 0 exercises, got %v", exercises)
 	}
 }
+
+func TestExercisesCreatedBy(t *testing.T) {
+	ctx := context.TODO()
+	userID := primitive.NewObjectID().Hex()
+	kept, err := exerciseRepo.CreateExercise(ctx, "kept exercise", "", entities.Weight, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := exerciseRepo.CreateExercise(ctx, "removed exercise", "", entities.Weight, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := exerciseRepo.GetExercisesCreatedBy(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("want 2 exercises created by %q, got %v", userID, got)
+	}
+
+	err = exerciseRepo.AnonymiseExercise(ctx, kept.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex, err := exerciseRepo.GetExerciseByID(ctx, kept.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex == nil || ex.CreatedBy != "" {
+		t.Errorf("want exercise without creator, got %v", ex)
+	}
+
+	n, err := exerciseRepo.DeleteExercise(ctx, removed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want 1 deleted exercise, got %d", n)
+	}
+
+	got, err = exerciseRepo.GetExercisesCreatedBy(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("want no exercises created by %q, got %v", userID, got)
+	}
+}
+
+func TestGetExercisesByIDs(t *testing.T) {
+	ctx := context.TODO()
+	notExisting := primitive.NewObjectID().Hex()
+
+	got, err := exerciseRepo.GetExercisesByIDs(ctx, []string{mockedExercise.ID, notExisting})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != mockedExercise.ID {
+		t.Errorf("want only exercise %q, got %v", mockedExercise.ID, got)
+	}
+
+	_, err = exerciseRepo.GetExercisesByIDs(ctx, []string{"INVALIDID"})
+	if err == nil {
+		t.Error("want error for invalid id")
+	}
+}
+
+func TestGetExercisesByNames(t *testing.T) {
+	ctx := context.TODO()
+
+	ex, err := exerciseRepo.CreateExercise(ctx, "Front Squat Barbell", "Squat with the bar on the front of the shoulders.", entities.Weight, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = exerciseRepo.UpdateExercise(ctx, &entities.Exercise{ID: ex.ID, Aliases: []string{"Front Squat (Barbell)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := exerciseRepo.GetExercisesByNames(ctx, []string{"front squat (barbell)", strings.ToUpper(mockedExercise.Name), "not existing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("want exercises matched by the alias and the name, got %v", got)
+	}
+	for _, e := range got {
+		if e.ID == ex.ID && (len(e.Aliases) != 1 || e.Aliases[0] != "Front Squat (Barbell)") {
+			t.Errorf("want alias to be stored, got %q", e.Aliases)
+		}
+	}
+}
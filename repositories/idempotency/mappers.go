@@ -0,0 +1,20 @@
+package idempotency
+
+import "github.com/unnamedxaer/gymm-api/entities"
+
+func mapRecordToEntity(data *recordData) *entities.IdempotencyRecord {
+	return &entities.IdempotencyRecord{
+		ID:          data.ID.Hex(),
+		Key:         data.Key,
+		UserID:      data.UserID,
+		Method:      data.Method,
+		Path:        data.Path,
+		RequestHash: data.RequestHash,
+		StatusCode:  data.StatusCode,
+		LockedUntil: data.LockedUntil.UTC(),
+		Header:      data.Header,
+		Body:        data.Body,
+		CreatedAt:   data.CreatedAt.UTC(),
+		ExpiresAt:   data.ExpiresAt.UTC(),
+	}
+}
@@ -0,0 +1,181 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type recordData struct {
+	ID primitive.ObjectID `bson:"_id,omitempty"`
+	// UserID is a string as the requests of not authenticated users
+	// are stored with empty user id
+	UserID      string              `bson:"user_id"`
+	Key         string              `bson:"key,omitempty"`
+	Method      string              `bson:"method,omitempty"`
+	Path        string              `bson:"path,omitempty"`
+	RequestHash []byte              `bson:"request_hash,omitempty"`
+	StatusCode  int                 `bson:"status_code,omitempty"`
+	LockedUntil time.Time           `bson:"locked_until,omitempty"`
+	Header      map[string][]string `bson:"header,omitempty"`
+	Body        []byte              `bson:"body,omitempty"`
+	CreatedAt   time.Time           `bson:"created_at,omitempty"`
+	ExpiresAt   time.Time           `bson:"expires_at,omitempty"`
+}
+
+func (repo *IdempotencyRepository) CreateIdempotencyRecord(
+	ctx context.Context,
+	rec *entities.IdempotencyRecord) (*entities.IdempotencyRecord, error) {
+	if rec.Key == "" {
+		return nil, errors.WithMessage(
+			errors.New("empty key"), "idempotencyRepo.CreateIdempotencyRecord")
+	}
+
+	data := recordData{
+		UserID:      rec.UserID,
+		Key:         rec.Key,
+		Method:      rec.Method,
+		Path:        rec.Path,
+		RequestHash: rec.RequestHash,
+		LockedUntil: rec.LockedUntil,
+		CreatedAt:   rec.CreatedAt,
+		ExpiresAt:   rec.ExpiresAt,
+	}
+
+	result, err := repo.col.InsertOne(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "idempotencyRepo.CreateIdempotencyRecord")
+	}
+
+	var ok bool
+	data.ID, ok = result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		repo.l.Error().Msgf(
+			"idempotencyRepo.CreateIdempotencyRecord: id type assertion failed, id: %v", result.InsertedID)
+	}
+
+	return mapRecordToEntity(&data), nil
+}
+
+func (repo *IdempotencyRepository) GetIdempotencyRecord(
+	ctx context.Context,
+	userID, key string) (*entities.IdempotencyRecord, error) {
+	filter := bson.M{"user_id": userID, "key": key}
+
+	result := repo.col.FindOne(ctx, filter)
+	if err := result.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "idempotencyRepo.GetIdempotencyRecord")
+	}
+
+	var data recordData
+	err := result.Decode(&data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "idempotencyRepo.GetIdempotencyRecord: decode")
+	}
+
+	// the ttl monitor runs once a minute so the document may still exist
+	if data.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+
+	return mapRecordToEntity(&data), nil
+}
+
+func (repo *IdempotencyRepository) ReplaceExpiredIdempotencyRecord(
+	ctx context.Context,
+	rec *entities.IdempotencyRecord) error {
+	filter := bson.M{
+		"user_id":    rec.UserID,
+		"key":        rec.Key,
+		"expires_at": bson.M{"$lt": time.Now()},
+	}
+	data := recordData{
+		UserID:      rec.UserID,
+		Key:         rec.Key,
+		Method:      rec.Method,
+		Path:        rec.Path,
+		RequestHash: rec.RequestHash,
+		LockedUntil: rec.LockedUntil,
+		CreatedAt:   rec.CreatedAt,
+		ExpiresAt:   rec.ExpiresAt,
+	}
+
+	// the upsert inserts the record if the expired one is already removed,
+	// it hits the unique index if the key is taken by the not expired one
+	_, err := repo.col.ReplaceOne(ctx, filter, &data, options.Replace().SetUpsert(true))
+	if err != nil {
+		return errors.WithMessage(err, "idempotencyRepo.ReplaceExpiredIdempotencyRecord")
+	}
+	return nil
+}
+
+func (repo *IdempotencyRepository) LockIdempotencyRecord(
+	ctx context.Context,
+	userID, key string,
+	lockedUntil time.Time) (bool, error) {
+	now := time.Now()
+	// the zero status code is not stored, $not matches also the records without the lease
+	filter := bson.M{
+		"user_id":      userID,
+		"key":          key,
+		"status_code":  bson.M{"$exists": false},
+		"locked_until": bson.M{"$not": bson.M{"$gt": now}},
+		"expires_at":   bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": lockedUntil}}
+
+	result, err := repo.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, errors.WithMessage(err, "idempotencyRepo.LockIdempotencyRecord")
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+func (repo *IdempotencyRepository) SaveIdempotencyResponse(
+	ctx context.Context,
+	userID, key string,
+	statusCode int,
+	header map[string][]string,
+	body []byte) error {
+	filter := bson.M{"user_id": userID, "key": key}
+	update := bson.M{"$set": bson.M{
+		"status_code": statusCode,
+		"header":      header,
+		"body":        body,
+	}}
+
+	result, err := repo.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.WithMessage(err, "idempotencyRepo.SaveIdempotencyResponse")
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.WithMessage(
+			errors.New("no record has been updated"), "idempotencyRepo.SaveIdempotencyResponse")
+	}
+
+	return nil
+}
+
+func (repo *IdempotencyRepository) DeleteIdempotencyRecord(
+	ctx context.Context,
+	userID, key string) (int64, error) {
+	filter := bson.M{"user_id": userID, "key": key}
+
+	result, err := repo.col.DeleteOne(ctx, filter)
+	if err != nil {
+		return 0, errors.WithMessage(err, "idempotencyRepo.DeleteIdempotencyRecord")
+	}
+
+	return result.DeletedCount, nil
+}
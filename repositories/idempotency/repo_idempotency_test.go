@@ -0,0 +1,214 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/repositories"
+	"github.com/unnamedxaer/gymm-api/testhelpers"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+var (
+	idempotencyRepo usecases.IdempotencyRepo
+	mockedRecord    entities.IdempotencyRecord
+)
+
+func TestMain(m *testing.M) {
+	testhelpers.EnsureTestEnv()
+	loggerMock := zerolog.New(nil)
+
+	dbName := os.Getenv("DB_NAME")
+	if dbName == "" {
+		log.Fatalln("environment variable 'DB_NAME' is not set")
+	}
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Fatalln("environment variable 'MONGO_URI' is not set")
+	}
+	db, err := repositories.GetDatabase(&loggerMock, mongoURI, dbName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = repositories.CreateCollections(&loggerMock, db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer testhelpers.DisconnectDB(&loggerMock, db)
+
+	col := db.Collection(repositories.IdempotencyCollectionName)
+	idempotencyRepo = NewRepository(&loggerMock, col)
+
+	now := time.Now().UTC()
+	mockedRecord = entities.IdempotencyRecord{
+		Key:         fmt.Sprintf("key-%d", now.UnixNano()),
+		UserID:      mocks.UserID,
+		Method:      http.MethodPost,
+		Path:        "/trainings",
+		RequestHash: []byte("hash"),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestCreateIdempotencyRecord(t *testing.T) {
+	ctx := context.TODO()
+
+	got, err := idempotencyRepo.CreateIdempotencyRecord(ctx, &mockedRecord)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	if got.ID == "" || got.Key != mockedRecord.Key || got.StatusCode != 0 {
+		t.Errorf("want created record like %v, got %v", mockedRecord, got)
+	}
+
+	_, err = idempotencyRepo.CreateIdempotencyRecord(ctx, &mockedRecord)
+	if !usecases.IsDuplicatedError(err) {
+		t.Errorf("want duplicated error, got %v", err)
+	}
+
+	anonymous := mockedRecord
+	anonymous.UserID = ""
+	_, err = idempotencyRepo.CreateIdempotencyRecord(ctx, &anonymous)
+	if err != nil {
+		t.Errorf("want the same key allowed for other user, got %v", err)
+	}
+}
+
+func TestSaveIdempotencyResponse(t *testing.T) {
+	ctx := context.TODO()
+
+	header := map[string][]string{"Content-Type": {"application/json"}}
+	body := []byte(`{"id":"1"}`)
+	err := idempotencyRepo.SaveIdempotencyResponse(
+		ctx, mockedRecord.UserID, mockedRecord.Key, http.StatusCreated, header, body)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	got, err := idempotencyRepo.GetIdempotencyRecord(ctx, mockedRecord.UserID, mockedRecord.Key)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	if got == nil || got.StatusCode != http.StatusCreated || string(got.Body) != string(body) ||
+		got.UserID != mockedRecord.UserID {
+		t.Errorf("want record with stored response, got %v", got)
+	}
+
+	err = idempotencyRepo.SaveIdempotencyResponse(
+		ctx, mockedRecord.UserID, "notfound", http.StatusCreated, header, body)
+	if err == nil {
+		t.Errorf("want error for not existing key, got nil")
+	}
+}
+
+func TestDeleteIdempotencyRecord(t *testing.T) {
+	ctx := context.TODO()
+
+	n, err := idempotencyRepo.DeleteIdempotencyRecord(ctx, "", mockedRecord.Key)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	if n != 1 {
+		t.Errorf("want 1 deleted record, got %d", n)
+	}
+
+	got, err := idempotencyRepo.GetIdempotencyRecord(ctx, "", mockedRecord.Key)
+	if err != nil || got != nil {
+		t.Errorf("want nil record and nil error, got %v, %v", got, err)
+	}
+}
+
+func TestReplaceExpiredIdempotencyRecord(t *testing.T) {
+	ctx := context.TODO()
+
+	// the expired record stays stored until the ttl monitor removes it
+	expired := mockedRecord
+	expired.Key = "expired-" + mockedRecord.Key
+	expired.ExpiresAt = time.Now().UTC().Add(-time.Minute)
+	_, err := idempotencyRepo.CreateIdempotencyRecord(ctx, &expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := idempotencyRepo.GetIdempotencyRecord(ctx, expired.UserID, expired.Key)
+	if err != nil || got != nil {
+		t.Fatalf("want nil record and nil error for the expired record, got %v, %v", got, err)
+	}
+
+	fresh := expired
+	fresh.Path = "/exercises"
+	fresh.ExpiresAt = time.Now().UTC().Add(time.Hour)
+	err = idempotencyRepo.ReplaceExpiredIdempotencyRecord(ctx, &fresh)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	got, err = idempotencyRepo.GetIdempotencyRecord(ctx, fresh.UserID, fresh.Key)
+	if err != nil || got == nil || got.Path != fresh.Path {
+		t.Fatalf("want the replaced record, got %v, %v", got, err)
+	}
+
+	// the key of the not expired record is not taken over
+	err = idempotencyRepo.ReplaceExpiredIdempotencyRecord(ctx, &fresh)
+	if !usecases.IsDuplicatedError(err) {
+		t.Errorf("want duplicated error, got %v", err)
+	}
+
+	_, err = idempotencyRepo.DeleteIdempotencyRecord(ctx, fresh.UserID, fresh.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockIdempotencyRecord(t *testing.T) {
+	ctx := context.TODO()
+
+	lost := mockedRecord
+	lost.Key = "lost-" + mockedRecord.Key
+	lost.LockedUntil = time.Now().UTC().Add(-time.Second)
+	_, err := idempotencyRepo.CreateIdempotencyRecord(ctx, &lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockedUntil := time.Now().UTC().Add(time.Minute)
+	locked, err := idempotencyRepo.LockIdempotencyRecord(ctx, lost.UserID, lost.Key, lockedUntil)
+	if err != nil || !locked {
+		t.Fatalf("want the record with ended lease to be locked, got %t, %v", locked, err)
+	}
+
+	// the lease is held by the first retry
+	locked, err = idempotencyRepo.LockIdempotencyRecord(ctx, lost.UserID, lost.Key, lockedUntil)
+	if err != nil || locked {
+		t.Errorf("want the locked record not to be locked again, got %t, %v", locked, err)
+	}
+
+	err = idempotencyRepo.SaveIdempotencyResponse(ctx, lost.UserID, lost.Key, http.StatusCreated, nil, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err = idempotencyRepo.LockIdempotencyRecord(ctx, lost.UserID, lost.Key, time.Now().UTC())
+	if err != nil || locked {
+		t.Errorf("want the completed record not to be locked, got %t, %v", locked, err)
+	}
+
+	_, err = idempotencyRepo.DeleteIdempotencyRecord(ctx, lost.UserID, lost.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,18 @@
+package idempotency
+
+import (
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type IdempotencyRepository struct {
+	col *mongo.Collection
+	l   *zerolog.Logger
+}
+
+func NewRepository(logger *zerolog.Logger, collection *mongo.Collection) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		col: collection,
+		l:   logger,
+	}
+}
@@ -0,0 +1,55 @@
+package imports
+
+import "github.com/unnamedxaer/gymm-api/entities"
+
+func mapImportJobToEntity(data *importJobData) *entities.ImportJob {
+	job := entities.ImportJob{
+		ID:                data.ID.Hex(),
+		UserID:            data.UserID.Hex(),
+		Source:            data.Source,
+		Status:            data.Status,
+		Timezone:          data.Timezone,
+		Units:             data.Units,
+		Report:            mapReportToEntity(&data.Report),
+		ImportedTrainings: data.ImportedTrainings,
+		CreatedExercises:  data.CreatedExercises,
+		Attempts:          data.Attempts,
+		Error:             data.Error,
+		CreatedAt:         data.CreatedAt.UTC(),
+		UpdatedAt:         data.UpdatedAt.UTC(),
+	}
+	return &job
+}
+
+func mapReportToEntity(data *importReportData) entities.ImportReport {
+	report := entities.ImportReport{
+		Rows:               data.Rows,
+		Trainings:          data.Trainings,
+		Sets:               data.Sets,
+		UnmatchedExercises: data.UnmatchedExercises,
+		RowErrors:          make([]entities.ImportRowError, len(data.RowErrors)),
+		RowErrorsCount:     data.RowErrorsCount,
+	}
+	if report.UnmatchedExercises == nil {
+		report.UnmatchedExercises = []string{}
+	}
+	for i, re := range data.RowErrors {
+		report.RowErrors[i] = entities.ImportRowError{Row: re.Row, Error: re.Error}
+	}
+	return report
+}
+
+func mapReportToData(report *entities.ImportReport) importReportData {
+	data := importReportData{
+		Rows:               report.Rows,
+		Trainings:          report.Trainings,
+		Sets:               report.Sets,
+		UnmatchedExercises: report.UnmatchedExercises,
+		RowErrors:          make([]importRowErrorData, len(report.RowErrors)),
+		RowErrorsCount:     report.RowErrorsCount,
+	}
+	for i, re := range report.RowErrors {
+		data.RowErrors[i] = importRowErrorData{Row: re.Row, Error: re.Error}
+	}
+	return data
+}
@@ -0,0 +1,304 @@
+package imports
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type importRowErrorData struct {
+	Row   int    `bson:"row"`
+	Error string `bson:"error"`
+}
+
+type importReportData struct {
+	Rows               int                  `bson:"rows"`
+	Trainings          int                  `bson:"trainings"`
+	Sets               int                  `bson:"sets"`
+	UnmatchedExercises []string             `bson:"unmatched_exercises"`
+	RowErrors          []importRowErrorData `bson:"row_errors"`
+	RowErrorsCount     int                  `bson:"row_errors_count"`
+}
+
+type importJobData struct {
+	ID                primitive.ObjectID    `bson:"_id,omitempty"`
+	UserID            primitive.ObjectID    `bson:"user_id"`
+	Source            entities.ImportSource `bson:"source"`
+	Status            entities.ImportStatus `bson:"status"`
+	Timezone          string                `bson:"timezone"`
+	Units             entities.UnitSystem   `bson:"units"`
+	Report            importReportData      `bson:"report"`
+	ImportedTrainings int                   `bson:"imported_trainings"`
+	CreatedExercises  int                   `bson:"created_exercises"`
+	Attempts          int                   `bson:"attempts"`
+	Error             string                `bson:"error,omitempty"`
+	// Data is the uploaded file, it is removed once the import is finished
+	Data []byte `bson:"data,omitempty"`
+	// LockedUntil is the time the running import is reserved for the runner that claimed it
+	LockedUntil *time.Time `bson:"locked_until,omitempty"`
+	// ExpiresAt is the time mongo removes the import that was not committed
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+	CreatedAt time.Time  `bson:"created_at"`
+	UpdatedAt time.Time  `bson:"updated_at"`
+}
+
+// withoutData is the projection that leaves out the uploaded file
+var withoutData = bson.M{"data": 0}
+
+func (repo *ImportRepository) CreateImportJob(
+	ctx context.Context,
+	job *entities.ImportJob,
+	data []byte,
+	expiresAt time.Time) (*entities.ImportJob, error) {
+	uOID, err := primitive.ObjectIDFromHex(job.UserID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(job.UserID, "user"), "importRepo.CreateImportJob")
+	}
+
+	jd := importJobData{
+		UserID:    uOID,
+		Source:    job.Source,
+		Status:    job.Status,
+		Timezone:  job.Timezone,
+		Units:     job.Units,
+		Report:    mapReportToData(&job.Report),
+		Data:      data,
+		ExpiresAt: &expiresAt,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+
+	result, err := repo.col.InsertOne(ctx, &jd)
+	if err != nil {
+		return nil, errors.WithMessage(err, "importRepo.CreateImportJob")
+	}
+
+	var ok bool
+	jd.ID, ok = result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("importRepo.CreateImportJob: ID assert failed")
+	}
+
+	return mapImportJobToEntity(&jd), nil
+}
+
+func (repo *ImportRepository) GetImportJob(
+	ctx context.Context,
+	userID, id string) (*entities.ImportJob, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "importRepo.GetImportJob")
+	}
+	jOID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "import"), "importRepo.GetImportJob")
+	}
+
+	var jd importJobData
+	opts := options.FindOne().SetProjection(withoutData)
+	err = repo.col.FindOne(ctx, bson.M{"_id": jOID, "user_id": uOID}, opts).Decode(&jd)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "importRepo.GetImportJob")
+	}
+
+	return mapImportJobToEntity(&jd), nil
+}
+
+func (repo *ImportRepository) GetImportJobData(
+	ctx context.Context,
+	id string) ([]byte, error) {
+	jOID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "import"), "importRepo.GetImportJobData")
+	}
+
+	var jd importJobData
+	opts := options.FindOne().SetProjection(bson.M{"data": 1})
+	err = repo.col.FindOne(ctx, bson.M{"_id": jOID}, opts).Decode(&jd)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "importRepo.GetImportJobData")
+	}
+
+	return jd.Data, nil
+}
+
+func (repo *ImportRepository) QueueImportJob(
+	ctx context.Context,
+	userID, id string) (*entities.ImportJob, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "importRepo.QueueImportJob")
+	}
+	jOID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "import"), "importRepo.QueueImportJob")
+	}
+
+	now := time.Now().UTC()
+	// mongo removes the expired documents with a delay
+	filter := bson.M{
+		"_id":        jOID,
+		"user_id":    uOID,
+		"status":     entities.ImportStatusReview,
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set":   bson.M{"status": entities.ImportStatusQueued, "updated_at": now},
+		"$unset": bson.M{"expires_at": ""},
+	}
+	opts := options.FindOneAndUpdate().
+		SetProjection(withoutData).
+		SetReturnDocument(options.After)
+
+	var jd importJobData
+	err = repo.col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&jd)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "importRepo.QueueImportJob")
+	}
+
+	return mapImportJobToEntity(&jd), nil
+}
+
+func (repo *ImportRepository) ClaimImportJob(
+	ctx context.Context,
+	now, lockedUntil time.Time) (*entities.ImportJob, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": entities.ImportStatusQueued},
+		bson.M{"status": entities.ImportStatusRunning, "locked_until": bson.M{"$lte": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{
+			"status":       entities.ImportStatusRunning,
+			"locked_until": lockedUntil,
+			"updated_at":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetProjection(withoutData).
+		SetSort(bson.M{"created_at": 1}).
+		SetReturnDocument(options.After)
+
+	var jd importJobData
+	err := repo.col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&jd)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "importRepo.ClaimImportJob")
+	}
+
+	return mapImportJobToEntity(&jd), nil
+}
+
+func (repo *ImportRepository) UpdateImportJobProgress(
+	ctx context.Context,
+	id string,
+	importedTrainings, createdExercises int,
+	lockedUntil time.Time) error {
+	jOID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "import"), "importRepo.UpdateImportJobProgress")
+	}
+
+	update := bson.M{"$set": bson.M{
+		"imported_trainings": importedTrainings,
+		"created_exercises":  createdExercises,
+		"locked_until":       lockedUntil,
+		"updated_at":         time.Now().UTC(),
+	}}
+	_, err = repo.col.UpdateOne(ctx, bson.M{"_id": jOID}, update)
+	if err != nil {
+		return errors.WithMessage(err, "importRepo.UpdateImportJobProgress")
+	}
+	return nil
+}
+
+func (repo *ImportRepository) FinishImportJob(
+	ctx context.Context,
+	id string,
+	status entities.ImportStatus,
+	errTxt string) error {
+	jOID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "import"), "importRepo.FinishImportJob")
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"status": status, "error": errTxt, "updated_at": time.Now().UTC()},
+		"$unset": bson.M{"data": "", "locked_until": ""},
+	}
+	_, err = repo.col.UpdateOne(ctx, bson.M{"_id": jOID}, update)
+	if err != nil {
+		return errors.WithMessage(err, "importRepo.FinishImportJob")
+	}
+	return nil
+}
+
+func (repo *ImportRepository) GetUserImportJobs(
+	ctx context.Context,
+	userID string) ([]entities.ImportJob, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "importRepo.GetUserImportJobs")
+	}
+
+	opts := options.Find().SetProjection(withoutData).SetSort(bson.M{"created_at": -1})
+	cursor, err := repo.col.Find(ctx, bson.M{"user_id": uOID}, opts)
+	if err != nil {
+		return nil, errors.WithMessage(err, "importRepo.GetUserImportJobs")
+	}
+
+	data := []importJobData{}
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "importRepo.GetUserImportJobs")
+	}
+
+	jobs := make([]entities.ImportJob, len(data))
+	for i := range data {
+		jobs[i] = *mapImportJobToEntity(&data[i])
+	}
+	return jobs, nil
+}
+
+func (repo *ImportRepository) DeleteUserImportJobs(
+	ctx context.Context,
+	userID string) (int64, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "importRepo.DeleteUserImportJobs")
+	}
+
+	result, err := repo.col.DeleteMany(ctx, bson.M{"user_id": uOID})
+	if err != nil {
+		return 0, errors.WithMessage(err, "importRepo.DeleteUserImportJobs")
+	}
+	return result.DeletedCount, nil
+}
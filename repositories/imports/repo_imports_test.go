@@ -0,0 +1,193 @@
+package imports
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/repositories"
+	"github.com/unnamedxaer/gymm-api/testhelpers"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	importRepo usecases.ImportRepo
+)
+
+func TestMain(m *testing.M) {
+	testhelpers.EnsureTestEnv()
+	loggerMock := zerolog.New(nil)
+
+	dbName := os.Getenv("DB_NAME")
+	if dbName == "" {
+		log.Fatalln("environment variable 'DB_NAME' is not set")
+	}
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Fatalln("environment variable 'MONGO_URI' is not set")
+	}
+	db, err := repositories.GetDatabase(&loggerMock, mongoURI, dbName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = repositories.CreateCollections(&loggerMock, db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer testhelpers.DisconnectDB(&loggerMock, db)
+
+	col := db.Collection(repositories.ImportJobsCollectionName)
+	_, err = col.DeleteMany(context.TODO(), bson.M{})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	importRepo = NewRepository(&loggerMock, col)
+
+	os.Exit(m.Run())
+}
+
+func TestImportJobLifecycle(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	data := []byte("title,start_time\n")
+
+	created, err := importRepo.CreateImportJob(ctx, &entities.ImportJob{
+		UserID:   mocks.UserID,
+		Source:   entities.ImportSourceHevy,
+		Status:   entities.ImportStatusReview,
+		Timezone: "UTC",
+		Units:    entities.UnitsMetric,
+		Report: entities.ImportReport{
+			Rows:               3,
+			UnmatchedExercises: []string{"Plank"},
+			RowErrors:          []entities.ImportRowError{{Row: 3, Error: "invalid number"}},
+			RowErrorsCount:     1,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, data, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := importRepo.GetImportJob(ctx, mocks.UserID, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Report.RowErrors[0].Row != 3 || got.Report.UnmatchedExercises[0] != "Plank" {
+		t.Fatalf("want the stored import with its report, got %+v", got)
+	}
+
+	got, err = importRepo.GetImportJob(ctx, mocks.UserID+"1", created.ID)
+	if err == nil && got != nil {
+		t.Errorf("want no import of the other user, got %+v", got)
+	}
+
+	queued, err := importRepo.QueueImportJob(ctx, mocks.UserID, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued == nil || queued.Status != entities.ImportStatusQueued {
+		t.Fatalf("want queued import, got %+v", queued)
+	}
+	queued, err = importRepo.QueueImportJob(ctx, mocks.UserID, created.ID)
+	if err != nil || queued != nil {
+		t.Errorf("want nil for the import that is not under review, got %+v, %v", queued, err)
+	}
+
+	claimed, err := importRepo.ClaimImportJob(ctx, now, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed == nil || claimed.ID != created.ID || claimed.Attempts != 1 {
+		t.Fatalf("want import %q claimed once, got %+v", created.ID, claimed)
+	}
+
+	// locked by the first runner
+	again, err := importRepo.ClaimImportJob(ctx, now, now.Add(time.Minute))
+	if err != nil || again != nil {
+		t.Errorf("want no import to claim, got %+v, %v", again, err)
+	}
+	// the lock expired
+	again, err = importRepo.ClaimImportJob(ctx, now.Add(2*time.Minute), now.Add(3*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == nil || again.Attempts != 2 {
+		t.Errorf("want import claimed again, got %+v", again)
+	}
+
+	err = importRepo.UpdateImportJobProgress(ctx, created.ID, 5, 1, now.Add(4*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotData, err := importRepo.GetImportJobData(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotData) != string(data) {
+		t.Errorf("want the uploaded file, got %q", gotData)
+	}
+
+	err = importRepo.FinishImportJob(ctx, created.ID, entities.ImportStatusCompleted, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = importRepo.GetImportJob(ctx, mocks.UserID, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != entities.ImportStatusCompleted || got.ImportedTrainings != 5 || got.CreatedExercises != 1 {
+		t.Errorf("want completed import with its progress, got %+v", got)
+	}
+	gotData, err = importRepo.GetImportJobData(ctx, created.ID)
+	if err != nil || gotData != nil {
+		t.Errorf("want the file to be removed, got %q, %v", gotData, err)
+	}
+}
+
+func TestUserImportJobs(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	userID := mocks.UserID[:len(mocks.UserID)-1] + "9"
+
+	for i := 0; i < 2; i++ {
+		_, err := importRepo.CreateImportJob(ctx, &entities.ImportJob{
+			UserID:    userID,
+			Source:    entities.ImportSourceStrong,
+			Status:    entities.ImportStatusReview,
+			CreatedAt: now.Add(time.Duration(i) * time.Minute),
+		}, []byte("file"), now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := importRepo.GetUserImportJobs(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || !jobs[0].CreatedAt.After(jobs[1].CreatedAt) || jobs[0].UserID != userID {
+		t.Fatalf("want 2 imports of the user, the newest first, got %+v", jobs)
+	}
+
+	n, err := importRepo.DeleteUserImportJobs(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("want 2 deleted imports, got %d", n)
+	}
+
+	jobs, err = importRepo.GetUserImportJobs(ctx, userID)
+	if err != nil || len(jobs) != 0 {
+		t.Errorf("want no imports of the user, got %+v, %v", jobs, err)
+	}
+}
@@ -0,0 +1,18 @@
+package imports
+
+import (
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ImportRepository struct {
+	col *mongo.Collection
+	l   *zerolog.Logger
+}
+
+func NewRepository(logger *zerolog.Logger, collection *mongo.Collection) *ImportRepository {
+	return &ImportRepository{
+		col: collection,
+		l:   logger,
+	}
+}
@@ -0,0 +1,537 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// expiresAtIndexName is a name of the index used by the expired data cleanup
+	expiresAtIndexName = "expires_at"
+	// usedTokensIndexName is a name of the index used by the refresh token reuse detection
+	usedTokensIndexName = "used_tokens"
+	// userDeviceIndexName is a name of the index that allows one refresh token family per device
+	userDeviceIndexName = "unique_user_id_device"
+	// userIDIndexName is a name of the former index that allowed one refresh token per user
+	userIDIndexName = "unique_user_id"
+	// emailVerificationIndexName is a name of the index used to find the user by the email verification token
+	emailVerificationIndexName = "email_verification_token"
+	// emailChangeIndexName is a name of the index used to find the user by the pending email address token
+	emailChangeIndexName = "email_change_token"
+	// resetPwdTokenIndexName is a name of the index used to find the reset password request by the token
+	resetPwdTokenIndexName = "unique_token_hash"
+	// externalIdentityIndexName is a name of the index that links the provider's account to one user
+	externalIdentityIndexName = "unique_external_identity"
+	// deletionScheduledAtIndexName is a name of the index used by the scheduled accounts deletion
+	deletionScheduledAtIndexName = "deletion_scheduled_at"
+	// trainingExerciseIndexName is a name of the index used to find the trainings with the exercise
+	trainingExerciseIndexName = "exercises_exercise_id"
+	// userStartTimeIndexName is a name of the index used to read the user's trainings in order of their start
+	userStartTimeIndexName = "user_id_start_time"
+	// exerciseAliasesIndexName is a name of the index used to match the imported exercises by their aliases
+	exerciseAliasesIndexName = "aliases"
+	// calendarFeedTokenIndexName is a name of the index used to find the user by the calendar feed secret
+	calendarFeedTokenIndexName = "unique_calendar_feed_token"
+	// openTrainingIndexName is a name of the index that allows one training in progress per user
+	openTrainingIndexName = "unique_user_id_open_training"
+)
+
+// migrateCollections brings collections of the existing deployments up to date,
+// every migration must be safe to run multiple times
+func migrateCollections(l *zerolog.Logger, db *mongo.Database) error {
+	for _, colName := range []string{
+		TokensCollectionName,
+		RefreshTokensCollectionName,
+		ResPwdReqCollectionName,
+	} {
+		err := addExpiresAtIndex(l, db.Collection(colName))
+		if err != nil {
+			return err
+		}
+	}
+
+	err := addUsedTokensIndex(l, db.Collection(RefreshTokensCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = migrateRefreshTokensPerDevice(l, db.Collection(RefreshTokensCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addEmailVerificationIndex(l, db.Collection(UsersCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addEmailChangeIndex(l, db.Collection(UsersCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addResetPwdTokenIndex(l, db.Collection(ResPwdReqCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addExternalIdentityIndex(l, db.Collection(UsersCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addDeletionScheduledAtIndex(l, db.Collection(UsersCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addTrainingExerciseIndex(l, db.Collection(TrainingsCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addUserStartTimeIndex(l, db.Collection(TrainingsCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addExerciseAliasesIndex(l, db.Collection(ExercisesCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addCalendarFeedTokenIndex(l, db.Collection(UsersCollectionName))
+	if err != nil {
+		return err
+	}
+
+	err = addOpenTrainingIndex(l, db.Collection(TrainingsCollectionName))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addExpiresAtIndex creates index on the "expires_at" field if it does not exist yet,
+// it lets the cleanup job remove expired documents without scanning whole collection
+func addExpiresAtIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, expiresAtIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", expiresAtIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName(expiresAtIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", expiresAtIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addUsedTokensIndex creates index on the rotated refresh tokens if it does not exist yet
+func addUsedTokensIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, usedTokensIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", usedTokensIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "used_tokens", Value: 1}},
+		Options: options.Index().SetName(usedTokensIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", usedTokensIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// userDeviceIndexModel returns the index of the refresh tokens collection
+// that keeps one token family per user's device
+func userDeviceIndexModel() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "device", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName(userDeviceIndexName),
+	}
+}
+
+// migrateRefreshTokensPerDevice replaces the index that allowed only one refresh token
+// per user with the one that allows a refresh token per user's device
+func migrateRefreshTokensPerDevice(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, userIDIndexName) != -1 {
+		_, err = col.Indexes().DropOne(context.Background(), userIDIndexName)
+		if err != nil {
+			return errors.WithMessagef(err, "drop index %q on %q collection", userIDIndexName, col.Name())
+		}
+		l.Info().Msgf("index %q on collection %q dropped", userIDIndexName, col.Name())
+	}
+
+	if indexOfColIndex(idxs, userDeviceIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", userDeviceIndexName, col.Name())
+		return nil
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), userDeviceIndexModel())
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", userDeviceIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addEmailVerificationIndex creates index on the email verification tokens if it does not exist yet,
+// it is sparse as only users with not verified email address have the token
+func addEmailVerificationIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, emailVerificationIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", emailVerificationIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "email_verification.token", Value: 1}},
+		Options: options.Index().SetSparse(true).SetName(emailVerificationIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", emailVerificationIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addEmailChangeIndex creates index on the pending email address tokens if it does not exist yet,
+// it is sparse as only users changing their email address have the token
+func addEmailChangeIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, emailChangeIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", emailChangeIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "email_change.token", Value: 1}},
+		Options: options.Index().SetSparse(true).SetName(emailChangeIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", emailChangeIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addResetPwdTokenIndex creates index on the reset password token hashes if it does not exist yet,
+// it is sparse as the requests created before the tokens were introduced do not have them
+func addResetPwdTokenIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, resetPwdTokenIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", resetPwdTokenIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true).SetName(resetPwdTokenIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", resetPwdTokenIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addExternalIdentityIndex creates index on the accounts at the OpenID Connect providers if it does not exist yet,
+// it is sparse as most of the users do not have any
+func addExternalIdentityIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, externalIdentityIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", externalIdentityIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "external_identities.issuer", Value: 1},
+			{Key: "external_identities.subject", Value: 1},
+		},
+		Options: options.Index().SetUnique(true).SetSparse(true).SetName(externalIdentityIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", externalIdentityIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addDeletionScheduledAtIndex creates index on the accounts deletion time if it does not exist yet,
+// it is sparse as only the users who asked to delete their accounts have it
+func addDeletionScheduledAtIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, deletionScheduledAtIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", deletionScheduledAtIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "deletion_scheduled_at", Value: 1}},
+		Options: options.Index().SetSparse(true).SetName(deletionScheduledAtIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", deletionScheduledAtIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addTrainingExerciseIndex creates index on the exercises done in the trainings if it does not exist yet,
+// it lets the account deletion tell whether the user's exercise is used by somebody else
+func addTrainingExerciseIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, trainingExerciseIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", trainingExerciseIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "exercises.exercise_id", Value: 1}},
+		Options: options.Index().SetName(trainingExerciseIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", trainingExerciseIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addUserStartTimeIndex creates index on the user's trainings start time if it does not exist yet,
+// it lets the export walk the trainings in order without sorting them in memory
+func addUserStartTimeIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, userStartTimeIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", userStartTimeIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "start_time", Value: 1}},
+		Options: options.Index().SetName(userStartTimeIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", userStartTimeIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addExerciseAliasesIndex creates index on the exercises aliases if it does not exist yet,
+// it uses the collection's case insensitive collation
+func addExerciseAliasesIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, exerciseAliasesIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", exerciseAliasesIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "aliases", Value: 1}},
+		Options: options.Index().SetName(exerciseAliasesIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", exerciseAliasesIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addCalendarFeedTokenIndex creates index on the calendar feed secret hashes if it does not exist yet,
+// it is sparse as only the users with the feed turned on have the secret
+func addCalendarFeedTokenIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, calendarFeedTokenIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", calendarFeedTokenIndexName, col.Name())
+		return nil
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "calendar_feed_token", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true).SetName(calendarFeedTokenIndexName),
+	}
+
+	indexName, err := col.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", calendarFeedTokenIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// addOpenTrainingIndex creates index on the user's training in progress if it does not exist yet.
+// The index covers only the null end time, so the trainings stored without it get the null first
+// and the surplus open trainings of the user, started concurrently before, are ended
+func addOpenTrainingIndex(l *zerolog.Logger, col *mongo.Collection) error {
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		return errors.WithMessagef(err, "get indexes of %q collection", col.Name())
+	}
+
+	if indexOfColIndex(idxs, openTrainingIndexName) != -1 {
+		l.Info().Msgf("index %q on collection %q already exists", openTrainingIndexName, col.Name())
+		return nil
+	}
+
+	ctx := context.Background()
+	_, err = col.UpdateMany(
+		ctx,
+		bson.M{"end_time": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"end_time": nil}})
+	if err != nil {
+		return errors.WithMessagef(err, "set null end time in %q collection", col.Name())
+	}
+
+	err = endSurplusOpenTrainings(l, col)
+	if err != nil {
+		return err
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName(openTrainingIndexName).
+			SetPartialFilterExpression(bson.M{"end_time": bson.M{"$type": "null"}}),
+	}
+
+	indexName, err := col.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create index %q on %q collection", openTrainingIndexName, col.Name())
+	}
+	l.Info().Msgf("index %q on collection %q created", indexName, col.Name())
+
+	return nil
+}
+
+// endSurplusOpenTrainings ends all but the latest started training in progress of every user,
+// they are ended at the time of their last modification
+func endSurplusOpenTrainings(l *zerolog.Logger, col *mongo.Collection) error {
+	ctx := context.Background()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"end_time": nil}}},
+		{{Key: "$sort", Value: bson.M{"start_time": -1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "ids": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	}
+	cursor, err := col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return errors.WithMessagef(err, "find surplus open trainings in %q collection", col.Name())
+	}
+
+	var users []struct {
+		IDs []interface{} `bson:"ids"`
+	}
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return errors.WithMessagef(err, "find surplus open trainings in %q collection", col.Name())
+	}
+
+	for _, u := range users {
+		update := bson.A{
+			bson.M{"$set": bson.M{"end_time": bson.M{"$ifNull": bson.A{"$updated_at", "$start_time"}}}},
+		}
+		results, err := col.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": u.IDs[1:]}}, update)
+		if err != nil {
+			return errors.WithMessagef(err, "end surplus open trainings in %q collection", col.Name())
+		}
+		l.Info().Msgf("%d surplus open trainings in %q collection ended", results.ModifiedCount, col.Name())
+	}
+
+	return nil
+}
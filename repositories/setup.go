@@ -20,6 +20,11 @@ const (
 	ResPwdReqCollectionName     = "resetPasswordRequest"
 	TrainingsCollectionName     = "trainings"
 	ExercisesCollectionName     = "exercises"
+	IdempotencyCollectionName   = "idempotencyKeys"
+	LoginAttemptsCollectionName = "loginAttempts"
+	APIKeysCollectionName       = "apiKeys"
+	AuditEventsCollectionName   = "auditEvents"
+	ImportJobsCollectionName    = "importJobs"
 )
 
 // Index represent index on the mongo collection
@@ -58,6 +63,16 @@ func GetCollection(l *zerolog.Logger, db *mongo.Database, collName string) *mong
 		fallthrough
 	case UsersCollectionName:
 		fallthrough
+	case IdempotencyCollectionName:
+		fallthrough
+	case LoginAttemptsCollectionName:
+		fallthrough
+	case APIKeysCollectionName:
+		fallthrough
+	case AuditEventsCollectionName:
+		fallthrough
+	case ImportJobsCollectionName:
+		fallthrough
 	case TrainingsCollectionName:
 		return db.Collection(collName)
 	default:
@@ -112,8 +127,20 @@ func CreateCollections(l *zerolog.Logger, db *mongo.Database) error {
 	}
 
 	colName = TrainingsCollectionName
+	err = createTrainingsCollection(l, db, colName, helpers.StrSliceIndexOf(collections, colName) == -1)
+	if err != nil {
+		return err
+	}
+
+	colName = ExercisesCollectionName
+	err = createExercisesCollection(l, db, colName, helpers.StrSliceIndexOf(collections, colName) == -1)
+	if err != nil {
+		return err
+	}
+
+	colName = IdempotencyCollectionName
 	if helpers.StrSliceIndexOf(collections, colName) == -1 {
-		err = createTrainingsCollection(l, db, colName)
+		err = createIdempotencyCollection(l, db, colName)
 		if err != nil {
 			return err
 		}
@@ -121,13 +148,47 @@ func CreateCollections(l *zerolog.Logger, db *mongo.Database) error {
 		l.Info().Msgf("collection '%s' already exists - skipped", colName)
 	}
 
-	colName = ExercisesCollectionName
-	err = createExercisesCollection(l, db, colName, helpers.StrSliceIndexOf(collections, colName) == -1)
-	if err != nil {
-		return err
+	colName = LoginAttemptsCollectionName
+	if helpers.StrSliceIndexOf(collections, colName) == -1 {
+		err = createLoginAttemptsCollection(l, db, colName)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Info().Msgf("collection '%s' already exists - skipped", colName)
 	}
 
-	return nil
+	colName = APIKeysCollectionName
+	if helpers.StrSliceIndexOf(collections, colName) == -1 {
+		err = createAPIKeysCollection(l, db, colName)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Info().Msgf("collection '%s' already exists - skipped", colName)
+	}
+
+	colName = AuditEventsCollectionName
+	if helpers.StrSliceIndexOf(collections, colName) == -1 {
+		err = createAuditEventsCollection(l, db, colName)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Info().Msgf("collection '%s' already exists - skipped", colName)
+	}
+
+	colName = ImportJobsCollectionName
+	if helpers.StrSliceIndexOf(collections, colName) == -1 {
+		err = createImportJobsCollection(l, db, colName)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Info().Msgf("collection '%s' already exists - skipped", colName)
+	}
+
+	return migrateCollections(l, db)
 }
 
 func createUsersCollection(l *zerolog.Logger, db *mongo.Database, collectionName string) error {
@@ -159,12 +220,58 @@ func createUsersCollection(l *zerolog.Logger, db *mongo.Database, collectionName
 	return nil
 }
 
-func createTrainingsCollection(l *zerolog.Logger, db *mongo.Database, collectionName string) error {
-	err := db.CreateCollection(context.Background(), collectionName)
+func createTrainingsCollection(l *zerolog.Logger, db *mongo.Database, collectionName string, create bool) error {
+	ctx := context.TODO()
+	if create {
+		err := db.CreateCollection(ctx, collectionName)
+		if err != nil {
+			return errors.WithMessagef(err, "create '%s' collection", collectionName)
+		}
+		l.Info().Msgf("collection '%s' created", collectionName)
+	} else {
+		l.Info().Msgf("collection '%s' already exists - skipped", collectionName)
+	}
+
+	col := db.Collection(collectionName)
+
+	idxs, err := getCollIndexes(col)
 	if err != nil {
-		return errors.WithMessagef(err, "create '%s' collection", collectionName)
+		return errors.WithMessagef(err, "get indexes of %q collection", collectionName)
+	}
+
+	// trainings created offline are identified by the client's id
+	indexName := "unique_user_id-client_id"
+	if indexOfColIndex(idxs, indexName) == -1 {
+		indexModel := mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "client_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName(indexName).
+				SetPartialFilterExpression(bson.M{"client_id": bson.M{"$exists": true}}),
+		}
+
+		indexName, err := col.Indexes().CreateOne(ctx, indexModel)
+		if err != nil {
+			return errors.WithMessagef(err, "create index %q on %q collection", indexName, collectionName)
+		}
+		l.Info().Msgf("index %q on collection %q created", indexName, collectionName)
+	} else {
+		l.Info().Msgf("index %q on collection %q already exists", indexName, collectionName)
+	}
+
+	indexName = "user_id-updated_at"
+	if indexOfColIndex(idxs, indexName) == -1 {
+		indexModel := mongo.IndexModel{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: 1}},
+			Options: options.Index().SetName(indexName),
+		}
+
+		indexName, err := col.Indexes().CreateOne(ctx, indexModel)
+		if err != nil {
+			return errors.WithMessagef(err, "create index %q on %q collection", indexName, collectionName)
+		}
+		l.Info().Msgf("index %q on collection %q created", indexName, collectionName)
+	} else {
+		l.Info().Msgf("index %q on collection %q already exists", indexName, collectionName)
 	}
-	l.Info().Msgf("collection '%s' created", collectionName)
 	return nil
 }
 
@@ -271,19 +378,16 @@ func createRefreshTokensCollection(l *zerolog.Logger, db *mongo.Database, collec
 	col := db.Collection(collectionName)
 
 	tokenIndexName := "unique_token"
-	userIDIndexName := "unique_user_id"
 	indexModel := []mongo.IndexModel{
 		{
 			Keys:    bson.D{{Key: "token", Value: 1}},
 			Options: options.Index().SetUnique(true).SetName(tokenIndexName)},
-		{
-			Keys:    bson.D{{Key: "user_id", Value: 1}},
-			Options: options.Index().SetUnique(true).SetName(userIDIndexName)},
+		userDeviceIndexModel(),
 	}
 
 	indexesNames, err := col.Indexes().CreateMany(context.Background(), indexModel)
 	if err != nil {
-		return errors.WithMessagef(err, "create indexes %q on %q collection", []string{tokenIndexName, userIDIndexName}, collectionName)
+		return errors.WithMessagef(err, "create indexes %q on %q collection", []string{tokenIndexName, userDeviceIndexName}, collectionName)
 	}
 
 	l.Info().Msgf("indexes %q on collection %q created", indexesNames, collectionName)
@@ -306,6 +410,166 @@ func createResPwdReqCollection(l *zerolog.Logger, db *mongo.Database, collection
 	return nil
 }
 
+func createIdempotencyCollection(l *zerolog.Logger, db *mongo.Database, collectionName string) error {
+	ctx := context.Background()
+	err := db.CreateCollection(ctx, collectionName)
+	if err != nil {
+		return errors.WithMessagef(err, "create %q collection", collectionName)
+	}
+	l.Info().Msgf("collection %q created", collectionName)
+
+	col := db.Collection(collectionName)
+
+	keyIndexName := "unique_user_id-key"
+	expiresAtIndexName := "ttl_expires_at"
+	indexModel := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName(keyIndexName)},
+		{
+			// documents are removed by mongo as soon as they expire
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName(expiresAtIndexName)},
+	}
+
+	indexesNames, err := col.Indexes().CreateMany(ctx, indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create indexes %q on %q collection", []string{keyIndexName, expiresAtIndexName}, collectionName)
+	}
+
+	l.Info().Msgf("indexes %q on collection %q created", indexesNames, collectionName)
+	return nil
+}
+
+func createLoginAttemptsCollection(l *zerolog.Logger, db *mongo.Database, collectionName string) error {
+	ctx := context.Background()
+	// the email addresses are compared case insensitively as in the users collection
+	err := db.CreateCollection(ctx, collectionName, &options.CreateCollectionOptions{
+		Collation: &options.Collation{
+			Strength: 2,
+			Locale:   "en",
+		},
+	})
+	if err != nil {
+		return errors.WithMessagef(err, "create %q collection", collectionName)
+	}
+	l.Info().Msgf("collection %q created", collectionName)
+
+	col := db.Collection(collectionName)
+
+	keyIndexName := "unique_key"
+	expiresAtIndexName := "ttl_expires_at"
+	indexModel := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName(keyIndexName)},
+		{
+			// failed attempts are forgotten by mongo as soon as they expire
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName(expiresAtIndexName)},
+	}
+
+	indexesNames, err := col.Indexes().CreateMany(ctx, indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create indexes %q on %q collection", []string{keyIndexName, expiresAtIndexName}, collectionName)
+	}
+
+	l.Info().Msgf("indexes %q on collection %q created", indexesNames, collectionName)
+	return nil
+}
+
+func createAPIKeysCollection(l *zerolog.Logger, db *mongo.Database, collectionName string) error {
+	ctx := context.Background()
+	err := db.CreateCollection(ctx, collectionName)
+	if err != nil {
+		return errors.WithMessagef(err, "create %q collection", collectionName)
+	}
+	l.Info().Msgf("collection %q created", collectionName)
+
+	col := db.Collection(collectionName)
+
+	keyHashIndexName := "unique_key_hash"
+	userIDIndexName := "user_id-created_at"
+	indexModel := []mongo.IndexModel{
+		{
+			// the keys are looked up by their hashes on every request
+			Keys:    bson.D{{Key: "key_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName(keyHashIndexName)},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName(userIDIndexName)},
+	}
+
+	indexesNames, err := col.Indexes().CreateMany(ctx, indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create indexes %q on %q collection", []string{keyHashIndexName, userIDIndexName}, collectionName)
+	}
+
+	l.Info().Msgf("indexes %q on collection %q created", indexesNames, collectionName)
+	return nil
+}
+
+func createAuditEventsCollection(l *zerolog.Logger, db *mongo.Database, collectionName string) error {
+	ctx := context.Background()
+	err := db.CreateCollection(ctx, collectionName)
+	if err != nil {
+		return errors.WithMessagef(err, "create %q collection", collectionName)
+	}
+	l.Info().Msgf("collection %q created", collectionName)
+
+	col := db.Collection(collectionName)
+
+	userIDIndexName := "user_id-created_at"
+	actorIDIndexName := "actor_id-created_at"
+	indexModel := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName(userIDIndexName)},
+		{
+			Keys:    bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName(actorIDIndexName)},
+	}
+
+	indexesNames, err := col.Indexes().CreateMany(ctx, indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create indexes %q on %q collection", []string{userIDIndexName, actorIDIndexName}, collectionName)
+	}
+
+	l.Info().Msgf("indexes %q on collection %q created", indexesNames, collectionName)
+	return nil
+}
+
+func createImportJobsCollection(l *zerolog.Logger, db *mongo.Database, collectionName string) error {
+	ctx := context.Background()
+	err := db.CreateCollection(ctx, collectionName)
+	if err != nil {
+		return errors.WithMessagef(err, "create %q collection", collectionName)
+	}
+	l.Info().Msgf("collection %q created", collectionName)
+
+	col := db.Collection(collectionName)
+
+	statusIndexName := "status-locked_until"
+	expiresAtIndexName := "ttl_expires_at"
+	indexModel := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "locked_until", Value: 1}},
+			Options: options.Index().SetName(statusIndexName)},
+		{
+			// the imports that were not committed are removed by mongo with their files
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName(expiresAtIndexName)},
+	}
+
+	indexesNames, err := col.Indexes().CreateMany(ctx, indexModel)
+	if err != nil {
+		return errors.WithMessagef(err, "create indexes %q on %q collection", []string{statusIndexName, expiresAtIndexName}, collectionName)
+	}
+
+	l.Info().Msgf("indexes %q on collection %q created", indexesNames, collectionName)
+	return nil
+}
+
 func getCollIndexes(col *mongo.Collection) ([]Index, error) {
 	indexesCur, err := col.Indexes().List(context.Background())
 	if err != nil {
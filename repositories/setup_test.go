@@ -3,8 +3,12 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +20,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -65,6 +70,56 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+func TestGetCollection(t *testing.T) {
+	// the constants are read from the source, so the new collections cannot be missed
+	f, err := parser.ParseFile(token.NewFileSet(), "setup.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, ident := range vs.Names {
+				if !ident.IsExported() || !strings.HasSuffix(ident.Name, "CollectionName") {
+					continue
+				}
+				lit, ok := vs.Values[i].(*ast.BasicLit)
+				if !ok {
+					t.Fatalf("%s: want string literal value", ident.Name)
+				}
+				name, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		t.Fatal("want collection name constants")
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("want the collection, got panic: %v", r)
+				}
+			}()
+			col := GetCollection(&loggerMock, db, name)
+			if col == nil || col.Name() != name {
+				t.Errorf("want collection %q, got %v", name, col)
+			}
+		})
+	}
+}
+
 func TestCreateUsersCollection(t *testing.T) {
 	colName := UsersCollectionName + colSuffix
 	err := createUsersCollection(&loggerMock, db, colName)
@@ -182,7 +237,7 @@ func TestCreateExercisesCollection(t *testing.T) {
 
 func TestCreateTrainingsCollection(t *testing.T) {
 	colName := TrainingsCollectionName + colSuffix
-	err := createTrainingsCollection(&loggerMock, db, colName)
+	err := createTrainingsCollection(&loggerMock, db, colName, true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -210,6 +265,17 @@ func TestCreateTrainingsCollection(t *testing.T) {
 	if result != wantCnt {
 		t.Fatalf("want %d documents in collection, got %d", wantCnt, result)
 	}
+
+	input["client_id"] = "6e1c3f0c-3bb4-4c36-9a49-8d0f3a1c2b7d"
+	_, err = trCol.InsertOne(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = trCol.InsertOne(context.Background(), input)
+	if !usecases.IsDuplicatedError(err) {
+		t.Fatalf("want error like: %s, got %v", "E11000 duplicate key error collection", err)
+	}
 }
 
 func TestCreateResPwdReqCollection(t *testing.T) {
@@ -244,3 +310,110 @@ func TestCreateResPwdReqCollection(t *testing.T) {
 		t.Fatalf("want %d documents in collection, got %d", wantCnt, result)
 	}
 }
+
+func TestAddExpiresAtIndex(t *testing.T) {
+	colName := TokensCollectionName + colSuffix
+	err := createTokensCollection(&loggerMock, db, colName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := db.Collection(colName)
+
+	// second call must be no-op for already migrated collection
+	for i := 0; i < 2; i++ {
+		err = addExpiresAtIndex(&loggerMock, col)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if indexOfColIndex(idxs, expiresAtIndexName) == -1 {
+		t.Errorf("want index %q on collection %q, got %v", expiresAtIndexName, colName, idxs)
+	}
+}
+
+func TestMigrateRefreshTokensPerDevice(t *testing.T) {
+	ctx := context.TODO()
+	col := db.Collection(RefreshTokensCollectionName + "_per_device" + colSuffix)
+
+	// index of the deployments created before the migration
+	_, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName(userIDIndexName),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = migrateRefreshTokensPerDevice(&loggerMock, col)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idxs, err := getCollIndexes(col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexOfColIndex(idxs, userIDIndexName) != -1 {
+		t.Errorf("want index %q to be dropped, got %v", userIDIndexName, idxs)
+	}
+	if indexOfColIndex(idxs, userDeviceIndexName) == -1 {
+		t.Errorf("want index %q, got %v", userDeviceIndexName, idxs)
+	}
+
+	userID := primitive.NewObjectID()
+	for _, device := range []string{"phone", "laptop"} {
+		_, err = col.InsertOne(ctx, bson.M{"user_id": userID, "device": device, "token": device})
+		if err != nil {
+			t.Fatalf("want refresh token per device, got %v", err)
+		}
+	}
+}
+
+func TestAddOpenTrainingIndex(t *testing.T) {
+	ctx := context.TODO()
+	col := db.Collection(TrainingsCollectionName + "_open" + colSuffix)
+
+	// trainings started concurrently before the migration, one without the end time field
+	userID := primitive.NewObjectID()
+	now := time.Now()
+	_, err := col.InsertMany(ctx, []interface{}{
+		bson.M{"user_id": userID, "start_time": now.Add(-time.Hour), "updated_at": now.Add(-time.Hour)},
+		bson.M{"user_id": userID, "start_time": now, "end_time": nil, "updated_at": now},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = addOpenTrainingIndex(&loggerMock, col)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := col.CountDocuments(ctx, bson.M{"user_id": userID, "end_time": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want %d open training left, got %d", 1, n)
+	}
+
+	_, err = col.InsertOne(ctx, bson.M{"user_id": userID, "start_time": now, "end_time": nil})
+	if !usecases.IsDuplicatedError(err) {
+		t.Errorf("want error like: %s, got %v", "E11000 duplicate key error collection", err)
+	}
+
+	_, err = col.InsertOne(ctx, bson.M{"user_id": userID, "start_time": now, "end_time": now})
+	if err != nil {
+		t.Errorf("want ended trainings not to be limited, got %v", err)
+	}
+}
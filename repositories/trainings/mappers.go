@@ -1,28 +1,38 @@
 package trainings
 
-import "github.com/unnamedxaer/gymm-api/entities"
+import (
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 func mapTrainingToEntity(td *trainingData) *entities.Training {
 	return &entities.Training{
 		ID:        td.ID.Hex(),
+		ClientID:  td.ClientID,
 		UserID:    td.UserID.Hex(),
 		StartTime: td.StartTime,
-		EndTime:   td.EndTime,
+		EndTime:   timeOrZero(td.EndTime),
 		Exercises: mapExercisesToEntities(td.Exercises),
 		Comment:   td.Comment,
 		CreatedAt: td.CreatedAt,
+		UpdatedAt: td.UpdatedAt,
 	}
 }
 
 func mapExerciseToEntity(ted *trainingExerciseData) *entities.TrainingExercise {
 	return &entities.TrainingExercise{
 		ID:         ted.ID.Hex(),
+		ClientID:   ted.ClientID,
 		ExerciseID: ted.ExerciseID.Hex(),
 		StartTime:  ted.StartTime,
 		EndTime:    ted.EndTime,
 		Comment:    ted.Comment,
 		Sets:       mapSetsToEntities(ted.Sets),
 		CreatedAt:  ted.CreatedAt,
+		UpdatedAt:  ted.UpdatedAt,
 	}
 }
 
@@ -40,9 +50,12 @@ func mapExercisesToEntities(ted []trainingExerciseData) []entities.TrainingExerc
 func mapSetToEntity(tsd trainingSetData) *entities.TrainingSet {
 	return &entities.TrainingSet{
 		ID:        tsd.ID.Hex(),
+		ClientID:  tsd.ClientID,
 		Time:      tsd.Time,
 		Reps:      tsd.Reps,
+		Load:      tsd.Load,
 		CreatedAt: tsd.CreatedAt,
+		UpdatedAt: tsd.UpdatedAt,
 	}
 }
 
@@ -56,3 +69,110 @@ func mapSetsToEntities(tsd []trainingSetData) []entities.TrainingSet {
 
 	return ts
 }
+
+// mapTrainingToData maps the training entity to the storage model,
+// records without ID get a new one and zero times are set to now
+func mapTrainingToData(t *entities.Training, now time.Time) (*trainingData, error) {
+	tOID, err := objectIDOrNew(t.ID, "training")
+	if err != nil {
+		return nil, err
+	}
+	uOID, err := primitive.ObjectIDFromHex(t.UserID)
+	if err != nil {
+		return nil, usecases.NewErrorInvalidID(t.UserID, "user")
+	}
+
+	exercises := make([]trainingExerciseData, len(t.Exercises))
+	for i := 0; i < len(t.Exercises); i++ {
+		ted, err := mapExerciseToData(&t.Exercises[i], now)
+		if err != nil {
+			return nil, err
+		}
+		exercises[i] = *ted
+	}
+
+	return &trainingData{
+		ID:        tOID,
+		ClientID:  t.ClientID,
+		UserID:    uOID,
+		StartTime: t.StartTime,
+		EndTime:   timeOrNil(t.EndTime),
+		Exercises: exercises,
+		Comment:   t.Comment,
+		CreatedAt: timeOrNow(t.CreatedAt, now),
+		UpdatedAt: timeOrNow(t.UpdatedAt, now),
+	}, nil
+}
+
+func mapExerciseToData(te *entities.TrainingExercise, now time.Time) (*trainingExerciseData, error) {
+	teOID, err := objectIDOrNew(te.ID, "training exercise")
+	if err != nil {
+		return nil, err
+	}
+	exOID, err := primitive.ObjectIDFromHex(te.ExerciseID)
+	if err != nil {
+		return nil, usecases.NewErrorInvalidID(te.ExerciseID, "exercise")
+	}
+
+	sets := make([]trainingSetData, len(te.Sets))
+	for i := 0; i < len(te.Sets); i++ {
+		sOID, err := objectIDOrNew(te.Sets[i].ID, "training set")
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = trainingSetData{
+			ID:        sOID,
+			ClientID:  te.Sets[i].ClientID,
+			Time:      te.Sets[i].Time,
+			Reps:      te.Sets[i].Reps,
+			Load:      te.Sets[i].Load,
+			CreatedAt: timeOrNow(te.Sets[i].CreatedAt, now),
+			UpdatedAt: timeOrNow(te.Sets[i].UpdatedAt, now),
+		}
+	}
+
+	return &trainingExerciseData{
+		ID:         teOID,
+		ClientID:   te.ClientID,
+		ExerciseID: exOID,
+		StartTime:  te.StartTime,
+		EndTime:    te.EndTime,
+		Sets:       sets,
+		Comment:    te.Comment,
+		CreatedAt:  timeOrNow(te.CreatedAt, now),
+		UpdatedAt:  timeOrNow(te.UpdatedAt, now),
+	}, nil
+}
+
+func objectIDOrNew(id string, dataName string) (primitive.ObjectID, error) {
+	if id == "" {
+		return primitive.NewObjectID(), nil
+	}
+	oID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, usecases.NewErrorInvalidID(id, dataName)
+	}
+	return oID, nil
+}
+
+func timeOrNow(t time.Time, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+	return t
+}
+
+// timeOrNil returns nil for the zero time, it is stored as null
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
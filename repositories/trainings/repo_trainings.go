@@ -3,7 +3,6 @@ package trainings
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,31 +14,40 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// trainingData is the stored training, its end time is null while the training is in progress,
+// so the user's open training can be indexed
 type trainingData struct {
 	ID        primitive.ObjectID     `bson:"_id,omitempty,required"`
+	ClientID  string                 `bson:"client_id,omitempty"`
 	UserID    primitive.ObjectID     `bson:"user_id,omitempty,required"`
 	StartTime time.Time              `bson:"start_time,omitempty,required"`
-	EndTime   time.Time              `bson:"end_time,omitempty"`
+	EndTime   *time.Time             `bson:"end_time"`
 	Exercises []trainingExerciseData `bson:"exercises,omitempty"`
 	Comment   string                 `bson:"comment,omitempty"`
 	CreatedAt time.Time              `bson:"created_at,omitempty,required"`
+	UpdatedAt time.Time              `bson:"updated_at,omitempty"`
 }
 
 type trainingExerciseData struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty,required"`
+	ClientID   string             `bson:"client_id,omitempty"`
 	ExerciseID primitive.ObjectID `bson:"exercise_id,omitempty,required"`
 	StartTime  time.Time          `bson:"start_time,omitempty,required"`
 	EndTime    time.Time          `bson:"end_time,omitempty"`
 	Sets       []trainingSetData  `bson:"sets,omitempty"`
 	Comment    string             `bson:"comment,omitempty"`
 	CreatedAt  time.Time          `bson:"created_at,omitempty,required"`
+	UpdatedAt  time.Time          `bson:"updated_at,omitempty"`
 }
 
 type trainingSetData struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty,required"`
+	ClientID  string             `bson:"client_id,omitempty"`
 	Time      time.Time          `bson:"time,omitempty,required"`
 	Reps      int                `bson:"reps,omitempty,required"`
+	Load      float64            `bson:"load,omitempty"`
 	CreatedAt time.Time          `bson:"created_at,omitempty,required"`
+	UpdatedAt time.Time          `bson:"updated_at,omitempty"`
 }
 
 func (r *TrainingRepository) GetTrainingByID(
@@ -82,14 +90,16 @@ func (r *TrainingRepository) StartTraining(
 		return nil, errors.WithMessage(
 			usecases.NewErrorInvalidID(userID, "user"), "start training")
 	}
+	now := time.Now()
 	td := trainingData{
 		UserID:    ouID,
 		StartTime: startTime,
-		CreatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 	results, err := r.col.InsertOne(ctx, td)
 	if err != nil {
-		return nil, fmt.Errorf("start training: %v", err)
+		return nil, errors.WithMessage(err, "start training")
 	}
 
 	t := &entities.Training{
@@ -97,6 +107,7 @@ func (r *TrainingRepository) StartTraining(
 		StartTime: startTime,
 		UserID:    userID,
 		CreatedAt: td.CreatedAt,
+		UpdatedAt: td.UpdatedAt,
 	}
 
 	return t, nil
@@ -113,18 +124,20 @@ func (r *TrainingRepository) EndTraining(
 	}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
-	update := bson.M{"$set": bson.M{"end_time": endTime}}
+	update := bson.M{"$set": bson.M{"end_time": endTime, "updated_at": time.Now()}}
+	// the training ended in the meantime is not matched
+	filter := bson.M{"_id": tOID, "end_time": nil}
 
-	results := r.col.FindOneAndUpdate(
-		ctx, trainingData{ID: tOID}, update, opts)
+	results := r.col.FindOneAndUpdate(ctx, filter, update, opts)
 	err = results.Err()
 	if err != nil {
-		if usecases.IsDuplicatedError(err) {
-			//
-		} else if strings.Contains(err.Error(), "") {
-			//
-		} else if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = r.trainingStateError(ctx, id)
+			var rneErr *usecases.RecordNotExistsError
+			if errors.As(err, &rneErr) {
+				return nil, nil
+			}
+			return nil, errors.WithMessage(err, "end training")
 		}
 		return nil, fmt.Errorf("end training: %v", err)
 	}
@@ -197,24 +210,30 @@ func (r TrainingRepository) StartExercise(
 	if err != nil {
 		return nil, usecases.NewErrorInvalidID(exercise.ExerciseID, "exercise")
 	}
+	now := time.Now()
 	newExerciseData := trainingExerciseData{
 		ID:         primitive.NewObjectID(),
 		ExerciseID: exOID,
 		StartTime:  exercise.StartTime,
 		Comment:    exercise.Comment,
-		CreatedAt:  time.Now(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
 	}
 
-	update := bson.M{"$push": bson.M{"exercises": newExerciseData}}
-	filter := bson.M{"_id": tOID}
+	update := bson.M{
+		"$push": bson.M{"exercises": newExerciseData},
+		"$set":  bson.M{"updated_at": now},
+	}
+	// the training ended in the meantime is not matched
+	filter := bson.M{"_id": tOID, "end_time": nil}
 
 	results, err := r.col.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return nil, fmt.Errorf("add exercise: %v", err)
 	}
 
-	if results.ModifiedCount == 0 {
-		return nil, fmt.Errorf("add exercise: no documents were modified")
+	if results.MatchedCount == 0 {
+		return nil, errors.WithMessage(r.trainingStateError(ctx, trID), "add exercise")
 	}
 
 	newExercise := entities.TrainingExercise{
@@ -224,6 +243,8 @@ func (r TrainingRepository) StartExercise(
 		EndTime:    newExerciseData.EndTime,
 		Comment:    newExerciseData.Comment,
 		Sets:       mapSetsToEntities(newExerciseData.Sets),
+		CreatedAt:  newExerciseData.CreatedAt,
+		UpdatedAt:  newExerciseData.UpdatedAt,
 	}
 	return &newExercise, nil
 }
@@ -244,34 +265,39 @@ func (r TrainingRepository) AddSet(
 			usecases.NewErrorInvalidID(userID, "user"), "add set")
 	}
 
+	now := time.Now()
 	newSetData := trainingSetData{
 		ID:        primitive.NewObjectID(),
 		Time:      set.Time,
 		Reps:      set.Reps,
-		CreatedAt: time.Now(),
+		Load:      set.Load,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	filter := bson.M{
-		"exercises._id": teOID,
-		"user_id":       uOID,
-	}
+	filter := openExerciseFilter(uOID, teOID)
 	// @improvement: check if there is a type safe way to insert nested docs
-	update := bson.M{"$push": bson.M{"exercises.$.sets": newSetData}}
+	update := bson.M{
+		"$push": bson.M{"exercises.$.sets": newSetData},
+		"$set":  bson.M{"exercises.$.updated_at": now, "updated_at": now},
+	}
 
 	results, err := r.col.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return nil, err
 	}
 
-	if results.ModifiedCount == 0 {
-		return nil, fmt.Errorf("add set: no documents were modified")
+	if results.MatchedCount == 0 {
+		return nil, errors.WithMessage(r.exerciseStateError(ctx, teID), "add set")
 	}
 
 	newSet := entities.TrainingSet{
 		ID:        newSetData.ID.Hex(),
 		Time:      newSetData.Time,
 		Reps:      newSetData.Reps,
+		Load:      newSetData.Load,
 		CreatedAt: newSetData.CreatedAt,
+		UpdatedAt: newSetData.UpdatedAt,
 	}
 	return &newSet, nil
 }
@@ -320,13 +346,21 @@ func (r TrainingRepository) EndExercise(
 			usecases.NewErrorInvalidID(id, "user"), "end exercises")
 	}
 
-	filter := bson.M{"exercises._id": teOID, "user_id": uOID}
-	update := bson.M{"$set": bson.M{"exercises.$.end_time": endTime.UTC()}}
+	filter := openExerciseFilter(uOID, teOID)
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"exercises.$.end_time":   endTime.UTC(),
+		"exercises.$.updated_at": now,
+		"updated_at":             now,
+	}}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
 	result := r.col.FindOneAndUpdate(ctx, filter, update, opts)
 	if err = result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.WithMessage(r.exerciseStateError(ctx, id), "end exercise")
+		}
 		return nil, fmt.Errorf("end exercise: %v", err)
 	}
 
@@ -335,6 +369,406 @@ func (r TrainingRepository) EndExercise(
 	if err != nil {
 		return nil, fmt.Errorf("end exercise: %v", err)
 	}
-	te := mapExerciseToEntity(&td.Exercises[0])
-	return te, nil
+	for i := range td.Exercises {
+		if td.Exercises[i].ID == teOID {
+			return mapExerciseToEntity(&td.Exercises[i]), nil
+		}
+	}
+	return nil, fmt.Errorf("end exercise: training exercise %q not found in updated training", id)
+}
+
+// GetTrainingByClientID returns user training created on the client with given client id
+func (r *TrainingRepository) GetTrainingByClientID(
+	ctx context.Context,
+	userID, clientID string) (*entities.Training, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "get training by client id")
+	}
+
+	filter := bson.M{"user_id": uOID, "client_id": clientID}
+
+	result := r.col.FindOne(ctx, filter)
+	if err = result.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("get training by client id: %v", err)
+	}
+
+	td := trainingData{}
+	err = result.Decode(&td)
+	if err != nil {
+		return nil, fmt.Errorf("get training by client id: %v", err)
+	}
+
+	return mapTrainingToEntity(&td), nil
+}
+
+// CreateTraining inserts the whole training with its exercises and sets
+func (r *TrainingRepository) CreateTraining(
+	ctx context.Context,
+	t *entities.Training) (*entities.Training, error) {
+	td, err := mapTrainingToData(t, time.Now())
+	if err != nil {
+		return nil, errors.WithMessage(err, "create training")
+	}
+
+	_, err = r.col.InsertOne(ctx, td)
+	if err != nil {
+		return nil, errors.WithMessage(err, "create training")
+	}
+
+	return mapTrainingToEntity(td), nil
+}
+
+// ReplaceTraining overrides stored user training with given one
+// as long as it was not modified since lastUpdatedAt,
+// nil is returned if the training was modified or removed in the meantime
+func (r *TrainingRepository) ReplaceTraining(
+	ctx context.Context,
+	t *entities.Training,
+	lastUpdatedAt time.Time) (*entities.Training, error) {
+	if t.ID == "" {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(t.ID, "training"), "replace training")
+	}
+
+	td, err := mapTrainingToData(t, time.Now())
+	if err != nil {
+		return nil, errors.WithMessage(err, "replace training")
+	}
+
+	filter := bson.M{"_id": td.ID, "user_id": td.UserID, "updated_at": lastUpdatedAt}
+	if lastUpdatedAt.IsZero() {
+		filter["updated_at"] = nil
+	}
+
+	results, err := r.col.ReplaceOne(ctx, filter, td)
+	if err != nil {
+		return nil, fmt.Errorf("replace training: %v", err)
+	}
+
+	if results.MatchedCount == 0 {
+		return nil, nil
+	}
+
+	return mapTrainingToEntity(td), nil
+}
+
+// GetUserTrainingsChangedSince returns user trainings modified after given time
+// and the ones modified at that time with ids greater than afterID
+func (r *TrainingRepository) GetUserTrainingsChangedSince(
+	ctx context.Context,
+	userID string,
+	since time.Time,
+	afterID string,
+	limit int64) ([]entities.Training, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"),
+			"get user trainings changed since")
+	}
+
+	filter := bson.M{"user_id": uOID}
+	if afterID != "" {
+		afterOID, err := primitive.ObjectIDFromHex(afterID)
+		if err != nil {
+			return nil, errors.WithMessage(
+				usecases.NewErrorInvalidID(afterID, "training"),
+				"get user trainings changed since")
+		}
+		filter["$or"] = bson.A{
+			bson.M{"updated_at": bson.M{"$gt": since}},
+			bson.M{"updated_at": since, "_id": bson.M{"$gt": afterOID}},
+		}
+	} else if !since.IsZero() {
+		filter["updated_at"] = bson.M{"$gt": since}
+	}
+	// the id breaks ties of the trainings modified at the same time so that the pages do not overlap
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}, {Key: "_id", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("get user trainings changed since: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	t := make([]entities.Training, 0, cursor.RemainingBatchLength())
+	for cursor.Next(ctx) {
+		var training trainingData
+		err = cursor.Decode(&training)
+		if err != nil {
+			return nil, fmt.Errorf("get user trainings changed since: %v", err)
+		}
+
+		t = append(t, *mapTrainingToEntity(&training))
+	}
+
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("get user trainings changed since: %v", err)
+	}
+
+	return t, nil
+}
+
+// GetUserOpenTraining returns user training that is not ended yet
+func (r *TrainingRepository) GetUserOpenTraining(
+	ctx context.Context,
+	userID string) (*entities.Training, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "get user open training")
+	}
+
+	filter := bson.M{"user_id": uOID, "end_time": nil}
+	opts := options.FindOne().SetSort(bson.M{"start_time": -1})
+
+	result := r.col.FindOne(ctx, filter, opts)
+	if err = result.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("get user open training: %v", err)
+	}
+
+	td := trainingData{}
+	err = result.Decode(&td)
+	if err != nil {
+		return nil, fmt.Errorf("get user open training: %v", err)
+	}
+
+	return mapTrainingToEntity(&td), nil
+}
+
+// GetTrainingByExerciseID returns training that contains training exercise with given id
+func (r *TrainingRepository) GetTrainingByExerciseID(
+	ctx context.Context,
+	teID string) (*entities.Training, error) {
+	teOID, err := primitive.ObjectIDFromHex(teID)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(teID, "training exercise"), "get training by exercise id")
+	}
+
+	filter := bson.M{"exercises._id": teOID}
+
+	result := r.col.FindOne(ctx, filter)
+	if err = result.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("get training by exercise id: %v", err)
+	}
+
+	td := trainingData{}
+	err = result.Decode(&td)
+	if err != nil {
+		return nil, fmt.Errorf("get training by exercise id: %v", err)
+	}
+
+	return mapTrainingToEntity(&td), nil
+}
+
+// GetInactiveTrainings returns trainings that are not ended yet
+// and were not modified since given time
+func (r *TrainingRepository) GetInactiveTrainings(
+	ctx context.Context,
+	before time.Time) ([]entities.Training, error) {
+	filter := bson.M{
+		"end_time": nil,
+		"$or": bson.A{
+			bson.M{"updated_at": bson.M{"$lt": before}},
+			// trainings created before the updated_at was introduced
+			bson.M{"updated_at": nil, "start_time": bson.M{"$lt": before}},
+		},
+	}
+
+	cursor, err := r.col.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("get inactive trainings: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	t := make([]entities.Training, 0, cursor.RemainingBatchLength())
+	for cursor.Next(ctx) {
+		var training trainingData
+		err = cursor.Decode(&training)
+		if err != nil {
+			return nil, fmt.Errorf("get inactive trainings: %v", err)
+		}
+
+		t = append(t, *mapTrainingToEntity(&training))
+	}
+
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("get inactive trainings: %v", err)
+	}
+
+	return t, nil
+}
+
+// CloseInactiveTraining overrides stored training with given ended one
+// as long as it was not modified since lastUpdatedAt,
+// nil is returned if the training was modified in the meantime
+func (r *TrainingRepository) CloseInactiveTraining(
+	ctx context.Context,
+	t *entities.Training,
+	lastUpdatedAt time.Time) (*entities.Training, error) {
+	td, err := mapTrainingToData(t, time.Now())
+	if err != nil {
+		return nil, errors.WithMessage(err, "close inactive training")
+	}
+
+	filter := bson.M{"_id": td.ID, "end_time": nil, "updated_at": lastUpdatedAt}
+	if lastUpdatedAt.IsZero() {
+		filter["updated_at"] = nil
+	}
+
+	results, err := r.col.ReplaceOne(ctx, filter, td)
+	if err != nil {
+		return nil, fmt.Errorf("close inactive training: %v", err)
+	}
+
+	if results.MatchedCount == 0 {
+		return nil, nil
+	}
+
+	return mapTrainingToEntity(td), nil
+}
+
+// DeleteUserTrainings removes all trainings of the user, it returns number of deleted trainings
+func (r *TrainingRepository) DeleteUserTrainings(
+	ctx context.Context,
+	userID string) (int64, error) {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "delete user trainings")
+	}
+
+	result, err := r.col.DeleteMany(ctx, bson.M{"user_id": uOID})
+	if err != nil {
+		return 0, fmt.Errorf("delete user trainings: %v", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// IsExerciseUsed tells whether any training contains the exercise
+func (r *TrainingRepository) IsExerciseUsed(
+	ctx context.Context,
+	exerciseID string) (bool, error) {
+	exOID, err := primitive.ObjectIDFromHex(exerciseID)
+	if err != nil {
+		return false, errors.WithMessage(
+			usecases.NewErrorInvalidID(exerciseID, "exercise"), "is exercise used")
+	}
+
+	n, err := r.col.CountDocuments(ctx, bson.M{"exercises.exercise_id": exOID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("is exercise used: %v", err)
+	}
+	return n > 0, nil
+}
+
+// ForEachUserTraining calls fn for every user training started within [from, to) in order of their start,
+// the zero times do not limit the range. The trainings are read one by one, it stops at the first error of fn
+func (r *TrainingRepository) ForEachUserTraining(
+	ctx context.Context,
+	userID string,
+	from, to time.Time,
+	fn func(t *entities.Training) error) error {
+	uOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.WithMessage(
+			usecases.NewErrorInvalidID(userID, "user"), "for each user training")
+	}
+
+	filter := bson.M{"user_id": uOID}
+	startTime := bson.M{}
+	if !from.IsZero() {
+		startTime["$gte"] = from
+	}
+	if !to.IsZero() {
+		startTime["$lt"] = to
+	}
+	if len(startTime) > 0 {
+		filter["start_time"] = startTime
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_time", Value: 1}})
+	cursor, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return fmt.Errorf("for each user training: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var td trainingData
+		err = cursor.Decode(&td)
+		if err != nil {
+			return fmt.Errorf("for each user training: %v", err)
+		}
+
+		err = fn(mapTrainingToEntity(&td))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("for each user training: %v", err)
+	}
+	return nil
+}
+
+// openExerciseFilter matches the user's training exercise that is in progress in the training in progress,
+// the zero end time of the exercise is not stored, so null matches it
+func openExerciseFilter(userID, teID primitive.ObjectID) bson.M {
+	return bson.M{
+		"user_id":  userID,
+		"end_time": nil,
+		"exercises": bson.M{"$elemMatch": bson.M{
+			"_id":      teID,
+			"end_time": nil,
+		}},
+	}
+}
+
+// trainingStateError tells why the conditional update has not matched the training,
+// the training has ended or it does not exist
+func (r TrainingRepository) trainingStateError(ctx context.Context, id string) error {
+	t, err := r.GetTrainingByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return usecases.NewErrorRecordNotExists("training")
+	}
+	return usecases.NewErrorTrainingCompleted(t.ID)
+}
+
+// exerciseStateError tells why the conditional update has not matched the training exercise,
+// the training or the exercise has ended or it does not exist
+func (r TrainingRepository) exerciseStateError(ctx context.Context, teID string) error {
+	t, err := r.GetTrainingByExerciseID(ctx, teID)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return usecases.NewErrorRecordNotExists("training exercise")
+	}
+	if !t.EndTime.IsZero() {
+		return usecases.NewErrorTrainingCompleted(t.ID)
+	}
+	return usecases.NewErrorTrainingExerciseCompleted(teID)
 }
@@ -2,6 +2,8 @@ package trainings
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/rand"
 	"os"
 	"testing"
@@ -13,6 +15,7 @@ import (
 	"github.com/unnamedxaer/gymm-api/repositories"
 	"github.com/unnamedxaer/gymm-api/repositories/users"
 	"github.com/unnamedxaer/gymm-api/testhelpers"
+	"github.com/unnamedxaer/gymm-api/usecases"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -361,6 +364,53 @@ func TestEndTraining(t *testing.T) {
 	}
 }
 
+func TestModifyEndedTraining(t *testing.T) {
+	ctx := context.TODO()
+	userID := primitive.NewObjectID().Hex()
+
+	tr, err := trainingRepo.StartTraining(ctx, userID, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	te, err := trainingRepo.StartExercise(ctx, tr.ID, &entities.TrainingExercise{
+		ExerciseID: primitive.NewObjectID().Hex(),
+		StartTime:  time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = trainingRepo.EndExercise(ctx, userID, te.ID, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var teCompletedErr *usecases.TrainingExerciseCompletedError
+	_, err = trainingRepo.AddSet(ctx, userID, te.ID, &entities.TrainingSet{Time: time.Now().UTC(), Reps: 1})
+	if !errors.As(err, &teCompletedErr) {
+		t.Errorf("expect error %T when adding set to ended exercise, got %v", teCompletedErr, err)
+	}
+
+	_, err = trainingRepo.EndTraining(ctx, tr.ID, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trCompletedErr *usecases.TrainingCompletedError
+	_, err = trainingRepo.EndTraining(ctx, tr.ID, time.Now().UTC())
+	if !errors.As(err, &trCompletedErr) {
+		t.Errorf("expect error %T when ending ended training, got %v", trCompletedErr, err)
+	}
+
+	_, err = trainingRepo.StartExercise(ctx, tr.ID, &entities.TrainingExercise{
+		ExerciseID: primitive.NewObjectID().Hex(),
+		StartTime:  time.Now().UTC(),
+	})
+	if !errors.As(err, &trCompletedErr) {
+		t.Errorf("expect error %T when starting exercise in ended training, got %v", trCompletedErr, err)
+	}
+}
+
 func TestGetUserTrainings(t *testing.T) {
 	ctx := context.TODO()
 	if mockedStartedTraining.StartTime.IsZero() {
@@ -391,3 +441,342 @@ func TestGetUserTrainings(t *testing.T) {
 		t.Errorf("expect training %q to be among trainings for user %q", mockedStartedTraining.ID, mockedStartedTraining.UserID)
 	}
 }
+
+func TestCreateTrainingAndGetByClientID(t *testing.T) {
+	ctx := context.TODO()
+	clientID := fmt.Sprintf("client-%d", time.Now().UnixNano())
+	now := time.Now().UTC()
+	input := entities.Training{
+		ClientID:  clientID,
+		UserID:    mockedUser.ID,
+		StartTime: now.Add(-time.Hour),
+		Exercises: []entities.TrainingExercise{
+			{
+				ClientID:   clientID + "-ex",
+				ExerciseID: "6070007dac9cb6e543aba500",
+				StartTime:  now.Add(-50 * time.Minute),
+				Sets: []entities.TrainingSet{
+					{ClientID: clientID + "-set", Time: now.Add(-45 * time.Minute), Reps: 8},
+				},
+			},
+		},
+	}
+
+	created, err := trainingRepo.CreateTraining(ctx, &input)
+	if err != nil {
+		t.Fatalf("expect to create training, got error: %v", err)
+	}
+
+	if created.ID == "" || created.Exercises[0].ID == "" || created.Exercises[0].Sets[0].ID == "" {
+		t.Errorf("expect ids to be assigned, got %v", created)
+	}
+
+	got, err := trainingRepo.GetTrainingByClientID(ctx, mockedUser.ID, clientID)
+	if err != nil {
+		t.Fatalf("expect to get training, got error: %v", err)
+	}
+
+	if got == nil || got.ID != created.ID {
+		t.Fatalf("expect training %q, got %v", created.ID, got)
+	}
+
+	_, err = trainingRepo.CreateTraining(ctx, &input)
+	if !usecases.IsDuplicatedError(err) {
+		t.Errorf("expect duplicated client id error, got %v", err)
+	}
+
+	lastUpdatedAt := got.UpdatedAt
+	got.Comment = "synced"
+	got.UpdatedAt = time.Now().UTC()
+
+	stale, err := trainingRepo.ReplaceTraining(ctx, got, lastUpdatedAt.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("expect to not replace training, got error: %v", err)
+	}
+	if stale != nil {
+		t.Fatalf("expect training modified in the meantime to not be replaced, got %v", stale)
+	}
+
+	replaced, err := trainingRepo.ReplaceTraining(ctx, got, lastUpdatedAt)
+	if err != nil {
+		t.Fatalf("expect to replace training, got error: %v", err)
+	}
+	if replaced == nil {
+		t.Fatal("expect training to be replaced, got nil")
+	}
+
+	if replaced.Comment != got.Comment || replaced.Exercises[0].Sets[0].ID != created.Exercises[0].Sets[0].ID {
+		t.Errorf("expect replaced training %v, got %v", got, replaced)
+	}
+}
+
+func TestGetUserTrainingsChangedSince(t *testing.T) {
+	ctx := context.TODO()
+	if mockedStartedTraining.StartTime.IsZero() {
+		t.Run("create new started training", TestStartTraining)
+	}
+
+	tr, err := trainingRepo.GetUserTrainingsChangedSince(ctx, mockedStartedTraining.UserID, time.Time{}, "", 0)
+	if err != nil {
+		t.Fatalf("expected to get trainings for user %q, got error: %v", mockedStartedTraining.UserID, err)
+	}
+
+	if len(tr) == 0 {
+		t.Errorf("expect to get at least one training for user %q", mockedStartedTraining.UserID)
+	}
+
+	tr, err = trainingRepo.GetUserTrainingsChangedSince(ctx, mockedStartedTraining.UserID, time.Now().Add(time.Minute), "", 0)
+	if err != nil {
+		t.Fatalf("expected to get trainings for user %q, got error: %v", mockedStartedTraining.UserID, err)
+	}
+
+	if len(tr) != 0 {
+		t.Errorf("expect no trainings changed in the future, got %v", tr)
+	}
+}
+
+func TestGetUserTrainingsChangedSincePages(t *testing.T) {
+	ctx := context.TODO()
+	userID := primitive.NewObjectID().Hex()
+	now := time.Now().UTC()
+
+	// the trainings modified at the same time are told apart by their ids
+	for i := 0; i < 3; i++ {
+		_, err := trainingRepo.CreateTraining(ctx, &entities.Training{
+			ClientID:  fmt.Sprintf("%s-%d", userID, i),
+			UserID:    userID,
+			StartTime: now.Add(-time.Hour),
+			EndTime:   now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := trainingRepo.GetUserTrainingsChangedSince(ctx, userID, time.Time{}, "", 2)
+	if err != nil {
+		t.Fatalf("expected to get trainings for user %q, got error: %v", userID, err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("expect 2 trainings on the first page, got %v", first)
+	}
+
+	last := first[len(first)-1]
+	second, err := trainingRepo.GetUserTrainingsChangedSince(ctx, userID, last.UpdatedAt, last.ID, 2)
+	if err != nil {
+		t.Fatalf("expected to get trainings for user %q, got error: %v", userID, err)
+	}
+	if len(second) != 1 {
+		t.Fatalf("expect 1 training on the second page, got %v", second)
+	}
+	for _, tr := range first {
+		if tr.ID == second[0].ID {
+			t.Errorf("expect pages not to overlap, got training %q twice", tr.ID)
+		}
+	}
+}
+
+func TestGetUserOpenTraining(t *testing.T) {
+	ctx := context.TODO()
+	userID := primitive.NewObjectID().Hex()
+
+	tr, err := trainingRepo.GetUserOpenTraining(ctx, userID)
+	if err != nil {
+		t.Fatalf("expected to get open training for user %q, got error: %v", userID, err)
+	}
+	if tr != nil {
+		t.Fatalf("expect no open training for new user, got %v", tr)
+	}
+
+	started, err := trainingRepo.StartTraining(ctx, userID, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err = trainingRepo.GetUserOpenTraining(ctx, userID)
+	if err != nil {
+		t.Fatalf("expected to get open training for user %q, got error: %v", userID, err)
+	}
+	if tr == nil || tr.ID != started.ID {
+		t.Fatalf("expect open training %q, got %v", started.ID, tr)
+	}
+
+	_, err = trainingRepo.EndTraining(ctx, started.ID, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err = trainingRepo.GetUserOpenTraining(ctx, userID)
+	if err != nil {
+		t.Fatalf("expected to get open training for user %q, got error: %v", userID, err)
+	}
+	if tr != nil {
+		t.Errorf("expect no open training after ending it, got %v", tr)
+	}
+}
+
+func TestGetTrainingByExerciseID(t *testing.T) {
+	ctx := context.TODO()
+	if mockedStartedExercise.StartTime.IsZero() {
+		t.Run("create new started exercise by 'TestAddExercise'", TestStartExercise)
+	}
+
+	tr, err := trainingRepo.GetTrainingByExerciseID(ctx, mockedStartedExercise.ID)
+	if err != nil {
+		t.Fatalf("expected to get training by exercise id %q, got error: %v", mockedStartedExercise.ID, err)
+	}
+
+	if tr == nil || tr.ID != mockedStartedTraining.ID {
+		t.Errorf("expect training %q, got %v", mockedStartedTraining.ID, tr)
+	}
+
+	tr, err = trainingRepo.GetTrainingByExerciseID(ctx, primitive.NewObjectID().Hex())
+	if err != nil {
+		t.Fatalf("expected nil error for not existing exercise, got: %v", err)
+	}
+	if tr != nil {
+		t.Errorf("expect nil training for not existing exercise, got %v", tr)
+	}
+}
+
+func TestCloseInactiveTraining(t *testing.T) {
+	ctx := context.TODO()
+	userID := primitive.NewObjectID().Hex()
+
+	started, err := trainingRepo.StartTraining(ctx, userID, time.Now().UTC().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inactive, err := trainingRepo.GetInactiveTrainings(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("expected to get inactive trainings, got error: %v", err)
+	}
+
+	var tr *entities.Training
+	for i := range inactive {
+		if inactive[i].ID == started.ID {
+			tr = &inactive[i]
+			break
+		}
+	}
+	if tr == nil {
+		t.Fatalf("expect training %q to be among inactive trainings", started.ID)
+	}
+
+	lastUpdatedAt := tr.UpdatedAt
+	tr.EndTime = tr.StartTime
+	tr.UpdatedAt = time.Now().UTC()
+
+	// simulates activity after the training was read
+	_, err = trainingRepo.StartExercise(ctx, tr.ID, &entities.TrainingExercise{
+		ExerciseID: primitive.NewObjectID().Hex(),
+		StartTime:  time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed, err := trainingRepo.CloseInactiveTraining(ctx, tr, lastUpdatedAt)
+	if err != nil {
+		t.Fatalf("expected to close inactive training, got error: %v", err)
+	}
+	if closed != nil {
+		t.Fatalf("expect training modified in the meantime to not be closed, got %v", closed)
+	}
+
+	tr, err = trainingRepo.GetTrainingByID(ctx, started.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastUpdatedAt = tr.UpdatedAt
+	tr.EndTime = tr.Exercises[0].StartTime
+	tr.UpdatedAt = time.Now().UTC()
+
+	closed, err = trainingRepo.CloseInactiveTraining(ctx, tr, lastUpdatedAt)
+	if err != nil {
+		t.Fatalf("expected to close inactive training, got error: %v", err)
+	}
+	if closed == nil || !testhelpers.TimesEqual(closed.EndTime, tr.EndTime) {
+		t.Errorf("expect closed training with end time %s, got %v", tr.EndTime, closed)
+	}
+}
+
+func TestDeleteUserTrainings(t *testing.T) {
+	ctx := context.TODO()
+	userID := primitive.NewObjectID().Hex()
+	exerciseID := primitive.NewObjectID().Hex()
+
+	tr, err := trainingRepo.StartTraining(ctx, userID, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = trainingRepo.StartExercise(ctx, tr.ID, &entities.TrainingExercise{
+		ExerciseID: exerciseID,
+		StartTime:  time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := trainingRepo.IsExerciseUsed(ctx, exerciseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !used {
+		t.Errorf("expect exercise %q to be used", exerciseID)
+	}
+
+	n, err := trainingRepo.DeleteUserTrainings(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expect 1 deleted training, got %d", n)
+	}
+
+	used, err = trainingRepo.IsExerciseUsed(ctx, exerciseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used {
+		t.Errorf("expect exercise %q not to be used after deleting the trainings", exerciseID)
+	}
+}
+
+func TestForEachUserTraining(t *testing.T) {
+	ctx := context.TODO()
+	userID := primitive.NewObjectID().Hex()
+	start := time.Now().UTC().Add(-48 * time.Hour)
+
+	for i := 2; i >= 0; i-- {
+		_, err := trainingRepo.StartTraining(ctx, userID, start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer trainingRepo.DeleteUserTrainings(ctx, userID)
+
+	var got []time.Time
+	err := trainingRepo.ForEachUserTraining(ctx, userID, start.Add(time.Hour), time.Time{}, func(tr *entities.Training) error {
+		got = append(got, tr.StartTime)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Before(got[1]) {
+		t.Errorf("expect 2 trainings in order of their start, got %v", got)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = trainingRepo.ForEachUserTraining(ctx, userID, time.Time{}, time.Time{}, func(tr *entities.Training) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("expect to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
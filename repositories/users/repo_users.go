@@ -2,6 +2,7 @@ package users
 
 import (
 	"context"
+	"regexp"
 	"time"
 
 	"github.com/pkg/errors"
@@ -9,6 +10,8 @@ import (
 	"github.com/unnamedxaer/gymm-api/usecases"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // UserData is used only to push data to db
@@ -18,6 +21,111 @@ type UserData struct {
 	EmailAddress string             `json:"emailAddress,omitempty" bson:"email_address,omitempty"`
 	Password     []byte             `json:"password,omitempty" bson:"password,omitempty"`
 	CreatedAt    time.Time          `json:"createdAt,omitempty" bson:"created_at,omitempty"`
+	// EmailVerification is set until the email address gets verified,
+	// accounts created before the verification was introduced do not have it
+	EmailVerification *EmailVerificationData `json:"-" bson:"email_verification,omitempty"`
+	// EmailChange is set while the new email address waits for the verification
+	EmailChange *EmailChangeData `json:"-" bson:"email_change,omitempty"`
+	TwoFactor   *TwoFactorData   `json:"-" bson:"two_factor,omitempty"`
+	// ExternalIdentities are the linked accounts at the OpenID Connect providers
+	ExternalIdentities []ExternalIdentityData `json:"-" bson:"external_identities,omitempty"`
+	// Role is empty for the users created before the roles were introduced
+	Role     string `json:"-" bson:"role,omitempty"`
+	Disabled bool   `json:"-" bson:"disabled,omitempty"`
+	// Preferences are missing until the user sets any of them
+	Preferences *PreferencesData `json:"-" bson:"preferences,omitempty"`
+	// DeletionScheduledAt is set while the account waits for the deletion
+	DeletionScheduledAt *time.Time `json:"-" bson:"deletion_scheduled_at,omitempty"`
+	// DeletionStarted is set once the removal of the user's data began, the deletion cannot be cancelled then
+	DeletionStarted bool `json:"-" bson:"deletion_started,omitempty"`
+	// CalendarFeedToken is the hash of the calendar feed secret, empty if the feed is off
+	CalendarFeedToken string `json:"-" bson:"calendar_feed_token,omitempty"`
+}
+
+// PreferencesData are the user's settings, the missing ones take the default values
+type PreferencesData struct {
+	Theme    string `bson:"theme,omitempty"`
+	Timezone string `bson:"timezone,omitempty"`
+	Units    string `bson:"units,omitempty"`
+}
+
+// mapPreferencesToEntity fills the preferences the user has not set with the default values
+func mapPreferencesToEntity(pd *PreferencesData) entities.UserPreferences {
+	prefs := entities.DefaultUserPreferences
+	if pd == nil {
+		return prefs
+	}
+
+	if pd.Theme != "" {
+		prefs.Theme = entities.Theme(pd.Theme)
+	}
+	if pd.Timezone != "" {
+		prefs.Timezone = pd.Timezone
+	}
+	if pd.Units != "" {
+		prefs.Units = entities.UnitSystem(pd.Units)
+	}
+	return prefs
+}
+
+// MapUserToEntity maps the stored user to the entity,
+// the users without a known role get the default one
+func MapUserToEntity(ud *UserData) entities.User {
+	role := entities.Role(ud.Role)
+	if !role.IsValid() {
+		role = entities.RoleUser
+	}
+
+	pendingEmailAddress := ""
+	if ud.EmailChange != nil {
+		pendingEmailAddress = ud.EmailChange.PendingEmailAddress
+	}
+
+	return entities.User{
+		ID:                  ud.ID.Hex(),
+		EmailAddress:        ud.EmailAddress,
+		Username:            ud.Username,
+		EmailVerified:       ud.EmailVerification == nil,
+		PendingEmailAddress: pendingEmailAddress,
+		TwoFactorEnabled:    ud.TwoFactor != nil && ud.TwoFactor.Enabled,
+		Role:                role,
+		Disabled:            ud.Disabled,
+		Preferences:         mapPreferencesToEntity(ud.Preferences),
+		DeletionScheduledAt: ud.DeletionScheduledAt,
+		CalendarFeedEnabled: ud.CalendarFeedToken != "",
+		CreatedAt:           ud.CreatedAt,
+	}
+}
+
+// ExternalIdentityData identifies the user's account at the OpenID Connect provider
+type ExternalIdentityData struct {
+	Issuer  string `bson:"issuer"`
+	Subject string `bson:"subject"`
+}
+
+// TwoFactorData is the TOTP second factor of the user
+type TwoFactorData struct {
+	// Secret is encrypted by the usecases
+	Secret        []byte   `bson:"secret,omitempty"`
+	Enabled       bool     `bson:"enabled"`
+	LastUsedStep  int64    `bson:"last_used_step"`
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+}
+
+// EmailVerificationData is a pending verification of the user's email address
+type EmailVerificationData struct {
+	// Token is a hash of the token sent to the user, empty if none has been sent yet
+	Token     string    `bson:"token,omitempty"`
+	ExpiresAt time.Time `bson:"expires_at,omitempty"`
+}
+
+// EmailChangeData is the new email address of the user waiting for the verification,
+// the address is not unique until it replaces the current one
+type EmailChangeData struct {
+	PendingEmailAddress string `bson:"pending_email_address"`
+	// Token is a hash of the token sent to the pending address
+	Token     string    `bson:"token"`
+	ExpiresAt time.Time `bson:"expires_at"`
 }
 
 // GetUserByID retrieves user info from storage
@@ -39,12 +147,7 @@ func (r *UserRepository) GetUserByID(
 		return nil, errors.WithMessage(err, "repo.GetUserByID")
 	}
 
-	u := entities.User{
-		ID:           ud.ID.Hex(),
-		EmailAddress: ud.EmailAddress,
-		Username:     ud.Username,
-		CreatedAt:    ud.CreatedAt,
-	}
+	u := MapUserToEntity(&ud)
 	return &u, nil
 }
 
@@ -62,6 +165,8 @@ func (r *UserRepository) CreateUser(
 		EmailAddress: emailAddress,
 		Password:     passwordHash,
 		CreatedAt:    now,
+		// the verification token is generated and sent by the usecases
+		EmailVerification: &EmailVerificationData{},
 	}
 
 	result, err := r.col.InsertOne(ctx, ud)
@@ -84,7 +189,295 @@ func (r *UserRepository) CreateUser(
 		ID:           id.Hex(),
 		Username:     username,
 		EmailAddress: emailAddress,
+		Role:         entities.RoleUser,
+		Preferences:  entities.DefaultUserPreferences,
 		CreatedAt:    now,
 	}
 	return &u, nil
 }
+
+// GetUsers returns the users ordered by their IDs, starting after the user with given ID,
+// the not empty query has to be a part of the user's email address or username
+func (r *UserRepository) GetUsers(
+	ctx context.Context,
+	query string,
+	afterID string,
+	limit int64) ([]entities.User, error) {
+	filter := bson.M{}
+	if query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"email_address": pattern},
+			bson.M{"username": pattern},
+		}
+	}
+	if afterID != "" {
+		oID, err := primitive.ObjectIDFromHex(afterID)
+		if err != nil {
+			return nil, errors.WithMessage(
+				usecases.NewErrorInvalidID(afterID, "user"), "repo.GetUsers")
+		}
+		filter["_id"] = bson.M{"$gt": oID}
+	}
+
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit)
+	cursor, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.WithMessage(err, "repo.GetUsers")
+	}
+
+	data := []UserData{}
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "repo.GetUsers")
+	}
+
+	users := make([]entities.User, len(data))
+	for i := range data {
+		users[i] = MapUserToEntity(&data[i])
+	}
+	return users, nil
+}
+
+// SetUserDisabled disables or re-enables the user's account,
+// it returns nil if there is no such user
+func (r *UserRepository) SetUserDisabled(
+	ctx context.Context,
+	id string,
+	disabled bool) (*entities.User, error) {
+	oID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "user"), "repo.SetUserDisabled")
+	}
+
+	update := bson.M{"$set": bson.M{"disabled": true}}
+	if !disabled {
+		update = bson.M{"$unset": bson.M{"disabled": ""}}
+	}
+
+	var ud UserData
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.col.FindOneAndUpdate(ctx, bson.M{"_id": oID}, update, opts).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "repo.SetUserDisabled")
+	}
+
+	u := MapUserToEntity(&ud)
+	return &u, nil
+}
+
+// SetUserRole replaces the user's role, it returns nil if there is no such user
+func (r *UserRepository) SetUserRole(
+	ctx context.Context,
+	id string,
+	role entities.Role) (*entities.User, error) {
+	oID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "user"), "repo.SetUserRole")
+	}
+
+	var ud UserData
+	update := bson.M{"$set": bson.M{"role": role}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.col.FindOneAndUpdate(ctx, bson.M{"_id": oID}, update, opts).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "repo.SetUserRole")
+	}
+
+	u := MapUserToEntity(&ud)
+	return &u, nil
+}
+
+// UpdateUserProfile sets the not nil fields of the profile,
+// it returns nil if there is no such user
+func (r *UserRepository) UpdateUserProfile(
+	ctx context.Context,
+	id string,
+	profile *usecases.UserProfileInput) (*entities.User, error) {
+	oID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "user"), "repo.UpdateUserProfile")
+	}
+
+	fields := bson.M{}
+	if profile.Username != nil {
+		fields["username"] = *profile.Username
+	}
+	if profile.Theme != nil {
+		fields["preferences.theme"] = string(*profile.Theme)
+	}
+	if profile.Timezone != nil {
+		fields["preferences.timezone"] = *profile.Timezone
+	}
+	if profile.Units != nil {
+		fields["preferences.units"] = string(*profile.Units)
+	}
+	if len(fields) == 0 {
+		return r.GetUserByID(ctx, id)
+	}
+
+	var ud UserData
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.col.FindOneAndUpdate(ctx, bson.M{"_id": oID}, bson.M{"$set": fields}, opts).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "repo.UpdateUserProfile")
+	}
+
+	u := MapUserToEntity(&ud)
+	return &u, nil
+}
+
+// SetUserDeletionTime schedules the deletion of the user's account at given time,
+// nil cancels the deletion. It returns nil if there is no such user or its deletion has started
+func (r *UserRepository) SetUserDeletionTime(
+	ctx context.Context,
+	id string,
+	at *time.Time) (*entities.User, error) {
+	oID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "user"), "repo.SetUserDeletionTime")
+	}
+
+	update := bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}}
+	if at != nil {
+		update = bson.M{"$set": bson.M{"deletion_scheduled_at": at.UTC()}}
+	}
+
+	filter := bson.M{
+		"_id":              oID,
+		"deletion_started": bson.M{"$ne": true},
+	}
+
+	var ud UserData
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "repo.SetUserDeletionTime")
+	}
+
+	u := MapUserToEntity(&ud)
+	return &u, nil
+}
+
+// StartUserDeletion marks the deletion of the user's account as started if it was scheduled before given time,
+// the deletion cannot be cancelled afterwards. It returns nil if there is no such user to delete
+func (r *UserRepository) StartUserDeletion(
+	ctx context.Context,
+	id string,
+	before time.Time) (*entities.User, error) {
+	oID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "user"), "repo.StartUserDeletion")
+	}
+
+	filter := bson.M{
+		"_id":                   oID,
+		"deletion_scheduled_at": bson.M{"$lte": before},
+	}
+	update := bson.M{"$set": bson.M{"deletion_started": true}}
+
+	var ud UserData
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "repo.StartUserDeletion")
+	}
+
+	u := MapUserToEntity(&ud)
+	return &u, nil
+}
+
+// SetCalendarFeedToken replaces the hash of the user's calendar feed secret,
+// the empty hash turns the feed off. It returns nil if there is no such user
+func (r *UserRepository) SetCalendarFeedToken(
+	ctx context.Context,
+	id string,
+	tokenHash string) (*entities.User, error) {
+	oID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.WithMessage(
+			usecases.NewErrorInvalidID(id, "user"), "repo.SetCalendarFeedToken")
+	}
+
+	update := bson.M{"$unset": bson.M{"calendar_feed_token": ""}}
+	if tokenHash != "" {
+		update = bson.M{"$set": bson.M{"calendar_feed_token": tokenHash}}
+	}
+
+	var ud UserData
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.col.FindOneAndUpdate(ctx, bson.M{"_id": oID}, update, opts).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "repo.SetCalendarFeedToken")
+	}
+
+	u := MapUserToEntity(&ud)
+	return &u, nil
+}
+
+// GetUserByCalendarFeedToken returns the user with the calendar feed secret of given hash,
+// it returns nil if there is no such user
+func (r *UserRepository) GetUserByCalendarFeedToken(
+	ctx context.Context,
+	tokenHash string) (*entities.User, error) {
+	var ud UserData
+	err := r.col.FindOne(ctx, bson.M{"calendar_feed_token": tokenHash}).Decode(&ud)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "repo.GetUserByCalendarFeedToken")
+	}
+
+	u := MapUserToEntity(&ud)
+	return &u, nil
+}
+
+// GetUsersToDelete returns up to limit users whose deletion was scheduled before given time
+func (r *UserRepository) GetUsersToDelete(
+	ctx context.Context,
+	before time.Time,
+	limit int64) ([]entities.User, error) {
+	filter := bson.M{"deletion_scheduled_at": bson.M{"$lte": before}}
+	opts := options.Find().SetSort(bson.M{"deletion_scheduled_at": 1}).SetLimit(limit)
+
+	cursor, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.WithMessage(err, "repo.GetUsersToDelete")
+	}
+
+	data := []UserData{}
+	err = cursor.All(ctx, &data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "repo.GetUsersToDelete")
+	}
+
+	users := make([]entities.User, len(data))
+	for i := range data {
+		users[i] = MapUserToEntity(&data[i])
+	}
+	return users, nil
+}
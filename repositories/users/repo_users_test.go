@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
 	"github.com/unnamedxaer/gymm-api/repositories"
 	"github.com/unnamedxaer/gymm-api/testhelpers"
 	"github.com/unnamedxaer/gymm-api/usecases"
@@ -94,6 +95,10 @@ func TestCreateUser(t *testing.T) {
 			gotUser.CreatedAt,
 			u.EmailAddress)
 	}
+
+	if gotUser.EmailVerified {
+		t.Fatalf("want email address %q of the new user to not be verified", u.EmailAddress)
+	}
 }
 
 func TestCreateUserDuplicatedEmail(t *testing.T) {
@@ -168,6 +173,134 @@ func TestGetUserByIDInvalidID(t *testing.T) {
 	}
 }
 
+func TestGetUsersAndSetUserDisabled(t *testing.T) {
+	ctx := context.TODO()
+	clearCollection(t)
+	first, err := ur.CreateUser(ctx, u.Username, u.EmailAddress, u.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ur.CreateUser(ctx, u.Username, "second."+u.EmailAddress, u.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ur.GetUsers(ctx, "", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != first.ID || got[0].Role != entities.RoleUser {
+		t.Fatalf("want first page [%v], got %v", first, got)
+	}
+
+	got, err = ur.GetUsers(ctx, "", got[0].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != second.ID {
+		t.Fatalf("want next page [%v], got %v", second, got)
+	}
+
+	got, err = ur.GetUsers(ctx, "SECOND.", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != second.ID {
+		t.Fatalf("want users matching the query [%v], got %v", second, got)
+	}
+
+	disabled, err := ur.SetUserDisabled(ctx, second.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled == nil || !disabled.Disabled {
+		t.Fatalf("want disabled user, got %v", disabled)
+	}
+
+	enabled, err := ur.SetUserDisabled(ctx, second.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled == nil || enabled.Disabled {
+		t.Fatalf("want enabled user, got %v", enabled)
+	}
+
+	notExisting, err := ur.SetUserDisabled(ctx, "60108393da81e60598d5347f", true)
+	if err != nil || notExisting != nil {
+		t.Fatalf("want nil user and error, got %v, %v", notExisting, err)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	ctx := context.TODO()
+	clearCollection(t)
+	created, err := ur.CreateUser(ctx, u.Username, u.EmailAddress, u.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ur.SetUserRole(ctx, created.ID, entities.RoleCoach)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Role != entities.RoleCoach {
+		t.Fatalf("want user with role %q, got %v", entities.RoleCoach, got)
+	}
+
+	got, err = ur.GetUserByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Role != entities.RoleCoach {
+		t.Fatalf("want stored role %q, got %v", entities.RoleCoach, got)
+	}
+
+	notExisting, err := ur.SetUserRole(ctx, "60108393da81e60598d5347f", entities.RoleAdmin)
+	if err != nil || notExisting != nil {
+		t.Fatalf("want nil user and error, got %v, %v", notExisting, err)
+	}
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	ctx := context.TODO()
+	clearCollection(t)
+	created, err := ur.CreateUser(ctx, u.Username, u.EmailAddress, u.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Preferences != entities.DefaultUserPreferences {
+		t.Errorf("want default preferences, got %+v", created.Preferences)
+	}
+
+	timezone := "Europe/Warsaw"
+	theme := entities.ThemeDark
+	got, err := ur.UpdateUserProfile(ctx, created.ID, &usecases.UserProfileInput{
+		Timezone: &timezone,
+		Theme:    &theme,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := entities.UserPreferences{Theme: theme, Timezone: timezone, Units: entities.UnitsMetric}
+	if got == nil || got.Username != u.Username || got.Preferences != want {
+		t.Fatalf("want username %q and preferences %+v, got %v", u.Username, want, got)
+	}
+
+	username := "changed " + u.Username
+	got, err = ur.UpdateUserProfile(ctx, created.ID, &usecases.UserProfileInput{Username: &username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Username != username || got.Preferences != want {
+		t.Fatalf("want username %q and preferences kept, got %v", username, got)
+	}
+
+	notExisting, err := ur.UpdateUserProfile(ctx, "60108393da81e60598d5347f", &usecases.UserProfileInput{Username: &username})
+	if err != nil || notExisting != nil {
+		t.Fatalf("want nil user and error, got %v, %v", notExisting, err)
+	}
+}
+
 func clearCollection(t *testing.T) {
 	_, err := ur.col.DeleteMany(context.TODO(), bson.D{})
 	if err != nil {
@@ -180,3 +313,116 @@ func insertMockUser(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUserDeletionTime(t *testing.T) {
+	ctx := context.TODO()
+	clearCollection(t)
+	created, err := ur.CreateUser(ctx, u.Username, u.EmailAddress, u.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleteAt := time.Now().UTC().Add(time.Hour)
+	got, err := ur.SetUserDeletionTime(ctx, created.ID, &deleteAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.DeletionScheduledAt == nil || !testhelpers.TimesEqual(*got.DeletionScheduledAt, deleteAt) {
+		t.Fatalf("want deletion scheduled at %v, got %v", deleteAt, got)
+	}
+
+	toDelete, err := ur.GetUsersToDelete(ctx, deleteAt.Add(-time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toDelete) != 0 {
+		t.Errorf("want no users before their deletion time, got %v", toDelete)
+	}
+
+	toDelete, err = ur.GetUsersToDelete(ctx, deleteAt.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toDelete) != 1 || toDelete[0].ID != created.ID {
+		t.Errorf("want user %q to be deleted, got %v", created.ID, toDelete)
+	}
+
+	got, err = ur.SetUserDeletionTime(ctx, created.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.DeletionScheduledAt != nil {
+		t.Fatalf("want deletion cancelled, got %v", got)
+	}
+
+	got, err = ur.StartUserDeletion(ctx, created.ID, deleteAt.Add(time.Minute))
+	if err != nil || got != nil {
+		t.Fatalf("want cancelled deletion not started, got %v, %v", got, err)
+	}
+
+	_, err = ur.SetUserDeletionTime(ctx, created.ID, &deleteAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ur.StartUserDeletion(ctx, created.ID, deleteAt.Add(-time.Minute))
+	if err != nil || got != nil {
+		t.Fatalf("want deletion not started before its time, got %v, %v", got, err)
+	}
+	got, err = ur.StartUserDeletion(ctx, created.ID, deleteAt.Add(time.Minute))
+	if err != nil || got == nil {
+		t.Fatalf("want deletion started, got %v, %v", got, err)
+	}
+
+	got, err = ur.SetUserDeletionTime(ctx, created.ID, nil)
+	if err != nil || got != nil {
+		t.Fatalf("want started deletion not cancelled, got %v, %v", got, err)
+	}
+
+	notExisting, err := ur.SetUserDeletionTime(ctx, "60108393da81e60598d5347f", &deleteAt)
+	if err != nil || notExisting != nil {
+		t.Fatalf("want nil user and error, got %v, %v", notExisting, err)
+	}
+}
+
+func TestCalendarFeedToken(t *testing.T) {
+	ctx := context.TODO()
+	clearCollection(t)
+	created, err := ur.CreateUser(ctx, u.Username, u.EmailAddress, u.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ur.SetCalendarFeedToken(ctx, created.ID, "feedtokenhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || !got.CalendarFeedEnabled {
+		t.Fatalf("want calendar feed enabled, got %v", got)
+	}
+
+	owner, err := ur.GetUserByCalendarFeedToken(ctx, "feedtokenhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner == nil || owner.ID != created.ID {
+		t.Fatalf("want user %q, got %v", created.ID, owner)
+	}
+
+	got, err = ur.SetCalendarFeedToken(ctx, created.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.CalendarFeedEnabled {
+		t.Fatalf("want calendar feed disabled, got %v", got)
+	}
+
+	owner, err = ur.GetUserByCalendarFeedToken(ctx, "feedtokenhash")
+	if err != nil || owner != nil {
+		t.Fatalf("want nil user and error for the revoked feed, got %v, %v", owner, err)
+	}
+
+	notExisting, err := ur.SetCalendarFeedToken(ctx, "60108393da81e60598d5347f", "feedtokenhash")
+	if err != nil || notExisting != nil {
+		t.Fatalf("want nil user and error, got %v, %v", notExisting, err)
+	}
+}
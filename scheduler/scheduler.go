@@ -0,0 +1,135 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Job is a task run periodically by the scheduler,
+// the context is cancelled when the scheduler is stopped
+type Job func(ctx context.Context) error
+
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	run      Job
+}
+
+// Scheduler runs registered jobs in intervals until it is stopped
+type Scheduler struct {
+	l       *zerolog.Logger
+	jobs    []scheduledJob
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	started bool
+}
+
+// NewScheduler creates new Scheduler, jobs must be added before it is started
+func NewScheduler(l *zerolog.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		l:      l,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Add registers the job to be run every interval, the first run happens
+// right after the scheduler is started
+func (s *Scheduler) Add(name string, interval time.Duration, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return fmt.Errorf("scheduler: cannot add job %q, already started", name)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("scheduler: invalid interval %s of job %q", interval, name)
+	}
+
+	s.jobs = append(s.jobs, scheduledJob{
+		name:     name,
+		interval: interval,
+		run:      job,
+	})
+	return nil
+}
+
+// Start runs every registered job in its own goroutine
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+}
+
+// Stop cancels running jobs and waits for them to return
+// or until the ctx is done, whichever happens first
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler: stop: %v", ctx.Err())
+	}
+}
+
+func (s *Scheduler) loop(j scheduledJob) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		s.runJob(j)
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runJob(j scheduledJob) {
+	// a panicking job must not take down the whole process
+	defer func() {
+		if r := recover(); r != nil {
+			s.l.Error().Str("job", j.name).Msgf("scheduler: job panicked: %v", r)
+		}
+	}()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	start := time.Now()
+	err := j.run(s.ctx)
+	if err != nil {
+		s.l.Err(err).Str("job", j.name).Msg("scheduler: job failed")
+		return
+	}
+	s.l.Debug().Str("job", j.name).Dur("took", time.Since(start)).Msg("scheduler: job done")
+}
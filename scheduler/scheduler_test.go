@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var l zerolog.Logger
+
+func TestMain(m *testing.M) {
+	l = zerolog.New(nil)
+
+	os.Exit(m.Run())
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	s := NewScheduler(&l)
+	var cnt int32
+	err := s.Add("count", 10*time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&cnt, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Start()
+	time.Sleep(55 * time.Millisecond)
+	err = s.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := atomic.LoadInt32(&cnt)
+	if got < 2 {
+		t.Errorf("want job to run at least %d times, got %d", 2, got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if after := atomic.LoadInt32(&cnt); after != got {
+		t.Errorf("want job to not run after stop, got %d runs, want %d", after, got)
+	}
+}
+
+func TestSchedulerStopWaitsForJobs(t *testing.T) {
+	s := NewScheduler(&l)
+	started := make(chan struct{})
+	var finished int32
+	err := s.Add("slow", time.Hour, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Start()
+	<-started
+	err = s.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Errorf("want stop to wait for the running job")
+	}
+}
+
+func TestSchedulerStopTimeout(t *testing.T) {
+	s := NewScheduler(&l)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	err := s.Add("stuck", time.Hour, func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Start()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = s.Stop(ctx)
+	if err == nil {
+		t.Errorf("want error when job does not return before the deadline")
+	}
+}
+
+func TestSchedulerAddAfterStart(t *testing.T) {
+	s := NewScheduler(&l)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	err := s.Add("late", time.Second, func(ctx context.Context) error { return nil })
+	if err == nil {
+		t.Errorf("want error when adding job to started scheduler")
+	}
+
+	err = NewScheduler(&l).Add("zero", 0, func(ctx context.Context) error { return nil })
+	if err == nil {
+		t.Errorf("want error for not positive interval")
+	}
+}
@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// KeySize is the required size of the encryption key in bytes (AES-256)
+const KeySize = 32
+
+// Cipher encrypts the secrets before they are stored
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates AES-GCM cipher with the given key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("totp: encryption key must have %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "totp: create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithMessage(err, "totp: create cipher")
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt returns the nonce followed by the encrypted data
+func (c *Cipher) Encrypt(plain []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// Decrypt reverses Encrypt, it fails if the data has been modified
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return nil, errors.New("totp: encrypted data too short")
+	}
+
+	plain, err := c.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "totp: decrypt")
+	}
+	return plain, nil
+}
@@ -0,0 +1,103 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret from the test vectors of RFC 6238
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// last 6 digits of the 8 digit codes from RFC 6238
+	testCases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range testCases {
+		got, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("time %d: want %q, got %q", unix, want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := Code(secret, Step(now.Add(-Period)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(secret, code, now)
+	if !ok || step != Step(now)-1 {
+		t.Errorf("want code of the previous period to be accepted, got %d, %t", step, ok)
+	}
+
+	if _, ok = Validate(secret, code, now.Add(3*Period)); ok {
+		t.Errorf("want outdated code to be rejected")
+	}
+	if _, ok = Validate(secret, "12345", now); ok {
+		t.Errorf("want too short code to be rejected")
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("The Gymm Api", "john@email.com", "ABC")
+	want := "otpauth://totp/The%20Gymm%20Api:john@email.com?"
+	if !strings.HasPrefix(got, want) ||
+		!strings.Contains(got, "secret=ABC") ||
+		!strings.Contains(got, "issuer=The+Gymm+Api") {
+		t.Errorf("want URI like %q, got %q", want, got)
+	}
+}
+
+func TestCipher(t *testing.T) {
+	_, err := NewCipher([]byte("short"))
+	if err == nil {
+		t.Errorf("want error for too short key")
+	}
+
+	c, err := NewCipher(bytes.Repeat([]byte{7}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := []byte(rfcSecret)
+	encrypted, err := c.Encrypt(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, plain) {
+		t.Errorf("want data to be encrypted, got %q", encrypted)
+	}
+
+	got, err := c.Decrypt(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("want %q, got %q", plain, got)
+	}
+
+	encrypted[len(encrypted)-1] ^= 1
+	if _, err = c.Decrypt(encrypted); err == nil {
+		t.Errorf("want error for modified data")
+	}
+}
@@ -0,0 +1,342 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+const (
+	// DefaultAccountDeletionGracePeriod is the time the user has to cancel the account deletion
+	DefaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+	// accountDeletionBatchSize limits the accounts deleted in a single run of the job
+	accountDeletionBatchSize = 100
+)
+
+type AccountUsecases struct {
+	userRepo     UserRepo
+	authRepo     AuthRepo
+	exerciseRepo ExerciseRepo
+	trainingRepo TrainingRepo
+	apiKeyRepo   APIKeyRepo
+	importRepo   ImportRepo
+	auditRepo    AuditRepo
+	l            *zerolog.Logger
+	gracePeriod  time.Duration
+}
+
+// IAccountUsecases are the actions on all of the user's data
+type IAccountUsecases interface {
+	// ExportUserData returns everything stored about the user, the secrets are left out
+	ExportUserData(ctx context.Context, userID string) (*entities.UserDataExport, error)
+	// ScheduleAccountDeletion schedules the deletion of the account after the grace period and ends all of its sessions,
+	// the time of already scheduled deletion is not changed
+	ScheduleAccountDeletion(ctx context.Context, mailer Mailer, userID string) (*entities.User, error)
+	// CancelAccountDeletion cancels the scheduled deletion of the account
+	CancelAccountDeletion(ctx context.Context, userID string) (*entities.User, error)
+	// DeleteScheduledAccounts deletes the accounts whose grace period has passed,
+	// it returns number of deleted accounts
+	DeleteScheduledAccounts(ctx context.Context) (int, error)
+}
+
+// getExistingUser returns the user or RecordNotExistsError if there is no such user
+func (acu *AccountUsecases) getExistingUser(ctx context.Context, userID string) (*entities.User, error) {
+	user, err := acu.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, NewErrorRecordNotExists("user")
+	}
+	return user, nil
+}
+
+func (acu *AccountUsecases) ExportUserData(
+	ctx context.Context,
+	userID string) (*entities.UserDataExport, error) {
+	exportedAt := time.Now().UTC()
+	user, err := acu.getExistingUser(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ExportUserData")
+	}
+
+	sessions, err := acu.authRepo.GetUserJWTs(ctx, userID, entities.NotExpired)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ExportUserData: sessions")
+	}
+	// the archive may be kept anywhere, the tokens would still let its reader act as the user
+	for i := range sessions {
+		sessions[i].Token = ""
+	}
+
+	exercises, err := acu.exerciseRepo.GetExercisesCreatedBy(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ExportUserData: exercises")
+	}
+
+	trainings, err := acu.trainingRepo.GetUserTrainingsChangedSince(ctx, userID, time.Time{}, "", 0)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ExportUserData: trainings")
+	}
+
+	apiKeys, err := acu.apiKeyRepo.GetAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ExportUserData: api keys")
+	}
+
+	imports, err := acu.importRepo.GetUserImportJobs(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ExportUserData: imports")
+	}
+
+	return &entities.UserDataExport{
+		Profile:    *user,
+		Sessions:   sessions,
+		Exercises:  exercises,
+		Trainings:  trainings,
+		APIKeys:    apiKeys,
+		Imports:    imports,
+		ExportedAt: exportedAt,
+	}, nil
+}
+
+func (acu *AccountUsecases) ScheduleAccountDeletion(
+	ctx context.Context,
+	mailer Mailer,
+	userID string) (*entities.User, error) {
+	user, err := acu.getExistingUser(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ScheduleAccountDeletion")
+	}
+
+	if user.DeletionScheduledAt == nil {
+		deleteAt := time.Now().UTC().Add(acu.gracePeriod)
+		user, err = acu.userRepo.SetUserDeletionTime(ctx, userID, &deleteAt)
+		if err != nil {
+			return nil, errors.WithMessage(err, "usecases.ScheduleAccountDeletion")
+		}
+		if user == nil {
+			// removed in the meantime
+			return nil, NewErrorRecordNotExists("user")
+		}
+
+		recordAuditEvent(ctx, acu.l, acu.auditRepo, entities.AuditEvent{
+			Action: entities.AuditActionAccountDeletionScheduled,
+			UserID: userID,
+			After:  map[string]interface{}{"deletionScheduledAt": deleteAt},
+		})
+
+		if mailer != nil {
+			go acu.sendAccountDeletionScheduledEmail(mailer, user)
+		}
+	}
+
+	// the user has to log in again to cancel the deletion
+	_, err = acu.authRepo.DeleteRefreshTokenAndAllTokens(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ScheduleAccountDeletion: end sessions")
+	}
+
+	return user, nil
+}
+
+func (acu *AccountUsecases) CancelAccountDeletion(
+	ctx context.Context,
+	userID string) (*entities.User, error) {
+	user, err := acu.getExistingUser(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CancelAccountDeletion")
+	}
+
+	if user.DeletionScheduledAt == nil {
+		return user, nil
+	}
+
+	scheduledAt := *user.DeletionScheduledAt
+	user, err = acu.userRepo.SetUserDeletionTime(ctx, userID, nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CancelAccountDeletion")
+	}
+	if user == nil {
+		// removed or being removed in the meantime
+		return nil, NewErrorRecordNotExists("user")
+	}
+
+	recordAuditEvent(ctx, acu.l, acu.auditRepo, entities.AuditEvent{
+		Action: entities.AuditActionAccountDeletionCancelled,
+		UserID: userID,
+		Before: map[string]interface{}{"deletionScheduledAt": scheduledAt},
+	})
+	return user, nil
+}
+
+func (acu *AccountUsecases) DeleteScheduledAccounts(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	users, err := acu.userRepo.GetUsersToDelete(ctx, now, accountDeletionBatchSize)
+	if err != nil {
+		return 0, errors.WithMessage(err, "usecases.DeleteScheduledAccounts")
+	}
+
+	deleted := 0
+	var lastErr error
+	for i := range users {
+		if ctx.Err() != nil {
+			return deleted, ctx.Err()
+		}
+
+		ok, err := acu.deleteAccount(ctx, &users[i], now)
+		if err != nil {
+			// the account is tried again in the next run
+			lastErr = errors.WithMessagef(err, "usecases.DeleteScheduledAccounts: user %q", users[i].ID)
+			acu.l.Err(lastErr).Send()
+			continue
+		}
+		if ok {
+			deleted++
+		}
+	}
+
+	return deleted, lastErr
+}
+
+// deleteAccount removes the data of the user whose deletion is still scheduled before given time,
+// it returns false if the deletion was cancelled in the meantime. The exercises used by the other users'
+// trainings stay available without their creator. The audit events are kept as the security record.
+func (acu *AccountUsecases) deleteAccount(ctx context.Context, user *entities.User, now time.Time) (bool, error) {
+	// the deletion cannot be cancelled from now on, so no data of the kept account are removed
+	started, err := acu.userRepo.StartUserDeletion(ctx, user.ID, now)
+	if err != nil {
+		return false, errors.WithMessage(err, "account")
+	}
+	if started == nil {
+		return false, nil
+	}
+
+	// the queued imports would store the trainings again
+	imports, err := acu.importRepo.DeleteUserImportJobs(ctx, user.ID)
+	if err != nil {
+		return false, errors.WithMessage(err, "imports")
+	}
+
+	trainings, err := acu.trainingRepo.DeleteUserTrainings(ctx, user.ID)
+	if err != nil {
+		return false, errors.WithMessage(err, "trainings")
+	}
+
+	exercises, err := acu.exerciseRepo.GetExercisesCreatedBy(ctx, user.ID)
+	if err != nil {
+		return false, errors.WithMessage(err, "exercises")
+	}
+
+	var exercisesDeleted, exercisesAnonymised int64
+	for _, ex := range exercises {
+		// the user's trainings are already removed, so the exercise is used by somebody else
+		used, err := acu.trainingRepo.IsExerciseUsed(ctx, ex.ID)
+		if err != nil {
+			return false, errors.WithMessage(err, "exercises")
+		}
+
+		if used {
+			err = acu.exerciseRepo.AnonymiseExercise(ctx, ex.ID)
+			if err != nil {
+				return false, errors.WithMessage(err, "exercises")
+			}
+			exercisesAnonymised++
+			continue
+		}
+
+		n, err := acu.exerciseRepo.DeleteExercise(ctx, ex.ID)
+		if err != nil {
+			return false, errors.WithMessage(err, "exercises")
+		}
+		exercisesDeleted += n
+	}
+
+	apiKeys, err := acu.apiKeyRepo.GetAPIKeys(ctx, user.ID)
+	if err != nil {
+		return false, errors.WithMessage(err, "api keys")
+	}
+	for _, k := range apiKeys {
+		_, err = acu.apiKeyRepo.DeleteAPIKey(ctx, user.ID, k.ID)
+		if err != nil {
+			return false, errors.WithMessage(err, "api keys")
+		}
+	}
+
+	// the user is removed at the end, so the failed deletion is retried
+	err = acu.authRepo.DeleteUserAccount(ctx, user.ID, now)
+	if err != nil {
+		return false, errors.WithMessage(err, "account")
+	}
+
+	recordAuditEvent(ctx, acu.l, acu.auditRepo, entities.AuditEvent{
+		Action: entities.AuditActionAccountDeleted,
+		UserID: user.ID,
+		Before: map[string]interface{}{"deletionScheduledAt": user.DeletionScheduledAt},
+		After: map[string]interface{}{
+			"trainings":           trainings,
+			"exercisesDeleted":    exercisesDeleted,
+			"exercisesAnonymised": exercisesAnonymised,
+			"apiKeys":             len(apiKeys),
+			"imports":             imports,
+		},
+	})
+	return true, nil
+}
+
+func (acu *AccountUsecases) sendAccountDeletionScheduledEmail(
+	m Mailer,
+	user *entities.User) {
+	data, err := generateAccountDeletionScheduledEmailContent(user)
+	if err != nil {
+		acu.l.Err(
+			fmt.Errorf("sending account deletion scheduled email abandoned: %v", err)).Send()
+		return
+	}
+
+	m.Send([]string{user.EmailAddress}, []byte("Account Deletion Scheduled"), data)
+}
+
+// NewDeleteScheduledAccountsJob creates a job that deletes the accounts whose grace period has passed,
+// the number of deleted accounts is logged
+func NewDeleteScheduledAccountsJob(
+	l *zerolog.Logger,
+	account IAccountUsecases) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := account.DeleteScheduledAccounts(ctx)
+		if n > 0 {
+			l.Info().Int("accounts", n).Msg("scheduled accounts deleted")
+		}
+		return err
+	}
+}
+
+// NewAccountUsecases creates usecases of the user's whole account,
+// the deletion scheduled by the user happens after the grace period
+func NewAccountUsecases(
+	l *zerolog.Logger,
+	userRepo UserRepo,
+	authRepo AuthRepo,
+	exerciseRepo ExerciseRepo,
+	trainingRepo TrainingRepo,
+	apiKeyRepo APIKeyRepo,
+	importRepo ImportRepo,
+	auditRepo AuditRepo,
+	gracePeriod time.Duration) IAccountUsecases {
+	return &AccountUsecases{
+		userRepo:     userRepo,
+		authRepo:     authRepo,
+		exerciseRepo: exerciseRepo,
+		trainingRepo: trainingRepo,
+		apiKeyRepo:   apiKeyRepo,
+		importRepo:   importRepo,
+		auditRepo:    auditRepo,
+		l:            l,
+		gracePeriod:  gracePeriod,
+	}
+}
@@ -0,0 +1,253 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func newTestAccountUsecases(
+	authRepo usecases.AuthRepo,
+	importRepo usecases.ImportRepo,
+	auditRepo usecases.AuditRepo) usecases.IAccountUsecases {
+	return usecases.NewAccountUsecases(
+		&mockedLogger,
+		&mocks.MockUserRepo{},
+		authRepo,
+		&mocks.MockExerciseRepo{},
+		&mocks.MockTrainingRepo{},
+		&mocks.MockAPIKeyRepo{},
+		importRepo,
+		auditRepo,
+		usecases.DefaultAccountDeletionGracePeriod)
+}
+
+func TestExportUserData(t *testing.T) {
+	ctx := context.TODO()
+	importRepo := &mocks.MockImportRepo{}
+	acu := newTestAccountUsecases(&mocks.MockAuthRepo{}, importRepo, &mocks.MockAuditRepo{})
+
+	job, err := importRepo.CreateImportJob(ctx, &entities.ImportJob{UserID: mocks.UserID}, []byte("file"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := acu.ExportUserData(ctx, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.Profile.ID != mocks.UserID {
+		t.Errorf("want profile of user %q, got %q", mocks.UserID, export.Profile.ID)
+	}
+	for _, s := range export.Sessions {
+		if s.Token != "" {
+			t.Errorf("want session tokens to be left out, got %q", s.Token)
+		}
+	}
+	if len(export.Exercises) != 1 || export.Exercises[0].ID != mocks.ExampleExercise.ID {
+		t.Errorf("want created exercise %q, got %v", mocks.ExampleExercise.ID, export.Exercises)
+	}
+	if len(export.Trainings) != 1 || export.Trainings[0].UserID != mocks.UserID {
+		t.Errorf("want trainings of the user, got %v", export.Trainings)
+	}
+	if len(export.Imports) != 1 || export.Imports[0].ID != job.ID {
+		t.Errorf("want import %q, got %v", job.ID, export.Imports)
+	}
+
+	_, err = acu.ExportUserData(ctx, "notfound")
+	var rneErr *usecases.RecordNotExistsError
+	if !errors.As(err, &rneErr) {
+		t.Errorf("want RecordNotExistsError for not existing user, got %v", err)
+	}
+}
+
+func TestScheduleAccountDeletion(t *testing.T) {
+	ctx := context.TODO()
+	authRepo := &mocks.MockAuthRepo{}
+	auditRepo := &mocks.MockAuditRepo{}
+	acu := newTestAccountUsecases(authRepo, &mocks.MockImportRepo{}, auditRepo)
+	m := &recordingMailer{sent: make(chan []byte, 1)}
+
+	_, err := authRepo.SaveRefreshToken(ctx, mocks.UserID, mocks.ExampleRefreshToken.Device,
+		mocks.ExampleRefreshToken.Token, "", mocks.ExampleRefreshToken.ExpiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minDeleteAt := time.Now().Add(usecases.DefaultAccountDeletionGracePeriod)
+	user, err := acu.ScheduleAccountDeletion(ctx, m, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.DeletionScheduledAt == nil || user.DeletionScheduledAt.Before(minDeleteAt.Add(-time.Second)) {
+		t.Errorf("want deletion scheduled after the grace period, got %v", user.DeletionScheduledAt)
+	}
+
+	rt, err := authRepo.GetRefreshTokenByToken(ctx, mocks.ExampleRefreshToken.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt != nil {
+		t.Errorf("want sessions of the user to be ended, got %v", rt)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].Action != entities.AuditActionAccountDeletionScheduled {
+		t.Errorf("want %q audit event, got %v", entities.AuditActionAccountDeletionScheduled, events)
+	}
+
+	select {
+	case data := <-m.sent:
+		if !strings.Contains(string(data), "will be deleted") {
+			t.Errorf("want email about the account deletion, got %s", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want account deletion email to be sent")
+	}
+
+	// already scheduled deletion is not postponed
+	userID := "deleting" + mocks.UserID
+	user, err = acu.ScheduleAccountDeletion(ctx, m, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.DeletionScheduledAt == nil || !user.DeletionScheduledAt.Equal(mocks.Now.Add(usecases.DefaultAccountDeletionGracePeriod)) {
+		t.Errorf("want the previous deletion time to be kept, got %v", user.DeletionScheduledAt)
+	}
+	if events := auditRepo.Events(); len(events) != 1 {
+		t.Errorf("want no audit event of already scheduled deletion, got %v", events)
+	}
+
+	_, err = acu.ScheduleAccountDeletion(ctx, m, "notfound")
+	var rneErr *usecases.RecordNotExistsError
+	if !errors.As(err, &rneErr) {
+		t.Errorf("want RecordNotExistsError for not existing user, got %v", err)
+	}
+}
+
+func TestCancelAccountDeletion(t *testing.T) {
+	ctx := context.TODO()
+	auditRepo := &mocks.MockAuditRepo{}
+	acu := newTestAccountUsecases(&mocks.MockAuthRepo{}, &mocks.MockImportRepo{}, auditRepo)
+
+	user, err := acu.CancelAccountDeletion(ctx, "deleting"+mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.DeletionScheduledAt != nil {
+		t.Errorf("want deletion to be cancelled, got %v", user.DeletionScheduledAt)
+	}
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].Action != entities.AuditActionAccountDeletionCancelled {
+		t.Errorf("want %q audit event, got %v", entities.AuditActionAccountDeletionCancelled, events)
+	}
+
+	// nothing to cancel
+	_, err = acu.CancelAccountDeletion(ctx, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := auditRepo.Events(); len(events) != 1 {
+		t.Errorf("want no audit event if the deletion was not scheduled, got %v", events)
+	}
+}
+
+func TestDeleteScheduledAccounts(t *testing.T) {
+	ctx := context.TODO()
+	auditRepo := &mocks.MockAuditRepo{}
+	importRepo := &mocks.MockImportRepo{}
+	acu := newTestAccountUsecases(&mocks.MockAuthRepo{}, importRepo, auditRepo)
+
+	_, err := importRepo.CreateImportJob(ctx, &entities.ImportJob{UserID: mocks.UserID}, []byte("file"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := acu.DeleteScheduledAccounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("want 1 deleted account, got %d", n)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].Action != entities.AuditActionAccountDeleted {
+		t.Fatalf("want %q audit event, got %v", entities.AuditActionAccountDeleted, events)
+	}
+	if events[0].UserID != mocks.UserID {
+		t.Errorf("want audit event of user %q, got %q", mocks.UserID, events[0].UserID)
+	}
+	// the exercise is used in the other users' trainings
+	if got := events[0].After["exercisesAnonymised"]; got != int64(1) {
+		t.Errorf("want 1 anonymised exercise, got %v", got)
+	}
+	if got := events[0].After["exercisesDeleted"]; got != int64(0) {
+		t.Errorf("want no deleted exercises, got %v", got)
+	}
+	if got := events[0].After["imports"]; got != int64(1) {
+		t.Errorf("want 1 deleted import, got %v", got)
+	}
+	if imports, _ := importRepo.GetUserImportJobs(ctx, mocks.UserID); len(imports) != 0 {
+		t.Errorf("want imports of the deleted account removed, got %v", imports)
+	}
+}
+
+// cancellingUserRepo reports the accounts to delete, but their deletion is cancelled before it starts
+type cancellingUserRepo struct {
+	mocks.MockUserRepo
+}
+
+func (r cancellingUserRepo) StartUserDeletion(
+	ctx context.Context,
+	id string,
+	before time.Time) (*entities.User, error) {
+	return nil, nil
+}
+
+// deletionRecordingTrainingRepo records the users whose trainings were removed
+type deletionRecordingTrainingRepo struct {
+	mocks.MockTrainingRepo
+	deletedFor []string
+}
+
+func (r *deletionRecordingTrainingRepo) DeleteUserTrainings(ctx context.Context, userID string) (int64, error) {
+	r.deletedFor = append(r.deletedFor, userID)
+	return r.MockTrainingRepo.DeleteUserTrainings(ctx, userID)
+}
+
+func TestDeleteScheduledAccountsCancelled(t *testing.T) {
+	ctx := context.TODO()
+	auditRepo := &mocks.MockAuditRepo{}
+	trainingRepo := &deletionRecordingTrainingRepo{}
+	acu := usecases.NewAccountUsecases(
+		&mockedLogger,
+		cancellingUserRepo{},
+		&mocks.MockAuthRepo{},
+		&mocks.MockExerciseRepo{},
+		trainingRepo,
+		&mocks.MockAPIKeyRepo{},
+		&mocks.MockImportRepo{},
+		auditRepo,
+		usecases.DefaultAccountDeletionGracePeriod)
+
+	n, err := acu.DeleteScheduledAccounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("want no deleted accounts, got %d", n)
+	}
+	if len(trainingRepo.deletedFor) != 0 {
+		t.Errorf("want data of the kept account not removed, got trainings of %v removed", trainingRepo.deletedFor)
+	}
+	if events := auditRepo.Events(); len(events) != 0 {
+		t.Errorf("want no audit events, got %v", events)
+	}
+}
@@ -0,0 +1,241 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+type AdminUsecases struct {
+	userRepo  UserRepo
+	authRepo  AuthRepo
+	auditRepo AuditRepo
+	l         *zerolog.Logger
+}
+
+// IAdminUsecases are the actions on the other users' accounts,
+// the actions that concern a single user are recorded as audit events of the actor from the context
+type IAdminUsecases interface {
+	// GetUsers returns up to limit users ordered by their IDs, starting after the user with afterID,
+	// the not empty query has to be a part of the user's email address or username
+	GetUsers(ctx context.Context, query string, afterID string, limit int64) ([]entities.User, error)
+	// GetUserSessions returns the not expired sessions of the user without their tokens
+	GetUserSessions(ctx context.Context, userID string) ([]entities.UserToken, error)
+	// LogoutUser ends all sessions of the user
+	LogoutUser(ctx context.Context, userID string) error
+	// DisableUser disables the account and ends all of its sessions
+	DisableUser(ctx context.Context, userID string) (*entities.User, error)
+	// EnableUser lets the user with disabled account log in again
+	EnableUser(ctx context.Context, userID string) (*entities.User, error)
+	// ChangeUserRole replaces the user's role, it returns InvalidRoleError for the unknown role
+	ChangeUserRole(ctx context.Context, userID string, role entities.Role) (*entities.User, error)
+	// GrantAdminRole makes the users with the email addresses admins, it is the way to appoint the first admin.
+	// The addresses without the account are skipped, so they are granted the role once it exists
+	GrantAdminRole(ctx context.Context, emailAddresses []string) error
+}
+
+func (adu *AdminUsecases) GetUsers(
+	ctx context.Context,
+	query string,
+	afterID string,
+	limit int64) ([]entities.User, error) {
+	return adu.userRepo.GetUsers(ctx, query, afterID, limit)
+}
+
+// getExistingUser returns the user or RecordNotExistsError if there is no such user
+func (adu *AdminUsecases) getExistingUser(ctx context.Context, userID string) (*entities.User, error) {
+	user, err := adu.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, NewErrorRecordNotExists("user")
+	}
+	return user, nil
+}
+
+func (adu *AdminUsecases) GetUserSessions(
+	ctx context.Context,
+	userID string) ([]entities.UserToken, error) {
+	_, err := adu.getExistingUser(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.GetUserSessions")
+	}
+
+	sessions, err := adu.authRepo.GetUserJWTs(ctx, userID, entities.NotExpired)
+	if err != nil {
+		return nil, err
+	}
+
+	// the token would let the admin act as the user
+	for i := range sessions {
+		sessions[i].Token = ""
+	}
+
+	recordAuditEvent(ctx, adu.l, adu.auditRepo, entities.AuditEvent{
+		Action: entities.AuditActionAdminViewSessions,
+		UserID: userID,
+	})
+	return sessions, nil
+}
+
+func (adu *AdminUsecases) LogoutUser(
+	ctx context.Context,
+	userID string) error {
+	_, err := adu.getExistingUser(ctx, userID)
+	if err != nil {
+		return errors.WithMessage(err, "usecases.LogoutUser")
+	}
+
+	_, err = adu.authRepo.DeleteRefreshTokenAndAllTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	recordAuditEvent(ctx, adu.l, adu.auditRepo, entities.AuditEvent{
+		Action: entities.AuditActionAdminLogoutUser,
+		UserID: userID,
+	})
+	return nil
+}
+
+func (adu *AdminUsecases) DisableUser(
+	ctx context.Context,
+	userID string) (*entities.User, error) {
+	user, err := adu.setUserDisabled(ctx, userID, true)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.DisableUser")
+	}
+
+	_, err = adu.authRepo.DeleteRefreshTokenAndAllTokens(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.DisableUser: end sessions")
+	}
+
+	return user, nil
+}
+
+func (adu *AdminUsecases) EnableUser(
+	ctx context.Context,
+	userID string) (*entities.User, error) {
+	user, err := adu.setUserDisabled(ctx, userID, false)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.EnableUser")
+	}
+	return user, nil
+}
+
+func (adu *AdminUsecases) setUserDisabled(
+	ctx context.Context,
+	userID string,
+	disabled bool) (*entities.User, error) {
+	before, err := adu.getExistingUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := adu.userRepo.SetUserDisabled(ctx, userID, disabled)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		// removed in the meantime
+		return nil, NewErrorRecordNotExists("user")
+	}
+
+	action := entities.AuditActionAdminEnableUser
+	if disabled {
+		action = entities.AuditActionAdminDisableUser
+	}
+	recordAuditEvent(ctx, adu.l, adu.auditRepo, entities.AuditEvent{
+		Action: action,
+		UserID: userID,
+		Before: map[string]interface{}{"disabled": before.Disabled},
+		After:  map[string]interface{}{"disabled": user.Disabled},
+	})
+	return user, nil
+}
+
+func (adu *AdminUsecases) ChangeUserRole(
+	ctx context.Context,
+	userID string,
+	role entities.Role) (*entities.User, error) {
+	if !role.IsValid() {
+		return nil, NewErrorInvalidRole(role)
+	}
+
+	before, err := adu.getExistingUser(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ChangeUserRole")
+	}
+
+	return adu.setUserRole(ctx, before, role)
+}
+
+func (adu *AdminUsecases) GrantAdminRole(
+	ctx context.Context,
+	emailAddresses []string) error {
+	for _, emailAddress := range emailAddresses {
+		user, err := adu.authRepo.GetUserByEmailAddress(ctx, emailAddress)
+		if err != nil {
+			return errors.WithMessage(err, "usecases.GrantAdminRole")
+		}
+
+		if user == nil {
+			adu.l.Warn().Msgf("cannot grant the admin role to %q, there is no such user yet", emailAddress)
+			continue
+		}
+		if user.Role == entities.RoleAdmin {
+			continue
+		}
+
+		_, err = adu.setUserRole(ctx, &user.User, entities.RoleAdmin)
+		if err != nil {
+			return errors.WithMessage(err, "usecases.GrantAdminRole")
+		}
+		adu.l.Info().Msgf("admin role granted to %q", emailAddress)
+	}
+
+	return nil
+}
+
+func (adu *AdminUsecases) setUserRole(
+	ctx context.Context,
+	before *entities.User,
+	role entities.Role) (*entities.User, error) {
+	user, err := adu.userRepo.SetUserRole(ctx, before.ID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		// removed in the meantime
+		return nil, NewErrorRecordNotExists("user")
+	}
+
+	recordAuditEvent(ctx, adu.l, adu.auditRepo, entities.AuditEvent{
+		Action: entities.AuditActionAdminChangeRole,
+		UserID: user.ID,
+		Before: map[string]interface{}{"role": before.Role},
+		After:  map[string]interface{}{"role": user.Role},
+	})
+	return user, nil
+}
+
+// NewAdminUsecases creates usecases of the users with the admin permissions
+func NewAdminUsecases(
+	l *zerolog.Logger,
+	userRepo UserRepo,
+	authRepo AuthRepo,
+	auditRepo AuditRepo) IAdminUsecases {
+	return &AdminUsecases{
+		userRepo:  userRepo,
+		authRepo:  authRepo,
+		auditRepo: auditRepo,
+		l:         l,
+	}
+}
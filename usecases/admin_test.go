@@ -0,0 +1,259 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+var adminActor = &usecases.AuditActor{
+	UserID:    mocks.AdminUserID,
+	IP:        "127.0.0.1",
+	UserAgent: "admin test",
+}
+
+func TestDisableUser(t *testing.T) {
+	ctx := usecases.WithAuditActor(context.TODO(), adminActor)
+
+	testCases := []struct {
+		desc   string
+		userID string
+		errTxt string
+	}{
+		{
+			desc:   "existing user",
+			userID: mocks.UserID,
+		},
+		{
+			desc:   "not existing user",
+			userID: "notfound",
+			errTxt: usecases.NewErrorRecordNotExists("user").Error(),
+		},
+		{
+			desc:   "invalid id",
+			userID: "INVALIDID",
+			errTxt: usecases.NewErrorInvalidID("INVALIDID", "user").Error(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			authRepo := &mocks.MockAuthRepo{}
+			auditRepo := &mocks.MockAuditRepo{}
+			_, err := authRepo.SaveRefreshToken(ctx, tc.userID, mocks.ExampleRefreshToken.Device,
+				mocks.ExampleRefreshToken.Token, "", mocks.ExampleRefreshToken.ExpiresAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			adu := usecases.NewAdminUsecases(&mockedLogger, &mocks.MockUserRepo{}, authRepo, auditRepo)
+
+			user, err := adu.DisableUser(ctx, tc.userID)
+			if tc.errTxt != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errTxt) {
+					t.Fatalf("want error %q, got %v", tc.errTxt, err)
+				}
+				if events := auditRepo.Events(); len(events) != 0 {
+					t.Errorf("want no audit events of the failed action, got %v", events)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !user.Disabled {
+				t.Errorf("want user %q to be disabled", user.ID)
+			}
+
+			rt, err := authRepo.GetRefreshTokenByToken(ctx, mocks.ExampleRefreshToken.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rt != nil {
+				t.Errorf("want sessions of the disabled user to be ended, got %v", rt)
+			}
+
+			events := auditRepo.Events()
+			if len(events) != 1 {
+				t.Fatalf("want 1 audit event, got %v", events)
+			}
+			e := events[0]
+			if e.Action != entities.AuditActionAdminDisableUser || e.ActorID != adminActor.UserID ||
+				e.UserID != tc.userID || e.IP != adminActor.IP || e.UserAgent != adminActor.UserAgent {
+				t.Errorf("want disable event of %q by %v, got %+v", tc.userID, adminActor.UserID, e)
+			}
+			if e.Before["disabled"] != false || e.After["disabled"] != true {
+				t.Errorf("want disabled changed from false to true, got %v -> %v", e.Before, e.After)
+			}
+		})
+	}
+}
+
+func TestEnableUser(t *testing.T) {
+	ctx := usecases.WithAuditActor(context.TODO(), adminActor)
+	auditRepo := &mocks.MockAuditRepo{}
+	adu := usecases.NewAdminUsecases(&mockedLogger, &mocks.MockUserRepo{}, &mocks.MockAuthRepo{}, auditRepo)
+
+	user, err := adu.EnableUser(ctx, mocks.DisabledUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Disabled {
+		t.Errorf("want user %q to be enabled", user.ID)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].Action != entities.AuditActionAdminEnableUser ||
+		events[0].Before["disabled"] != true || events[0].After["disabled"] != false {
+		t.Errorf("want enable event of %q, got %+v", mocks.DisabledUserID, events)
+	}
+}
+
+func TestGetUserSessions(t *testing.T) {
+	ctx := usecases.WithAuditActor(context.TODO(), adminActor)
+	auditRepo := &mocks.MockAuditRepo{}
+	adu := usecases.NewAdminUsecases(&mockedLogger, &mocks.MockUserRepo{}, &mocks.MockAuthRepo{}, auditRepo)
+
+	sessions, err := adu.GetUserSessions(ctx, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) == 0 {
+		t.Fatal("want sessions of the user")
+	}
+	for _, s := range sessions {
+		if s.Token != "" {
+			t.Errorf("want session %q without the token", s.ID)
+		}
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].Action != entities.AuditActionAdminViewSessions {
+		t.Errorf("want view sessions event, got %+v", events)
+	}
+}
+
+func TestLogoutUser(t *testing.T) {
+	ctx := usecases.WithAuditActor(context.TODO(), adminActor)
+	auditRepo := &mocks.MockAuditRepo{}
+	adu := usecases.NewAdminUsecases(&mockedLogger, &mocks.MockUserRepo{}, &mocks.MockAuthRepo{}, auditRepo)
+
+	err := adu.LogoutUser(ctx, "notfound")
+	var rneErr *usecases.RecordNotExistsError
+	if !errors.As(err, &rneErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorRecordNotExists("user"), err)
+	}
+
+	err = adu.LogoutUser(ctx, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].Action != entities.AuditActionAdminLogoutUser || events[0].UserID != mocks.UserID {
+		t.Errorf("want logout event of %q, got %+v", mocks.UserID, events)
+	}
+}
+
+func TestChangeUserRole(t *testing.T) {
+	ctx := usecases.WithAuditActor(context.TODO(), adminActor)
+
+	testCases := []struct {
+		desc   string
+		userID string
+		role   entities.Role
+		errTxt string
+	}{
+		{
+			desc:   "existing user",
+			userID: mocks.UserID,
+			role:   entities.RoleCoach,
+		},
+		{
+			desc:   "not existing user",
+			userID: "notfound",
+			role:   entities.RoleCoach,
+			errTxt: usecases.NewErrorRecordNotExists("user").Error(),
+		},
+		{
+			desc:   "invalid role",
+			userID: mocks.UserID,
+			role:   "superuser",
+			errTxt: usecases.NewErrorInvalidRole("superuser").Error(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			auditRepo := &mocks.MockAuditRepo{}
+			adu := usecases.NewAdminUsecases(&mockedLogger, &mocks.MockUserRepo{}, &mocks.MockAuthRepo{}, auditRepo)
+
+			user, err := adu.ChangeUserRole(ctx, tc.userID, tc.role)
+			if tc.errTxt != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errTxt) {
+					t.Fatalf("want error %q, got %v", tc.errTxt, err)
+				}
+				if events := auditRepo.Events(); len(events) != 0 {
+					t.Errorf("want no audit events of the failed action, got %v", events)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tc.role {
+				t.Errorf("want role %q, got %q", tc.role, user.Role)
+			}
+
+			events := auditRepo.Events()
+			if len(events) != 1 {
+				t.Fatalf("want 1 audit event, got %v", events)
+			}
+			e := events[0]
+			if e.Action != entities.AuditActionAdminChangeRole || e.ActorID != adminActor.UserID || e.UserID != tc.userID {
+				t.Errorf("want change role event of %q by %v, got %+v", tc.userID, adminActor.UserID, e)
+			}
+			if e.Before["role"] != entities.RoleUser || e.After["role"] != tc.role {
+				t.Errorf("want role changed from %q to %q, got %v -> %v", entities.RoleUser, tc.role, e.Before, e.After)
+			}
+		})
+	}
+}
+
+func TestGrantAdminRole(t *testing.T) {
+	auditRepo := &mocks.MockAuditRepo{}
+	adu := usecases.NewAdminUsecases(&mockedLogger, &mocks.MockUserRepo{}, &mocks.MockAuthRepo{}, auditRepo)
+
+	err := adu.GrantAdminRole(context.TODO(), []string{mocks.NonexistingEmail, mocks.ExampleUser.EmailAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 {
+		t.Fatalf("want 1 audit event of the existing user, got %v", events)
+	}
+	e := events[0]
+	if e.Action != entities.AuditActionAdminChangeRole || e.UserID != mocks.ExampleUser.ID ||
+		e.ActorID != "" || e.After["role"] != entities.RoleAdmin {
+		t.Errorf("want admin role granted to %q at the start, got %+v", mocks.ExampleUser.ID, e)
+	}
+}
+
+func TestLoginDisabledAccount(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+
+	_, err := au.Login(ctx, nil, &usecases.UserInput{
+		EmailAddress: mocks.DisabledEmail,
+		Password:     string(mocks.Password),
+	}, "127.0.0.1")
+	var adErr *usecases.AccountDisabledError
+	if !errors.As(err, &adErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorAccountDisabled(), err)
+	}
+}
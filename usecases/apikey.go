@@ -0,0 +1,146 @@
+package usecases
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// APIKeyPrefix starts every API key, it tells the keys apart from the jwt sent in the same header
+const APIKeyPrefix = "gymm_"
+
+const (
+	// apiKeyShownLength is the length of the key's beginning that is kept to let the user recognize the key
+	apiKeyShownLength = len(APIKeyPrefix) + 6
+	// apiKeyLastUsedPrecision limits the writes of the last use of the frequently used key
+	apiKeyLastUsedPrecision = time.Minute
+)
+
+type APIKeyInput struct {
+	Name   string                 `json:"name" validate:"required,min=1,max=50,printascii"`
+	Scopes []entities.APIKeyScope `json:"scopes" validate:"required,min=1,max=3,unique,dive,api_key_scope"`
+	// ExpiresAt is nil if the key should never expire
+	ExpiresAt *time.Time `json:"expiresAt" validate:"-"`
+}
+
+// APIKeyRepo represents storage of the API keys, only the hashes of the keys are stored
+type APIKeyRepo interface {
+	// CreateAPIKey inserts the key with the hash of its plain value
+	CreateAPIKey(ctx context.Context, key *entities.APIKey, keyHash string) (*entities.APIKey, error)
+	// GetAPIKeys returns the keys of the user
+	GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error)
+	// GetAPIKeyByHash returns the key with given hash, it returns nil if there is no such key
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*entities.APIKey, error)
+	// DeleteAPIKey removes the key of the user, it returns number of deleted keys
+	DeleteAPIKey(ctx context.Context, userID string, keyID string) (int64, error)
+	// UpdateAPIKeyLastUsed sets the time the key was last used at
+	UpdateAPIKeyLastUsed(ctx context.Context, keyID string, usedAt time.Time) error
+}
+
+type APIKeyUsecases struct {
+	repo APIKeyRepo
+	l    *zerolog.Logger
+}
+
+type IAPIKeyUsecases interface {
+	// CreateAPIKey generates new key for the user,
+	// returned key is the only place where its plain value is available
+	CreateAPIKey(ctx context.Context, userID string, input *APIKeyInput) (*entities.APIKey, error)
+	// GetAPIKeys returns the keys of the user without their plain values
+	GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error)
+	// RevokeAPIKey removes the key of the user, it returns RecordNotExistsError if there is no such key
+	RevokeAPIKey(ctx context.Context, userID string, keyID string) error
+	// AuthenticateAPIKey returns the key with the given plain value and records its use,
+	// it returns InvalidAPIKeyError if the key does not exist or is expired
+	AuthenticateAPIKey(ctx context.Context, key string) (*entities.APIKey, error)
+}
+
+func (ku *APIKeyUsecases) CreateAPIKey(
+	ctx context.Context,
+	userID string,
+	input *APIKeyInput) (*entities.APIKey, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CreateAPIKey: generate key")
+	}
+	plain := APIKeyPrefix + token
+
+	key := entities.APIKey{
+		UserID:    userID,
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		Prefix:    plain[:apiKeyShownLength],
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: input.ExpiresAt,
+	}
+
+	created, err := ku.repo.CreateAPIKey(ctx, &key, hashToken(plain))
+	if err != nil {
+		return nil, err
+	}
+
+	created.Key = plain
+	return created, nil
+}
+
+func (ku *APIKeyUsecases) GetAPIKeys(
+	ctx context.Context,
+	userID string) ([]entities.APIKey, error) {
+	return ku.repo.GetAPIKeys(ctx, userID)
+}
+
+func (ku *APIKeyUsecases) RevokeAPIKey(
+	ctx context.Context,
+	userID string,
+	keyID string) error {
+	n, err := ku.repo.DeleteAPIKey(ctx, userID, keyID)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return errors.WithMessage(NewErrorRecordNotExists("api key"), "usecases.RevokeAPIKey")
+	}
+	return nil
+}
+
+func (ku *APIKeyUsecases) AuthenticateAPIKey(
+	ctx context.Context,
+	key string) (*entities.APIKey, error) {
+	if len(key) <= len(APIKeyPrefix) || key[:len(APIKeyPrefix)] != APIKeyPrefix {
+		return nil, NewErrorInvalidAPIKey()
+	}
+
+	apiKey, err := ku.repo.GetAPIKeyByHash(ctx, hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if apiKey == nil || apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(now) {
+		return nil, NewErrorInvalidAPIKey()
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyLastUsedPrecision {
+		// the request does not depend on it, so it is not failed
+		err = ku.repo.UpdateAPIKeyLastUsed(ctx, apiKey.ID, now)
+		if err != nil {
+			ku.l.Error().Err(err).Msgf("update last use of the api key %q", apiKey.ID)
+		} else {
+			apiKey.LastUsedAt = &now
+		}
+	}
+
+	return apiKey, nil
+}
+
+// NewAPIKeyUsecases creates API key usecases
+func NewAPIKeyUsecases(l *zerolog.Logger, repo APIKeyRepo) IAPIKeyUsecases {
+	return &APIKeyUsecases{
+		repo: repo,
+		l:    l,
+	}
+}
@@ -0,0 +1,101 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	ctx := context.TODO()
+	repo := &mocks.MockAPIKeyRepo{}
+	ku := usecases.NewAPIKeyUsecases(&mockedLogger, repo)
+
+	key, err := ku.CreateAPIKey(ctx, mocks.UserID, &usecases.APIKeyInput{
+		Name:   "spreadsheet",
+		Scopes: []entities.APIKeyScope{entities.APIKeyScopeTrainingsRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key.Key, usecases.APIKeyPrefix) || !strings.HasPrefix(key.Key, key.Prefix) {
+		t.Errorf("want key starting with %q and its prefix %q, got %q", usecases.APIKeyPrefix, key.Prefix, key.Key)
+	}
+
+	stored, err := ku.GetAPIKeys(ctx, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Key != "" || stored[0].LastUsedAt != nil {
+		t.Errorf("want one not used key without its plain value, got %+v", stored)
+	}
+
+	got, err := ku.AuthenticateAPIKey(ctx, key.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != mocks.UserID || !got.HasScope(entities.APIKeyScopeTrainingsRead) ||
+		got.HasScope(entities.APIKeyScopeTrainingsWrite) {
+		t.Errorf("want key of user %q with read scope only, got %+v", mocks.UserID, got)
+	}
+
+	stored, _ = ku.GetAPIKeys(ctx, mocks.UserID)
+	if stored[0].LastUsedAt == nil {
+		t.Errorf("want last use to be recorded")
+	}
+
+	var iakErr *usecases.InvalidAPIKeyError
+	_, err = ku.AuthenticateAPIKey(ctx, key.Key+"x")
+	if !errors.As(err, &iakErr) {
+		t.Errorf("want error %q for unknown key, got %v", usecases.NewErrorInvalidAPIKey(), err)
+	}
+
+	var rneErr *usecases.RecordNotExistsError
+	err = ku.RevokeAPIKey(ctx, mocks.NonexistingUserID, key.ID)
+	if !errors.As(err, &rneErr) {
+		t.Errorf("want error %q for key of other user, got %v", usecases.NewErrorRecordNotExists("api key"), err)
+	}
+
+	err = ku.RevokeAPIKey(ctx, mocks.UserID, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ku.AuthenticateAPIKey(ctx, key.Key)
+	if !errors.As(err, &iakErr) {
+		t.Errorf("want error %q for revoked key, got %v", usecases.NewErrorInvalidAPIKey(), err)
+	}
+}
+
+func TestAPIKeyExpired(t *testing.T) {
+	ctx := context.TODO()
+	ku := usecases.NewAPIKeyUsecases(&mockedLogger, &mocks.MockAPIKeyRepo{})
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	key, err := ku.CreateAPIKey(ctx, mocks.UserID, &usecases.APIKeyInput{
+		Name:      "short lived",
+		Scopes:    []entities.APIKeyScope{entities.APIKeyScopeExercises},
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ku.AuthenticateAPIKey(ctx, key.Key)
+	if err != nil {
+		t.Fatalf("want key valid before it expires, got %v", err)
+	}
+
+	time.Sleep(time.Until(expiresAt))
+	var iakErr *usecases.InvalidAPIKeyError
+	_, err = ku.AuthenticateAPIKey(ctx, key.Key)
+	if !errors.As(err, &iakErr) {
+		t.Errorf("want error %q for expired key, got %v", usecases.NewErrorInvalidAPIKey(), err)
+	}
+}
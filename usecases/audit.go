@@ -0,0 +1,106 @@
+package usecases
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// auditInsertTimeout limits storing of the audit event, it does not depend on the request
+const auditInsertTimeout = 5 * time.Second
+
+// AuditRepo represents the append-only storage of the audit events
+type AuditRepo interface {
+	// InsertAuditEvent stores the event, the stored events are never changed
+	InsertAuditEvent(ctx context.Context, event *entities.AuditEvent) (*entities.AuditEvent, error)
+	// GetAuditEvents returns up to limit events of the user with given actions, the newest first,
+	// starting before the event with beforeID if it is not empty
+	GetAuditEvents(
+		ctx context.Context,
+		userID string,
+		actions []entities.AuditAction,
+		beforeID string,
+		limit int64) ([]entities.AuditEvent, error)
+}
+
+// AuditActor is the user who performs the audited action and the client they use,
+// the UserID is empty for the anonymous requests
+type AuditActor struct {
+	UserID    string
+	IP        string
+	UserAgent string
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor returns the context that makes the actor the performer of the audited actions
+func WithAuditActor(ctx context.Context, actor *AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// recordAuditEvent stores the event of the action performed by the actor from the context,
+// the event's ActorID takes precedence over the actor's one, eg. the user who is logging in.
+// The action has already happened, so the event is stored even if the client is gone and the failure is only logged
+func recordAuditEvent(
+	ctx context.Context,
+	l *zerolog.Logger,
+	repo AuditRepo,
+	event entities.AuditEvent) {
+	if actor, ok := ctx.Value(auditActorKey{}).(*AuditActor); ok {
+		if event.ActorID == "" {
+			event.ActorID = actor.UserID
+		}
+		event.IP = actor.IP
+		event.UserAgent = actor.UserAgent
+	}
+	event.CreatedAt = time.Now().UTC()
+
+	// the request context is cancelled once the client disconnects
+	insertCtx, cancel := context.WithTimeout(context.Background(), auditInsertTimeout)
+	defer cancel()
+
+	_, err := repo.InsertAuditEvent(insertCtx, &event)
+	if err != nil {
+		l.Error().Err(err).Msgf("record audit event %q of user %q", event.Action, event.UserID)
+	}
+}
+
+type AuditUsecases struct {
+	repo AuditRepo
+}
+
+type IAuditUsecases interface {
+	// GetSecurityEvents returns up to limit security events of the user, the newest first,
+	// starting before the event with beforeID if it is not empty.
+	// The client of the other user, eg. the admin, is not revealed
+	GetSecurityEvents(ctx context.Context, userID string, beforeID string, limit int64) ([]entities.AuditEvent, error)
+}
+
+func (auu *AuditUsecases) GetSecurityEvents(
+	ctx context.Context,
+	userID string,
+	beforeID string,
+	limit int64) ([]entities.AuditEvent, error) {
+	events, err := auu.repo.GetAuditEvents(ctx, userID, entities.SecurityAuditActions, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		if events[i].ActorID != "" && events[i].ActorID != userID {
+			events[i].ActorID = ""
+			events[i].IP = ""
+			events[i].UserAgent = ""
+		}
+	}
+	return events, nil
+}
+
+// NewAuditUsecases creates audit usecases
+func NewAuditUsecases(repo AuditRepo) IAuditUsecases {
+	return &AuditUsecases{
+		repo: repo,
+	}
+}
@@ -0,0 +1,109 @@
+package usecases_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestLoginIsAudited(t *testing.T) {
+	actor := &usecases.AuditActor{IP: "127.0.0.1", UserAgent: "login test"}
+	ctx := usecases.WithAuditActor(context.TODO(), actor)
+	auditRepo := &mocks.MockAuditRepo{}
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, auditRepo, mockedCipher, mockedHasher)
+
+	_, err := au.Login(ctx, &mocks.MockMailer{}, &usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password) + "X",
+	}, actor.IP)
+	if _, ok := err.(usecases.IncorrectCredentialsError); !ok {
+		t.Fatalf("want error %q, got %v", usecases.IncorrectCredentialsError{}, err)
+	}
+
+	user, err := au.Login(ctx, &mocks.MockMailer{}, &usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	}, actor.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 2 {
+		t.Fatalf("want 2 audit events, got %+v", events)
+	}
+
+	failed := events[0]
+	if failed.Action != entities.AuditActionLoginFailed || failed.UserID != user.ID || failed.ActorID != "" ||
+		failed.IP != actor.IP || failed.UserAgent != actor.UserAgent {
+		t.Errorf("want anonymous failed login of %q, got %+v", user.ID, failed)
+	}
+
+	succeeded := events[1]
+	if succeeded.Action != entities.AuditActionLoginSucceeded || succeeded.UserID != user.ID || succeeded.ActorID != user.ID {
+		t.Errorf("want succeeded login of %q, got %+v", user.ID, succeeded)
+	}
+}
+
+func TestAuditEventOfCancelledRequest(t *testing.T) {
+	actor := &usecases.AuditActor{UserID: mocks.UserID, IP: "127.0.0.1", UserAgent: "cancel test"}
+	ctx, cancel := context.WithCancel(usecases.WithAuditActor(context.TODO(), actor))
+	auditRepo := &mocks.MockAuditRepo{}
+	eu := usecases.NewExerciseUseCases(&mockedLogger, &mocks.MockExerciseRepo{}, auditRepo)
+
+	// the client disconnects once the exercise is stored
+	cancel()
+	ex, err := eu.CreateExercise(ctx, "Squat", "", entities.Weight, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].RecordID != ex.ID || events[0].UserAgent != actor.UserAgent {
+		t.Errorf("want exercise created event of the cancelled request, got %+v", events)
+	}
+}
+
+func TestGetSecurityEvents(t *testing.T) {
+	ctx := context.TODO()
+	auditRepo := &mocks.MockAuditRepo{}
+	for _, e := range []entities.AuditEvent{
+		{Action: entities.AuditActionLoginSucceeded, UserID: mocks.UserID, ActorID: mocks.UserID, IP: "10.0.0.1"},
+		{Action: entities.AuditActionExerciseCreated, UserID: mocks.UserID, ActorID: mocks.UserID},
+		{Action: entities.AuditActionAdminDisableUser, UserID: mocks.UserID, ActorID: mocks.AdminUserID, IP: "10.0.0.2"},
+		{Action: entities.AuditActionLoginSucceeded, UserID: mocks.AdminUserID, ActorID: mocks.AdminUserID},
+	} {
+		e := e
+		_, err := auditRepo.InsertAuditEvent(ctx, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	auu := usecases.NewAuditUsecases(auditRepo)
+
+	events, err := auu.GetSecurityEvents(ctx, mocks.UserID, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("want 2 security events of the user, got %+v", events)
+	}
+
+	if events[0].Action != entities.AuditActionAdminDisableUser || events[0].ActorID != "" || events[0].IP != "" {
+		t.Errorf("want the admin's disable event without the admin's details, got %+v", events[0])
+	}
+	if events[1].Action != entities.AuditActionLoginSucceeded || events[1].IP != "10.0.0.1" {
+		t.Errorf("want the user's login with the IP address, got %+v", events[1])
+	}
+
+	older, err := auu.GetSecurityEvents(ctx, mocks.UserID, events[0].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(older) != 1 || older[0].ID != events[1].ID {
+		t.Errorf("want only the events before %q, got %+v", events[0].ID, older)
+	}
+}
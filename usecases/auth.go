@@ -8,53 +8,181 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/unnamedxaer/gymm-api/entities"
-	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// resetPwdRequestsLimit is the number of reset password requests
+	// allowed for the email address within resetPwdRequestsWindow
+	resetPwdRequestsLimit  = 3
+	resetPwdRequestsWindow = time.Hour
 )
 
 type AuthRepo interface {
 	GetUserByEmailAddress(ctx context.Context, emailAddress string) (*entities.AuthUser, error)
 	GetUserByID(ctx context.Context, id string) (*entities.AuthUser, error)
 	ChangePassword(ctx context.Context, userID string, newPwd []byte) error
-	AddResetPasswordRequest(ctx context.Context, emailaddress string, expiresAt time.Time) (*entities.ResetPwdReq, error)
-	UpdatePasswordForResetRequest(ctx context.Context, reqID string, password []byte) error
+	// ReplacePasswordHash sets the new password hash only if the user's hash is still the old one,
+	// false is returned if the password has been changed in the meantime
+	ReplacePasswordHash(ctx context.Context, userID string, oldHash, newHash []byte) (bool, error)
+	AddResetPasswordRequest(ctx context.Context, emailaddress string, tokenHash string, expiresAt time.Time) (*entities.ResetPwdReq, error)
+	// CountResetPasswordRequests returns the number of requests for the email address created since given time
+	CountResetPasswordRequests(ctx context.Context, emailaddress string, since time.Time) (int64, error)
+	// UpdatePasswordForResetRequest sets the password of the user of the request with given token hash
+	// and returns the user
+	UpdatePasswordForResetRequest(ctx context.Context, tokenHash string, password []byte) (*entities.User, error)
 	SaveJWT(ctx context.Context, userID string, device string, token string, expiresAt time.Time) (*entities.UserToken, error)
 	GetUserJWTs(ctx context.Context, userID string, expired entities.ExpireType) ([]entities.UserToken, error)
+	// IsJWTStored tells whether the jwt of the user is stored, the tokens of the ended sessions are removed
+	IsJWTStored(ctx context.Context, userID string, token string) (bool, error)
 	DeleteJWT(ctx context.Context, ut *entities.UserToken) (int64, error)
-	SaveRefreshToken(ctx context.Context, userID string, token string, expiresAt time.Time) (*entities.RefreshToken, error)
-	GetRefreshToken(ctx context.Context, userID string) (*entities.RefreshToken, error)
-	DeleteRefreshToken(ctx context.Context, userID string) (n int64, err error)
+	// SaveRefreshToken starts new token family for the user's device if previous is empty,
+	// otherwise it replaces the previous token with the new one, it returns nil
+	// if the previous token is not the current, not expired token of the family
+	SaveRefreshToken(ctx context.Context, userID string, device string, token string, previous string, expiresAt time.Time) (*entities.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, userID string, device string) (*entities.RefreshToken, error)
+	// GetRefreshTokenByToken returns refresh token family which current or already rotated token equals given one
+	GetRefreshTokenByToken(ctx context.Context, token string) (*entities.RefreshToken, error)
+	DeleteRefreshToken(ctx context.Context, userID string, device string) (n int64, err error)
 	DeleteRefreshTokenAndAllTokens(ctx context.Context, userID string) (n int64, err error)
+	// DeleteExpiredJWTs removes jwt tokens that expired before given time
+	DeleteExpiredJWTs(ctx context.Context, before time.Time) (int64, error)
+	// DeleteExpiredRefreshTokens removes refresh tokens that expired before given time
+	DeleteExpiredRefreshTokens(ctx context.Context, before time.Time) (int64, error)
+	// DeleteExpiredResetPasswordRequests removes reset password requests that expired before given time
+	DeleteExpiredResetPasswordRequests(ctx context.Context, before time.Time) (int64, error)
+	// SaveEmailVerificationToken replaces the pending email verification token of the user,
+	// it returns RecordNotExistsError if the email address is already verified
+	SaveEmailVerificationToken(ctx context.Context, userID string, token string, expiresAt time.Time) error
+	// VerifyEmailAddress marks email address of the user with given, not expired token as verified,
+	// the pending email address with the token replaces the current one.
+	// It returns EmailAddressInUseError if the pending address was taken in the meantime and nil if there is no such user
+	VerifyEmailAddress(ctx context.Context, token string) (*entities.User, error)
+	// ChangeEmailAddress sets the pending email address of the user with its verification token,
+	// it returns EmailAddressInUseError if the address belongs to another user and nil if there is no such user
+	ChangeEmailAddress(
+		ctx context.Context,
+		userID string,
+		emailAddress string,
+		token string,
+		expiresAt time.Time) (*entities.User, error)
+	// DeleteUserAccount removes the user whose deletion was scheduled before given time together with
+	// the user's tokens, refresh tokens and reset password requests, nothing is removed if there is no such user
+	DeleteUserAccount(ctx context.Context, userID string, scheduledBefore time.Time) error
+	// SaveTwoFactorSecret starts the two-factor setup of the user with the encrypted secret,
+	// it returns RecordNotExistsError if the two-factor authentication is already enabled
+	SaveTwoFactorSecret(ctx context.Context, userID string, secret []byte) error
+	// EnableTwoFactor completes the two-factor setup of the user,
+	// it returns RecordNotExistsError if there is no setup in progress
+	EnableTwoFactor(ctx context.Context, userID string, step int64, recoveryCodes []string) error
+	// UseTwoFactorStep marks the TOTP step as used, it returns false
+	// if a code of the same or later step has been already used
+	UseTwoFactorStep(ctx context.Context, userID string, step int64) (bool, error)
+	// UseRecoveryCode removes the hashed recovery code of the user,
+	// it returns false if the user does not have such code
+	UseRecoveryCode(ctx context.Context, userID string, code string) (bool, error)
+	// DeleteTwoFactor disables the two-factor authentication of the user and removes its secret
+	DeleteTwoFactor(ctx context.Context, userID string) error
+	// GetLoginAttempts returns failed login attempts of the given keys, keys without failures are skipped
+	GetLoginAttempts(ctx context.Context, keys []string) ([]entities.LoginAttempts, error)
+	// AddLoginFailure increments the number of failed attempts of the key
+	// and postpones forgetting them to expiresAt
+	AddLoginFailure(ctx context.Context, key string, expiresAt time.Time) (*entities.LoginAttempts, error)
+	// LockLogin rejects login attempts of the key until given time
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	// DeleteLoginAttempts forgets failed login attempts of the key
+	DeleteLoginAttempts(ctx context.Context, key string) error
+	// GetUserByExternalIdentity returns the user linked to the account at the OpenID Connect provider,
+	// it returns nil if there is no such user
+	GetUserByExternalIdentity(ctx context.Context, issuer string, subject string) (*entities.AuthUser, error)
+	// LinkExternalIdentity links the account at the OpenID Connect provider to the user
+	LinkExternalIdentity(ctx context.Context, userID string, issuer string, subject string) error
+	// CreateUserWithExternalIdentity creates the user with verified email address
+	// linked to the account at the OpenID Connect provider
+	CreateUserWithExternalIdentity(ctx context.Context, username string, emailAddress string, passwordHash []byte, issuer string, subject string) (*entities.User, error)
+}
+
+// SecretCipher encrypts the secrets before they are stored
+type SecretCipher interface {
+	Encrypt(plain []byte) ([]byte, error)
+	Decrypt(data []byte) ([]byte, error)
 }
 
 type AuthUsecases struct {
-	repo AuthRepo
-	l    *zerolog.Logger
+	repo      AuthRepo
+	auditRepo AuditRepo
+	l         *zerolog.Logger
+	// secrets is nil if the two-factor authentication is not configured
+	secrets SecretCipher
+	hasher  PasswordHasher
 }
 
 type IAuthUsecases interface {
-	// Login checks given credentials against registered users
-	Login(ctx context.Context, u *UserInput) (*entities.User, error)
-	// ChangePassword updates user password
-	ChangePassword(ctx context.Context, userID string, oldPwd, newPwd string) error
-	// AddResetPasswordRequest adds a password reset request and send it via email
+	// Login checks given credentials against registered users,
+	// the failed attempts are counted per email and IP address and slow down the next ones,
+	// it returns LoginLockedError if the next attempt is not allowed yet
+	// and AccountDisabledError if the credentials are correct but the account is disabled
+	Login(ctx context.Context, mailer Mailer, u *UserInput, ip string) (*entities.User, error)
+	// ChangePassword updates user password, all of the user's sessions are revoked
+	// and the user is notified by email
+	ChangePassword(ctx context.Context, mailer Mailer, userID string, oldPwd, newPwd string) error
+	// AddResetPasswordRequest adds a password reset request and send it via email,
+	// request for not verified email address is silently ignored
 	AddResetPasswordRequest(ctx context.Context, mailer Mailer, emailaddress string) (*entities.ResetPwdReq, error)
-	// UpdatePasswordForResetRequest sets new password based on reset request ID
-	UpdatePasswordForResetRequest(ctx context.Context, reqID string, password string) error
+	// UpdatePasswordForResetRequest sets new password based on the token from the reset link,
+	// all of the user's sessions are revoked and the user is notified by email
+	UpdatePasswordForResetRequest(ctx context.Context, mailer Mailer, token string, password string) error
 	// SaveJWT saves jwt for given user and device name
 	SaveJWT(ctx context.Context, userID string, device string, token string, expiresAt time.Time) (*entities.UserToken, error)
 	// GetUserJWTs returns user jwt tokens
 	// if expired is true it returns only expired tokens
 	GetUserJWTs(ctx context.Context, userID string, expired entities.ExpireType) ([]entities.UserToken, error)
+	// IsSessionActive tells whether the session of the jwt has not been ended,
+	// eg. by the logout or the password change
+	IsSessionActive(ctx context.Context, userID string, token string) (bool, error)
 	// DeleteJWT removes jwt token, it returns number of deleted results and error if any
 	DeleteJWT(ctx context.Context, ut *entities.UserToken) (int64, error)
-	// SaveRefreshToken creates new or override existing entry in storage with given refresh token for the user.
-	SaveRefreshToken(ctx context.Context, userID string, token string, expiresAt time.Time) (*entities.RefreshToken, error)
-	// GetRefreshToken reads refresh token for given user.
-	GetRefreshToken(ctx context.Context, userID string) (*entities.RefreshToken, error)
-	// DeleteRefreshToken removes refresh token for given user id
-	DeleteRefreshToken(ctx context.Context, userID string) (n int64, err error)
+	// CreateRefreshToken starts new refresh token family for the user's device,
+	// returned token is the only place where its plain value is available
+	CreateRefreshToken(ctx context.Context, userID string, device string) (*entities.RefreshToken, error)
+	// RotateRefreshToken exchanges the refresh token for the new one,
+	// reusing already rotated token revokes the whole token family
+	RotateRefreshToken(ctx context.Context, token string) (*entities.RefreshToken, error)
+	// RevokeRefreshToken removes the token family which the refresh token belongs to
+	RevokeRefreshToken(ctx context.Context, token string) (n int64, err error)
+	// GetRefreshToken reads refresh token for given user's device.
+	GetRefreshToken(ctx context.Context, userID string, device string) (*entities.RefreshToken, error)
+	// DeleteRefreshToken removes refresh token of given user's device
+	DeleteRefreshToken(ctx context.Context, userID string, device string) (n int64, err error)
 	// DeleteRefreshTokenAndAllTokens removes all jwt tokens and refresh token for given user
 	DeleteRefreshTokenAndAllTokens(ctx context.Context, userID string) (n int64, err error)
+	// SendEmailVerification sends a new email verification link to the user,
+	// the previously sent links stop working
+	SendEmailVerification(ctx context.Context, mailer Mailer, userID string) error
+	// VerifyEmail marks email address as verified based on the token from the verification link,
+	// the pending email address replaces the current one
+	VerifyEmail(ctx context.Context, token string) (*entities.User, error)
+	// ChangeEmailAddress sets the pending email address of the user after checking the password,
+	// it replaces the current address once verified and the current address is notified by email
+	ChangeEmailAddress(ctx context.Context, mailer Mailer, userID string, password string, emailAddress string) (*entities.User, error)
+	// SetupTwoFactor generates new TOTP secret for the user,
+	// the two-factor authentication stays disabled until it is confirmed with EnableTwoFactor
+	SetupTwoFactor(ctx context.Context, userID string) (*TwoFactorSetup, error)
+	// EnableTwoFactor enables the two-factor authentication if the code matches the secret
+	// from the setup, it returns one-time recovery codes
+	EnableTwoFactor(ctx context.Context, userID string, code string) ([]string, error)
+	// VerifyTwoFactor checks the TOTP or recovery code at the second step of the login,
+	// every code can be used only once. The failures count to the login lockout of the user's email
+	// and the ip address, it returns LoginLockedError if the next attempt is not allowed yet.
+	// The challenge allows only a few attempts and one login, InvalidTwoFactorChallengeError is returned after
+	VerifyTwoFactor(ctx context.Context, mailer Mailer, userID string, challengeID string, code string, ip string) error
+	// DisableTwoFactor disables the two-factor authentication, it requires the password and a valid code.
+	// The failures count to the login lockout of the user's email and the ip address,
+	// it returns LoginLockedError if the next attempt is not allowed yet.
+	DisableTwoFactor(ctx context.Context, mailer Mailer, userID string, password string, code string, ip string) error
+	// LoginWithExternalIdentity returns the user linked to the account at the OpenID Connect provider,
+	// the account is linked to the user with the same verified email address
+	// or a new user is created if there is none, it returns AccountDisabledError for the disabled account
+	LoginWithExternalIdentity(ctx context.Context, identity *entities.ExternalIdentity) (*entities.User, error)
 }
 
 type IncorrectCredentialsError struct{}
@@ -65,30 +193,98 @@ func (err IncorrectCredentialsError) Error() string {
 
 func (au *AuthUsecases) Login(
 	ctx context.Context,
-	u *UserInput) (*entities.User, error) {
+	mailer Mailer,
+	u *UserInput,
+	ip string) (*entities.User, error) {
+	keys := loginAttemptsKeys(u.EmailAddress, ip)
+	err := au.checkLoginAttempts(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
 	user, err := au.repo.GetUserByEmailAddress(ctx, u.EmailAddress)
 	if err != nil {
 		return nil, err
 	}
 
 	if user == nil {
+		// count it as well, so the lockout does not reveal which accounts exist
+		err = au.addLoginFailure(ctx, mailer, nil, keys)
+		if err != nil {
+			return nil, err
+		}
 		return nil, nil
 	}
 
-	err = bcrypt.CompareHashAndPassword(user.Password, []byte(u.Password))
+	ok, err := au.hasher.Compare(user.Password, u.Password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return nil, IncorrectCredentialsError{}
+		return nil, errors.WithMessage(err, "usecases.Login")
+	}
+	if !ok {
+		au.recordLogin(ctx, user.ID, false)
+		err = au.addLoginFailure(ctx, mailer, &user.User, keys)
+		if err != nil {
+			return nil, err
 		}
+		return nil, IncorrectCredentialsError{}
+	}
 
-		return nil, errors.WithMessage(err, "usecases.Login")
+	// checked after the password, so it does not reveal the account's state to anyone
+	if user.Disabled {
+		au.recordLogin(ctx, user.ID, false)
+		return nil, errors.WithMessage(NewErrorAccountDisabled(), "usecases.Login")
 	}
 
+	if au.hasher.NeedsRehash(user.Password) {
+		// the plain password is known only now, so the old hashes are upgraded on login
+		au.rehashPassword(ctx, user.ID, user.Password, u.Password)
+	}
+
+	if user.TwoFactorEnabled {
+		// the login completes with the second step, see VerifyTwoFactor
+		return &user.User, nil
+	}
+
+	// failures of the IP address are kept, one known password must not reset them
+	err = au.repo.DeleteLoginAttempts(ctx, keys[0])
+	if err != nil {
+		au.l.Err(err).Send()
+	}
+
+	au.recordLogin(ctx, user.ID, true)
 	return &user.User, nil
 }
 
+// recordLogin records the login attempt to the user's account,
+// the user is the actor only of the succeeded one
+func (au *AuthUsecases) recordLogin(ctx context.Context, userID string, succeeded bool) {
+	event := entities.AuditEvent{
+		Action: entities.AuditActionLoginFailed,
+		UserID: userID,
+	}
+	if succeeded {
+		event.Action = entities.AuditActionLoginSucceeded
+		event.ActorID = userID
+	}
+	recordAuditEvent(ctx, au.l, au.auditRepo, event)
+}
+
+// rehashPassword replaces the verified password hash with the one of the current hasher settings,
+// the password changed since the verification is kept,
+// the failure is only logged as the old hash still works
+func (au *AuthUsecases) rehashPassword(ctx context.Context, userID string, oldHash []byte, pwd string) {
+	hash, err := au.hasher.Hash(pwd)
+	if err == nil {
+		_, err = au.repo.ReplacePasswordHash(ctx, userID, oldHash, hash)
+	}
+	if err != nil {
+		au.l.Err(errors.WithMessage(err, "usecases.rehashPassword")).Send()
+	}
+}
+
 func (au *AuthUsecases) ChangePassword(
 	ctx context.Context,
+	mailer Mailer,
 	userID string,
 	oldPwd,
 	newPwd string) error {
@@ -103,16 +299,15 @@ func (au *AuthUsecases) ChangePassword(
 			errors.New("could not find the user"), "usecases.ChangePassword")
 	}
 
-	err = bcrypt.CompareHashAndPassword(user.Password, []byte(oldPwd))
+	ok, err := au.hasher.Compare(user.Password, oldPwd)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return IncorrectCredentialsError{}
-		}
-
 		return errors.WithMessage(err, "usecases.ChangePassword")
 	}
+	if !ok {
+		return IncorrectCredentialsError{}
+	}
 
-	passwordHash, err := hashPassword(newPwd)
+	passwordHash, err := au.hasher.Hash(newPwd)
 	if err != nil {
 		return errors.WithMessage(err, "invalid password, cannot hash")
 	}
@@ -122,7 +317,12 @@ func (au *AuthUsecases) ChangePassword(
 		return err
 	}
 
-	return nil
+	recordAuditEvent(ctx, au.l, au.auditRepo, entities.AuditEvent{
+		Action:  entities.AuditActionPasswordChanged,
+		ActorID: userID,
+		UserID:  userID,
+	})
+	return au.revokeSessionsOnPasswordChange(ctx, mailer, &user.User)
 }
 
 func (au *AuthUsecases) AddResetPasswordRequest(
@@ -131,7 +331,23 @@ func (au *AuthUsecases) AddResetPasswordRequest(
 	emailaddress string) (*entities.ResetPwdReq, error) {
 	expiresAt := time.Now().Add(time.Minute * 15) // @todo: config
 
-	pwdResetReq, err := au.repo.AddResetPasswordRequest(ctx, emailaddress, expiresAt)
+	n, err := au.repo.CountResetPasswordRequests(
+		ctx, emailaddress, time.Now().Add(-resetPwdRequestsWindow))
+	if err != nil {
+		return nil, err
+	}
+	if n >= resetPwdRequestsLimit {
+		// the same result as for the unknown address, so the limit does not reveal the accounts
+		au.l.Debug().Msgf("reset password request: limit of requests for %q reached", emailaddress)
+		return nil, nil
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.AddResetPasswordRequest: generate token")
+	}
+
+	pwdResetReq, err := au.repo.AddResetPasswordRequest(ctx, emailaddress, hashToken(token), expiresAt)
 	if err != nil {
 		var rneErr *RecordNotExistsError
 		if errors.As(err, &rneErr) {
@@ -139,6 +355,7 @@ func (au *AuthUsecases) AddResetPasswordRequest(
 		}
 		return nil, err
 	}
+	pwdResetReq.Token = token
 
 	select {
 	case <-ctx.Done():
@@ -151,7 +368,8 @@ func (au *AuthUsecases) AddResetPasswordRequest(
 
 func (au *AuthUsecases) UpdatePasswordForResetRequest(
 	ctx context.Context,
-	reqID string,
+	mailer Mailer,
+	token string,
 	password string) error {
 
 	if len(password) == 0 {
@@ -159,19 +377,64 @@ func (au *AuthUsecases) UpdatePasswordForResetRequest(
 			fmt.Errorf("missing password"), "reset password request")
 	}
 
-	hash, err := hashPassword(password)
+	if token == "" {
+		return errors.WithMessage(
+			NewErrorInvalidID(token, "reset password request"), "reset password request")
+	}
+
+	hash, err := au.hasher.Hash(password)
 	if err != nil {
 		return errors.WithMessage(err, "reset password request")
 	}
 
-	err = au.repo.UpdatePasswordForResetRequest(ctx, reqID, hash)
+	user, err := au.repo.UpdatePasswordForResetRequest(ctx, hashToken(token), hash)
 	if err != nil {
 		return err
 	}
 
+	// the holder of the token sent to the user's email address acts as the user
+	recordAuditEvent(ctx, au.l, au.auditRepo, entities.AuditEvent{
+		Action:  entities.AuditActionPasswordReset,
+		ActorID: user.ID,
+		UserID:  user.ID,
+	})
+	return au.revokeSessionsOnPasswordChange(ctx, mailer, user)
+}
+
+// revokeSessionsOnPasswordChange logouts the user from all devices,
+// so a stolen session does not survive the password change
+func (au *AuthUsecases) revokeSessionsOnPasswordChange(
+	ctx context.Context,
+	mailer Mailer,
+	user *entities.User) error {
+	_, err := au.repo.DeleteRefreshTokenAndAllTokens(ctx, user.ID)
+	if err != nil {
+		return errors.WithMessage(err, "usecases.revokeSessionsOnPasswordChange")
+	}
+
+	if mailer != nil {
+		u := *user
+		select {
+		case <-ctx.Done():
+		default:
+			go au.sendPasswordChangedEmail(mailer, &u)
+		}
+	}
+
 	return nil
 }
 
+func (au *AuthUsecases) sendPasswordChangedEmail(m Mailer, user *entities.User) {
+	data, err := generatePasswordChangedEmailContent(user)
+	if err != nil {
+		au.l.Err(
+			fmt.Errorf("sending password changed email abandoned: %v", err)).Send()
+		return
+	}
+
+	m.Send([]string{user.EmailAddress}, []byte("Password Changed"), data)
+}
+
 func (au *AuthUsecases) SaveJWT(
 	ctx context.Context,
 	userID string,
@@ -182,6 +445,13 @@ func (au *AuthUsecases) SaveJWT(
 	return au.repo.SaveJWT(ctx, userID, device, token, expiresAt)
 }
 
+func (au *AuthUsecases) IsSessionActive(
+	ctx context.Context,
+	userID string,
+	token string) (bool, error) {
+	return au.repo.IsJWTStored(ctx, userID, token)
+}
+
 func (au *AuthUsecases) DeleteJWT(
 	ctx context.Context,
 	token *entities.UserToken) (int64, error) {
@@ -195,30 +465,43 @@ func (au *AuthUsecases) GetUserJWTs(
 	return au.repo.GetUserJWTs(ctx, userID, expired)
 }
 
-func (au *AuthUsecases) SaveRefreshToken(
-	ctx context.Context,
-	userID string,
-	token string,
-	expiresAt time.Time) (*entities.RefreshToken, error) {
-	return au.repo.SaveRefreshToken(ctx, userID, token, expiresAt)
-}
-
 func (au *AuthUsecases) GetRefreshToken(
 	ctx context.Context,
-	userID string) (*entities.RefreshToken, error) {
-	return au.repo.GetRefreshToken(ctx, userID)
+	userID string,
+	device string) (*entities.RefreshToken, error) {
+	return au.repo.GetRefreshToken(ctx, userID, device)
 }
 
 func (au *AuthUsecases) DeleteRefreshToken(
 	ctx context.Context,
-	userID string) (n int64, err error) {
-	return au.repo.DeleteRefreshToken(ctx, userID)
+	userID string,
+	device string) (n int64, err error) {
+	n, err = au.repo.DeleteRefreshToken(ctx, userID, device)
+	if err != nil {
+		return 0, err
+	}
+
+	recordAuditEvent(ctx, au.l, au.auditRepo, entities.AuditEvent{
+		Action: entities.AuditActionSessionRevoked,
+		UserID: userID,
+		Before: map[string]interface{}{"device": device},
+	})
+	return n, nil
 }
 
 func (au *AuthUsecases) DeleteRefreshTokenAndAllTokens(
 	ctx context.Context,
 	userID string) (n int64, err error) {
-	return au.repo.DeleteRefreshTokenAndAllTokens(ctx, userID)
+	n, err = au.repo.DeleteRefreshTokenAndAllTokens(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	recordAuditEvent(ctx, au.l, au.auditRepo, entities.AuditEvent{
+		Action: entities.AuditActionAllSessionsRevoked,
+		UserID: userID,
+	})
+	return n, nil
 }
 
 func (au *AuthUsecases) sendResetPwdRequestEmail(
@@ -264,10 +547,19 @@ func (au *AuthUsecases) sendResetPwdRequestEmail(
 	go m.Send([]string{pwdResetReq.EmailAddress}, []byte("Reset Password"), data)
 }
 
-// NewAuthUsecases creates auth usecases
-func NewAuthUsecases(l *zerolog.Logger, repo AuthRepo) IAuthUsecases {
+// NewAuthUsecases creates auth usecases,
+// secrets may be nil if the two-factor authentication is not configured
+func NewAuthUsecases(
+	l *zerolog.Logger,
+	repo AuthRepo,
+	auditRepo AuditRepo,
+	secrets SecretCipher,
+	hasher PasswordHasher) IAuthUsecases {
 	return &AuthUsecases{
-		repo: repo,
-		l:    l,
+		repo:      repo,
+		auditRepo: auditRepo,
+		l:         l,
+		secrets:   secrets,
+		hasher:    hasher,
 	}
 }
@@ -0,0 +1,97 @@
+package usecases
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// AuthCleanupMetrics counts the documents removed by the expired auth data cleanup,
+// it is safe for concurrent use
+type AuthCleanupMetrics struct {
+	runs          int64
+	jwts          int64
+	refreshTokens int64
+	resetPwdReqs  int64
+}
+
+// AuthCleanupStats is a snapshot of the AuthCleanupMetrics
+type AuthCleanupStats struct {
+	Runs          int64 `json:"runs"`
+	JWTs          int64 `json:"jwts"`
+	RefreshTokens int64 `json:"refreshTokens"`
+	ResetPwdReqs  int64 `json:"resetPasswordRequests"`
+}
+
+// Stats returns the totals since the process start
+func (m *AuthCleanupMetrics) Stats() AuthCleanupStats {
+	return AuthCleanupStats{
+		Runs:          atomic.LoadInt64(&m.runs),
+		JWTs:          atomic.LoadInt64(&m.jwts),
+		RefreshTokens: atomic.LoadInt64(&m.refreshTokens),
+		ResetPwdReqs:  atomic.LoadInt64(&m.resetPwdReqs),
+	}
+}
+
+func (m *AuthCleanupMetrics) add(s AuthCleanupStats) {
+	atomic.AddInt64(&m.runs, s.Runs)
+	atomic.AddInt64(&m.jwts, s.JWTs)
+	atomic.AddInt64(&m.refreshTokens, s.RefreshTokens)
+	atomic.AddInt64(&m.resetPwdReqs, s.ResetPwdReqs)
+}
+
+// CleanupExpiredAuthData removes jwt tokens, refresh tokens and reset password
+// requests that expired more than retention ago, it returns number of removed documents
+func CleanupExpiredAuthData(
+	ctx context.Context,
+	repo AuthRepo,
+	retention time.Duration) (AuthCleanupStats, error) {
+	before := time.Now().Add(-retention)
+	stats := AuthCleanupStats{Runs: 1}
+
+	var err error
+	stats.JWTs, err = repo.DeleteExpiredJWTs(ctx, before)
+	if err != nil {
+		return stats, errors.WithMessage(err, "cleanup expired auth data")
+	}
+
+	stats.RefreshTokens, err = repo.DeleteExpiredRefreshTokens(ctx, before)
+	if err != nil {
+		return stats, errors.WithMessage(err, "cleanup expired auth data")
+	}
+
+	stats.ResetPwdReqs, err = repo.DeleteExpiredResetPasswordRequests(ctx, before)
+	if err != nil {
+		return stats, errors.WithMessage(err, "cleanup expired auth data")
+	}
+
+	return stats, nil
+}
+
+// NewCleanupExpiredAuthDataJob creates a job that removes expired auth data,
+// the number of removed documents is logged and added to the metrics
+func NewCleanupExpiredAuthDataJob(
+	l *zerolog.Logger,
+	repo AuthRepo,
+	retention time.Duration,
+	metrics *AuthCleanupMetrics) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stats, err := CleanupExpiredAuthData(ctx, repo, retention)
+		metrics.add(stats)
+
+		total := metrics.Stats()
+		l.Info().
+			Int64("jwts", stats.JWTs).
+			Int64("refreshTokens", stats.RefreshTokens).
+			Int64("resetPasswordRequests", stats.ResetPwdReqs).
+			Int64("totalJwts", total.JWTs).
+			Int64("totalRefreshTokens", total.RefreshTokens).
+			Int64("totalResetPasswordRequests", total.ResetPwdReqs).
+			Msg("expired auth data removed")
+
+		return err
+	}
+}
@@ -0,0 +1,53 @@
+package usecases_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestCleanupExpiredAuthData(t *testing.T) {
+	ctx := context.TODO()
+	repo := &mocks.MockAuthRepo{}
+
+	stats, err := usecases.CleanupExpiredAuthData(ctx, repo, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.JWTs != 0 || stats.RefreshTokens != 0 {
+		t.Errorf("want not expired tokens to be kept, got %+v", stats)
+	}
+
+	// tokens of the mocks expire in one year
+	stats, err = usecases.CleanupExpiredAuthData(ctx, repo, -2*365*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.JWTs != 1 || stats.RefreshTokens != 1 {
+		t.Errorf("want expired tokens to be removed, got %+v", stats)
+	}
+}
+
+func TestCleanupExpiredAuthDataJob(t *testing.T) {
+	metrics := &usecases.AuthCleanupMetrics{}
+	job := usecases.NewCleanupExpiredAuthDataJob(
+		&mockedLogger, &mocks.MockAuthRepo{}, -2*365*24*time.Hour, metrics)
+
+	for i := 0; i < 2; i++ {
+		err := job(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := metrics.Stats()
+	want := usecases.AuthCleanupStats{Runs: 2, JWTs: 2, RefreshTokens: 2}
+	if got != want {
+		t.Errorf("want metrics %+v, got %+v", want, got)
+	}
+}
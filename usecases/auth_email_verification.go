@@ -0,0 +1,172 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// EmailVerificationTTL is the time after which the link from the verification email stops working
+const EmailVerificationTTL = 24 * time.Hour
+
+func (au *AuthUsecases) SendEmailVerification(
+	ctx context.Context,
+	mailer Mailer,
+	userID string) error {
+	authUser, err := au.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if authUser == nil {
+		return errors.WithMessage(
+			NewErrorRecordNotExists("user"), "usecases.SendEmailVerification")
+	}
+
+	if authUser.EmailVerified {
+		return NewErrorEmailAlreadyVerified()
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return errors.WithMessage(err, "usecases.SendEmailVerification: generate token")
+	}
+
+	err = au.repo.SaveEmailVerificationToken(
+		ctx, userID, hashToken(token), time.Now().Add(EmailVerificationTTL))
+	if err != nil {
+		var rneErr *RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			// verified in the meantime
+			return NewErrorEmailAlreadyVerified()
+		}
+		return err
+	}
+
+	user := authUser.User
+	select {
+	case <-ctx.Done():
+	default:
+		go au.sendEmailVerificationEmail(mailer, &user, token)
+	}
+
+	return nil
+}
+
+func (au *AuthUsecases) VerifyEmail(
+	ctx context.Context,
+	token string) (*entities.User, error) {
+	if token == "" {
+		return nil, NewErrorInvalidEmailVerificationToken()
+	}
+
+	user, err := au.repo.VerifyEmailAddress(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, NewErrorInvalidEmailVerificationToken()
+	}
+
+	return user, nil
+}
+
+func (au *AuthUsecases) ChangeEmailAddress(
+	ctx context.Context,
+	mailer Mailer,
+	userID string,
+	password string,
+	emailAddress string) (*entities.User, error) {
+	authUser, err := au.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if authUser == nil {
+		return nil, errors.WithMessage(
+			NewErrorRecordNotExists("user"), "usecases.ChangeEmailAddress")
+	}
+
+	ok, err := au.hasher.Compare(authUser.Password, password)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ChangeEmailAddress")
+	}
+	if !ok {
+		return nil, IncorrectCredentialsError{}
+	}
+
+	if strings.EqualFold(authUser.EmailAddress, emailAddress) {
+		return nil, errors.WithMessage(NewErrorEmailAddressInUse(), "usecases.ChangeEmailAddress")
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.ChangeEmailAddress: generate token")
+	}
+
+	user, err := au.repo.ChangeEmailAddress(
+		ctx, userID, emailAddress, hashToken(token), time.Now().Add(EmailVerificationTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, errors.WithMessage(
+			NewErrorRecordNotExists("user"), "usecases.ChangeEmailAddress")
+	}
+
+	recordAuditEvent(ctx, au.l, au.auditRepo, entities.AuditEvent{
+		Action:  entities.AuditActionEmailChanged,
+		ActorID: userID,
+		UserID:  userID,
+		Before:  map[string]interface{}{"emailAddress": authUser.EmailAddress},
+		After:   map[string]interface{}{"pendingEmailAddress": user.PendingEmailAddress},
+	})
+
+	oldUser := authUser.User
+	// the verification link goes to the pending address
+	newUser := *user
+	newUser.EmailAddress = user.PendingEmailAddress
+	select {
+	case <-ctx.Done():
+	default:
+		go au.sendEmailVerificationEmail(mailer, &newUser, token)
+		// the owner of the current address learns about the change in case it was not them
+		go au.sendEmailChangedEmail(mailer, &oldUser, newUser.EmailAddress)
+	}
+
+	return user, nil
+}
+
+func (au *AuthUsecases) sendEmailChangedEmail(
+	m Mailer,
+	user *entities.User,
+	newEmailAddress string) {
+	data, err := generateEmailChangedEmailContent(user, newEmailAddress)
+	if err != nil {
+		au.l.Err(
+			fmt.Errorf("sending email changed email abandoned: %v", err)).Send()
+		return
+	}
+
+	m.Send([]string{user.EmailAddress}, []byte("Email Address Change Requested"), data)
+}
+
+func (au *AuthUsecases) sendEmailVerificationEmail(
+	m Mailer,
+	user *entities.User,
+	token string) {
+	data, err := generateEmailVerificationEmailContent(user, token)
+	if err != nil {
+		au.l.Err(
+			fmt.Errorf("sending email verification abandoned: %v", err)).Send()
+		return
+	}
+
+	m.Send([]string{user.EmailAddress}, []byte("Verify Email Address"), data)
+}
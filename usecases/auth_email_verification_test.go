@@ -0,0 +1,167 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+type recordingMailer struct {
+	sent chan []byte
+}
+
+func (m *recordingMailer) Send(recipients []string, subject, data []byte) {
+	m.sent <- data
+}
+
+func (m *recordingMailer) Close() {}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	m := &recordingMailer{sent: make(chan []byte, 1)}
+	userID := "unverified" + mocks.UserID
+
+	err := au.SendEmailVerification(ctx, m, userID)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	var data []byte
+	select {
+	case data = <-m.sent:
+	case <-time.After(time.Second):
+		t.Fatal("want verification email to be sent")
+	}
+
+	match := regexp.MustCompile(`/email/verify/([0-9a-zA-Z_-]+)`).FindSubmatch(data)
+	if match == nil {
+		t.Fatalf("want verification link in the email, got %s", data)
+	}
+	token := string(match[1])
+
+	_, err = au.VerifyEmail(ctx, "not-issued-token")
+	var ievtErr *usecases.InvalidEmailVerificationTokenError
+	if !errors.As(err, &ievtErr) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorInvalidEmailVerificationToken(), err)
+	}
+
+	user, err := au.VerifyEmail(ctx, token)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if user.ID != userID || !user.EmailVerified {
+		t.Errorf("want verified user %q, got %+v", userID, user)
+	}
+
+	_, err = au.VerifyEmail(ctx, token)
+	if !errors.As(err, &ievtErr) {
+		t.Errorf("want the token to be single use, got %v", err)
+	}
+}
+
+func TestSendEmailVerificationAlreadyVerified(t *testing.T) {
+	ctx := context.TODO()
+	err := authUC.SendEmailVerification(ctx, &mocks.MockMailer{}, mocks.UserID)
+	var eavErr *usecases.EmailAlreadyVerifiedError
+	if !errors.As(err, &eavErr) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorEmailAlreadyVerified(), err)
+	}
+}
+
+func TestChangeEmailAddress(t *testing.T) {
+	ctx := context.TODO()
+	auditRepo := &mocks.MockAuditRepo{}
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, auditRepo, mockedCipher, mockedHasher)
+	m := &recordingMailer{sent: make(chan []byte, 2)}
+	newEmail := "new" + mocks.ExampleUser.EmailAddress
+
+	_, err := au.ChangeEmailAddress(ctx, m, mocks.UserID, string(mocks.Password)+"X", newEmail)
+	if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+		t.Errorf("want error %q, got %v", usecases.IncorrectCredentialsError{}, err)
+	}
+
+	var eiuErr *usecases.EmailAddressInUseError
+	for _, email := range []string{mocks.InUseEmail, mocks.ExampleUser.EmailAddress} {
+		_, err = au.ChangeEmailAddress(ctx, m, mocks.UserID, string(mocks.Password), email)
+		if !errors.As(err, &eiuErr) {
+			t.Errorf("want error %q for %q, got %v", usecases.NewErrorEmailAddressInUse(), email, err)
+		}
+	}
+
+	user, err := au.ChangeEmailAddress(ctx, m, mocks.UserID, string(mocks.Password), newEmail)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if user.EmailAddress != mocks.ExampleUser.EmailAddress || !user.EmailVerified || user.PendingEmailAddress != newEmail {
+		t.Errorf("want verified %q kept until %q is verified, got %+v", mocks.ExampleUser.EmailAddress, newEmail, user)
+	}
+
+	// the verification of the new address and the notice to the old one
+	var token, notice string
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-m.sent:
+			if match := regexp.MustCompile(`/email/verify/([0-9a-zA-Z_-]+)`).FindSubmatch(data); match != nil {
+				token = string(match[1])
+			} else {
+				notice = string(data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("want verification and notice emails to be sent")
+		}
+	}
+	if !strings.Contains(notice, newEmail) {
+		t.Errorf("want notice about the change to %q, got %s", newEmail, notice)
+	}
+
+	user, err = au.VerifyEmail(ctx, token)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if user.EmailAddress != newEmail || !user.EmailVerified {
+		t.Errorf("want verified %q, got %+v", newEmail, user)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].Action != entities.AuditActionEmailChanged ||
+		events[0].After["pendingEmailAddress"] != newEmail {
+		t.Errorf("want email changed event, got %+v", events)
+	}
+}
+
+func TestChangeEmailAddressTakenBeforeVerification(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	m := &recordingMailer{sent: make(chan []byte, 2)}
+
+	_, err := au.ChangeEmailAddress(ctx, m, mocks.UserID, string(mocks.Password), mocks.ClaimedEmail)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	var token string
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-m.sent:
+			if match := regexp.MustCompile(`/email/verify/([0-9a-zA-Z_-]+)`).FindSubmatch(data); match != nil {
+				token = string(match[1])
+			}
+		case <-time.After(time.Second):
+			t.Fatal("want verification and notice emails to be sent")
+		}
+	}
+
+	_, err = au.VerifyEmail(ctx, token)
+	var eiuErr *usecases.EmailAddressInUseError
+	if !errors.As(err, &eiuErr) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorEmailAddressInUse(), err)
+	}
+}
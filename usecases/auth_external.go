@@ -0,0 +1,124 @@
+package usecases
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+const (
+	externalUsernameMinLen = 2
+	externalUsernameMaxLen = 50
+	// externalUsernameFallback is used if neither the name nor the email address gives a valid username
+	externalUsernameFallback = "user"
+)
+
+func (au *AuthUsecases) LoginWithExternalIdentity(
+	ctx context.Context,
+	identity *entities.ExternalIdentity) (*entities.User, error) {
+	user, err := au.getExternalIdentityUser(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		// otherwise the login completes with the second step
+		au.recordLogin(ctx, user.ID, true)
+	}
+	return user, nil
+}
+
+// getExternalIdentityUser returns the user linked to the identity, links or creates one if there is none
+func (au *AuthUsecases) getExternalIdentityUser(
+	ctx context.Context,
+	identity *entities.ExternalIdentity) (*entities.User, error) {
+	linked, err := au.repo.GetUserByExternalIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if linked != nil {
+		if linked.Disabled {
+			return nil, errors.WithMessage(NewErrorAccountDisabled(), "usecases.LoginWithExternalIdentity")
+		}
+		return &linked.User, nil
+	}
+
+	// linking by the email address is safe only if the provider owns it
+	if !identity.EmailVerified || identity.EmailAddress == "" {
+		return nil, NewErrorExternalEmailNotVerified()
+	}
+
+	authUser, err := au.repo.GetUserByEmailAddress(ctx, identity.EmailAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if authUser != nil {
+		// the not verified account could have been registered by anyone
+		// to take over the account of the email owner once it is linked
+		if !authUser.EmailVerified {
+			return nil, errors.WithMessage(
+				NewErrorEmailAddressInUse(), "usecases.LoginWithExternalIdentity")
+		}
+
+		if authUser.Disabled {
+			return nil, errors.WithMessage(NewErrorAccountDisabled(), "usecases.LoginWithExternalIdentity")
+		}
+
+		err = au.repo.LinkExternalIdentity(ctx, authUser.ID, identity.Issuer, identity.Subject)
+		if err != nil {
+			return nil, err
+		}
+
+		return &authUser.User, nil
+	}
+
+	// the user signs in only with the provider, nobody knows the password
+	password, err := generateToken()
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.LoginWithExternalIdentity: generate password")
+	}
+
+	passwordHash, err := au.hasher.Hash(password)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.LoginWithExternalIdentity: hash password")
+	}
+
+	return au.repo.CreateUserWithExternalIdentity(
+		ctx,
+		externalUsername(identity),
+		identity.EmailAddress,
+		passwordHash,
+		identity.Issuer,
+		identity.Subject)
+}
+
+// externalUsername returns the username for the new user
+// based on the name or the email address from the provider
+func externalUsername(identity *entities.ExternalIdentity) string {
+	for _, candidate := range []string{
+		identity.Name,
+		strings.SplitN(identity.EmailAddress, "@", 2)[0],
+	} {
+		username := strings.Map(func(r rune) rune {
+			if r < ' ' || r > '~' {
+				return -1
+			}
+			return r
+		}, candidate)
+		username = strings.TrimSpace(username)
+
+		if len(username) > externalUsernameMaxLen {
+			username = strings.TrimSpace(username[:externalUsernameMaxLen])
+		}
+
+		if len(username) >= externalUsernameMinLen {
+			return username
+		}
+	}
+
+	return externalUsernameFallback
+}
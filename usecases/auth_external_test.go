@@ -0,0 +1,112 @@
+package usecases_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestLoginWithExternalIdentity(t *testing.T) {
+	ctx := context.TODO()
+	const issuer = "https://accounts.example.com"
+
+	testCases := []struct {
+		desc     string
+		identity entities.ExternalIdentity
+		errTxt   string
+		username string
+	}{
+		{
+			desc: "link existing verified user",
+			identity: entities.ExternalIdentity{
+				Subject:       "existing",
+				EmailAddress:  mocks.ExampleUser.EmailAddress,
+				EmailVerified: true,
+			},
+			username: mocks.ExampleUser.Username,
+		},
+		{
+			desc: "create new user",
+			identity: entities.ExternalIdentity{
+				Subject:       "new",
+				EmailAddress:  "new.notfound@email.com",
+				EmailVerified: true,
+				Name:          "  Zoë Smith  ",
+			},
+			username: "Zo Smith",
+		},
+		{
+			desc: "create new user without name",
+			identity: entities.ExternalIdentity{
+				Subject:       "noname",
+				EmailAddress:  "jane.notfound@email.com",
+				EmailVerified: true,
+			},
+			username: "jane.notfound",
+		},
+		{
+			desc: "email not verified by provider",
+			identity: entities.ExternalIdentity{
+				Subject:      "notverified",
+				EmailAddress: mocks.ExampleUser.EmailAddress,
+			},
+			errTxt: usecases.NewErrorExternalEmailNotVerified().Error(),
+		},
+		{
+			desc: "existing user with not verified email",
+			identity: entities.ExternalIdentity{
+				Subject:       "unverifiedlocal",
+				EmailAddress:  "unverified@email.com",
+				EmailVerified: true,
+			},
+			errTxt: usecases.NewErrorEmailAddressInUse().Error(),
+		},
+		{
+			desc: "existing disabled user",
+			identity: entities.ExternalIdentity{
+				Subject:       "disabled",
+				EmailAddress:  mocks.DisabledEmail,
+				EmailVerified: true,
+			},
+			errTxt: usecases.NewErrorAccountDisabled().Error(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			repo := &mocks.MockAuthRepo{}
+			au := usecases.NewAuthUsecases(&mockedLogger, repo, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+			tc.identity.Issuer = issuer
+
+			user, err := au.LoginWithExternalIdentity(ctx, &tc.identity)
+			if tc.errTxt != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errTxt) {
+					t.Fatalf("want error %q, got %v", tc.errTxt, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Username != tc.username || user.EmailAddress != tc.identity.EmailAddress {
+				t.Errorf("want user %q <%s>, got %q <%s>",
+					tc.username, tc.identity.EmailAddress, user.Username, user.EmailAddress)
+			}
+
+			// the identity is linked, so the next login does not depend on the email address
+			tc.identity.EmailAddress = "changed@email.com"
+			tc.identity.EmailVerified = false
+			linked, err := au.LoginWithExternalIdentity(ctx, &tc.identity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked.ID != user.ID {
+				t.Errorf("want linked user %q, got %q", user.ID, linked.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+const (
+	// loginAttemptsWindow is the time after the last failure when the failures are forgotten
+	loginAttemptsWindow = time.Hour
+	// loginBackoffBase is the delay after the first failure over the free ones,
+	// it doubles with every next failure
+	loginBackoffBase = time.Second
+	// LoginLockoutDuration is the longest time the login can be locked for
+	LoginLockoutDuration = 15 * time.Minute
+
+	loginAttemptsEmailPrefix = "email:"
+	loginAttemptsIPPrefix    = "ip:"
+)
+
+// loginLimit describes how many failures are allowed before the next attempts are delayed
+type loginLimit struct {
+	// free is the number of failures without any delay
+	free int
+	// lockout is the number of failures which locks the login for LoginLockoutDuration
+	lockout int
+}
+
+var (
+	emailLoginLimit = loginLimit{free: 3, lockout: 10}
+	// many users can share the IP address, eg. behind NAT
+	ipLoginLimit = loginLimit{free: 20, lockout: 100}
+)
+
+// delay returns time for which the next attempt is rejected after given number of failures
+func (l loginLimit) delay(failures int) time.Duration {
+	if failures >= l.lockout {
+		return LoginLockoutDuration
+	}
+	if failures <= l.free {
+		return 0
+	}
+
+	d := loginBackoffBase << (failures - l.free - 1)
+	if d <= 0 || d > LoginLockoutDuration {
+		return LoginLockoutDuration
+	}
+	return d
+}
+
+// loginAttemptsKeys returns keys of the failed attempts, the email address is always the first one
+func loginAttemptsKeys(emailAddress, ip string) []string {
+	keys := []string{loginAttemptsEmailPrefix + strings.ToLower(strings.TrimSpace(emailAddress))}
+	if ip != "" {
+		keys = append(keys, loginAttemptsIPPrefix+ip)
+	}
+	return keys
+}
+
+// checkLoginAttempts returns LoginLockedError if any of the keys is locked
+func (au *AuthUsecases) checkLoginAttempts(ctx context.Context, keys []string) error {
+	attempts, err := au.repo.GetLoginAttempts(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	var retryAfter time.Duration
+	now := time.Now()
+	for _, a := range attempts {
+		if d := a.LockedUntil.Sub(now); d > retryAfter {
+			retryAfter = d
+		}
+	}
+
+	if retryAfter > 0 {
+		return NewErrorLoginLocked(retryAfter)
+	}
+	return nil
+}
+
+// addLoginFailure counts the failure for all of the keys and delays the next attempts,
+// user is nil if there is no account with the email address
+func (au *AuthUsecases) addLoginFailure(
+	ctx context.Context,
+	mailer Mailer,
+	user *entities.User,
+	keys []string) error {
+	now := time.Now()
+	for _, key := range keys {
+		attempts, err := au.repo.AddLoginFailure(ctx, key, now.Add(loginAttemptsWindow))
+		if err != nil {
+			return err
+		}
+
+		limit := ipLoginLimit
+		if strings.HasPrefix(key, loginAttemptsEmailPrefix) {
+			limit = emailLoginLimit
+		}
+
+		d := limit.delay(attempts.Failures)
+		if d == 0 {
+			continue
+		}
+
+		err = au.repo.LockLogin(ctx, key, now.Add(d))
+		if err != nil {
+			return err
+		}
+
+		// notify only once, when the lockout starts
+		if user != nil && mailer != nil && limit == emailLoginLimit && attempts.Failures == limit.lockout {
+			go au.sendLoginLockedEmail(mailer, user, attempts.Failures)
+		}
+	}
+
+	return nil
+}
+
+func (au *AuthUsecases) sendLoginLockedEmail(
+	m Mailer,
+	user *entities.User,
+	failures int) {
+	data, err := generateLoginLockedEmailContent(user, failures, LoginLockoutDuration)
+	if err != nil {
+		au.l.Err(
+			fmt.Errorf("sending login locked email abandoned: %v", err)).Send()
+		return
+	}
+
+	m.Send([]string{user.EmailAddress}, []byte("Login Locked"), data)
+}
@@ -0,0 +1,109 @@
+package usecases_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	ctx := context.TODO()
+	repo := &mocks.MockAuthRepo{}
+	au := usecases.NewAuthUsecases(&mockedLogger, repo, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	wrong := &usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     "wrong password",
+	}
+
+	// the free attempts and the first one which starts the backoff
+	for i := 0; i < 4; i++ {
+		_, err := au.Login(ctx, nil, wrong, "127.0.0.1")
+		if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+			t.Fatalf("attempt %d: want error %q, got %v", i+1, usecases.IncorrectCredentialsError{}, err)
+		}
+	}
+
+	var llErr *usecases.LoginLockedError
+	_, err := au.Login(ctx, nil, wrong, "127.0.0.1")
+	if !errors.As(err, &llErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorLoginLocked(0), err)
+	}
+	if llErr.RetryAfter <= 0 || llErr.RetryAfter > time.Second {
+		t.Errorf("want retry after within a second, got %v", llErr.RetryAfter)
+	}
+
+	// the correct password is rejected as well until the delay passes
+	correct := &usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	}
+	_, err = au.Login(ctx, nil, correct, "127.0.0.1")
+	if !errors.As(err, &llErr) {
+		t.Fatalf("want error %q for correct password, got %v", usecases.NewErrorLoginLocked(0), err)
+	}
+
+	time.Sleep(llErr.RetryAfter)
+	user, err := au.Login(ctx, nil, correct, "127.0.0.1")
+	if err != nil || user == nil {
+		t.Fatalf("want user after the delay, got %v, %v", user, err)
+	}
+
+	attempts, err := repo.GetLoginAttempts(ctx, []string{"email:" + mocks.ExampleUser.EmailAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 0 {
+		t.Errorf("want failures of the email address to be reset, got %+v", attempts)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.TODO()
+	repo := &mocks.MockAuthRepo{}
+	au := usecases.NewAuthUsecases(&mockedLogger, repo, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	m := &recordingMailer{sent: make(chan []byte, 1)}
+	key := "email:" + mocks.ExampleUser.EmailAddress
+
+	// the failures before the last one, without waiting for the delays
+	for i := 0; i < 9; i++ {
+		_, err := repo.AddLoginFailure(ctx, key, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := au.Login(ctx, m, &usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     "wrong password",
+	}, "")
+	if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+		t.Fatalf("want error %q, got %v", usecases.IncorrectCredentialsError{}, err)
+	}
+
+	var data []byte
+	select {
+	case data = <-m.sent:
+	case <-time.After(time.Second):
+		t.Fatal("want login locked email to be sent")
+	}
+	if !bytes.Contains(data, []byte("/password/reset")) {
+		t.Errorf("want password reset link in the email, got %s", data)
+	}
+
+	var llErr *usecases.LoginLockedError
+	_, err = au.Login(ctx, m, &usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	}, "")
+	if !errors.As(err, &llErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorLoginLocked(0), err)
+	}
+	if llErr.RetryAfter < usecases.LoginLockoutDuration-time.Minute {
+		t.Errorf("want login to be locked for %v, got %v", usecases.LoginLockoutDuration, llErr.RetryAfter)
+	}
+}
@@ -0,0 +1,137 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// RefreshTokenTTL is the time after which not used refresh token expires,
+// every rotation extends the session by this time
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+func (au *AuthUsecases) CreateRefreshToken(
+	ctx context.Context,
+	userID string,
+	device string) (*entities.RefreshToken, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, errors.WithMessage(err, "create refresh token")
+	}
+
+	rt, err := au.repo.SaveRefreshToken(
+		ctx, userID, device, hashToken(token), "", time.Now().Add(RefreshTokenTTL))
+	if err != nil {
+		return nil, errors.WithMessage(err, "create refresh token")
+	}
+	if rt == nil {
+		return nil, errors.WithMessage(
+			NewErrorRecordNotExists("refresh token"), "create refresh token")
+	}
+
+	rt.Token = token
+	return rt, nil
+}
+
+func (au *AuthUsecases) RotateRefreshToken(
+	ctx context.Context,
+	token string) (*entities.RefreshToken, error) {
+	if token == "" {
+		return nil, NewErrorInvalidRefreshToken()
+	}
+
+	hash := hashToken(token)
+	stored, err := au.repo.GetRefreshTokenByToken(ctx, hash)
+	if err != nil {
+		return nil, errors.WithMessage(err, "rotate refresh token")
+	}
+	if stored == nil {
+		return nil, NewErrorInvalidRefreshToken()
+	}
+
+	if stored.Token != hash {
+		return nil, au.revokeRefreshTokenFamily(ctx, stored)
+	}
+
+	if time.Until(stored.ExpiresAt) <= 0 {
+		return nil, NewErrorInvalidRefreshToken()
+	}
+
+	newToken, err := generateToken()
+	if err != nil {
+		return nil, errors.WithMessage(err, "rotate refresh token")
+	}
+
+	rt, err := au.repo.SaveRefreshToken(
+		ctx, stored.UserID, stored.Device, hashToken(newToken), hash, time.Now().Add(RefreshTokenTTL))
+	if err != nil {
+		return nil, errors.WithMessage(err, "rotate refresh token")
+	}
+	if rt == nil {
+		// the token has been rotated concurrently, so this is a reuse too
+		return nil, au.revokeRefreshTokenFamily(ctx, stored)
+	}
+
+	rt.Token = newToken
+	return rt, nil
+}
+
+func (au *AuthUsecases) RevokeRefreshToken(
+	ctx context.Context,
+	token string) (int64, error) {
+	stored, err := au.repo.GetRefreshTokenByToken(ctx, hashToken(token))
+	if err != nil {
+		return 0, errors.WithMessage(err, "revoke refresh token")
+	}
+	if stored == nil {
+		return 0, nil
+	}
+
+	n, err := au.repo.DeleteRefreshToken(ctx, stored.UserID, stored.Device)
+	if err != nil {
+		return n, errors.WithMessage(err, "revoke refresh token")
+	}
+	return n, nil
+}
+
+// revokeRefreshTokenFamily drops the refresh token and jwt of the device session
+// after a reuse of the refresh token, the legitimate user must login again on that device
+func (au *AuthUsecases) revokeRefreshTokenFamily(ctx context.Context, rt *entities.RefreshToken) error {
+	au.l.Warn().Msgf(
+		"refresh token reuse detected for the user %q on the device %q, revoking the token family",
+		rt.UserID, rt.Device)
+
+	_, err := au.repo.DeleteRefreshToken(ctx, rt.UserID, rt.Device)
+	if err != nil {
+		return errors.WithMessage(err, "revoke refresh token family")
+	}
+
+	_, err = au.repo.DeleteJWT(ctx, &entities.UserToken{UserID: rt.UserID, Device: rt.Device})
+	if err != nil {
+		return errors.WithMessage(err, "revoke refresh token family")
+	}
+
+	return NewErrorRefreshTokenReused(rt.UserID)
+}
+
+// generateToken returns new random, opaque token, eg. the refresh token
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the form of the token kept in storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,97 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+
+	device := mocks.ExampleUserToken.Device
+	first, err := au.CreateRefreshToken(ctx, mocks.UserID, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := au.CreateRefreshToken(ctx, mocks.UserID, "other device")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := au.GetRefreshToken(ctx, mocks.UserID, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Token == first.Token {
+		t.Errorf("want refresh token to be stored hashed, got plain value %q", stored.Token)
+	}
+
+	second, err := au.RotateRefreshToken(ctx, first.Token)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if second.Token == "" || second.Token == first.Token {
+		t.Fatalf("want new refresh token, got %q", second.Token)
+	}
+	if second.UserID != mocks.UserID || second.Device != device {
+		t.Errorf("want token of the user %q on device %q, got %+v", mocks.UserID, device, second)
+	}
+
+	_, err = au.RotateRefreshToken(ctx, "not-issued-token")
+	var irtErr *usecases.InvalidRefreshTokenError
+	if !errors.As(err, &irtErr) {
+		t.Errorf("want error %q for unknown token, got %v", usecases.NewErrorInvalidRefreshToken(), err)
+	}
+
+	// the first token has been rotated already, using it means it has leaked
+	_, err = au.RotateRefreshToken(ctx, first.Token)
+	var rtrErr *usecases.RefreshTokenReusedError
+	if !errors.As(err, &rtrErr) {
+		t.Fatalf("want error %q for reused token, got %v", usecases.NewErrorRefreshTokenReused(mocks.UserID), err)
+	}
+
+	_, err = au.RotateRefreshToken(ctx, second.Token)
+	if !errors.As(err, &irtErr) {
+		t.Errorf("want whole token family to be revoked after reuse, got %v", err)
+	}
+
+	_, err = au.RotateRefreshToken(ctx, other.Token)
+	if err != nil {
+		t.Errorf("want token of the other device to be kept, got %v", err)
+	}
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+
+	revoked, err := au.CreateRefreshToken(ctx, mocks.UserID, "revoked device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := au.CreateRefreshToken(ctx, mocks.UserID, "kept device")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = au.RevokeRefreshToken(ctx, revoked.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = au.RotateRefreshToken(ctx, revoked.Token)
+	var irtErr *usecases.InvalidRefreshTokenError
+	if !errors.As(err, &irtErr) {
+		t.Errorf("want error %q for revoked token, got %v", usecases.NewErrorInvalidRefreshToken(), err)
+	}
+
+	_, err = au.RotateRefreshToken(ctx, kept.Token)
+	if err != nil {
+		t.Errorf("want token of the other device to be kept, got %v", err)
+	}
+}
@@ -2,9 +2,12 @@ package usecases_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/unnamedxaer/gymm-api/mailer"
 	"github.com/unnamedxaer/gymm-api/mocks"
@@ -46,7 +49,7 @@ func TestChangePassword(t *testing.T) {
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 
-			err := authUC.ChangePassword(ctx, mocks.UserID, tC.oldPwd, tC.newPwd)
+			err := authUC.ChangePassword(ctx, &mocks.MockMailer{}, mocks.UserID, tC.oldPwd, tC.newPwd)
 			if tC.errTxt == "" {
 				if err != nil {
 					t.Errorf("want nil error, got %q", err)
@@ -75,6 +78,11 @@ func TestAddResetPasswordRequest(t *testing.T) {
 			emailAddress: mocks.NonexistingEmail,
 			errTxt:       "",
 		},
+		{
+			desc:         "not verified email address",
+			emailAddress: "unverified@email.com",
+			errTxt:       "",
+		},
 		{
 			desc:         "correct",
 			emailAddress: mocks.ExampleUser.EmailAddress,
@@ -127,7 +135,7 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 	}{
 		{
 			desc:   "missing pasword",
-			reqID:  mocks.ExampleResetPwdReq.ID,
+			reqID:  mocks.ExampleResetPwdReq.Token,
 			errTxt: "missing password",
 		},
 		{
@@ -143,7 +151,7 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 		},
 		{
 			desc:     "correct",
-			reqID:    mocks.ExampleResetPwdReq.ID,
+			reqID:    mocks.ExampleResetPwdReq.Token,
 			password: string(mocks.Password),
 		},
 	}
@@ -152,7 +160,7 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 
-			err := authUC.UpdatePasswordForResetRequest(ctx, tC.reqID, tC.password)
+			err := authUC.UpdatePasswordForResetRequest(ctx, &mocks.MockMailer{}, tC.reqID, tC.password)
 			if tC.errTxt == "" {
 				if err != nil {
 					t.Errorf("want nil error, got %q", err)
@@ -166,3 +174,96 @@ func TestUpdatePasswordForResetRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestResetPasswordToken(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	m := &recordingMailer{sent: make(chan []byte, 5)}
+
+	pwdResReq, err := au.AddResetPasswordRequest(ctx, m, mocks.ExampleUser.EmailAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	select {
+	case data = <-m.sent:
+	case <-time.After(time.Second):
+		t.Fatal("want reset password email to be sent")
+	}
+
+	match := regexp.MustCompile(`/password/reset/([0-9a-zA-Z_-]+)`).FindSubmatch(data)
+	if match == nil {
+		t.Fatalf("want reset link in the email, got %s", data)
+	}
+	token := string(match[1])
+	if token != pwdResReq.Token || strings.Contains(string(data), pwdResReq.ID) {
+		t.Errorf("want the link with the token %q instead of the request ID, got %q", pwdResReq.Token, token)
+	}
+	if len(token) < 43 {
+		t.Errorf("want token of at least 256 bits, got %q", token)
+	}
+
+	err = au.UpdatePasswordForResetRequest(ctx, m, token, string(mocks.Password))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	select {
+	case data = <-m.sent:
+	case <-time.After(time.Second):
+		t.Fatal("want password changed email to be sent")
+	}
+	if !strings.Contains(string(data), "password changed") {
+		t.Errorf("want password changed email, got %s", data)
+	}
+
+	err = au.UpdatePasswordForResetRequest(ctx, m, token, string(mocks.Password))
+	if err == nil || !strings.Contains(err.Error(), usecases.NewErrorRecordNotExists("reset password request").Error()) {
+		t.Errorf("want the token to be single use, got %v", err)
+	}
+
+	// the first request counts to the limit as well
+	for i := 1; i < 3; i++ {
+		pwdResReq, err = au.AddResetPasswordRequest(ctx, m, mocks.ExampleUser.EmailAddress)
+		if err != nil || pwdResReq == nil {
+			t.Fatalf("request %d: want saved request, got %v, %v", i+1, pwdResReq, err)
+		}
+	}
+
+	pwdResReq, err = au.AddResetPasswordRequest(ctx, m, mocks.ExampleUser.EmailAddress)
+	if err != nil || pwdResReq != nil {
+		t.Errorf("want request over the limit to be silently dropped, got %v, %v", pwdResReq, err)
+	}
+}
+
+func TestChangePasswordRevokesSessions(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	m := &recordingMailer{sent: make(chan []byte, 1)}
+
+	rt, err := au.CreateRefreshToken(ctx, mocks.UserID, "stolen device")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = au.ChangePassword(ctx, m, mocks.UserID, string(mocks.Password), string(mocks.Password)+"X")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	select {
+	case data := <-m.sent:
+		if !strings.Contains(string(data), "password changed") {
+			t.Errorf("want password changed email, got %s", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want password changed email to be sent")
+	}
+
+	_, err = au.RotateRefreshToken(ctx, rt.Token)
+	var irtErr *usecases.InvalidRefreshTokenError
+	if !errors.As(err, &irtErr) {
+		t.Errorf("want refresh token to be revoked, got %v", err)
+	}
+}
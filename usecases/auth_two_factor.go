@@ -0,0 +1,318 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/totp"
+)
+
+const (
+	// totpIssuer is the name shown next to the codes in the authenticator apps
+	totpIssuer = "The Gymm Api"
+	// recoveryCodesCount is the number of recovery codes generated when the two-factor authentication is enabled
+	recoveryCodesCount = 10
+	// twoFactorChallengeAttempts is the number of codes that can be tried with one challenge,
+	// the challenge is used up by the successful login as well
+	twoFactorChallengeAttempts = 3
+
+	loginAttemptsChallengePrefix = "challenge:"
+)
+
+// TwoFactorSetup is the TOTP secret waiting for the confirmation
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth URI of the secret, meant to be shown as QR code
+	URI string `json:"uri"`
+}
+
+func (au *AuthUsecases) SetupTwoFactor(
+	ctx context.Context,
+	userID string) (*TwoFactorSetup, error) {
+	if au.secrets == nil {
+		return nil, errors.New("two-factor authentication is not configured")
+	}
+
+	user, err := au.getTwoFactorUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, NewErrorTwoFactorAlreadyEnabled()
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.SetupTwoFactor: generate secret")
+	}
+
+	encrypted, err := au.secrets.Encrypt([]byte(secret))
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.SetupTwoFactor: encrypt secret")
+	}
+
+	err = au.repo.SaveTwoFactorSecret(ctx, userID, encrypted)
+	if err != nil {
+		var rneErr *RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			return nil, NewErrorTwoFactorAlreadyEnabled()
+		}
+		return nil, err
+	}
+
+	return &TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.EmailAddress, secret),
+	}, nil
+}
+
+func (au *AuthUsecases) EnableTwoFactor(
+	ctx context.Context,
+	userID string,
+	code string) ([]string, error) {
+	user, err := au.getTwoFactorUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactor == nil {
+		return nil, NewErrorTwoFactorNotEnabled()
+	}
+
+	if user.TwoFactor.Enabled {
+		return nil, NewErrorTwoFactorAlreadyEnabled()
+	}
+
+	step, ok, err := au.validateTOTP(user.TwoFactor, code)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.EnableTwoFactor")
+	}
+	if !ok {
+		return nil, IncorrectCredentialsError{}
+	}
+
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		codes[i], err = generateRecoveryCode()
+		if err != nil {
+			return nil, errors.WithMessage(err, "usecases.EnableTwoFactor: generate recovery code")
+		}
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	err = au.repo.EnableTwoFactor(ctx, userID, step, hashes)
+	if err != nil {
+		var rneErr *RecordNotExistsError
+		if errors.As(err, &rneErr) {
+			// enabled or disabled in the meantime
+			return nil, NewErrorTwoFactorNotEnabled()
+		}
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (au *AuthUsecases) VerifyTwoFactor(
+	ctx context.Context,
+	mailer Mailer,
+	userID string,
+	challengeID string,
+	code string,
+	ip string) error {
+	user, err := au.getTwoFactorUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		return NewErrorTwoFactorNotEnabled()
+	}
+
+	// the codes are guessed under the same limits as the passwords
+	keys := loginAttemptsKeys(user.EmailAddress, ip)
+	err = au.checkLoginAttempts(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	challengeKey := loginAttemptsChallengePrefix + challengeID
+	err = au.useTwoFactorChallenge(ctx, challengeKey)
+	if err != nil {
+		return err
+	}
+
+	// the second step of the login
+	err = au.useTwoFactorCode(ctx, user, code)
+	au.recordLogin(ctx, userID, err == nil)
+	if err != nil {
+		if errors.Is(err, IncorrectCredentialsError{}) {
+			if lfErr := au.addLoginFailure(ctx, mailer, &user.User, keys); lfErr != nil {
+				return lfErr
+			}
+		}
+		return err
+	}
+
+	err = au.repo.LockLogin(ctx, challengeKey, time.Now().Add(loginAttemptsWindow))
+	if err != nil {
+		return err
+	}
+
+	// the password alone does not reset the failures of the user with two-factor authentication
+	err = au.repo.DeleteLoginAttempts(ctx, keys[0])
+	if err != nil {
+		au.l.Err(err).Send()
+	}
+	return nil
+}
+
+// useTwoFactorChallenge counts the attempt made with the challenge, it returns InvalidTwoFactorChallengeError
+// if the challenge has been already used for the login or for too many attempts
+func (au *AuthUsecases) useTwoFactorChallenge(ctx context.Context, key string) error {
+	attempts, err := au.repo.AddLoginFailure(ctx, key, time.Now().Add(loginAttemptsWindow))
+	if err != nil {
+		return err
+	}
+
+	if attempts.Failures > twoFactorChallengeAttempts || attempts.LockedUntil.After(time.Now()) {
+		return NewErrorInvalidTwoFactorChallenge()
+	}
+	return nil
+}
+
+func (au *AuthUsecases) DisableTwoFactor(
+	ctx context.Context,
+	mailer Mailer,
+	userID string,
+	password string,
+	code string,
+	ip string) error {
+	user, err := au.getTwoFactorUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.TwoFactor == nil {
+		return NewErrorTwoFactorNotEnabled()
+	}
+
+	// the stolen session must not be enough to guess the code, so the limits of the login apply
+	keys := loginAttemptsKeys(user.EmailAddress, ip)
+	err = au.checkLoginAttempts(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	ok, err := au.hasher.Compare(user.Password, password)
+	if err != nil {
+		return errors.WithMessage(err, "usecases.DisableTwoFactor")
+	}
+	if !ok {
+		err = IncorrectCredentialsError{}
+	} else if user.TwoFactor.Enabled {
+		// not confirmed setup can be dropped without the code
+		err = au.useTwoFactorCode(ctx, user, code)
+	}
+	if err != nil {
+		if errors.Is(err, IncorrectCredentialsError{}) {
+			if lfErr := au.addLoginFailure(ctx, mailer, &user.User, keys); lfErr != nil {
+				return lfErr
+			}
+		}
+		return err
+	}
+
+	return au.repo.DeleteTwoFactor(ctx, userID)
+}
+
+func (au *AuthUsecases) getTwoFactorUser(
+	ctx context.Context,
+	userID string) (*entities.AuthUser, error) {
+	user, err := au.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, errors.WithMessage(
+			NewErrorRecordNotExists("user"), "usecases.getTwoFactorUser")
+	}
+
+	return user, nil
+}
+
+// useTwoFactorCode accepts either the TOTP code or the recovery code,
+// both are marked as used so they cannot be replayed
+func (au *AuthUsecases) useTwoFactorCode(
+	ctx context.Context,
+	user *entities.AuthUser,
+	code string) error {
+	code = strings.TrimSpace(code)
+
+	var used bool
+	if len(code) == totp.Digits {
+		step, ok, err := au.validateTOTP(user.TwoFactor, code)
+		if err != nil {
+			return errors.WithMessage(err, "usecases.useTwoFactorCode")
+		}
+		if ok {
+			used, err = au.repo.UseTwoFactorStep(ctx, user.ID, step)
+			if err != nil {
+				return err
+			}
+		}
+	} else if code != "" {
+		var err error
+		used, err = au.repo.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+	}
+
+	if !used {
+		return IncorrectCredentialsError{}
+	}
+	return nil
+}
+
+func (au *AuthUsecases) validateTOTP(
+	tf *entities.TwoFactor,
+	code string) (step int64, ok bool, err error) {
+	if au.secrets == nil {
+		return 0, false, errors.New("two-factor authentication is not configured")
+	}
+
+	secret, err := au.secrets.Decrypt(tf.Secret)
+	if err != nil {
+		return 0, false, errors.WithMessage(err, "decrypt secret")
+	}
+
+	step, ok = totp.Validate(string(secret), code, time.Now())
+	return step, ok, nil
+}
+
+// generateRecoveryCode returns new random code formatted like "abcd-efgh"
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return code[:4] + "-" + code[4:], nil
+}
+
+// normalizeRecoveryCode lets the user type the code without the dash or in upper case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
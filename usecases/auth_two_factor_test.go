@@ -0,0 +1,201 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/totp"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestTwoFactor(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	userID := mocks.TwoFactorUserID
+	// every login gets a new challenge
+	var challenges int
+	verify := func(code string) error {
+		challenges++
+		return au.VerifyTwoFactor(ctx, &mocks.MockMailer{}, userID, strconv.Itoa(challenges), code, "")
+	}
+
+	var tfneErr *usecases.TwoFactorNotEnabledError
+	err := verify("123456")
+	if !errors.As(err, &tfneErr) {
+		t.Errorf("want error %q before the setup, got %v", usecases.NewErrorTwoFactorNotEnabled(), err)
+	}
+
+	setup, err := au.SetupTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(setup.URI, "otpauth://totp/") || !strings.Contains(setup.URI, setup.Secret) {
+		t.Errorf("want otpauth URI with the secret %q, got %q", setup.Secret, setup.URI)
+	}
+
+	// the previous period, so the current one is left for the login
+	code, err := totp.Code(setup.Secret, totp.Step(time.Now())-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = au.EnableTwoFactor(ctx, userID, "000000"+code)
+	if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+		t.Errorf("want error %q for invalid code, got %v", usecases.IncorrectCredentialsError{}, err)
+	}
+
+	recoveryCodes, err := au.EnableTwoFactor(ctx, userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recoveryCodes) != 10 {
+		t.Errorf("want %d recovery codes, got %v", 10, recoveryCodes)
+	}
+
+	var tfaeErr *usecases.TwoFactorAlreadyEnabledError
+	_, err = au.SetupTwoFactor(ctx, userID)
+	if !errors.As(err, &tfaeErr) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorTwoFactorAlreadyEnabled(), err)
+	}
+
+	// the code used to enable the two-factor authentication cannot be replayed
+	err = verify(code)
+	if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+		t.Errorf("want reused code to be rejected, got %v", err)
+	}
+
+	current, err := totp.Code(setup.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verify(current); err != nil {
+		t.Errorf("want current code to be accepted, got %v", err)
+	}
+
+	recoveryCode := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	if err = verify(recoveryCode); err != nil {
+		t.Errorf("want recovery code to be accepted, got %v", err)
+	}
+	err = verify(recoveryCodes[0])
+	if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+		t.Errorf("want recovery code to be used only once, got %v", err)
+	}
+
+	err = au.DisableTwoFactor(ctx, nil, userID, string(mocks.Password), "", "")
+	if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+		t.Errorf("want code to be required to disable, got %v", err)
+	}
+	err = au.DisableTwoFactor(ctx, nil, userID, "wrong password", recoveryCodes[1], "")
+	if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+		t.Errorf("want password to be required to disable, got %v", err)
+	}
+	if err = au.DisableTwoFactor(ctx, nil, userID, string(mocks.Password), recoveryCodes[1], ""); err != nil {
+		t.Fatal(err)
+	}
+
+	err = verify(recoveryCodes[2])
+	if !errors.As(err, &tfneErr) {
+		t.Errorf("want error %q after disabling, got %v", usecases.NewErrorTwoFactorNotEnabled(), err)
+	}
+}
+
+func TestTwoFactorAttempts(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	userID := mocks.TwoFactorUserID
+	verify := func(challengeID, code string) error {
+		return au.VerifyTwoFactor(ctx, &mocks.MockMailer{}, userID, challengeID, code, "127.0.0.1")
+	}
+
+	setup, err := au.SetupTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(setup.Secret, totp.Step(time.Now())-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := au.EnableTwoFactor(ctx, userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var itfcErr *usecases.InvalidTwoFactorChallengeError
+	for i := 0; i < 3; i++ {
+		err = verify("capped", "000000")
+		if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+			t.Fatalf("want error %q, got %v", usecases.IncorrectCredentialsError{}, err)
+		}
+	}
+	err = verify("capped", recoveryCodes[0])
+	if !errors.As(err, &itfcErr) {
+		t.Errorf("want error %q after too many attempts, got %v", usecases.NewErrorInvalidTwoFactorChallenge(), err)
+	}
+
+	if err = verify("single-use", recoveryCodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	err = verify("single-use", recoveryCodes[1])
+	if !errors.As(err, &itfcErr) {
+		t.Errorf("want error %q for used challenge, got %v", usecases.NewErrorInvalidTwoFactorChallenge(), err)
+	}
+
+	// the failures of the fresh challenges lock the login as the failed passwords do
+	var llErr *usecases.LoginLockedError
+	for i := 0; i < 5; i++ {
+		err = verify("guess"+strconv.Itoa(i), "000000")
+		if errors.As(err, &llErr) {
+			break
+		}
+		if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+			t.Fatalf("want error %q, got %v", usecases.IncorrectCredentialsError{}, err)
+		}
+	}
+	if llErr == nil {
+		t.Errorf("want error %q after repeated failures, got %v", usecases.NewErrorLoginLocked(0), err)
+	}
+}
+
+func TestDisableTwoFactorAttempts(t *testing.T) {
+	ctx := context.TODO()
+	au := usecases.NewAuthUsecases(&mockedLogger, &mocks.MockAuthRepo{}, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	userID := mocks.TwoFactorUserID
+
+	setup, err := au.SetupTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(setup.Secret, totp.Step(time.Now())-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := au.EnableTwoFactor(ctx, userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var llErr *usecases.LoginLockedError
+	for i := 0; i < 10; i++ {
+		err = au.DisableTwoFactor(ctx, nil, userID, string(mocks.Password), "000000", "127.0.0.1")
+		if errors.As(err, &llErr) {
+			break
+		}
+		if !errors.Is(err, usecases.IncorrectCredentialsError{}) {
+			t.Fatalf("want error %q, got %v", usecases.IncorrectCredentialsError{}, err)
+		}
+	}
+	if llErr == nil {
+		t.Fatalf("want error %q after repeated failures, got %v", usecases.NewErrorLoginLocked(0), err)
+	}
+
+	// the valid code is not tried while locked
+	err = au.DisableTwoFactor(ctx, nil, userID, string(mocks.Password), recoveryCodes[0], "127.0.0.1")
+	if !errors.As(err, &llErr) {
+		t.Errorf("want error %q for the valid code, got %v", usecases.NewErrorLoginLocked(0), err)
+	}
+}
@@ -0,0 +1,179 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// CalendarFeedTokenPrefix starts every calendar feed secret
+const CalendarFeedTokenPrefix = "gymmcal_"
+
+const (
+	// calendarFeedPeriod is how far back the feed reaches,
+	// the calendar apps download the whole feed on every refresh
+	calendarFeedPeriod = 365 * 24 * time.Hour
+	// lbPerKg is the number of pounds in one kilogram
+	lbPerKg = 2.20462262
+)
+
+type CalendarUsecases struct {
+	userRepo     UserRepo
+	trainingRepo TrainingRepo
+	exerciseRepo ExerciseRepo
+}
+
+type ICalendarUsecases interface {
+	// CreateCalendarFeed generates new feed secret of the user, the previous one stops working.
+	// Returned feed is the only place where the plain secret is available
+	CreateCalendarFeed(ctx context.Context, userID string) (*entities.CalendarFeed, error)
+	// RevokeCalendarFeed turns the user's calendar feed off
+	RevokeCalendarFeed(ctx context.Context, userID string) error
+	// GetCalendarEvents returns the owner of the feed secret and the trainings completed in the last year,
+	// it returns InvalidCalendarFeedTokenError if there is no such feed or the account is not active
+	GetCalendarEvents(ctx context.Context, token string) (*entities.User, []entities.CalendarEvent, error)
+}
+
+func (cu *CalendarUsecases) CreateCalendarFeed(
+	ctx context.Context,
+	userID string) (*entities.CalendarFeed, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CreateCalendarFeed: generate token")
+	}
+	plain := CalendarFeedTokenPrefix + token
+
+	user, err := cu.userRepo.SetCalendarFeedToken(ctx, userID, hashToken(plain))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.WithMessage(NewErrorRecordNotExists("user"), "usecases.CreateCalendarFeed")
+	}
+
+	return &entities.CalendarFeed{Token: plain}, nil
+}
+
+func (cu *CalendarUsecases) RevokeCalendarFeed(
+	ctx context.Context,
+	userID string) error {
+	user, err := cu.userRepo.SetCalendarFeedToken(ctx, userID, "")
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.WithMessage(NewErrorRecordNotExists("user"), "usecases.RevokeCalendarFeed")
+	}
+	return nil
+}
+
+func (cu *CalendarUsecases) GetCalendarEvents(
+	ctx context.Context,
+	token string) (*entities.User, []entities.CalendarEvent, error) {
+	if !strings.HasPrefix(token, CalendarFeedTokenPrefix) {
+		return nil, nil, NewErrorInvalidCalendarFeedToken()
+	}
+
+	user, err := cu.userRepo.GetUserByCalendarFeedToken(ctx, hashToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || user.Disabled || user.DeletionScheduledAt != nil {
+		return nil, nil, NewErrorInvalidCalendarFeedToken()
+	}
+
+	var trainings []entities.Training
+	from := time.Now().UTC().Add(-calendarFeedPeriod)
+	err = cu.trainingRepo.ForEachUserTraining(ctx, user.ID, from, time.Time{}, func(t *entities.Training) error {
+		// the training in progress is shown once it ends
+		if !t.EndTime.IsZero() {
+			trainings = append(trainings, *t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "usecases.GetCalendarEvents")
+	}
+
+	exercises := make(map[string]*entities.Exercise)
+	err = lookupExercises(ctx, cu.exerciseRepo, trainings, exercises)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "usecases.GetCalendarEvents")
+	}
+
+	events := make([]entities.CalendarEvent, 0, len(trainings))
+	for i := range trainings {
+		t := &trainings[i]
+		events = append(events, entities.CalendarEvent{
+			TrainingID:  t.ID,
+			Summary:     "Training",
+			Description: describeTraining(t, exercises, user.Preferences.Units),
+			StartTime:   t.StartTime,
+			EndTime:     t.EndTime,
+			UpdatedAt:   t.UpdatedAt,
+		})
+	}
+	return user, events, nil
+}
+
+// describeTraining lists the training comment and its exercises, one per line,
+// eg. "Deadlift: 5 × 100 kg, 5 × 110 kg"
+func describeTraining(
+	t *entities.Training,
+	exercises map[string]*entities.Exercise,
+	units entities.UnitSystem) string {
+	var lines []string
+	if t.Comment != "" {
+		lines = append(lines, t.Comment)
+	}
+
+	for _, te := range t.Exercises {
+		name, setUnit := "Unknown exercise", entities.Weight
+		if ex := exercises[te.ExerciseID]; ex != nil {
+			name, setUnit = ex.Name, ex.SetUnit
+		}
+
+		if len(te.Sets) == 0 {
+			lines = append(lines, name)
+			continue
+		}
+
+		sets := make([]string, 0, len(te.Sets))
+		for _, s := range te.Sets {
+			sets = append(sets, describeSet(&s, setUnit, units))
+		}
+		lines = append(lines, name+": "+strings.Join(sets, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeSet formats the set in the user's units, the reps of the time set are seconds
+func describeSet(s *entities.TrainingSet, setUnit entities.SetUnit, units entities.UnitSystem) string {
+	if setUnit == entities.Time {
+		return fmt.Sprintf("%d s", s.Reps)
+	}
+	if s.Load == 0 {
+		return fmt.Sprintf("%d reps", s.Reps)
+	}
+
+	load, unit := s.Load, "kg"
+	if units == entities.UnitsImperial {
+		load, unit = s.Load*lbPerKg, "lb"
+	}
+	return fmt.Sprintf("%d × %s %s", s.Reps, strconv.FormatFloat(math.Round(load*10)/10, 'f', -1, 64), unit)
+}
+
+// NewCalendarUsecases creates usecases of the users' calendar feeds
+func NewCalendarUsecases(userRepo UserRepo, trainingRepo TrainingRepo, exerciseRepo ExerciseRepo) ICalendarUsecases {
+	return &CalendarUsecases{
+		userRepo:     userRepo,
+		trainingRepo: trainingRepo,
+		exerciseRepo: exerciseRepo,
+	}
+}
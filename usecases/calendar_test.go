@@ -0,0 +1,90 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+// endedTrainingRepo returns the example training as completed and another one still in progress
+type endedTrainingRepo struct {
+	mocks.MockTrainingRepo
+}
+
+func (r *endedTrainingRepo) ForEachUserTraining(
+	ctx context.Context,
+	userID string,
+	from, to time.Time,
+	fn func(t *entities.Training) error) error {
+	ended := mocks.ExampleTraining
+	ended.EndTime = mocks.Now
+	err := fn(&ended)
+	if err != nil {
+		return err
+	}
+
+	open := mocks.ExampleTraining
+	open.ID = "607443ceb40d9ea8602803e8"
+	return fn(&open)
+}
+
+func TestCreateCalendarFeed(t *testing.T) {
+	ctx := context.TODO()
+	cu := usecases.NewCalendarUsecases(&mocks.MockUserRepo{}, &mocks.MockTrainingRepo{}, &mocks.MockExerciseRepo{})
+
+	feed, err := cu.CreateCalendarFeed(ctx, mocks.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Token) <= len(usecases.CalendarFeedTokenPrefix) ||
+		feed.Token[:len(usecases.CalendarFeedTokenPrefix)] != usecases.CalendarFeedTokenPrefix {
+		t.Errorf("want token with prefix %q, got %q", usecases.CalendarFeedTokenPrefix, feed.Token)
+	}
+
+	_, err = cu.CreateCalendarFeed(ctx, mocks.NonexistingUserID+"notfound")
+	var rneErr *usecases.RecordNotExistsError
+	if !errors.As(err, &rneErr) {
+		t.Errorf("want RecordNotExistsError, got %v", err)
+	}
+}
+
+func TestGetCalendarEvents(t *testing.T) {
+	ctx := context.TODO()
+	cu := usecases.NewCalendarUsecases(&mocks.MockUserRepo{}, &endedTrainingRepo{}, &mocks.MockExerciseRepo{})
+
+	user, events, err := cu.GetCalendarEvents(ctx, mocks.CalendarFeedToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != mocks.UserID {
+		t.Errorf("want owner %q, got %q", mocks.UserID, user.ID)
+	}
+
+	// the training in progress is left out
+	if len(events) != 1 {
+		t.Fatalf("want 1 event, got %+v", events)
+	}
+	e := events[0]
+	if e.TrainingID != mocks.ExampleTraining.ID || !e.EndTime.Equal(mocks.Now) {
+		t.Errorf("want event of the ended example training, got %+v", e)
+	}
+	want := mocks.ExampleTraining.Comment + "\n" +
+		"Deadlift: 12 × 100 kg, 10 × 110 kg, 10 reps\n" +
+		"Deadlift"
+	if e.Description != want {
+		t.Errorf("want description %q, got %q", want, e.Description)
+	}
+
+	for _, token := range []string{"", "gymmcal_wrong", mocks.CalendarFeedToken[len(usecases.CalendarFeedTokenPrefix):]} {
+		_, _, err = cu.GetCalendarEvents(ctx, token)
+		var tokenErr *usecases.InvalidCalendarFeedTokenError
+		if !errors.As(err, &tokenErr) {
+			t.Errorf("token %q: want InvalidCalendarFeedTokenError, got %v", token, err)
+		}
+	}
+}
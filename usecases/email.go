@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"text/template"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/unnamedxaer/gymm-api/entities"
@@ -27,8 +28,7 @@ func generatePwdResetEmailContent(
 	clientURL := os.Getenv("CLIENT_URL")
 	appName := "The Gymm Api"
 
-	url := fmt.Sprintf("%s/password/reset/%s", clientURL, pwdResetReq.ID)
-	fmt.Println("URL:", url)
+	url := fmt.Sprintf("%s/password/reset/%s", clientURL, pwdResetReq.Token)
 
 	data := map[string]interface{}{
 		"User":    user,
@@ -43,3 +43,167 @@ func generatePwdResetEmailContent(
 	}
 	return b.Bytes(), nil
 }
+
+func generateTrainingClosedEmailContent(
+	user *entities.User,
+	t *entities.Training) ([]byte, error) {
+
+	tmpl, err := template.ParseFiles("./templates/templatefiles/trainingclosed.html")
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate training closed email content:")
+	}
+
+	clientURL := os.Getenv("CLIENT_URL")
+	appName := "The Gymm Api"
+
+	url := fmt.Sprintf("%s/trainings/%s", clientURL, t.ID)
+
+	data := map[string]interface{}{
+		"User":     user,
+		"AppName":  appName,
+		"URL":      url,
+		"Training": t,
+	}
+
+	b := bytes.Buffer{}
+	err = tmpl.Execute(&b, &data)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate training closed email content:")
+	}
+	return b.Bytes(), nil
+}
+
+func generateEmailVerificationEmailContent(
+	user *entities.User,
+	token string) ([]byte, error) {
+
+	tmpl, err := template.ParseFiles("./templates/templatefiles/verifyemail.html")
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate email verification email content:")
+	}
+
+	clientURL := os.Getenv("CLIENT_URL")
+	appName := "The Gymm Api"
+
+	url := fmt.Sprintf("%s/email/verify/%s", clientURL, token)
+
+	data := map[string]interface{}{
+		"User":    user,
+		"AppName": appName,
+		"URL":     url,
+	}
+
+	b := bytes.Buffer{}
+	err = tmpl.Execute(&b, &data)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate email verification email content:")
+	}
+	return b.Bytes(), nil
+}
+
+func generateLoginLockedEmailContent(
+	user *entities.User,
+	failures int,
+	lockedFor time.Duration) ([]byte, error) {
+
+	tmpl, err := template.ParseFiles("./templates/templatefiles/loginlocked.html")
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate login locked email content:")
+	}
+
+	clientURL := os.Getenv("CLIENT_URL")
+	appName := "The Gymm Api"
+
+	url := fmt.Sprintf("%s/password/reset", clientURL)
+
+	data := map[string]interface{}{
+		"User":      user,
+		"AppName":   appName,
+		"URL":       url,
+		"Failures":  failures,
+		"LockedFor": int(lockedFor.Minutes()),
+	}
+
+	b := bytes.Buffer{}
+	err = tmpl.Execute(&b, &data)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate login locked email content:")
+	}
+	return b.Bytes(), nil
+}
+
+func generatePasswordChangedEmailContent(user *entities.User) ([]byte, error) {
+
+	tmpl, err := template.ParseFiles("./templates/templatefiles/passwordchanged.html")
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate password changed email content:")
+	}
+
+	clientURL := os.Getenv("CLIENT_URL")
+	appName := "The Gymm Api"
+
+	url := fmt.Sprintf("%s/password/reset", clientURL)
+
+	data := map[string]interface{}{
+		"User":    user,
+		"AppName": appName,
+		"URL":     url,
+	}
+
+	b := bytes.Buffer{}
+	err = tmpl.Execute(&b, &data)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate password changed email content:")
+	}
+	return b.Bytes(), nil
+}
+
+func generateEmailChangedEmailContent(user *entities.User, newEmailAddress string) ([]byte, error) {
+
+	tmpl, err := template.ParseFiles("./templates/templatefiles/emailchanged.html")
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate email changed email content:")
+	}
+
+	appName := "The Gymm Api"
+
+	data := map[string]interface{}{
+		"User":            user,
+		"AppName":         appName,
+		"NewEmailAddress": newEmailAddress,
+	}
+
+	b := bytes.Buffer{}
+	err = tmpl.Execute(&b, &data)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate email changed email content:")
+	}
+	return b.Bytes(), nil
+}
+
+func generateAccountDeletionScheduledEmailContent(user *entities.User) ([]byte, error) {
+
+	tmpl, err := template.ParseFiles("./templates/templatefiles/accountdeletion.html")
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate account deletion scheduled email content:")
+	}
+
+	clientURL := os.Getenv("CLIENT_URL")
+	appName := "The Gymm Api"
+
+	url := fmt.Sprintf("%s/login", clientURL)
+
+	data := map[string]interface{}{
+		"User":     user,
+		"AppName":  appName,
+		"URL":      url,
+		"DeleteAt": user.DeletionScheduledAt.Format("January 2, 2006 15:04 MST"),
+	}
+
+	b := bytes.Buffer{}
+	err = tmpl.Execute(&b, &data)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "generate account deletion scheduled email content:")
+	}
+	return b.Bytes(), nil
+}
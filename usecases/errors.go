@@ -1,7 +1,10 @@
 package usecases
 
 import (
+	"time"
+
 	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -52,7 +55,7 @@ func NewErrorRecordNotExists(dataName string) *RecordNotExistsError {
 	}
 }
 
-// IsDuplicatedError checks whether given mongo error says that an insert violated unique constrain
+// IsDuplicatedError checks whether given mongo error says that an insert or update violated unique constrain
 func IsDuplicatedError(err error) bool {
 	var e mongo.WriteException
 
@@ -63,5 +66,348 @@ func IsDuplicatedError(err error) bool {
 			}
 		}
 	}
+
+	// the find and modify commands report it as the command error
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		return ce.Code == 11000
+	}
 	return false
 }
+
+// InvalidSyncTokenError is an error returned when the sync token sent by the client cannot be parsed
+type InvalidSyncTokenError struct {
+	Token string
+}
+
+func (err InvalidSyncTokenError) Error() string {
+	return "invalid sync token: " + err.Token
+}
+
+// NewErrorInvalidSyncToken returns a new error of type *InvalidSyncTokenError
+func NewErrorInvalidSyncToken(token string) *InvalidSyncTokenError {
+	return &InvalidSyncTokenError{
+		Token: token,
+	}
+}
+
+// IdempotencyKeyMismatchError is an error returned when the idempotency key is reused for a different request
+type IdempotencyKeyMismatchError struct {
+	Key string
+}
+
+func (err IdempotencyKeyMismatchError) Error() string {
+	return "idempotency key " + err.Key + " was already used for a different request"
+}
+
+// NewErrorIdempotencyKeyMismatch returns a new error of type *IdempotencyKeyMismatchError
+func NewErrorIdempotencyKeyMismatch(key string) *IdempotencyKeyMismatchError {
+	return &IdempotencyKeyMismatchError{
+		Key: key,
+	}
+}
+
+// IdempotencyKeyInProgressError is an error returned when the request with the same idempotency key is still processed
+type IdempotencyKeyInProgressError struct {
+	Key string
+}
+
+func (err IdempotencyKeyInProgressError) Error() string {
+	return "request with idempotency key " + err.Key + " is in progress"
+}
+
+// NewErrorIdempotencyKeyInProgress returns a new error of type *IdempotencyKeyInProgressError
+func NewErrorIdempotencyKeyInProgress(key string) *IdempotencyKeyInProgressError {
+	return &IdempotencyKeyInProgressError{
+		Key: key,
+	}
+}
+
+// NotOwnerError is an error returned when user tries to access or modify a record that belongs to another user
+type NotOwnerError struct {
+	dataName string
+}
+
+func (err NotOwnerError) Error() string {
+	return "you are not the owner of the " + err.dataName
+}
+
+// NewErrorNotOwner returns a new error of type *NotOwnerError
+func NewErrorNotOwner(dataName string) *NotOwnerError {
+	return &NotOwnerError{
+		dataName: dataName,
+	}
+}
+
+// TrainingCompletedError is an error returned when user tries to modify a training that has already ended
+type TrainingCompletedError struct {
+	ID string
+}
+
+func (err TrainingCompletedError) Error() string {
+	return "training " + err.ID + " already completed"
+}
+
+// NewErrorTrainingCompleted returns a new error of type *TrainingCompletedError
+func NewErrorTrainingCompleted(id string) *TrainingCompletedError {
+	return &TrainingCompletedError{
+		ID: id,
+	}
+}
+
+// TrainingExerciseCompletedError is an error returned when user tries to modify a training exercise that has already ended
+type TrainingExerciseCompletedError struct {
+	ID string
+}
+
+func (err TrainingExerciseCompletedError) Error() string {
+	return "training exercise " + err.ID + " already completed"
+}
+
+// NewErrorTrainingExerciseCompleted returns a new error of type *TrainingExerciseCompletedError
+func NewErrorTrainingExerciseCompleted(id string) *TrainingExerciseCompletedError {
+	return &TrainingExerciseCompletedError{
+		ID: id,
+	}
+}
+
+// TrainingInProgressError is an error returned when user tries to start a new training while another one is not ended yet
+type TrainingInProgressError struct {
+	ID string
+}
+
+func (err TrainingInProgressError) Error() string {
+	return "training " + err.ID + " is still in progress, end it before starting a new one"
+}
+
+// NewErrorTrainingInProgress returns a new error of type *TrainingInProgressError
+func NewErrorTrainingInProgress(id string) *TrainingInProgressError {
+	return &TrainingInProgressError{
+		ID: id,
+	}
+}
+
+// ConcurrentModificationError is an error returned when the record keeps being modified
+// by the other requests while it is being updated
+type ConcurrentModificationError struct {
+	Name string
+}
+
+func (err ConcurrentModificationError) Error() string {
+	return err.Name + " is being modified concurrently, try again"
+}
+
+// NewErrorConcurrentModification returns a new error of type *ConcurrentModificationError
+func NewErrorConcurrentModification(name string) *ConcurrentModificationError {
+	return &ConcurrentModificationError{
+		Name: name,
+	}
+}
+
+// InvalidRefreshTokenError is an error returned when the refresh token does not exist or has expired
+type InvalidRefreshTokenError struct{}
+
+func (err InvalidRefreshTokenError) Error() string {
+	return "invalid refresh token"
+}
+
+// NewErrorInvalidRefreshToken returns a new error of type *InvalidRefreshTokenError
+func NewErrorInvalidRefreshToken() *InvalidRefreshTokenError {
+	return &InvalidRefreshTokenError{}
+}
+
+// RefreshTokenReusedError is an error returned when already rotated refresh token is used again,
+// it means that the token might have been stolen
+type RefreshTokenReusedError struct {
+	UserID string
+}
+
+func (err RefreshTokenReusedError) Error() string {
+	return "refresh token reused, all sessions of the user " + err.UserID + " revoked"
+}
+
+// NewErrorRefreshTokenReused returns a new error of type *RefreshTokenReusedError
+func NewErrorRefreshTokenReused(userID string) *RefreshTokenReusedError {
+	return &RefreshTokenReusedError{
+		UserID: userID,
+	}
+}
+
+// InvalidEmailVerificationTokenError is an error returned when the email verification token does not exist or has expired
+type InvalidEmailVerificationTokenError struct{}
+
+func (err InvalidEmailVerificationTokenError) Error() string {
+	return "invalid email verification token"
+}
+
+// NewErrorInvalidEmailVerificationToken returns a new error of type *InvalidEmailVerificationTokenError
+func NewErrorInvalidEmailVerificationToken() *InvalidEmailVerificationTokenError {
+	return &InvalidEmailVerificationTokenError{}
+}
+
+// EmailAlreadyVerifiedError is an error returned when user requests verification of already verified email address
+type EmailAlreadyVerifiedError struct{}
+
+func (err EmailAlreadyVerifiedError) Error() string {
+	return "email address already verified"
+}
+
+// NewErrorEmailAlreadyVerified returns a new error of type *EmailAlreadyVerifiedError
+func NewErrorEmailAlreadyVerified() *EmailAlreadyVerifiedError {
+	return &EmailAlreadyVerifiedError{}
+}
+
+// TwoFactorAlreadyEnabledError is an error returned when user starts the two-factor setup while it is already enabled
+type TwoFactorAlreadyEnabledError struct{}
+
+func (err TwoFactorAlreadyEnabledError) Error() string {
+	return "two-factor authentication already enabled"
+}
+
+// NewErrorTwoFactorAlreadyEnabled returns a new error of type *TwoFactorAlreadyEnabledError
+func NewErrorTwoFactorAlreadyEnabled() *TwoFactorAlreadyEnabledError {
+	return &TwoFactorAlreadyEnabledError{}
+}
+
+// TwoFactorNotEnabledError is an error returned when the two-factor authentication of the user is not enabled or set up
+type TwoFactorNotEnabledError struct{}
+
+func (err TwoFactorNotEnabledError) Error() string {
+	return "two-factor authentication not enabled"
+}
+
+// NewErrorTwoFactorNotEnabled returns a new error of type *TwoFactorNotEnabledError
+func NewErrorTwoFactorNotEnabled() *TwoFactorNotEnabledError {
+	return &TwoFactorNotEnabledError{}
+}
+
+// InvalidTwoFactorChallengeError is an error returned when the two-factor challenge
+// has been already used for the login or for too many attempts
+type InvalidTwoFactorChallengeError struct{}
+
+func (err InvalidTwoFactorChallengeError) Error() string {
+	return "invalid two-factor challenge, log in again"
+}
+
+// NewErrorInvalidTwoFactorChallenge returns a new error of type *InvalidTwoFactorChallengeError
+func NewErrorInvalidTwoFactorChallenge() *InvalidTwoFactorChallengeError {
+	return &InvalidTwoFactorChallengeError{}
+}
+
+// LoginLockedError is an error returned when login is attempted too early after the previous failures,
+// it is the same for the locked email and IP address
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (err LoginLockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// NewErrorLoginLocked returns a new error of type *LoginLockedError
+func NewErrorLoginLocked(retryAfter time.Duration) *LoginLockedError {
+	return &LoginLockedError{
+		RetryAfter: retryAfter,
+	}
+}
+
+// ExternalEmailNotVerifiedError is an error returned when the OpenID Connect provider
+// has not verified the email address of the account that is not linked yet
+type ExternalEmailNotVerifiedError struct{}
+
+func (err ExternalEmailNotVerifiedError) Error() string {
+	return "email address not verified by the identity provider"
+}
+
+// NewErrorExternalEmailNotVerified returns a new error of type *ExternalEmailNotVerifiedError
+func NewErrorExternalEmailNotVerified() *ExternalEmailNotVerifiedError {
+	return &ExternalEmailNotVerifiedError{}
+}
+
+// InvalidAPIKeyError is an error returned when the API key does not exist or is expired
+type InvalidAPIKeyError struct{}
+
+func (err InvalidAPIKeyError) Error() string {
+	return "invalid api key"
+}
+
+// NewErrorInvalidAPIKey returns a new error of type *InvalidAPIKeyError
+func NewErrorInvalidAPIKey() *InvalidAPIKeyError {
+	return &InvalidAPIKeyError{}
+}
+
+// AccountDisabledError is an error returned when the user's account has been disabled by the admin
+type AccountDisabledError struct{}
+
+func (err AccountDisabledError) Error() string {
+	return "account disabled"
+}
+
+// NewErrorAccountDisabled returns a new error of type *AccountDisabledError
+func NewErrorAccountDisabled() *AccountDisabledError {
+	return &AccountDisabledError{}
+}
+
+// InvalidRoleError is an error returned when the role is not one of the known roles
+type InvalidRoleError struct {
+	Role entities.Role
+}
+
+func (err InvalidRoleError) Error() string {
+	return "invalid role: " + string(err.Role)
+}
+
+// NewErrorInvalidRole returns a new error of type *InvalidRoleError
+func NewErrorInvalidRole(role entities.Role) *InvalidRoleError {
+	return &InvalidRoleError{
+		Role: role,
+	}
+}
+
+// InvalidImportFileError is an error returned when the imported file is not in the format of its source
+type InvalidImportFileError struct {
+	Reason string
+}
+
+func (err InvalidImportFileError) Error() string {
+	return "invalid import file: " + err.Reason
+}
+
+// NewErrorInvalidImportFile returns a new error of type *InvalidImportFileError
+func NewErrorInvalidImportFile(reason string) *InvalidImportFileError {
+	return &InvalidImportFileError{
+		Reason: reason,
+	}
+}
+
+// InvalidCalendarFeedTokenError is an error returned when there is no calendar feed with the secret
+type InvalidCalendarFeedTokenError struct{}
+
+func (err InvalidCalendarFeedTokenError) Error() string {
+	return "invalid calendar feed token"
+}
+
+// NewErrorInvalidCalendarFeedToken returns a new error of type *InvalidCalendarFeedTokenError
+func NewErrorInvalidCalendarFeedToken() *InvalidCalendarFeedTokenError {
+	return &InvalidCalendarFeedTokenError{}
+}
+
+// InvalidSyncRecordError is an error returned when the record sent by the client with the sync breaks the data rules
+type InvalidSyncRecordError struct {
+	DataName string
+	ID       string
+	Reason   string
+}
+
+func (err InvalidSyncRecordError) Error() string {
+	return "invalid " + err.DataName + " " + err.ID + ": " + err.Reason
+}
+
+// NewErrorInvalidSyncRecord returns a new error of type *InvalidSyncRecordError
+func NewErrorInvalidSyncRecord(dataName, id, reason string) *InvalidSyncRecordError {
+	return &InvalidSyncRecordError{
+		DataName: dataName,
+		ID:       id,
+		Reason:   reason,
+	}
+}
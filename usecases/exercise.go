@@ -2,8 +2,10 @@ package usecases
 
 import (
 	"context"
+	"strings"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/unnamedxaer/gymm-api/entities"
 )
 
@@ -13,6 +15,8 @@ type ExerciseInput struct {
 	SetUnit     entities.SetUnit `json:"setUnit" validate:"set_unit,required,oneof=1 2"`
 	CreatedAt   time.Time        `json:"createdAt" validate:"-"`
 	CreatedBy   string           `json:"createdBy" validate:"-"`
+	// Aliases are set by the update only, the empty list removes them
+	Aliases []string `json:"aliases" validate:"omitempty,max=10,dive,min=2,max=50,printascii"`
 }
 
 type ExerciseRepo interface {
@@ -20,10 +24,22 @@ type ExerciseRepo interface {
 	GetExerciseByID(ctx context.Context, id string) (*entities.Exercise, error)
 	GetExercisesByName(ctx context.Context, name string) ([]entities.Exercise, error)
 	UpdateExercise(ctx context.Context, ex *entities.Exercise) (*entities.Exercise, error)
+	// GetExercisesCreatedBy returns the exercises created by the user
+	GetExercisesCreatedBy(ctx context.Context, userID string) ([]entities.Exercise, error)
+	// DeleteExercise removes the exercise, it returns number of deleted exercises
+	DeleteExercise(ctx context.Context, id string) (int64, error)
+	// AnonymiseExercise removes the creator of the exercise, the exercise stays available to everyone
+	AnonymiseExercise(ctx context.Context, id string) error
+	// GetExercisesByIDs returns the exercises with given ids, the not existing ones are left out
+	GetExercisesByIDs(ctx context.Context, ids []string) ([]entities.Exercise, error)
+	// GetExercisesByNames returns the exercises whose name or alias is one of the names, case insensitive
+	GetExercisesByNames(ctx context.Context, names []string) ([]entities.Exercise, error)
 }
 
 type ExerciseUseCases struct {
-	repo ExerciseRepo
+	repo      ExerciseRepo
+	auditRepo AuditRepo
+	l         *zerolog.Logger
 }
 
 type IExerciseUseCases interface {
@@ -39,7 +55,22 @@ func (eu *ExerciseUseCases) CreateExercise(
 	description string,
 	setUnit entities.SetUnit,
 	loggedUserID string) (*entities.Exercise, error) {
-	return eu.repo.CreateExercise(ctx, name, description, setUnit, loggedUserID)
+	ex, err := eu.repo.CreateExercise(ctx, name, description, setUnit, loggedUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAuditEvent(ctx, eu.l, eu.auditRepo, entities.AuditEvent{
+		Action:   entities.AuditActionExerciseCreated,
+		UserID:   loggedUserID,
+		RecordID: ex.ID,
+		After: map[string]interface{}{
+			"name":        ex.Name,
+			"description": ex.Description,
+			"setUnit":     ex.SetUnit,
+		},
+	})
+	return ex, nil
 }
 
 func (eu *ExerciseUseCases) GetExerciseByID(
@@ -56,11 +87,53 @@ func (eu *ExerciseUseCases) GetExercisesByName(
 func (eu *ExerciseUseCases) UpdateExercise(
 	ctx context.Context,
 	ex *entities.Exercise) (*entities.Exercise, error) {
-	return eu.repo.UpdateExercise(ctx, ex)
+	before, err := eu.repo.GetExerciseByID(ctx, ex.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := eu.repo.UpdateExercise(ctx, ex)
+	if err != nil || updated == nil || before == nil {
+		return updated, err
+	}
+
+	changedFrom, changedTo := exerciseDiff(before, updated)
+	if len(changedTo) > 0 {
+		recordAuditEvent(ctx, eu.l, eu.auditRepo, entities.AuditEvent{
+			Action:   entities.AuditActionExerciseUpdated,
+			UserID:   before.CreatedBy,
+			RecordID: updated.ID,
+			Before:   changedFrom,
+			After:    changedTo,
+		})
+	}
+	return updated, nil
+}
+
+// exerciseDiff returns the values of the changed fields before and after the update
+func exerciseDiff(before, after *entities.Exercise) (map[string]interface{}, map[string]interface{}) {
+	from := map[string]interface{}{}
+	to := map[string]interface{}{}
+	if before.Name != after.Name {
+		from["name"], to["name"] = before.Name, after.Name
+	}
+	if before.Description != after.Description {
+		from["description"], to["description"] = before.Description, after.Description
+	}
+	if before.SetUnit != after.SetUnit {
+		from["setUnit"], to["setUnit"] = before.SetUnit, after.SetUnit
+	}
+	if strings.Join(before.Aliases, "\n") != strings.Join(after.Aliases, "\n") {
+		from["aliases"], to["aliases"] = before.Aliases, after.Aliases
+	}
+	return from, to
 }
 
-func NewExerciseUseCases(exRepo ExerciseRepo) IExerciseUseCases {
+// NewExerciseUseCases creates exercise usecases, the changes of the exercises are recorded as audit events
+func NewExerciseUseCases(l *zerolog.Logger, exRepo ExerciseRepo, auditRepo AuditRepo) IExerciseUseCases {
 	return &ExerciseUseCases{
-		repo: exRepo,
+		repo:      exRepo,
+		auditRepo: auditRepo,
+		l:         l,
 	}
 }
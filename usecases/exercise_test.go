@@ -64,3 +64,39 @@ func TestUpdateExercise(t *testing.T) {
 		t.Fatalf("want\n%v got\n%v", exerciseInput, got)
 	}
 }
+
+func TestExerciseChangesAreAudited(t *testing.T) {
+	ctx := usecases.WithAuditActor(context.TODO(), &usecases.AuditActor{UserID: mocks.UserID})
+	auditRepo := &mocks.MockAuditRepo{}
+	eu := usecases.NewExerciseUseCases(&mockedLogger, &mocks.MockExerciseRepo{}, auditRepo)
+
+	created, err := eu.CreateExercise(ctx, exerciseInput.Name, exerciseInput.Description, exerciseInput.SetUnit, exerciseInput.CreatedBy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := entities.Exercise{ID: created.ID, Name: "Romanian deadlift"}
+	_, err = eu.UpdateExercise(ctx, &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 2 {
+		t.Fatalf("want 2 audit events, got %+v", events)
+	}
+
+	if events[0].Action != entities.AuditActionExerciseCreated || events[0].RecordID != created.ID ||
+		events[0].After["name"] != exerciseInput.Name {
+		t.Errorf("want create event of %q, got %+v", created.ID, events[0])
+	}
+
+	e := events[1]
+	if e.Action != entities.AuditActionExerciseUpdated || e.RecordID != created.ID || e.ActorID != mocks.UserID {
+		t.Errorf("want update event of %q, got %+v", created.ID, e)
+	}
+	if len(e.Before) != 1 || e.Before["name"] != mocks.ExampleExercise.Name || e.After["name"] != input.Name {
+		t.Errorf("want only the name changed from %q to %q, got %v -> %v",
+			mocks.ExampleExercise.Name, input.Name, e.Before, e.After)
+	}
+}
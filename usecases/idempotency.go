@@ -0,0 +1,141 @@
+package usecases
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// IdempotencyKeyTTL is a time for which the response of the request
+// sent with the idempotency key is kept in storage
+const IdempotencyKeyTTL = 24 * time.Hour // @todo: config
+
+// IdempotencyLockTTL is a time for which the request in progress holds the key,
+// the handler that panicked or the crashed server does not block the retries for the whole IdempotencyKeyTTL
+const IdempotencyLockTTL = time.Minute
+
+// IdempotencyRepo represents storage of the idempotency keys
+type IdempotencyRepo interface {
+	// CreateIdempotencyRecord inserts new record,
+	// it fails with duplicated error if the key is already used by the user
+	CreateIdempotencyRecord(ctx context.Context, rec *entities.IdempotencyRecord) (*entities.IdempotencyRecord, error)
+	// GetIdempotencyRecord returns record for given user and key, it returns nil if the record has expired
+	GetIdempotencyRecord(ctx context.Context, userID, key string) (*entities.IdempotencyRecord, error)
+	// ReplaceExpiredIdempotencyRecord replaces the expired record of the user and key that is still stored,
+	// the record is inserted if there is none. It fails with duplicated error if the key is in use
+	ReplaceExpiredIdempotencyRecord(ctx context.Context, rec *entities.IdempotencyRecord) error
+	// LockIdempotencyRecord renews the lease of the user's record in progress whose lease has ended,
+	// false is returned if there is no such record
+	LockIdempotencyRecord(ctx context.Context, userID, key string, lockedUntil time.Time) (bool, error)
+	// SaveIdempotencyResponse stores the response for the given user and key
+	SaveIdempotencyResponse(ctx context.Context, userID, key string, statusCode int, header map[string][]string, body []byte) error
+	// DeleteIdempotencyRecord removes record for given user and key
+	DeleteIdempotencyRecord(ctx context.Context, userID, key string) (int64, error)
+}
+
+type IdempotencyUsecases struct {
+	repo IdempotencyRepo
+}
+
+type IIdempotencyUsecases interface {
+	// Begin reserves the key for the request.
+	// If the key was already used for the same request the stored record
+	// is returned, otherwise the returned record is nil.
+	Begin(ctx context.Context, userID, key, method, path string, requestHash []byte) (*entities.IdempotencyRecord, error)
+	// Complete stores the response of the request started with Begin
+	Complete(ctx context.Context, userID, key string, statusCode int, header map[string][]string, body []byte) error
+	// Abandon releases the key so the request can be retried
+	Abandon(ctx context.Context, userID, key string) error
+}
+
+func (iu *IdempotencyUsecases) Begin(
+	ctx context.Context,
+	userID, key, method, path string,
+	requestHash []byte) (*entities.IdempotencyRecord, error) {
+	now := time.Now()
+	rec := entities.IdempotencyRecord{
+		Key:         key,
+		UserID:      userID,
+		Method:      method,
+		Path:        path,
+		RequestHash: requestHash,
+		LockedUntil: now.Add(IdempotencyLockTTL),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(IdempotencyKeyTTL),
+	}
+
+	_, err := iu.repo.CreateIdempotencyRecord(ctx, &rec)
+	if err == nil {
+		return nil, nil
+	}
+	if !IsDuplicatedError(err) {
+		return nil, errors.WithMessage(err, "idempotency begin")
+	}
+
+	stored, err := iu.repo.GetIdempotencyRecord(ctx, userID, key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "idempotency begin")
+	}
+	if stored == nil {
+		// the record has expired, but the ttl monitor may not have removed it yet
+		err = iu.repo.ReplaceExpiredIdempotencyRecord(ctx, &rec)
+		if err == nil {
+			return nil, nil
+		}
+		if IsDuplicatedError(err) {
+			// another request has taken the key in the meantime
+			return nil, NewErrorIdempotencyKeyInProgress(key)
+		}
+		return nil, errors.WithMessage(err, "idempotency begin")
+	}
+
+	if stored.Method != method || stored.Path != path ||
+		!bytes.Equal(stored.RequestHash, requestHash) {
+		return nil, NewErrorIdempotencyKeyMismatch(key)
+	}
+
+	if stored.StatusCode == 0 {
+		if stored.LockedUntil.After(now) {
+			return nil, NewErrorIdempotencyKeyInProgress(key)
+		}
+
+		// the lease has ended without the response, the request is taken over by this retry
+		locked, err := iu.repo.LockIdempotencyRecord(ctx, userID, key, rec.LockedUntil)
+		if err != nil {
+			return nil, errors.WithMessage(err, "idempotency begin")
+		}
+		if !locked {
+			// another retry has taken the key in the meantime
+			return nil, NewErrorIdempotencyKeyInProgress(key)
+		}
+		return nil, nil
+	}
+
+	return stored, nil
+}
+
+func (iu *IdempotencyUsecases) Complete(
+	ctx context.Context,
+	userID, key string,
+	statusCode int,
+	header map[string][]string,
+	body []byte) error {
+	return iu.repo.SaveIdempotencyResponse(ctx, userID, key, statusCode, header, body)
+}
+
+func (iu *IdempotencyUsecases) Abandon(
+	ctx context.Context,
+	userID, key string) error {
+	_, err := iu.repo.DeleteIdempotencyRecord(ctx, userID, key)
+	return err
+}
+
+// NewIdempotencyUsecases creates idempotency usecases
+func NewIdempotencyUsecases(repo IdempotencyRepo) IIdempotencyUsecases {
+	return &IdempotencyUsecases{
+		repo: repo,
+	}
+}
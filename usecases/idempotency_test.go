@@ -0,0 +1,166 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestIdempotencyBegin(t *testing.T) {
+	ctx := context.TODO()
+	iu := usecases.NewIdempotencyUsecases(&mocks.MockIdempotencyRepo{})
+	key := "a1c9a6e2-5d5b-4b8e-9d43-1b2f0f6b7c10"
+	hash := []byte("request hash")
+
+	rec, err := iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec != nil {
+		t.Fatalf("want nil record for the new key, got %v", rec)
+	}
+
+	_, err = iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", hash)
+	var inProgressErr *usecases.IdempotencyKeyInProgressError
+	if !errors.As(err, &inProgressErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorIdempotencyKeyInProgress(key), err)
+	}
+
+	_, err = iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", []byte("other hash"))
+	var mismatchErr *usecases.IdempotencyKeyMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorIdempotencyKeyMismatch(key), err)
+	}
+
+	body := []byte(`{"id":"1"}`)
+	err = iu.Complete(ctx, mocks.UserID, key, http.StatusCreated, nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err = iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.StatusCode != http.StatusCreated || string(rec.Body) != string(body) {
+		t.Fatalf("want stored response %d %q, got %v", http.StatusCreated, body, rec)
+	}
+
+	// the key is scoped per user
+	rec, err = iu.Begin(ctx, mocks.UserID+"1", key, http.MethodPost, "/trainings", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec != nil {
+		t.Fatalf("want nil record for the other user, got %v", rec)
+	}
+}
+
+func TestIdempotencyAbandon(t *testing.T) {
+	ctx := context.TODO()
+	iu := usecases.NewIdempotencyUsecases(&mocks.MockIdempotencyRepo{})
+	key := "7e0f1c2d-8a3b-4c5d-9e6f-0a1b2c3d4e5f"
+
+	_, err := iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = iu.Abandon(ctx, mocks.UserID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", nil)
+	if err != nil {
+		t.Fatalf("want the key to be released, got %v", err)
+	}
+	if rec != nil {
+		t.Fatalf("want nil record, got %v", rec)
+	}
+}
+
+func TestIdempotencyBeginExpiredKey(t *testing.T) {
+	ctx := context.TODO()
+	repo := &mocks.MockIdempotencyRepo{}
+	iu := usecases.NewIdempotencyUsecases(repo)
+	key := "5f0e1a3c-8d4b-4c2a-9b7e-2a6d1c3e4f50"
+	hash := []byte("request hash")
+
+	// the expired record is still stored as the ttl monitor has not run yet
+	_, err := repo.CreateIdempotencyRecord(ctx, &entities.IdempotencyRecord{
+		Key:         key,
+		UserID:      mocks.UserID,
+		Method:      http.MethodPost,
+		Path:        "/trainings",
+		RequestHash: []byte("old request hash"),
+		StatusCode:  http.StatusCreated,
+		ExpiresAt:   time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec != nil {
+		t.Fatalf("want nil record for the expired key, got %v", rec)
+	}
+
+	_, err = iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", hash)
+	var inProgressErr *usecases.IdempotencyKeyInProgressError
+	if !errors.As(err, &inProgressErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorIdempotencyKeyInProgress(key), err)
+	}
+}
+
+func TestIdempotencyBeginLostRequest(t *testing.T) {
+	ctx := context.TODO()
+	repo := &mocks.MockIdempotencyRepo{}
+	iu := usecases.NewIdempotencyUsecases(repo)
+	key := "0c4f5e2a-6b1d-4f3e-8a9c-7d2e1b0a3f64"
+	hash := []byte("request hash")
+
+	// the request has not completed before its lease ended, e.g. the server crashed
+	_, err := repo.CreateIdempotencyRecord(ctx, &entities.IdempotencyRecord{
+		Key:         key,
+		UserID:      mocks.UserID,
+		Method:      http.MethodPost,
+		Path:        "/trainings",
+		RequestHash: hash,
+		LockedUntil: time.Now().Add(-time.Second),
+		ExpiresAt:   time.Now().Add(usecases.IdempotencyKeyTTL),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", []byte("other hash"))
+	var mismatchErr *usecases.IdempotencyKeyMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorIdempotencyKeyMismatch(key), err)
+	}
+
+	rec, err := iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", hash)
+	if err != nil {
+		t.Fatalf("want the retry to take the key over, got %v", err)
+	}
+	if rec != nil {
+		t.Fatalf("want nil record, got %v", rec)
+	}
+
+	// the retry holds the new lease
+	_, err = iu.Begin(ctx, mocks.UserID, key, http.MethodPost, "/trainings", hash)
+	var inProgressErr *usecases.IdempotencyKeyInProgressError
+	if !errors.As(err, &inProgressErr) {
+		t.Fatalf("want error %q, got %v", usecases.NewErrorIdempotencyKeyInProgress(key), err)
+	}
+}
@@ -0,0 +1,64 @@
+package usecases
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultBcryptCost is the cost of the password hashes if not configured otherwise
+const DefaultBcryptCost = 12
+
+// PasswordHasher hashes the user passwords,
+// other algorithms (e.g. argon2id) can be introduced by implementing it
+type PasswordHasher interface {
+	// Hash returns the hash of the password
+	Hash(pwd string) ([]byte, error)
+	// Compare reports whether the password matches the hash
+	Compare(hash []byte, pwd string) (bool, error)
+	// NeedsRehash reports whether the hash was created with weaker settings
+	// or other algorithm than the current ones, so it should be replaced
+	NeedsRehash(hash []byte) bool
+}
+
+// BcryptHasher is the PasswordHasher using bcrypt
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher returns the bcrypt hasher with given cost
+func NewBcryptHasher(cost int) (*BcryptHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf(
+			"bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cost)
+	}
+
+	return &BcryptHasher{
+		cost: cost,
+	}, nil
+}
+
+func (h *BcryptHasher) Hash(pwd string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(pwd), h.cost)
+}
+
+func (h *BcryptHasher) Compare(hash []byte, pwd string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(pwd))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *BcryptHasher) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		// not a bcrypt hash
+		return true
+	}
+	return cost < h.cost
+}
@@ -0,0 +1,147 @@
+package usecases_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptHasher(t *testing.T) {
+	for _, cost := range []int{bcrypt.MinCost - 1, bcrypt.MaxCost + 1} {
+		if _, err := usecases.NewBcryptHasher(cost); err == nil {
+			t.Errorf("want error for cost %d", cost)
+		}
+	}
+
+	h, err := usecases.NewBcryptHasher(bcrypt.MinCost + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := h.Hash(string(mocks.Password))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for pwd, want := range map[string]bool{string(mocks.Password): true, "wrong password": false} {
+		ok, err := h.Compare(hash, pwd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != want {
+			t.Errorf("%q: want match %t, got %t", pwd, want, ok)
+		}
+	}
+
+	if h.NeedsRehash(hash) {
+		t.Errorf("want no rehash of the hash with the current cost")
+	}
+	if !h.NeedsRehash(mocks.PasswordHash) {
+		t.Errorf("want rehash of the hash with lower cost")
+	}
+	if !h.NeedsRehash([]byte("$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA")) {
+		t.Errorf("want rehash of the hash of other algorithm")
+	}
+}
+
+// passwordRecordingRepo keeps the hashes read by GetUserByEmailAddress and saved by ReplacePasswordHash,
+// changed pretends the password was changed after it had been verified
+type passwordRecordingRepo struct {
+	mocks.MockAuthRepo
+	readHashes [][]byte
+	hashes     [][]byte
+	oldHashes  [][]byte
+	changed    bool
+}
+
+func (r *passwordRecordingRepo) GetUserByEmailAddress(
+	ctx context.Context,
+	emailAddress string) (*entities.AuthUser, error) {
+	u, err := r.MockAuthRepo.GetUserByEmailAddress(ctx, emailAddress)
+	if u != nil {
+		r.readHashes = append(r.readHashes, u.Password)
+	}
+	return u, err
+}
+
+func (r *passwordRecordingRepo) ReplacePasswordHash(
+	ctx context.Context,
+	userID string,
+	oldHash,
+	newHash []byte) (bool, error) {
+	r.oldHashes = append(r.oldHashes, oldHash)
+	if r.changed {
+		return false, nil
+	}
+	r.hashes = append(r.hashes, newHash)
+	return true, nil
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	ctx := context.TODO()
+	u := &usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	}
+
+	repo := &passwordRecordingRepo{}
+	au := usecases.NewAuthUsecases(&mockedLogger, repo, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
+	_, err := au.Login(ctx, nil, u, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.hashes) != 0 {
+		t.Errorf("want no rehash of the hash with the current cost, got %d", len(repo.hashes))
+	}
+
+	h, err := usecases.NewBcryptHasher(bcrypt.MinCost + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	au = usecases.NewAuthUsecases(&mockedLogger, repo, &mocks.MockAuditRepo{}, mockedCipher, h)
+	_, err = au.Login(ctx, nil, u, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.hashes) != 1 {
+		t.Fatalf("want the password to be rehashed once, got %d", len(repo.hashes))
+	}
+	if cost, _ := bcrypt.Cost(repo.hashes[0]); cost != bcrypt.MinCost+1 {
+		t.Errorf("want new hash with cost %d, got %d", bcrypt.MinCost+1, cost)
+	}
+	if ok, _ := h.Compare(repo.hashes[0], u.Password); !ok {
+		t.Errorf("want new hash to match the password")
+	}
+	if string(repo.oldHashes[0]) != string(repo.readHashes[len(repo.readHashes)-1]) {
+		t.Errorf("want the verified hash to be replaced, got %q", repo.oldHashes[0])
+	}
+}
+
+func TestLoginKeepsPasswordChangedBeforeRehash(t *testing.T) {
+	ctx := context.TODO()
+	u := &usecases.UserInput{
+		EmailAddress: mocks.ExampleUser.EmailAddress,
+		Password:     string(mocks.Password),
+	}
+
+	h, err := usecases.NewBcryptHasher(bcrypt.MinCost + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &passwordRecordingRepo{changed: true}
+	au := usecases.NewAuthUsecases(&mockedLogger, repo, &mocks.MockAuditRepo{}, mockedCipher, h)
+	_, err = au.Login(ctx, nil, u, "")
+	if err != nil {
+		t.Fatalf("want the login to succeed, got %v", err)
+	}
+	if len(repo.oldHashes) != 1 {
+		t.Fatalf("want one rehash attempt, got %d", len(repo.oldHashes))
+	}
+	if len(repo.hashes) != 0 {
+		t.Errorf("want the changed password to be kept, got %d new hashes", len(repo.hashes))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/unnamedxaer/gymm-api/entities"
 )
 
@@ -19,7 +20,8 @@ type TrainingInput struct {
 type TrainingRepo interface {
 	// GetTrainingByID returns training for given id
 	GetTrainingByID(ctx context.Context, id string) (*entities.Training, error)
-	// StartTraining starts new training by inserting new record in training storage with start time.
+	// StartTraining starts new training by inserting new record in training storage with start time,
+	// it returns the duplicated error if the user has another training in progress.
 	StartTraining(ctx context.Context, userID string, startTime time.Time) (*entities.Training, error)
 	// EndTraining marks given training as completed by setting training end time.
 	EndTraining(ctx context.Context, trainingID string, endTime time.Time) (*entities.Training, error)
@@ -28,38 +30,114 @@ type TrainingRepo interface {
 	AddSet(ctx context.Context, userID, teID string, set *entities.TrainingSet) (*entities.TrainingSet, error)
 	GetTrainingExercises(ctx context.Context, id string) ([]entities.TrainingExercise, error)
 	EndExercise(ctx context.Context, userID, id string, endTime time.Time) (*entities.TrainingExercise, error)
+	// GetTrainingByClientID returns user training for given client generated id
+	GetTrainingByClientID(ctx context.Context, userID, clientID string) (*entities.Training, error)
+	// CreateTraining inserts the whole training with its exercises and sets.
+	CreateTraining(ctx context.Context, t *entities.Training) (*entities.Training, error)
+	// ReplaceTraining overrides stored user training with given one
+	// as long as it was not modified since lastUpdatedAt, otherwise nil is returned
+	ReplaceTraining(ctx context.Context, t *entities.Training, lastUpdatedAt time.Time) (*entities.Training, error)
+	// GetUserTrainingsChangedSince returns up to limit user trainings modified after given time
+	// or at that time with ids greater than non empty afterID, in order of modification.
+	// For zero time it returns all user trainings, the non positive limit returns all of them.
+	GetUserTrainingsChangedSince(
+		ctx context.Context, userID string, since time.Time, afterID string, limit int64) ([]entities.Training, error)
+	// GetUserOpenTraining returns user training that is not ended yet
+	GetUserOpenTraining(ctx context.Context, userID string) (*entities.Training, error)
+	// GetTrainingByExerciseID returns training that contains training exercise with given id
+	GetTrainingByExerciseID(ctx context.Context, teID string) (*entities.Training, error)
+	// GetInactiveTrainings returns not ended trainings that were not modified since given time
+	GetInactiveTrainings(ctx context.Context, before time.Time) ([]entities.Training, error)
+	// CloseInactiveTraining overrides stored training with given ended one
+	// as long as it was not modified since lastUpdatedAt, otherwise nil is returned
+	CloseInactiveTraining(ctx context.Context, t *entities.Training, lastUpdatedAt time.Time) (*entities.Training, error)
+	// DeleteUserTrainings removes all trainings of the user, it returns number of deleted trainings
+	DeleteUserTrainings(ctx context.Context, userID string) (int64, error)
+	// IsExerciseUsed tells whether any training contains the exercise
+	IsExerciseUsed(ctx context.Context, exerciseID string) (bool, error)
+	// ForEachUserTraining calls fn for every user training started within [from, to) in order of their start,
+	// the zero times do not limit the range. It stops at the first error of fn
+	ForEachUserTraining(ctx context.Context, userID string, from, to time.Time, fn func(t *entities.Training) error) error
 }
 
 type TrainingUsecases struct {
-	repo TrainingRepo
+	repo         TrainingRepo
+	exerciseRepo ExerciseRepo
 }
 
 type ITrainingUsecases interface {
-	GetTrainingByID(ctx context.Context, id string) (*entities.Training, error)
+	GetTrainingByID(ctx context.Context, userID, id string) (*entities.Training, error)
 	StartTraining(ctx context.Context, userID string) (*entities.Training, error)
-	EndTraining(ctx context.Context, id string) (*entities.Training, error)
+	EndTraining(ctx context.Context, userID, id string) (*entities.Training, error)
 	GetUserTrainings(ctx context.Context, userID string, started bool) (t []entities.Training, err error)
-	StartExercise(ctx context.Context, trID string, exercise *entities.TrainingExercise) (*entities.TrainingExercise, error)
+	StartExercise(ctx context.Context, userID, trID string, exercise *entities.TrainingExercise) (*entities.TrainingExercise, error)
 	AddSet(ctx context.Context, userID, teID string, set *entities.TrainingSet) (*entities.TrainingSet, error)
 	GetTrainingExercises(ctx context.Context, id string) ([]entities.TrainingExercise, error)
 	EndExercise(ctx context.Context, userID, id string, endTime time.Time) (*entities.TrainingExercise, error)
+	// Sync applies trainings created or modified offline by the client
+	// and returns trainings changed since the client's last sync
+	Sync(ctx context.Context, userID string, input *SyncInput) (*entities.SyncResult, error)
+	// CloseAbandonedTrainings ends trainings with no activity for the inactiveFor period
+	CloseAbandonedTrainings(ctx context.Context, inactiveFor time.Duration) ([]entities.Training, error)
 }
 
-// GetTrainingByID returns training for given id
+// GetTrainingByID returns user training for given id,
+// nil is returned if the training does not exist
 func (tu *TrainingUsecases) GetTrainingByID(ctx context.Context,
-	id string) (*entities.Training, error) {
-	return tu.repo.GetTrainingByID(ctx, id)
+	userID, id string) (*entities.Training, error) {
+	t, err := tu.repo.GetTrainingByID(ctx, id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get training by id")
+	}
+
+	if t != nil && t.UserID != userID {
+		return nil, errors.WithMessage(NewErrorNotOwner("training"), "get training by id")
+	}
+
+	return t, nil
 }
 
-// StartTraining creates a new training.
+// StartTraining creates a new training,
+// user can have only one training in progress.
 func (tu *TrainingUsecases) StartTraining(ctx context.Context,
 	userID string) (*entities.Training, error) {
-	return tu.repo.StartTraining(ctx, userID, time.Now())
+	open, err := tu.repo.GetUserOpenTraining(ctx, userID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "start training")
+	}
+
+	if open != nil {
+		return nil, errors.WithMessage(NewErrorTrainingInProgress(open.ID), "start training")
+	}
+
+	t, err := tu.repo.StartTraining(ctx, userID, time.Now())
+	if err != nil {
+		if !IsDuplicatedError(err) {
+			return nil, err
+		}
+
+		// the other training has been started concurrently
+		open, err = tu.repo.GetUserOpenTraining(ctx, userID)
+		if err != nil {
+			return nil, errors.WithMessage(err, "start training")
+		}
+		id := ""
+		if open != nil {
+			id = open.ID
+		}
+		return nil, errors.WithMessage(NewErrorTrainingInProgress(id), "start training")
+	}
+	return t, nil
 }
 
-// EndTraining stops current training.
+// EndTraining stops user's training.
 func (tu *TrainingUsecases) EndTraining(ctx context.Context,
-	id string) (*entities.Training, error) {
+	userID, id string) (*entities.Training, error) {
+	_, err := tu.getOpenTraining(ctx, userID, id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "end training")
+	}
+
 	return tu.repo.EndTraining(ctx, id, time.Now())
 }
 
@@ -68,13 +146,25 @@ func (tu *TrainingUsecases) GetUserTrainings(ctx context.Context,
 	return tu.repo.GetUserTrainings(ctx, userID, started)
 }
 
+// StartExercise adds new exercise to the user's training that is in progress.
 func (tu *TrainingUsecases) StartExercise(ctx context.Context,
-	trID string, exercise *entities.TrainingExercise) (*entities.TrainingExercise, error) {
+	userID, trID string, exercise *entities.TrainingExercise) (*entities.TrainingExercise, error) {
+	_, err := tu.getOpenTraining(ctx, userID, trID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "start exercise")
+	}
+
 	return tu.repo.StartExercise(ctx, trID, exercise)
 }
 
+// AddSet adds new set to the user's training exercise that is in progress.
 func (tu *TrainingUsecases) AddSet(ctx context.Context,
 	userID, teID string, set *entities.TrainingSet) (*entities.TrainingSet, error) {
+	_, err := tu.getOpenExercise(ctx, userID, teID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "add set")
+	}
+
 	return tu.repo.AddSet(ctx, userID, teID, set)
 }
 
@@ -83,13 +173,78 @@ func (tu *TrainingUsecases) GetTrainingExercises(ctx context.Context,
 	return tu.repo.GetTrainingExercises(ctx, id)
 }
 
+// EndExercise stops user's training exercise.
 func (tu *TrainingUsecases) EndExercise(ctx context.Context,
 	userID, id string, endTime time.Time) (*entities.TrainingExercise, error) {
+	_, err := tu.getOpenExercise(ctx, userID, id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "end exercise")
+	}
+
 	return tu.repo.EndExercise(ctx, userID, id, endTime)
 }
 
-func NewTrainingUseCases(repo TrainingRepo) ITrainingUsecases {
+// getOpenTraining returns user's training that is not ended yet
+func (tu *TrainingUsecases) getOpenTraining(ctx context.Context,
+	userID, id string) (*entities.Training, error) {
+	t, err := tu.repo.GetTrainingByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil {
+		return nil, NewErrorRecordNotExists("training")
+	}
+
+	if t.UserID != userID {
+		return nil, NewErrorNotOwner("training")
+	}
+
+	if !t.EndTime.IsZero() {
+		return nil, NewErrorTrainingCompleted(t.ID)
+	}
+
+	return t, nil
+}
+
+// getOpenExercise returns user's training exercise that is not ended yet
+// and belongs to the training in progress
+func (tu *TrainingUsecases) getOpenExercise(ctx context.Context,
+	userID, teID string) (*entities.TrainingExercise, error) {
+	t, err := tu.repo.GetTrainingByExerciseID(ctx, teID)
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil {
+		return nil, NewErrorRecordNotExists("training exercise")
+	}
+
+	if t.UserID != userID {
+		return nil, NewErrorNotOwner("training exercise")
+	}
+
+	if !t.EndTime.IsZero() {
+		return nil, NewErrorTrainingCompleted(t.ID)
+	}
+
+	for i := range t.Exercises {
+		if t.Exercises[i].ID != teID {
+			continue
+		}
+
+		if !t.Exercises[i].EndTime.IsZero() {
+			return nil, NewErrorTrainingExerciseCompleted(teID)
+		}
+		return &t.Exercises[i], nil
+	}
+
+	return nil, NewErrorRecordNotExists("training exercise")
+}
+
+func NewTrainingUseCases(repo TrainingRepo, exerciseRepo ExerciseRepo) ITrainingUsecases {
 	return &TrainingUsecases{
-		repo: repo,
+		repo:         repo,
+		exerciseRepo: exerciseRepo,
 	}
 }
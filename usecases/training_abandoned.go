@@ -0,0 +1,134 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// CloseAbandonedTrainings ends trainings that have had no activity for the inactiveFor period.
+// Training and its open exercises are ended at the time of their last set
+// so the durations are not inflated by the time the training was left open.
+func (tu *TrainingUsecases) CloseAbandonedTrainings(
+	ctx context.Context,
+	inactiveFor time.Duration) ([]entities.Training, error) {
+	now := time.Now()
+	inactive, err := tu.repo.GetInactiveTrainings(ctx, now.Add(-inactiveFor))
+	if err != nil {
+		return nil, errors.WithMessage(err, "close abandoned trainings")
+	}
+
+	closed := make([]entities.Training, 0, len(inactive))
+	for i := range inactive {
+		if err = ctx.Err(); err != nil {
+			return closed, errors.WithMessage(err, "close abandoned trainings")
+		}
+
+		lastUpdatedAt := inactive[i].UpdatedAt
+		t := endAbandonedTraining(&inactive[i], now)
+		t, err = tu.repo.CloseInactiveTraining(ctx, t, lastUpdatedAt)
+		if err != nil {
+			return closed, errors.WithMessage(err, "close abandoned trainings")
+		}
+
+		// nil means the user came back to the training in the meantime
+		if t != nil {
+			closed = append(closed, *t)
+		}
+	}
+
+	return closed, nil
+}
+
+// endAbandonedTraining returns copy of the training with end times
+// set to the time of the last activity
+func endAbandonedTraining(t *entities.Training, now time.Time) *entities.Training {
+	out := *t
+	out.Exercises = make([]entities.TrainingExercise, len(t.Exercises))
+	copy(out.Exercises, t.Exercises)
+
+	lastActivity := t.StartTime
+	for i := range out.Exercises {
+		te := &out.Exercises[i]
+		if te.EndTime.IsZero() {
+			te.EndTime = lastExerciseActivity(te)
+			te.UpdatedAt = now
+		}
+		if te.EndTime.After(lastActivity) {
+			lastActivity = te.EndTime
+		}
+	}
+
+	out.EndTime = lastActivity
+	out.UpdatedAt = now
+	return &out
+}
+
+// lastExerciseActivity returns time of the last set of the exercise,
+// or its start time if it has no sets
+func lastExerciseActivity(te *entities.TrainingExercise) time.Time {
+	last := te.StartTime
+	for _, s := range te.Sets {
+		if s.Time.After(last) {
+			last = s.Time
+		}
+	}
+	return last
+}
+
+// NewCloseAbandonedTrainingsJob creates a job that closes trainings with
+// no activity for the inactiveFor period. If mailer is not nil, owners
+// of the closed trainings are notified by email.
+func NewCloseAbandonedTrainingsJob(
+	l *zerolog.Logger,
+	tu ITrainingUsecases,
+	userRepo UserRepo,
+	mailer Mailer,
+	inactiveFor time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		closed, err := tu.CloseAbandonedTrainings(ctx, inactiveFor)
+		if len(closed) > 0 {
+			l.Info().Msgf("closed %d abandoned trainings", len(closed))
+		}
+
+		if mailer != nil {
+			for i := range closed {
+				notifyTrainingClosed(ctx, l, userRepo, mailer, &closed[i])
+			}
+		}
+
+		return err
+	}
+}
+
+func notifyTrainingClosed(
+	ctx context.Context,
+	l *zerolog.Logger,
+	userRepo UserRepo,
+	m Mailer,
+	t *entities.Training) {
+	u, err := userRepo.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		l.Err(err).Send()
+		return
+	}
+
+	if u == nil {
+		l.Err(fmt.Errorf(
+			"sending email about closed training abandoned: user with id %s not found",
+			t.UserID)).Send()
+		return
+	}
+
+	data, err := generateTrainingClosedEmailContent(u, t)
+	if err != nil {
+		l.Err(err).Send()
+		return
+	}
+
+	m.Send([]string{u.EmailAddress}, []byte("Training Closed"), data)
+}
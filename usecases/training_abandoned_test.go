@@ -0,0 +1,54 @@
+package usecases_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/mocks"
+)
+
+func TestCloseAbandonedTrainings(t *testing.T) {
+	ctx := context.TODO()
+
+	closed, err := trainingUC.CloseAbandonedTrainings(ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(closed) != 1 {
+		t.Fatalf("want %d closed training, got %d", 1, len(closed))
+	}
+
+	tr := closed[0]
+	openExercise := mocks.ExampleTraining.Exercises[1]
+	endedExercise := mocks.ExampleTraining.Exercises[0]
+
+	if !tr.Exercises[1].EndTime.Equal(openExercise.StartTime) {
+		t.Errorf("want exercise without sets to end at its start time %s, got %s",
+			openExercise.StartTime, tr.Exercises[1].EndTime)
+	}
+
+	if !tr.Exercises[0].EndTime.Equal(endedExercise.EndTime) {
+		t.Errorf("want ended exercise to keep its end time %s, got %s",
+			endedExercise.EndTime, tr.Exercises[0].EndTime)
+	}
+
+	if !tr.EndTime.Equal(endedExercise.EndTime) {
+		t.Errorf("want training to end at the last activity %s, got %s",
+			endedExercise.EndTime, tr.EndTime)
+	}
+
+	if !mocks.ExampleTraining.EndTime.IsZero() || !mocks.ExampleTraining.Exercises[1].EndTime.IsZero() {
+		t.Errorf("want example training to not be modified, got %v", mocks.ExampleTraining)
+	}
+
+	closed, err = trainingUC.CloseAbandonedTrainings(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(closed) != 0 {
+		t.Errorf("want no trainings to be closed, got %v", closed)
+	}
+}
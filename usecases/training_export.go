@@ -0,0 +1,140 @@
+package usecases
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// trainingExportBatchSize is number of trainings whose exercise names are looked up at once
+const trainingExportBatchSize = 50
+
+type TrainingExportUsecases struct {
+	trainingRepo TrainingRepo
+	exerciseRepo ExerciseRepo
+}
+
+type ITrainingExportUsecases interface {
+	// ExportTrainings calls write for every set of the user trainings started within [from, to)
+	// in order of the trainings start, the zero times do not limit the range.
+	// The trainings are read from the storage as they are written, it stops at the first error of write
+	ExportTrainings(
+		ctx context.Context,
+		userID string,
+		from, to time.Time,
+		write func(row *entities.TrainingExportRow) error) error
+}
+
+func (teu *TrainingExportUsecases) ExportTrainings(
+	ctx context.Context,
+	userID string,
+	from, to time.Time,
+	write func(row *entities.TrainingExportRow) error) error {
+	exercises := make(map[string]*entities.Exercise)
+	batch := make([]entities.Training, 0, trainingExportBatchSize)
+
+	flush := func() error {
+		err := lookupExercises(ctx, teu.exerciseRepo, batch, exercises)
+		if err != nil {
+			return err
+		}
+
+		for i := range batch {
+			err = writeTrainingExportRows(&batch[i], exercises, write)
+			if err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := teu.trainingRepo.ForEachUserTraining(ctx, userID, from, to, func(t *entities.Training) error {
+		batch = append(batch, *t)
+		if len(batch) < trainingExportBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return errors.WithMessage(err, "usecases.ExportTrainings")
+	}
+
+	err = flush()
+	if err != nil {
+		return errors.WithMessage(err, "usecases.ExportTrainings")
+	}
+	return nil
+}
+
+// lookupExercises adds the exercises of the trainings that are not known yet to the exercises,
+// the not existing exercises are added as nil
+func lookupExercises(
+	ctx context.Context,
+	exerciseRepo ExerciseRepo,
+	trainings []entities.Training,
+	exercises map[string]*entities.Exercise) error {
+	var ids []string
+	for _, t := range trainings {
+		for _, te := range t.Exercises {
+			if _, ok := exercises[te.ExerciseID]; ok {
+				continue
+			}
+			exercises[te.ExerciseID] = nil
+			ids = append(ids, te.ExerciseID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	found, err := exerciseRepo.GetExercisesByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range found {
+		exercises[found[i].ID] = &found[i]
+	}
+	return nil
+}
+
+func writeTrainingExportRows(
+	t *entities.Training,
+	exercises map[string]*entities.Exercise,
+	write func(row *entities.TrainingExportRow) error) error {
+	for _, te := range t.Exercises {
+		row := entities.TrainingExportRow{
+			TrainingID:        t.ID,
+			TrainingStartTime: t.StartTime,
+			TrainingEndTime:   t.EndTime,
+			ExerciseID:        te.ExerciseID,
+		}
+		if ex := exercises[te.ExerciseID]; ex != nil {
+			row.ExerciseName = ex.Name
+			row.SetUnit = ex.SetUnit
+		}
+
+		for i, s := range te.Sets {
+			row.SetNumber = i + 1
+			row.Reps = s.Reps
+			row.Load = s.Load
+			row.SetTime = s.Time
+			err := write(&row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NewTrainingExportUsecases creates usecases of the training history export
+func NewTrainingExportUsecases(trainingRepo TrainingRepo, exerciseRepo ExerciseRepo) ITrainingExportUsecases {
+	return &TrainingExportUsecases{
+		trainingRepo: trainingRepo,
+		exerciseRepo: exerciseRepo,
+	}
+}
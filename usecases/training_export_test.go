@@ -0,0 +1,64 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestExportTrainings(t *testing.T) {
+	ctx := context.TODO()
+	teu := usecases.NewTrainingExportUsecases(&mocks.MockTrainingRepo{}, &mocks.MockExerciseRepo{})
+
+	var rows []entities.TrainingExportRow
+	err := teu.ExportTrainings(ctx, mocks.UserID, time.Time{}, time.Time{}, func(row *entities.TrainingExportRow) error {
+		rows = append(rows, *row)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one row per set, the exercise without sets has no rows
+	want := len(mocks.ExampleTrainingExercise.Sets)
+	if len(rows) != want {
+		t.Fatalf("want %d rows, got %d", want, len(rows))
+	}
+	for i, row := range rows {
+		set := mocks.ExampleTrainingExercise.Sets[i]
+		if row.TrainingID != mocks.ExampleTraining.ID || row.SetNumber != i+1 ||
+			row.Reps != set.Reps || row.Load != set.Load || !row.SetTime.Equal(set.Time) {
+			t.Errorf("want row of set %d %+v, got %+v", i+1, set, row)
+		}
+		if row.ExerciseName != mocks.ExampleExercise.Name || row.SetUnit != mocks.ExampleExercise.SetUnit {
+			t.Errorf("want exercise %q with unit %v, got %q with %v",
+				mocks.ExampleExercise.Name, mocks.ExampleExercise.SetUnit, row.ExerciseName, row.SetUnit)
+		}
+	}
+
+	// the training started before the range
+	rows = nil
+	err = teu.ExportTrainings(ctx, mocks.UserID, mocks.Now, time.Time{}, func(row *entities.TrainingExportRow) error {
+		rows = append(rows, *row)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("want no rows out of the range, got %v", rows)
+	}
+
+	writeErr := errors.New("client gone")
+	err = teu.ExportTrainings(ctx, mocks.UserID, time.Time{}, time.Time{}, func(row *entities.TrainingExportRow) error {
+		return writeErr
+	})
+	if !errors.Is(err, writeErr) {
+		t.Errorf("want write error %v, got %v", writeErr, err)
+	}
+}
@@ -0,0 +1,546 @@
+package usecases
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/helpers"
+)
+
+const (
+	// importReviewPeriod is the time the uploaded file waits for the user to commit it
+	importReviewPeriod = 24 * time.Hour
+	// importLease is the time the running import is locked for the single runner,
+	// it is extended with every progress checkpoint
+	importLease = 5 * time.Minute
+	// importCheckpointSize is number of trainings stored between the progress checkpoints
+	importCheckpointSize = 20
+	// maxImportAttempts is number of times the interrupted import is resumed before it fails
+	maxImportAttempts = 3
+	// maxImportReportRowErrors limits the row errors kept in the report
+	maxImportReportRowErrors = 100
+	// maxExerciseNameLength is the longest name allowed for the exercise
+	maxExerciseNameLength = 50
+)
+
+// exerciseNameInvalidChars matches characters not allowed in the exercise name
+var exerciseNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9\s+]`)
+
+// importSourceNames are the names of the apps shown in the description of the created exercises
+var importSourceNames = map[entities.ImportSource]string{
+	entities.ImportSourceStrong:   "Strong",
+	entities.ImportSourceHevy:     "Hevy",
+	entities.ImportSourceFitNotes: "FitNotes",
+}
+
+// ImportInput describes the uploaded training log
+type ImportInput struct {
+	Source entities.ImportSource `json:"source" validate:"required,oneof=strong hevy fitnotes"`
+	// Timezone is the location of the times without the offset in the file
+	Timezone string `json:"timezone" validate:"required,timezone"`
+	// Units are the units of the weights without the unit in the file
+	Units entities.UnitSystem `json:"units" validate:"required,oneof=metric imperial"`
+}
+
+// TrainingImportParser reads the training log exported from the other app
+type TrainingImportParser interface {
+	// Parse returns the sets read from the file and the rows that were skipped,
+	// the times without offset are in loc and the weights without unit are in units.
+	// InvalidImportFileError is returned if the file is not the app's export at all
+	Parse(r io.Reader, loc *time.Location, units entities.UnitSystem) ([]entities.ImportedSet, []entities.ImportRowError, error)
+}
+
+// ImportRepo represents the import jobs repository
+type ImportRepo interface {
+	// CreateImportJob stores the job with the uploaded file, the job is removed at expiresAt unless it is queued
+	CreateImportJob(ctx context.Context, job *entities.ImportJob, data []byte, expiresAt time.Time) (*entities.ImportJob, error)
+	// GetImportJob returns the user's import job without the file
+	GetImportJob(ctx context.Context, userID, id string) (*entities.ImportJob, error)
+	// GetImportJobData returns the uploaded file of the job, nil is returned if it is already removed
+	GetImportJobData(ctx context.Context, id string) ([]byte, error)
+	// QueueImportJob moves the user's job under review to the queue,
+	// nil is returned if there is no such job under review
+	QueueImportJob(ctx context.Context, userID, id string) (*entities.ImportJob, error)
+	// ClaimImportJob marks the oldest queued job, or the running one whose lock has expired,
+	// as running and locked until lockedUntil and increments its attempts, nil is returned if there is no such job
+	ClaimImportJob(ctx context.Context, now, lockedUntil time.Time) (*entities.ImportJob, error)
+	// UpdateImportJobProgress saves the progress of the running job and extends its lock
+	UpdateImportJobProgress(ctx context.Context, id string, importedTrainings, createdExercises int, lockedUntil time.Time) error
+	// FinishImportJob sets the final status of the job and removes its file
+	FinishImportJob(ctx context.Context, id string, status entities.ImportStatus, errTxt string) error
+	// GetUserImportJobs returns all import jobs of the user without their files, the newest first
+	GetUserImportJobs(ctx context.Context, userID string) ([]entities.ImportJob, error)
+	// DeleteUserImportJobs removes all import jobs of the user, it returns number of deleted jobs
+	DeleteUserImportJobs(ctx context.Context, userID string) (int64, error)
+}
+
+type TrainingImportUsecases struct {
+	l            *zerolog.Logger
+	importRepo   ImportRepo
+	trainingRepo TrainingRepo
+	exerciseRepo ExerciseRepo
+	auditRepo    AuditRepo
+	parsers      map[entities.ImportSource]TrainingImportParser
+}
+
+// ITrainingImportUsecases are the imports of the training logs of the other apps
+type ITrainingImportUsecases interface {
+	// CreateImport reads the file and stores it for the review with the report of what would be imported,
+	// nothing is imported until the import is committed
+	CreateImport(ctx context.Context, userID string, input *ImportInput, data []byte) (*entities.ImportJob, error)
+	// GetImport returns the user's import, nil is returned if it does not exist
+	GetImport(ctx context.Context, userID, id string) (*entities.ImportJob, error)
+	// CommitImport queues the import under review, the already committed import is returned as it is
+	CommitImport(ctx context.Context, userID, id string) (*entities.ImportJob, error)
+	// ProcessImports runs the queued imports and resumes the interrupted ones,
+	// it returns number of the finished imports
+	ProcessImports(ctx context.Context) (int, error)
+}
+
+// importPlan is the content of the file grouped the way it is stored
+type importPlan struct {
+	sets    []entities.ImportedSet
+	rowErrs []entities.ImportRowError
+	// names are the distinct exercise names in order of their appearance
+	names []string
+	// trainings are the indexes of the sets of every training in order of the trainings appearance
+	trainings [][]int
+}
+
+// prepareImport parses the file, the sets of exercises whose names can not be used are moved to the row errors
+func (tiu *TrainingImportUsecases) prepareImport(
+	source entities.ImportSource,
+	timezone string,
+	units entities.UnitSystem,
+	data []byte) (*importPlan, error) {
+	parser, ok := tiu.parsers[source]
+	if !ok {
+		return nil, NewErrorInvalidImportFile(fmt.Sprintf("unsupported source %q", source))
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, errors.WithMessage(err, "load timezone")
+	}
+
+	sets, rowErrs, err := parser.Parse(bytes.NewReader(data), loc, units)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 && len(rowErrs) == 0 {
+		return nil, NewErrorInvalidImportFile("the file has no sets")
+	}
+
+	p := importPlan{rowErrs: rowErrs}
+	seenNames := make(map[string]bool)
+	trainings := make(map[int64]int)
+	for _, s := range sets {
+		if len(importedExerciseName(s.ExerciseName)) < 2 {
+			p.rowErrs = append(p.rowErrs, entities.ImportRowError{
+				Row:   s.Row,
+				Error: fmt.Sprintf("exercise name %q has too few letters or digits", s.ExerciseName),
+			})
+			continue
+		}
+
+		key := strings.ToLower(s.ExerciseName)
+		if !seenNames[key] {
+			seenNames[key] = true
+			p.names = append(p.names, s.ExerciseName)
+		}
+
+		ti, ok := trainings[s.TrainingStart.Unix()]
+		if !ok {
+			ti = len(p.trainings)
+			trainings[s.TrainingStart.Unix()] = ti
+			p.trainings = append(p.trainings, nil)
+		}
+		p.trainings[ti] = append(p.trainings[ti], len(p.sets))
+		p.sets = append(p.sets, s)
+	}
+	return &p, nil
+}
+
+// importedExerciseName returns the name of the exercise created for the imported name,
+// the characters not allowed in the exercise names are left out
+func importedExerciseName(name string) string {
+	name = helpers.TrimWhiteSpaces(exerciseNameInvalidChars.ReplaceAllString(name, " "))
+	if len(name) > maxExerciseNameLength {
+		name = strings.TrimSpace(name[:maxExerciseNameLength])
+	}
+	return name
+}
+
+// matchExercises returns the exercises of the imported names keyed by the lower case name,
+// the name is matched by the exercise name or alias and then by the name it would be created with.
+// The names without the exercise are left out
+func (tiu *TrainingImportUsecases) matchExercises(
+	ctx context.Context,
+	names []string) (map[string]*entities.Exercise, error) {
+	lookup := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		lookup = append(lookup, name)
+		if n := importedExerciseName(name); n != name {
+			lookup = append(lookup, n)
+		}
+	}
+
+	found, err := tiu.exerciseRepo.GetExercisesByNames(ctx, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make(map[string]*entities.Exercise, len(names))
+	for _, name := range names {
+		if ex := findExerciseByName(found, name, true); ex != nil {
+			matched[strings.ToLower(name)] = ex
+		} else if ex := findExerciseByName(found, importedExerciseName(name), false); ex != nil {
+			matched[strings.ToLower(name)] = ex
+		}
+	}
+	return matched, nil
+}
+
+func findExerciseByName(exercises []entities.Exercise, name string, aliases bool) *entities.Exercise {
+	for i := range exercises {
+		if strings.EqualFold(exercises[i].Name, name) {
+			return &exercises[i]
+		}
+		if !aliases {
+			continue
+		}
+		for _, alias := range exercises[i].Aliases {
+			if strings.EqualFold(alias, name) {
+				return &exercises[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (tiu *TrainingImportUsecases) CreateImport(
+	ctx context.Context,
+	userID string,
+	input *ImportInput,
+	data []byte) (*entities.ImportJob, error) {
+	p, err := tiu.prepareImport(input.Source, input.Timezone, input.Units, data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CreateImport")
+	}
+
+	matched, err := tiu.matchExercises(ctx, p.names)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CreateImport")
+	}
+
+	report := entities.ImportReport{
+		Rows:               len(p.sets) + len(p.rowErrs),
+		Trainings:          len(p.trainings),
+		Sets:               len(p.sets),
+		UnmatchedExercises: []string{},
+		RowErrors:          p.rowErrs,
+		RowErrorsCount:     len(p.rowErrs),
+	}
+	if report.RowErrors == nil {
+		report.RowErrors = []entities.ImportRowError{}
+	}
+	if len(report.RowErrors) > maxImportReportRowErrors {
+		report.RowErrors = report.RowErrors[:maxImportReportRowErrors]
+	}
+	for _, name := range p.names {
+		if matched[strings.ToLower(name)] == nil {
+			report.UnmatchedExercises = append(report.UnmatchedExercises, name)
+		}
+	}
+
+	now := time.Now().UTC()
+	job := entities.ImportJob{
+		UserID:    userID,
+		Source:    input.Source,
+		Status:    entities.ImportStatusReview,
+		Timezone:  input.Timezone,
+		Units:     input.Units,
+		Report:    report,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	out, err := tiu.importRepo.CreateImportJob(ctx, &job, data, now.Add(importReviewPeriod))
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CreateImport")
+	}
+	return out, nil
+}
+
+func (tiu *TrainingImportUsecases) GetImport(
+	ctx context.Context,
+	userID, id string) (*entities.ImportJob, error) {
+	return tiu.importRepo.GetImportJob(ctx, userID, id)
+}
+
+func (tiu *TrainingImportUsecases) CommitImport(
+	ctx context.Context,
+	userID, id string) (*entities.ImportJob, error) {
+	job, err := tiu.importRepo.QueueImportJob(ctx, userID, id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CommitImport")
+	}
+	if job != nil {
+		return job, nil
+	}
+
+	// committed before or removed after the review period
+	job, err = tiu.importRepo.GetImportJob(ctx, userID, id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "usecases.CommitImport")
+	}
+	if job == nil {
+		return nil, NewErrorRecordNotExists("import")
+	}
+	return job, nil
+}
+
+func (tiu *TrainingImportUsecases) ProcessImports(ctx context.Context) (int, error) {
+	finished := 0
+	var lastErr error
+	for {
+		if ctx.Err() != nil {
+			return finished, ctx.Err()
+		}
+
+		now := time.Now().UTC()
+		job, err := tiu.importRepo.ClaimImportJob(ctx, now, now.Add(importLease))
+		if err != nil {
+			return finished, errors.WithMessage(err, "usecases.ProcessImports")
+		}
+		if job == nil {
+			return finished, lastErr
+		}
+
+		if job.Attempts > maxImportAttempts {
+			err = tiu.importRepo.FinishImportJob(ctx, job.ID, entities.ImportStatusFailed, "the import was interrupted too many times")
+		} else {
+			err = tiu.processImport(ctx, job)
+		}
+		if err != nil {
+			// the job is claimed again once its lock expires
+			lastErr = errors.WithMessagef(err, "usecases.ProcessImports: import %q", job.ID)
+			tiu.l.Err(lastErr).Send()
+			continue
+		}
+		finished++
+	}
+}
+
+// processImport stores the trainings of the job starting after the already imported ones,
+// the trainings have the client ids derived from the job so the repeated attempt does not duplicate them
+func (tiu *TrainingImportUsecases) processImport(ctx context.Context, job *entities.ImportJob) error {
+	data, err := tiu.importRepo.GetImportJobData(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return tiu.importRepo.FinishImportJob(ctx, job.ID, entities.ImportStatusFailed, "the file is no longer available")
+	}
+
+	p, err := tiu.prepareImport(job.Source, job.Timezone, job.Units, data)
+	if err != nil {
+		var fileErr *InvalidImportFileError
+		if errors.As(err, &fileErr) {
+			return tiu.importRepo.FinishImportJob(ctx, job.ID, entities.ImportStatusFailed, fileErr.Error())
+		}
+		return err
+	}
+
+	exercises, createdExercises, err := tiu.createMissingExercises(ctx, job, p)
+	if err != nil {
+		return errors.WithMessage(err, "create exercises")
+	}
+	createdExercises += job.CreatedExercises
+
+	for i := job.ImportedTrainings; i < len(p.trainings); i++ {
+		t := buildImportedTraining(job, i, p, exercises)
+		existing, err := tiu.trainingRepo.GetTrainingByClientID(ctx, job.UserID, t.ClientID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			_, err = tiu.trainingRepo.CreateTraining(ctx, t)
+			if err != nil {
+				return err
+			}
+		}
+
+		if (i+1)%importCheckpointSize == 0 {
+			err = tiu.importRepo.UpdateImportJobProgress(ctx, job.ID, i+1, createdExercises, time.Now().UTC().Add(importLease))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = tiu.importRepo.UpdateImportJobProgress(ctx, job.ID, len(p.trainings), createdExercises, time.Now().UTC().Add(importLease))
+	if err != nil {
+		return err
+	}
+	return tiu.importRepo.FinishImportJob(ctx, job.ID, entities.ImportStatusCompleted, "")
+}
+
+// createMissingExercises returns the exercises of all of the imported names and number of the created ones,
+// the exercise whose name had to be changed keeps the imported name as its alias
+func (tiu *TrainingImportUsecases) createMissingExercises(
+	ctx context.Context,
+	job *entities.ImportJob,
+	p *importPlan) (map[string]*entities.Exercise, int, error) {
+	exercises, err := tiu.matchExercises(ctx, p.names)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	description := fmt.Sprintf("Imported from %s.", importSourceNames[job.Source])
+	created := 0
+	// the different imported names may end up with the same exercise name
+	createdByName := make(map[string]*entities.Exercise)
+	for _, name := range p.names {
+		key := strings.ToLower(name)
+		if exercises[key] != nil {
+			continue
+		}
+
+		exName := importedExerciseName(name)
+		ex := createdByName[strings.ToLower(exName)]
+		if ex == nil {
+			ex, err = tiu.exerciseRepo.CreateExercise(ctx, exName, description, importedSetUnit(p.sets, name), job.UserID)
+			if err != nil {
+				return nil, 0, err
+			}
+			createdByName[strings.ToLower(exName)] = ex
+			created++
+
+			// the import runs in the background on behalf of the user who committed it
+			recordAuditEvent(ctx, tiu.l, tiu.auditRepo, entities.AuditEvent{
+				Action:   entities.AuditActionExerciseCreated,
+				ActorID:  job.UserID,
+				UserID:   job.UserID,
+				RecordID: ex.ID,
+				After: map[string]interface{}{
+					"name":        ex.Name,
+					"description": ex.Description,
+					"setUnit":     ex.SetUnit,
+				},
+			})
+		}
+
+		if !strings.EqualFold(ex.Name, name) {
+			ex.Aliases = append(ex.Aliases, name)
+			_, err = tiu.exerciseRepo.UpdateExercise(ctx, &entities.Exercise{ID: ex.ID, Aliases: ex.Aliases})
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		exercises[key] = ex
+	}
+	return exercises, created, nil
+}
+
+// importedSetUnit returns the time unit if the sets of the exercise have the time but no reps
+func importedSetUnit(sets []entities.ImportedSet, exerciseName string) entities.SetUnit {
+	for _, s := range sets {
+		if strings.EqualFold(s.ExerciseName, exerciseName) && (s.Reps > 0 || s.Seconds == 0) {
+			return entities.Weight
+		}
+	}
+	return entities.Time
+}
+
+// buildImportedTraining returns the i-th training of the import,
+// the app exports do not have the time of the sets so they get the start of the training
+func buildImportedTraining(
+	job *entities.ImportJob,
+	i int,
+	p *importPlan,
+	exercises map[string]*entities.Exercise) *entities.Training {
+	first := p.sets[p.trainings[i][0]]
+	t := entities.Training{
+		ClientID:  fmt.Sprintf("import-%s-%d", job.ID, i),
+		UserID:    job.UserID,
+		StartTime: first.TrainingStart.UTC(),
+		EndTime:   first.TrainingStart.UTC(),
+		Comment:   first.TrainingName,
+		Exercises: []entities.TrainingExercise{},
+	}
+
+	exIdx := make(map[string]int)
+	for _, si := range p.trainings[i] {
+		s := p.sets[si]
+		if end := s.TrainingEnd.UTC(); end.After(t.EndTime) {
+			t.EndTime = end
+		}
+
+		ex := exercises[strings.ToLower(s.ExerciseName)]
+		ei, ok := exIdx[ex.ID]
+		if !ok {
+			ei = len(t.Exercises)
+			exIdx[ex.ID] = ei
+			t.Exercises = append(t.Exercises, entities.TrainingExercise{
+				ExerciseID: ex.ID,
+				StartTime:  t.StartTime,
+				Sets:       []entities.TrainingSet{},
+			})
+		}
+
+		set := entities.TrainingSet{
+			Time: t.StartTime,
+			Reps: s.Reps,
+			Load: s.Load,
+		}
+		if ex.SetUnit == entities.Time && s.Seconds > 0 {
+			set.Reps = s.Seconds
+		}
+		t.Exercises[ei].Sets = append(t.Exercises[ei].Sets, set)
+	}
+
+	for ei := range t.Exercises {
+		t.Exercises[ei].EndTime = t.EndTime
+	}
+	return &t
+}
+
+// NewProcessImportsJob creates a job that runs the committed imports,
+// the number of finished imports is logged
+func NewProcessImportsJob(
+	l *zerolog.Logger,
+	imports ITrainingImportUsecases) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := imports.ProcessImports(ctx)
+		if n > 0 {
+			l.Info().Int("imports", n).Msg("imports finished")
+		}
+		return err
+	}
+}
+
+// NewTrainingImportUsecases creates usecases of the training logs import,
+// the parsers read the files of the supported apps
+func NewTrainingImportUsecases(
+	l *zerolog.Logger,
+	importRepo ImportRepo,
+	trainingRepo TrainingRepo,
+	exerciseRepo ExerciseRepo,
+	auditRepo AuditRepo,
+	parsers map[entities.ImportSource]TrainingImportParser) ITrainingImportUsecases {
+	return &TrainingImportUsecases{
+		l:            l,
+		importRepo:   importRepo,
+		trainingRepo: trainingRepo,
+		exerciseRepo: exerciseRepo,
+		auditRepo:    auditRepo,
+		parsers:      parsers,
+	}
+}
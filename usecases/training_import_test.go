@@ -0,0 +1,227 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/importers"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+const strongImportFile = "Date;Workout Name;Duration;Exercise Name;Set Order;Weight;Reps;Distance;Seconds;Notes;Workout Notes;RPE\n" +
+	"2021-03-14 10:05:12;Morning;1h;Deadlift;1;100;5;0;0;;;\n" +
+	"2021-03-14 10:05:12;Morning;1h;Bench Press (Barbell);1;60;8;0;0;;;\n" +
+	"2021-03-16 18:00:00;Evening;45m;deadlift;1;110;5;0;0;;;\n" +
+	"2021-03-16 18:00:00;Evening;45m;Deadlift;2;;;0;0;;;\n"
+
+// recordingTrainingRepo keeps the created trainings by their client ids
+type recordingTrainingRepo struct {
+	mocks.MockTrainingRepo
+	mu        sync.Mutex
+	trainings map[string]entities.Training
+	createErr error
+}
+
+func (r *recordingTrainingRepo) GetTrainingByClientID(
+	ctx context.Context,
+	userID, clientID string) (*entities.Training, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.trainings[clientID]
+	if !ok {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+func (r *recordingTrainingRepo) CreateTraining(
+	ctx context.Context,
+	t *entities.Training) (*entities.Training, error) {
+	if r.createErr != nil {
+		return nil, r.createErr
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trainings[t.ClientID] = *t
+	out := *t
+	return &out, nil
+}
+
+func newTestTrainingImportUsecases(
+	importRepo usecases.ImportRepo,
+	trainingRepo usecases.TrainingRepo,
+	auditRepo usecases.AuditRepo) usecases.ITrainingImportUsecases {
+	return usecases.NewTrainingImportUsecases(
+		&mockedLogger,
+		importRepo,
+		trainingRepo,
+		&mocks.MockExerciseRepo{},
+		auditRepo,
+		importers.Parsers())
+}
+
+var strongImportInput = usecases.ImportInput{
+	Source:   entities.ImportSourceStrong,
+	Timezone: "Europe/Warsaw",
+	Units:    entities.UnitsMetric,
+}
+
+func TestCreateImport(t *testing.T) {
+	ctx := context.TODO()
+	tiu := newTestTrainingImportUsecases(&mocks.MockImportRepo{}, &recordingTrainingRepo{}, &mocks.MockAuditRepo{})
+
+	job, err := tiu.CreateImport(ctx, mocks.UserID, &strongImportInput, []byte(strongImportFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != entities.ImportStatusReview {
+		t.Errorf("want import under review, got %q", job.Status)
+	}
+
+	r := job.Report
+	if r.Rows != 4 || r.Trainings != 2 || r.Sets != 3 {
+		t.Errorf("want 4 rows, 2 trainings and 3 sets, got %+v", r)
+	}
+	if len(r.UnmatchedExercises) != 1 || r.UnmatchedExercises[0] != "Bench Press (Barbell)" {
+		t.Errorf("want unmatched bench press, got %v", r.UnmatchedExercises)
+	}
+	if r.RowErrorsCount != 1 || len(r.RowErrors) != 1 || r.RowErrors[0].Row != 5 {
+		t.Errorf("want error of row 5, got %+v", r.RowErrors)
+	}
+
+	_, err = tiu.CreateImport(ctx, mocks.UserID, &strongImportInput, []byte("foo,bar\n1,2\n"))
+	var fileErr *usecases.InvalidImportFileError
+	if !errors.As(err, &fileErr) {
+		t.Errorf("want InvalidImportFileError, got %v", err)
+	}
+}
+
+func TestCommitImport(t *testing.T) {
+	ctx := context.TODO()
+	tiu := newTestTrainingImportUsecases(&mocks.MockImportRepo{}, &recordingTrainingRepo{}, &mocks.MockAuditRepo{})
+
+	job, err := tiu.CreateImport(ctx, mocks.UserID, &strongImportInput, []byte(strongImportFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		committed, err := tiu.CommitImport(ctx, mocks.UserID, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if committed.Status != entities.ImportStatusQueued {
+			t.Errorf("commit %d: want queued import, got %q", i, committed.Status)
+		}
+	}
+
+	_, err = tiu.CommitImport(ctx, "other"+mocks.UserID, job.ID)
+	var rneErr *usecases.RecordNotExistsError
+	if !errors.As(err, &rneErr) {
+		t.Errorf("want RecordNotExistsError for the import of the other user, got %v", err)
+	}
+}
+
+func TestProcessImports(t *testing.T) {
+	ctx := context.TODO()
+	importRepo := &mocks.MockImportRepo{}
+	trainingRepo := &recordingTrainingRepo{trainings: make(map[string]entities.Training)}
+	auditRepo := &mocks.MockAuditRepo{}
+	tiu := newTestTrainingImportUsecases(importRepo, trainingRepo, auditRepo)
+
+	job, err := tiu.CreateImport(ctx, mocks.UserID, &strongImportInput, []byte(strongImportFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tiu.CommitImport(ctx, mocks.UserID, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first training was stored before the previous attempt was interrupted
+	trainingRepo.trainings["import-"+job.ID+"-0"] = entities.Training{ClientID: "import-" + job.ID + "-0"}
+
+	n, err := tiu.ProcessImports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("want 1 finished import, got %d", n)
+	}
+
+	job, err = tiu.GetImport(ctx, mocks.UserID, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != entities.ImportStatusCompleted || job.ImportedTrainings != 2 || job.CreatedExercises != 1 {
+		t.Errorf("want completed import of 2 trainings with 1 created exercise, got %+v", job)
+	}
+
+	if len(trainingRepo.trainings) != 2 {
+		t.Fatalf("want 2 trainings, got %d", len(trainingRepo.trainings))
+	}
+	second := trainingRepo.trainings["import-"+job.ID+"-1"]
+	if second.UserID != mocks.UserID || second.Comment != "Evening" {
+		t.Errorf("want the Evening training of the user, got %+v", second)
+	}
+	if len(second.Exercises) != 1 || len(second.Exercises[0].Sets) != 1 || second.Exercises[0].Sets[0].Load != 110 {
+		t.Errorf("want single deadlift set of 110 kg, got %+v", second.Exercises)
+	}
+	if want := second.StartTime.Add(45 * time.Minute); !second.EndTime.Equal(want) {
+		t.Errorf("want training end %v, got %v", want, second.EndTime)
+	}
+
+	events := auditRepo.Events()
+	if len(events) != 1 || events[0].Action != entities.AuditActionExerciseCreated ||
+		events[0].ActorID != mocks.UserID || events[0].UserID != mocks.UserID {
+		t.Errorf("want exercise created event of the user, got %+v", events)
+	}
+}
+
+func TestProcessImportsFailsAfterAttempts(t *testing.T) {
+	ctx := context.TODO()
+	importRepo := &mocks.MockImportRepo{}
+	trainingRepo := &recordingTrainingRepo{
+		trainings: make(map[string]entities.Training),
+		createErr: errors.New("connection lost"),
+	}
+	tiu := newTestTrainingImportUsecases(importRepo, trainingRepo, &mocks.MockAuditRepo{})
+
+	job, err := tiu.CreateImport(ctx, mocks.UserID, &strongImportInput, []byte(strongImportFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tiu.CommitImport(ctx, mocks.UserID, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		n, err := tiu.ProcessImports(ctx)
+		if err == nil || n != 0 {
+			t.Fatalf("attempt %d: want failed attempt, got %d, %v", i, n, err)
+		}
+		importRepo.ExpireImportLocks()
+	}
+
+	n, err := tiu.ProcessImports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("want finished import, got %d", n)
+	}
+	job, err = tiu.GetImport(ctx, mocks.UserID, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != entities.ImportStatusFailed || !strings.Contains(job.Error, "interrupted") {
+		t.Errorf("want failed import, got %+v", job)
+	}
+}
@@ -0,0 +1,563 @@
+package usecases
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unnamedxaer/gymm-api/entities"
+)
+
+// SyncInput represents batch of changes made by the client while offline
+type SyncInput struct {
+	// Token is the token received with the previous sync,
+	// empty for the very first sync
+	Token     string              `json:"token"`
+	Trainings []entities.Training `json:"trainings"`
+}
+
+// Sync applies client changes to the user trainings.
+//
+// Records are matched by the client ids (or by ids for records known to
+// the server) so sending the same batch again does not create duplicates.
+// Conflicts are resolved per record (training, exercise, set) with the
+// last writer wins policy based on the "updatedAt" times. Every record that was
+// modified on both sides since the client's last sync is reported back.
+//
+// The rules of the trainings started online apply as well, the new training in progress
+// is rejected while the user has another one, and the records are not added
+// to the ended trainings and exercises. The ended training or exercise stays ended.
+// The whole batch is rejected if any record refers to not existing exercise
+// or its times are out of order or in the future.
+//
+// At most SyncTrainingsLimit changed trainings are returned, the result tells
+// whether there are more of them to get with the next sync.
+func (tu *TrainingUsecases) Sync(
+	ctx context.Context,
+	userID string,
+	input *SyncInput) (*entities.SyncResult, error) {
+	since, afterID, err := parseSyncToken(input.Token)
+	if err != nil {
+		return nil, errors.WithMessage(err, "sync")
+	}
+
+	// token is taken before applying the changes so that nothing written
+	// concurrently is missed by the next sync, at the cost of returning
+	// records applied here once again
+	syncedAt := time.Now()
+
+	err = tu.validateSyncedTrainings(ctx, input.Trainings, syncedAt)
+	if err != nil {
+		return nil, errors.WithMessage(err, "sync")
+	}
+
+	conflicts := []entities.SyncConflict{}
+	for i := range input.Trainings {
+		c, err := tu.syncTraining(ctx, userID, &input.Trainings[i], since, syncedAt)
+		if err != nil {
+			return nil, errors.WithMessage(err, "sync")
+		}
+		conflicts = append(conflicts, c...)
+	}
+
+	changed, err := tu.repo.GetUserTrainingsChangedSince(ctx, userID, since, afterID, SyncTrainingsLimit+1)
+	if err != nil {
+		return nil, errors.WithMessage(err, "sync")
+	}
+
+	result := &entities.SyncResult{
+		Token:     formatSyncToken(syncedAt, ""),
+		Trainings: changed,
+		Conflicts: conflicts,
+	}
+	if len(changed) > SyncTrainingsLimit {
+		// the next sync continues after the last returned training
+		result.Trainings = changed[:SyncTrainingsLimit]
+		last := result.Trainings[SyncTrainingsLimit-1]
+		result.Token = formatSyncToken(last.UpdatedAt, last.ID)
+		result.HasMore = true
+	}
+
+	return result, nil
+}
+
+// SyncTrainingsLimit is the maximum number of changed trainings returned by a single sync
+const SyncTrainingsLimit = 100
+
+// syncClockSkew is how far the client's clock may be ahead of the server's one
+const syncClockSkew = time.Minute
+
+// validateSyncedTrainings checks the client's trainings before any of them is applied,
+// the records cannot refer to not existing exercises, start after they end
+// or before their parent starts, or happen after receivedAt
+func (tu *TrainingUsecases) validateSyncedTrainings(
+	ctx context.Context,
+	trainings []entities.Training,
+	receivedAt time.Time) error {
+	latest := receivedAt.Add(syncClockSkew)
+	ids := []string{}
+	for i := range trainings {
+		t := &trainings[i]
+		id := syncRecordID(t.ID, t.ClientID)
+		if err := validateSyncedTimes("training", id, t.StartTime, t.EndTime, time.Time{}, latest); err != nil {
+			return err
+		}
+
+		for j := range t.Exercises {
+			te := &t.Exercises[j]
+			id := syncRecordID(te.ID, te.ClientID)
+			if err := validateSyncedTimes("training exercise", id, te.StartTime, te.EndTime, t.StartTime, latest); err != nil {
+				return err
+			}
+			ids = append(ids, te.ExerciseID)
+
+			for k := range te.Sets {
+				ts := &te.Sets[k]
+				id := syncRecordID(ts.ID, ts.ClientID)
+				if err := validateSyncedTimes("training set", id, ts.Time, time.Time{}, te.StartTime, latest); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	exercises, err := tu.exerciseRepo.GetExercisesByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(exercises))
+	for _, ex := range exercises {
+		known[ex.ID] = true
+	}
+	for i := range trainings {
+		for _, te := range trainings[i].Exercises {
+			if !known[te.ExerciseID] {
+				return NewErrorInvalidSyncRecord(
+					"training exercise", syncRecordID(te.ID, te.ClientID), "exercise "+te.ExerciseID+" does not exist")
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSyncedTimes checks that the record starts not before its parent (notBefore),
+// does not end before it starts and nothing happens after the latest time
+func validateSyncedTimes(dataName, id string, start, end, notBefore, latest time.Time) error {
+	switch {
+	case start.IsZero():
+		return NewErrorInvalidSyncRecord(dataName, id, "missing start time")
+	case start.Before(notBefore):
+		return NewErrorInvalidSyncRecord(dataName, id, "start time before the start of its parent")
+	case !end.IsZero() && end.Before(start):
+		return NewErrorInvalidSyncRecord(dataName, id, "end time before start time")
+	case start.After(latest) || end.After(latest):
+		return NewErrorInvalidSyncRecord(dataName, id, "time in the future")
+	}
+	return nil
+}
+
+// syncRecordID returns the id the client knows the record by
+func syncRecordID(id, clientID string) string {
+	if clientID != "" {
+		return clientID
+	}
+	return id
+}
+
+// syncAttempts is the number of times the client's training is merged
+// when the stored one keeps being modified before it is replaced
+const syncAttempts = 3
+
+func (tu *TrainingUsecases) syncTraining(
+	ctx context.Context,
+	userID string,
+	incoming *entities.Training,
+	since, receivedAt time.Time) ([]entities.SyncConflict, error) {
+	for i := 0; i < syncAttempts; i++ {
+		conflicts, applied, err := tu.applySyncedTraining(ctx, userID, incoming, since, receivedAt)
+		if err != nil || applied {
+			return conflicts, err
+		}
+	}
+
+	return nil, NewErrorConcurrentModification("training")
+}
+
+// applySyncedTraining merges the client's training into the stored one,
+// it returns false if the stored training was modified after it had been read
+func (tu *TrainingUsecases) applySyncedTraining(
+	ctx context.Context,
+	userID string,
+	incoming *entities.Training,
+	since, receivedAt time.Time) ([]entities.SyncConflict, bool, error) {
+
+	stored, err := tu.findSyncedTraining(ctx, userID, incoming)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if stored == nil {
+		if incoming.ClientID == "" {
+			return nil, false, NewErrorInvalidID(incoming.ID, "training")
+		}
+
+		if incoming.EndTime.IsZero() {
+			open, err := tu.repo.GetUserOpenTraining(ctx, userID)
+			if err != nil {
+				return nil, false, err
+			}
+			if open != nil {
+				return []entities.SyncConflict{
+					rejectedSyncRecord(entities.SyncEntityTraining, incoming.ClientID),
+				}, true, nil
+			}
+		}
+
+		t := newSyncedTraining(incoming, userID, time.Now())
+		_, err = tu.repo.CreateTraining(ctx, t)
+		if err == nil {
+			return nil, true, nil
+		}
+		if !IsDuplicatedError(err) {
+			return nil, false, err
+		}
+
+		// the same batch is being applied concurrently,
+		// merge it with the one that won the insert
+		stored, err = tu.repo.GetTrainingByClientID(ctx, userID, incoming.ClientID)
+		if err != nil {
+			return nil, false, err
+		}
+		if stored == nil {
+			// the other training in progress has been started concurrently
+			return []entities.SyncConflict{
+				rejectedSyncRecord(entities.SyncEntityTraining, incoming.ClientID),
+			}, true, nil
+		}
+	}
+
+	merged, changed, conflicts, err := mergeTraining(stored, incoming, since, receivedAt, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+
+	if changed {
+		replaced, err := tu.repo.ReplaceTraining(ctx, merged, stored.UpdatedAt)
+		if err != nil {
+			return nil, false, err
+		}
+		if replaced == nil {
+			return nil, false, nil
+		}
+	}
+
+	return conflicts, true, nil
+}
+
+// findSyncedTraining looks for the stored version of the client's training
+func (tu *TrainingUsecases) findSyncedTraining(
+	ctx context.Context,
+	userID string,
+	incoming *entities.Training) (*entities.Training, error) {
+	if incoming.ClientID != "" {
+		t, err := tu.repo.GetTrainingByClientID(ctx, userID, incoming.ClientID)
+		if err != nil || t != nil {
+			return t, err
+		}
+	}
+
+	if incoming.ID == "" {
+		return nil, nil
+	}
+
+	t, err := tu.repo.GetTrainingByID(ctx, incoming.ID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.UserID != userID {
+		return nil, NewErrorRecordNotExists("training")
+	}
+	return t, nil
+}
+
+func newSyncedTraining(incoming *entities.Training, userID string, now time.Time) *entities.Training {
+	t := *incoming
+	t.ID = ""
+	t.UserID = userID
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	t.Exercises = make([]entities.TrainingExercise, len(incoming.Exercises))
+	for i := range incoming.Exercises {
+		t.Exercises[i] = newSyncedExercise(&incoming.Exercises[i], now)
+	}
+	return &t
+}
+
+func newSyncedExercise(incoming *entities.TrainingExercise, now time.Time) entities.TrainingExercise {
+	te := *incoming
+	te.ID = ""
+	te.CreatedAt = now
+	te.UpdatedAt = now
+	te.Sets = make([]entities.TrainingSet, len(incoming.Sets))
+	for i := range incoming.Sets {
+		te.Sets[i] = newSyncedSet(&incoming.Sets[i], now)
+	}
+	return te
+}
+
+func newSyncedSet(incoming *entities.TrainingSet, now time.Time) entities.TrainingSet {
+	ts := *incoming
+	ts.ID = ""
+	ts.CreatedAt = now
+	ts.UpdatedAt = now
+	return ts
+}
+
+// mergeTraining merges client's version of the training into the stored one,
+// it returns the merged training and info whether anything has changed
+func mergeTraining(
+	stored, incoming *entities.Training,
+	since, receivedAt, now time.Time) (*entities.Training, bool, []entities.SyncConflict, error) {
+	merged := *stored
+	merged.Exercises = make([]entities.TrainingExercise, len(stored.Exercises))
+	copy(merged.Exercises, stored.Exercises)
+
+	changed := false
+	conflicts := []entities.SyncConflict{}
+
+	ended := !stored.EndTime.IsZero()
+	endTime := incoming.EndTime
+	if ended && endTime.IsZero() {
+		// the client has not seen the training ended
+		endTime = stored.EndTime
+	}
+
+	equal := stored.StartTime.Equal(incoming.StartTime) &&
+		stored.EndTime.Equal(endTime) &&
+		stored.Comment == incoming.Comment
+	if !equal {
+		clientWins, c := resolveSyncConflict(
+			entities.SyncEntityTraining, stored.ID, incoming.ClientID,
+			stored.UpdatedAt, incoming.UpdatedAt, since, receivedAt)
+		if c != nil {
+			conflicts = append(conflicts, *c)
+		}
+		if clientWins {
+			merged.StartTime = incoming.StartTime
+			merged.EndTime = endTime
+			merged.Comment = incoming.Comment
+			changed = true
+		}
+	}
+
+	for i := range incoming.Exercises {
+		ie := &incoming.Exercises[i]
+		idx := indexOfSyncedExercise(merged.Exercises, ie)
+		if idx == -1 {
+			if ie.ClientID == "" {
+				return nil, false, nil, NewErrorInvalidID(ie.ID, "training exercise")
+			}
+			if ended {
+				conflicts = append(conflicts, rejectedSyncRecord(entities.SyncEntityExercise, ie.ClientID))
+				continue
+			}
+			merged.Exercises = append(merged.Exercises, newSyncedExercise(ie, now))
+			changed = true
+			continue
+		}
+
+		exChanged, c, err := mergeExercise(&merged.Exercises[idx], ie, ended, since, receivedAt, now)
+		if err != nil {
+			return nil, false, nil, err
+		}
+		conflicts = append(conflicts, c...)
+		changed = changed || exChanged
+	}
+
+	if changed {
+		merged.UpdatedAt = now
+	}
+
+	return &merged, changed, conflicts, nil
+}
+
+// mergeExercise merges client's version of the exercise into the stored one in place,
+// no sets are added if the exercise or its training (trainingEnded) has ended
+func mergeExercise(
+	stored, incoming *entities.TrainingExercise,
+	trainingEnded bool,
+	since, receivedAt, now time.Time) (bool, []entities.SyncConflict, error) {
+	changed := false
+	conflicts := []entities.SyncConflict{}
+
+	sets := make([]entities.TrainingSet, len(stored.Sets))
+	copy(sets, stored.Sets)
+
+	ended := !stored.EndTime.IsZero()
+	endTime := incoming.EndTime
+	if ended && endTime.IsZero() {
+		endTime = stored.EndTime
+	}
+
+	equal := stored.ExerciseID == incoming.ExerciseID &&
+		stored.StartTime.Equal(incoming.StartTime) &&
+		stored.EndTime.Equal(endTime) &&
+		stored.Comment == incoming.Comment
+	if !equal {
+		clientWins, c := resolveSyncConflict(
+			entities.SyncEntityExercise, stored.ID, incoming.ClientID,
+			stored.UpdatedAt, incoming.UpdatedAt, since, receivedAt)
+		if c != nil {
+			conflicts = append(conflicts, *c)
+		}
+		if clientWins {
+			stored.ExerciseID = incoming.ExerciseID
+			stored.StartTime = incoming.StartTime
+			stored.EndTime = endTime
+			stored.Comment = incoming.Comment
+			changed = true
+		}
+	}
+
+	for i := range incoming.Sets {
+		is := &incoming.Sets[i]
+		idx := indexOfSyncedSet(sets, is)
+		if idx == -1 {
+			if is.ClientID == "" {
+				return false, nil, NewErrorInvalidID(is.ID, "training set")
+			}
+			if ended || trainingEnded {
+				conflicts = append(conflicts, rejectedSyncRecord(entities.SyncEntitySet, is.ClientID))
+				continue
+			}
+			sets = append(sets, newSyncedSet(is, now))
+			changed = true
+			continue
+		}
+
+		ss := &sets[idx]
+		if ss.Time.Equal(is.Time) && ss.Reps == is.Reps && ss.Load == is.Load {
+			continue
+		}
+
+		clientWins, c := resolveSyncConflict(
+			entities.SyncEntitySet, ss.ID, is.ClientID,
+			ss.UpdatedAt, is.UpdatedAt, since, receivedAt)
+		if c != nil {
+			conflicts = append(conflicts, *c)
+		}
+		if clientWins {
+			ss.Time = is.Time
+			ss.Reps = is.Reps
+			ss.Load = is.Load
+			ss.UpdatedAt = now
+			changed = true
+		}
+	}
+
+	stored.Sets = sets
+	if changed {
+		stored.UpdatedAt = now
+	}
+
+	return changed, conflicts, nil
+}
+
+// resolveSyncConflict decides whether the client's version of the record
+// should override stored one, it returns conflict if the record was modified
+// on both sides since the last sync. The client's modification time is not trusted
+// to be later than receivedAt so that the client cannot win every future conflict.
+func resolveSyncConflict(
+	entity entities.SyncEntity,
+	id, clientID string,
+	storedUpdatedAt, incomingUpdatedAt, since, receivedAt time.Time) (bool, *entities.SyncConflict) {
+	if incomingUpdatedAt.After(receivedAt) {
+		incomingUpdatedAt = receivedAt
+	}
+
+	clientWins := incomingUpdatedAt.After(storedUpdatedAt)
+
+	if !storedUpdatedAt.After(since) || !incomingUpdatedAt.After(since) {
+		return clientWins, nil
+	}
+
+	c := &entities.SyncConflict{
+		Entity:     entity,
+		ID:         id,
+		ClientID:   clientID,
+		Resolution: entities.SyncResolutionServerWins,
+	}
+	if clientWins {
+		c.Resolution = entities.SyncResolutionClientWins
+	}
+	return clientWins, c
+}
+
+// rejectedSyncRecord reports the client's new record discarded as it breaks the training rules
+func rejectedSyncRecord(entity entities.SyncEntity, clientID string) entities.SyncConflict {
+	return entities.SyncConflict{
+		Entity:     entity,
+		ClientID:   clientID,
+		Resolution: entities.SyncResolutionRejected,
+	}
+}
+
+func indexOfSyncedExercise(exercises []entities.TrainingExercise, te *entities.TrainingExercise) int {
+	for i, ex := range exercises {
+		if (te.ClientID != "" && ex.ClientID == te.ClientID) ||
+			(te.ID != "" && ex.ID == te.ID) {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfSyncedSet(sets []entities.TrainingSet, ts *entities.TrainingSet) int {
+	for i, s := range sets {
+		if (ts.ClientID != "" && s.ClientID == ts.ClientID) ||
+			(ts.ID != "" && s.ID == ts.ID) {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatSyncToken creates an opaque token for given point in time,
+// non empty afterID marks the last training returned for that time
+func formatSyncToken(t time.Time, afterID string) string {
+	token := strconv.FormatInt(t.UnixNano(), 36)
+	if afterID != "" {
+		token += "." + afterID
+	}
+	return token
+}
+
+// parseSyncToken reads point in time and the last returned training id from the token,
+// empty token gives zero time
+func parseSyncToken(token string) (time.Time, string, error) {
+	if token == "" {
+		return time.Time{}, "", nil
+	}
+
+	timePart, afterID := token, ""
+	if i := strings.IndexByte(token, '.'); i != -1 {
+		timePart, afterID = token[:i], token[i+1:]
+		if afterID == "" {
+			return time.Time{}, "", NewErrorInvalidSyncToken(token)
+		}
+	}
+
+	n, err := strconv.ParseInt(timePart, 36, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, "", NewErrorInvalidSyncToken(token)
+	}
+
+	return time.Unix(0, n), afterID, nil
+}
@@ -0,0 +1,388 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unnamedxaer/gymm-api/entities"
+	"github.com/unnamedxaer/gymm-api/mocks"
+	"github.com/unnamedxaer/gymm-api/usecases"
+)
+
+func TestSync(t *testing.T) {
+	newTraining := entities.Training{
+		ClientID:  "f3b1c8a2-7c1e-4a57-b3f4-2a9d1e6c0b11",
+		StartTime: mocks.Now.Add(-time.Hour),
+		UpdatedAt: mocks.Now,
+		Exercises: []entities.TrainingExercise{
+			{
+				ClientID:   "5a0c7e1d-1a4b-4f0c-8f0e-9c3b2d7e6a12",
+				ExerciseID: mocks.ExampleExercise.ID,
+				StartTime:  mocks.Now.Add(-50 * time.Minute),
+				Sets: []entities.TrainingSet{
+					{
+						ClientID: "9d2e4b6f-3c8a-4e1b-a7d5-0f6c8b2e4a13",
+						Time:     mocks.Now.Add(-45 * time.Minute),
+						Reps:     8,
+					},
+				},
+			},
+		},
+	}
+
+	editedTraining := mocks.ExampleTraining
+	editedTraining.Comment += " - edited offline"
+	editedTraining.UpdatedAt = mocks.Now
+
+	staleTraining := mocks.ExampleTraining
+	staleTraining.Comment += " - edited long time ago"
+	staleTraining.UpdatedAt = mocks.ExampleTraining.UpdatedAt.Add(-time.Hour)
+
+	// the set added offline to the exercise that has been ended
+	lateSet := mocks.ExampleTraining
+	lateSet.Exercises = append([]entities.TrainingExercise{}, mocks.ExampleTraining.Exercises...)
+	lateSet.Exercises[0].Sets = append(append([]entities.TrainingSet{}, lateSet.Exercises[0].Sets...),
+		entities.TrainingSet{
+			ClientID: "2c7e9a4b-8d1f-4b3a-9e6c-1a5d7f3b8c14",
+			Time:     mocks.Now,
+			Reps:     5,
+		})
+
+	testCases := []struct {
+		desc          string
+		userID        string
+		input         usecases.SyncInput
+		wantConflicts int
+		resolution    entities.SyncResolution
+		errTxt        string
+	}{
+		{
+			desc:  "first sync without changes",
+			input: usecases.SyncInput{},
+		},
+		{
+			desc: "new training",
+			input: usecases.SyncInput{
+				Trainings: []entities.Training{newTraining},
+			},
+		},
+		{
+			desc: "new training without client id",
+			input: usecases.SyncInput{
+				Trainings: []entities.Training{{StartTime: mocks.Now}},
+			},
+			errTxt: usecases.NewErrorInvalidID("", "training").Error(),
+		},
+		{
+			desc: "client wins",
+			input: usecases.SyncInput{
+				Token:     strings.Repeat("1", 12),
+				Trainings: []entities.Training{editedTraining},
+			},
+			wantConflicts: 1,
+			resolution:    entities.SyncResolutionClientWins,
+		},
+		{
+			desc: "server wins",
+			input: usecases.SyncInput{
+				Token:     strings.Repeat("1", 12),
+				Trainings: []entities.Training{staleTraining},
+			},
+			wantConflicts: 1,
+			resolution:    entities.SyncResolutionServerWins,
+		},
+		{
+			desc:   "second training in progress",
+			userID: mocks.UserIDWithOpenTraining,
+			input: usecases.SyncInput{
+				Trainings: []entities.Training{newTraining},
+			},
+			wantConflicts: 1,
+			resolution:    entities.SyncResolutionRejected,
+		},
+		{
+			desc: "set of ended exercise",
+			input: usecases.SyncInput{
+				Trainings: []entities.Training{lateSet},
+			},
+			wantConflicts: 1,
+			resolution:    entities.SyncResolutionRejected,
+		},
+		{
+			desc: "invalid token",
+			input: usecases.SyncInput{
+				Token: "🐼",
+			},
+			errTxt: usecases.NewErrorInvalidSyncToken("🐼").Error(),
+		},
+		{
+			desc: "token without training id",
+			input: usecases.SyncInput{
+				Token: strings.Repeat("1", 12) + ".",
+			},
+			errTxt: usecases.NewErrorInvalidSyncToken(strings.Repeat("1", 12) + ".").Error(),
+		},
+		{
+			desc: "not existing exercise",
+			input: usecases.SyncInput{
+				Trainings: []entities.Training{withExercise(newTraining, func(te *entities.TrainingExercise) {
+					te.ExerciseID = "5f8f8c44b54764421b7156c9"
+				})},
+			},
+			errTxt: "exercise 5f8f8c44b54764421b7156c9 does not exist",
+		},
+		{
+			desc: "exercise ended before its start",
+			input: usecases.SyncInput{
+				Trainings: []entities.Training{withExercise(newTraining, func(te *entities.TrainingExercise) {
+					te.EndTime = te.StartTime.Add(-time.Minute)
+				})},
+			},
+			errTxt: "end time before start time",
+		},
+		{
+			desc: "set before the exercise start",
+			input: usecases.SyncInput{
+				Trainings: []entities.Training{withExercise(newTraining, func(te *entities.TrainingExercise) {
+					te.Sets = []entities.TrainingSet{{ClientID: te.Sets[0].ClientID, Time: te.StartTime.Add(-time.Minute)}}
+				})},
+			},
+			errTxt: "start time before the start of its parent",
+		},
+		{
+			desc: "training in the future",
+			input: usecases.SyncInput{
+				Trainings: []entities.Training{{ClientID: newTraining.ClientID, StartTime: time.Now().Add(time.Hour)}},
+			},
+			errTxt: "time in the future",
+		},
+	}
+
+	ctx := context.TODO()
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			userID := tC.userID
+			if userID == "" {
+				userID = mocks.UserID
+			}
+			got, err := trainingUC.Sync(ctx, userID, &tC.input)
+			if tC.errTxt != "" {
+				if err == nil || !strings.Contains(err.Error(), tC.errTxt) {
+					t.Errorf("want error like %q, got %v", tC.errTxt, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+
+			if got.Token == "" {
+				t.Errorf("want sync token, got %v", got)
+			}
+
+			if len(got.Conflicts) != tC.wantConflicts {
+				t.Fatalf("want %d conflicts, got %v", tC.wantConflicts, got.Conflicts)
+			}
+
+			for _, c := range got.Conflicts {
+				if c.Resolution != tC.resolution {
+					t.Errorf("want conflict resolved with %d, got %v", tC.resolution, c)
+				}
+			}
+		})
+	}
+}
+
+// withExercise returns a copy of the training with its first exercise modified by fn
+func withExercise(t entities.Training, fn func(te *entities.TrainingExercise)) entities.Training {
+	t.Exercises = append([]entities.TrainingExercise{}, t.Exercises...)
+	fn(&t.Exercises[0])
+	return t
+}
+
+// replacingTrainingRepo keeps the trainings replaced by the sync,
+// the first modified replacements find the training modified in the meantime
+type replacingTrainingRepo struct {
+	mocks.MockTrainingRepo
+	modified int
+	replaced []entities.Training
+}
+
+func (r *replacingTrainingRepo) ReplaceTraining(
+	ctx context.Context,
+	t *entities.Training,
+	lastUpdatedAt time.Time) (*entities.Training, error) {
+	if r.modified > 0 {
+		r.modified--
+		return nil, nil
+	}
+
+	r.replaced = append(r.replaced, *t)
+	return r.MockTrainingRepo.ReplaceTraining(ctx, t, lastUpdatedAt)
+}
+
+func TestSyncEndedTraining(t *testing.T) {
+	repo := &replacingTrainingRepo{}
+	tu := usecases.NewTrainingUseCases(repo, &mocks.MockExerciseRepo{})
+
+	// the client has not seen the training ended and keeps adding to it
+	incoming := mocks.ExampleTraining
+	incoming.ID += "ended"
+	incoming.ClientID = ""
+	incoming.Comment += " - edited offline"
+	incoming.UpdatedAt = mocks.Now
+	incoming.Exercises = append(append([]entities.TrainingExercise{}, mocks.ExampleTraining.Exercises...),
+		entities.TrainingExercise{
+			ClientID:   "7e3a1c9d-4b2f-4d8e-a6c1-3f9b5d2e7a15",
+			ExerciseID: mocks.ExampleExercise.ID,
+			StartTime:  mocks.Now,
+		})
+
+	got, err := tu.Sync(context.TODO(), mocks.UserID, &usecases.SyncInput{
+		Trainings: []entities.Training{incoming},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := 0
+	for _, c := range got.Conflicts {
+		if c.Resolution == entities.SyncResolutionRejected && c.Entity == entities.SyncEntityExercise {
+			rejected++
+		}
+	}
+	if rejected != 1 {
+		t.Errorf("want the new exercise to be rejected, got %v", got.Conflicts)
+	}
+
+	if len(repo.replaced) != 1 {
+		t.Fatalf("want the training to be replaced once, got %v", repo.replaced)
+	}
+	replaced := repo.replaced[0]
+	if replaced.EndTime.IsZero() {
+		t.Errorf("want the training to stay ended, got %v", replaced)
+	}
+	if replaced.Comment != incoming.Comment {
+		t.Errorf("want comment %q, got %q", incoming.Comment, replaced.Comment)
+	}
+	if len(replaced.Exercises) != len(mocks.ExampleTraining.Exercises) {
+		t.Errorf("want %d exercises, got %d", len(mocks.ExampleTraining.Exercises), len(replaced.Exercises))
+	}
+}
+
+func TestSyncModifiedTraining(t *testing.T) {
+	edited := mocks.ExampleTraining
+	edited.Comment += " - edited offline"
+	edited.UpdatedAt = mocks.Now
+	input := usecases.SyncInput{Trainings: []entities.Training{edited}}
+
+	repo := &replacingTrainingRepo{modified: 2}
+	_, err := usecases.NewTrainingUseCases(repo, &mocks.MockExerciseRepo{}).Sync(context.TODO(), mocks.UserID, &input)
+	if err != nil {
+		t.Fatalf("want the merge to be retried, got %v", err)
+	}
+	if len(repo.replaced) != 1 {
+		t.Errorf("want the training to be replaced once, got %v", repo.replaced)
+	}
+
+	repo = &replacingTrainingRepo{modified: 3}
+	_, err = usecases.NewTrainingUseCases(repo, &mocks.MockExerciseRepo{}).Sync(context.TODO(), mocks.UserID, &input)
+	var cmErr *usecases.ConcurrentModificationError
+	if !errors.As(err, &cmErr) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorConcurrentModification("training"), err)
+	}
+}
+
+// concurrentlyModifiedTrainingRepo returns the trainings modified on the server
+// after the sync request has been received
+type concurrentlyModifiedTrainingRepo struct {
+	replacingTrainingRepo
+}
+
+func (r *concurrentlyModifiedTrainingRepo) GetTrainingByClientID(
+	ctx context.Context,
+	userID, clientID string) (*entities.Training, error) {
+	t, err := r.replacingTrainingRepo.GetTrainingByClientID(ctx, userID, clientID)
+	if t != nil {
+		t.UpdatedAt = time.Now().Add(time.Second)
+	}
+	return t, err
+}
+
+func TestSyncClientClockAhead(t *testing.T) {
+	// the client's clock is a day ahead, its change still loses to the later one made on the server
+	edited := mocks.ExampleTraining
+	edited.Comment += " - edited offline"
+	edited.UpdatedAt = time.Now().Add(24 * time.Hour)
+
+	repo := &concurrentlyModifiedTrainingRepo{}
+	got, err := usecases.NewTrainingUseCases(repo, &mocks.MockExerciseRepo{}).Sync(
+		context.TODO(), mocks.UserID, &usecases.SyncInput{
+			Token:     strings.Repeat("1", 12),
+			Trainings: []entities.Training{edited},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Conflicts) != 1 || got.Conflicts[0].Resolution != entities.SyncResolutionServerWins {
+		t.Errorf("want the server to win the conflict, got %v", got.Conflicts)
+	}
+	if len(repo.replaced) != 0 {
+		t.Errorf("want the training not to be replaced, got %v", repo.replaced)
+	}
+}
+
+// manyTrainingsRepo has more changed trainings than a single sync returns,
+// it keeps the position the last sync continued from
+type manyTrainingsRepo struct {
+	mocks.MockTrainingRepo
+	since   time.Time
+	afterID string
+}
+
+func (r *manyTrainingsRepo) GetUserTrainingsChangedSince(
+	ctx context.Context,
+	userID string,
+	since time.Time,
+	afterID string,
+	limit int64) ([]entities.Training, error) {
+	r.since, r.afterID = since, afterID
+
+	out := make([]entities.Training, limit)
+	for i := range out {
+		out[i] = mocks.ExampleTraining
+		out[i].ID = fmt.Sprintf("%024x", i)
+		out[i].UpdatedAt = mocks.Now.Add(time.Duration(i) * time.Millisecond)
+	}
+	return out, nil
+}
+
+func TestSyncPages(t *testing.T) {
+	repo := &manyTrainingsRepo{}
+	tu := usecases.NewTrainingUseCases(repo, &mocks.MockExerciseRepo{})
+
+	got, err := tu.Sync(context.TODO(), mocks.UserID, &usecases.SyncInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.HasMore || len(got.Trainings) != usecases.SyncTrainingsLimit {
+		t.Fatalf("want first %d trainings and more of them, got %d, has more: %t",
+			usecases.SyncTrainingsLimit, len(got.Trainings), got.HasMore)
+	}
+
+	last := got.Trainings[len(got.Trainings)-1]
+	_, err = tu.Sync(context.TODO(), mocks.UserID, &usecases.SyncInput{Token: got.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.afterID != last.ID || !repo.since.Equal(last.UpdatedAt) {
+		t.Errorf("want the sync to continue after training %q changed at %s, got %q at %s",
+			last.ID, last.UpdatedAt, repo.afterID, repo.since)
+	}
+}
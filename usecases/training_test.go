@@ -2,9 +2,11 @@ package usecases_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/unnamedxaer/gymm-api/entities"
 	"github.com/unnamedxaer/gymm-api/mocks"
 	"github.com/unnamedxaer/gymm-api/usecases"
 )
@@ -35,13 +37,13 @@ func TestStartTraining(t *testing.T) {
 func TestEndTraining(t *testing.T) {
 	ctx := context.TODO()
 
-	tr, err := trainingUC.EndTraining(ctx, mocks.ExampleTraining.ID)
+	tr, err := trainingUC.EndTraining(ctx, mocks.ExampleTraining.UserID, mocks.ExampleTraining.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if tr.StartTime.IsZero() || tr.ID == "" {
-		t.Errorf("want started training, got %v", tr)
+	if tr.EndTime.IsZero() || tr.ID == "" {
+		t.Errorf("want ended training, got %v", tr)
 	}
 }
 
@@ -74,13 +76,16 @@ func TestEndTrainingExercise(t *testing.T) {
 func TestAddTrainingExercise(t *testing.T) {
 	ctx := context.TODO()
 
-	tr, err := trainingUC.EndTraining(ctx, mocks.ExampleTraining.ID)
+	te, err := trainingUC.StartExercise(ctx, mocks.ExampleTraining.UserID, mocks.ExampleTraining.ID, &entities.TrainingExercise{
+		ExerciseID: mocks.ExampleExercise.ID,
+		StartTime:  time.Now(),
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if tr.StartTime.IsZero() || tr.ID == "" {
-		t.Errorf("want started exercise, got %v", tr)
+	if te.StartTime.IsZero() || te.ID == "" {
+		t.Errorf("want started exercise, got %v", te)
 	}
 }
 
@@ -127,3 +132,130 @@ func TestGetUserTrainings(t *testing.T) {
 		t.Errorf("want at least %d trainings, got %d", cnt, len(tr))
 	}
 }
+
+func TestTrainingRules(t *testing.T) {
+	ctx := context.TODO()
+	otherUserID := mocks.NonexistingUserID
+	endedTrainingID := mocks.ExampleTraining.ID + "ended"
+	endedExerciseID := mocks.ExampleTraining.Exercises[0].ID
+	openExerciseID := mocks.ExampleTraining.Exercises[1].ID
+
+	var (
+		inProgressErr  *usecases.TrainingInProgressError
+		trCompletedErr *usecases.TrainingCompletedError
+		teCompletedErr *usecases.TrainingExerciseCompletedError
+		notOwnerErr    *usecases.NotOwnerError
+		rneErr         *usecases.RecordNotExistsError
+	)
+
+	testCases := []struct {
+		desc string
+		call func() error
+		want interface{}
+	}{
+		{
+			desc: "start training while another one is in progress",
+			call: func() error {
+				_, err := trainingUC.StartTraining(ctx, mocks.UserIDWithOpenTraining)
+				return err
+			},
+			want: &inProgressErr,
+		},
+		{
+			desc: "start training while another one is being started",
+			call: func() error {
+				_, err := trainingUC.StartTraining(ctx, mocks.UserIDStartingTrainingConcurrently)
+				return err
+			},
+			want: &inProgressErr,
+		},
+		{
+			desc: "end already ended training",
+			call: func() error {
+				_, err := trainingUC.EndTraining(ctx, mocks.UserID, endedTrainingID)
+				return err
+			},
+			want: &trCompletedErr,
+		},
+		{
+			desc: "end training of other user",
+			call: func() error {
+				_, err := trainingUC.EndTraining(ctx, otherUserID, mocks.ExampleTraining.ID)
+				return err
+			},
+			want: &notOwnerErr,
+		},
+		{
+			desc: "end not existing training",
+			call: func() error {
+				_, err := trainingUC.EndTraining(ctx, mocks.UserID, "notfound")
+				return err
+			},
+			want: &rneErr,
+		},
+		{
+			desc: "get training of other user",
+			call: func() error {
+				_, err := trainingUC.GetTrainingByID(ctx, otherUserID, mocks.ExampleTraining.ID)
+				return err
+			},
+			want: &notOwnerErr,
+		},
+		{
+			desc: "start exercise in ended training",
+			call: func() error {
+				_, err := trainingUC.StartExercise(ctx, mocks.UserID, endedTrainingID, &entities.TrainingExercise{})
+				return err
+			},
+			want: &trCompletedErr,
+		},
+		{
+			desc: "start exercise in training of other user",
+			call: func() error {
+				_, err := trainingUC.StartExercise(ctx, otherUserID, mocks.ExampleTraining.ID, &entities.TrainingExercise{})
+				return err
+			},
+			want: &notOwnerErr,
+		},
+		{
+			desc: "add set to ended exercise",
+			call: func() error {
+				_, err := trainingUC.AddSet(ctx, mocks.UserID, endedExerciseID, &mocks.ExampleTrainingSet)
+				return err
+			},
+			want: &teCompletedErr,
+		},
+		{
+			desc: "add set to exercise of other user",
+			call: func() error {
+				_, err := trainingUC.AddSet(ctx, otherUserID, openExerciseID, &mocks.ExampleTrainingSet)
+				return err
+			},
+			want: &notOwnerErr,
+		},
+		{
+			desc: "end already ended exercise",
+			call: func() error {
+				_, err := trainingUC.EndExercise(ctx, mocks.UserID, endedExerciseID, time.Now())
+				return err
+			},
+			want: &teCompletedErr,
+		},
+		{
+			desc: "end not existing exercise",
+			call: func() error {
+				_, err := trainingUC.EndExercise(ctx, mocks.UserID, "notfound", time.Now())
+				return err
+			},
+			want: &rneErr,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.call()
+			if !errors.As(err, tC.want) {
+				t.Errorf("want error of type %T, got %v", tC.want, err)
+			}
+		})
+	}
+}
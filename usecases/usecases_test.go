@@ -1,33 +1,57 @@
 package usecases_test
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
 	"github.com/rs/zerolog"
 	"github.com/unnamedxaer/gymm-api/mocks"
 	"github.com/unnamedxaer/gymm-api/testhelpers"
+	"github.com/unnamedxaer/gymm-api/totp"
 	"github.com/unnamedxaer/gymm-api/usecases"
+	"golang.org/x/crypto/bcrypt"
 )
 
-var mockedLogger zerolog.Logger
+var (
+	mockedLogger zerolog.Logger
+	mockedCipher usecases.SecretCipher
+	mockedHasher usecases.PasswordHasher
+)
 
 func TestMain(m *testing.M) {
 	testhelpers.EnsureTestEnv()
 
+	// email templates are read relative to the project root
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+
 	mockedLogger = zerolog.New(nil)
 
+	var err error
+	mockedCipher, err = totp.NewCipher(bytes.Repeat([]byte{7}, totp.KeySize))
+	if err != nil {
+		panic(err)
+	}
+
+	// the mocked users' hashes have the min cost, so they are not rehashed
+	mockedHasher, err = usecases.NewBcryptHasher(bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+
 	var ar usecases.AuthRepo = &mocks.MockAuthRepo{}
-	authUC = usecases.NewAuthUsecases(&mockedLogger, ar)
+	authUC = usecases.NewAuthUsecases(&mockedLogger, ar, &mocks.MockAuditRepo{}, mockedCipher, mockedHasher)
 
 	var ur usecases.UserRepo = &mocks.MockUserRepo{}
-	userUC = usecases.NewUserUseCases(ur)
+	userUC = usecases.NewUserUseCases(ur, mockedHasher)
 
 	var er usecases.ExerciseRepo = &mocks.MockExerciseRepo{}
-	exerciseUC = usecases.NewExerciseUseCases(er)
+	exerciseUC = usecases.NewExerciseUseCases(&mockedLogger, er, &mocks.MockAuditRepo{})
 
 	var tr usecases.TrainingRepo = &mocks.MockTrainingRepo{}
-	trainingUC = usecases.NewTrainingUseCases(tr)
+	trainingUC = usecases.NewTrainingUseCases(tr, er)
 
 	code := m.Run()
 	os.Exit(code)
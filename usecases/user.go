@@ -6,7 +6,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/unnamedxaer/gymm-api/entities"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // UserInput represents data received from req
@@ -18,6 +17,15 @@ type UserInput struct {
 	CreatedAt    time.Time `json:"createdAt"`
 }
 
+// UserProfileInput represents the changes of the user's profile received from req,
+// the nil fields are left unchanged
+type UserProfileInput struct {
+	Username *string              `json:"userName" validate:"omitempty,min=2,max=50,printascii"`
+	Theme    *entities.Theme      `json:"theme" validate:"omitempty,oneof=system light dark"`
+	Timezone *string              `json:"timezone" validate:"omitempty,timezone"`
+	Units    *entities.UnitSystem `json:"units" validate:"omitempty,oneof=metric imperial"`
+}
+
 type UserRepo interface {
 	// New creates new error of type EmailAddressInUse
 	// NewEmailAddressInUse() error
@@ -30,15 +38,40 @@ type UserRepo interface {
 		username,
 		email string,
 		passwordHash []byte) (*entities.User, error)
+	// GetUsers returns up to limit users ordered by their IDs, starting after the user with afterID,
+	// the not empty query has to be a part of the user's email address or username
+	GetUsers(ctx context.Context, query string, afterID string, limit int64) ([]entities.User, error)
+	// SetUserDisabled disables or re-enables the account, it returns nil if there is no such user
+	SetUserDisabled(ctx context.Context, id string, disabled bool) (*entities.User, error)
+	// SetUserRole replaces the user's role, it returns nil if there is no such user
+	SetUserRole(ctx context.Context, id string, role entities.Role) (*entities.User, error)
+	// UpdateUserProfile sets the not nil fields of the profile, it returns nil if there is no such user
+	UpdateUserProfile(ctx context.Context, id string, profile *UserProfileInput) (*entities.User, error)
+	// SetUserDeletionTime schedules the deletion of the account at given time, nil cancels the deletion.
+	// It returns nil if there is no such user or its deletion has started
+	SetUserDeletionTime(ctx context.Context, id string, at *time.Time) (*entities.User, error)
+	// StartUserDeletion marks the deletion of the account as started if it was scheduled before given time,
+	// the deletion cannot be cancelled afterwards. It returns nil if there is no such user to delete
+	StartUserDeletion(ctx context.Context, id string, before time.Time) (*entities.User, error)
+	// GetUsersToDelete returns up to limit users whose deletion was scheduled before given time
+	GetUsersToDelete(ctx context.Context, before time.Time, limit int64) ([]entities.User, error)
+	// SetCalendarFeedToken replaces the hash of the calendar feed secret, the empty hash turns the feed off.
+	// It returns nil if there is no such user
+	SetCalendarFeedToken(ctx context.Context, id string, tokenHash string) (*entities.User, error)
+	// GetUserByCalendarFeedToken returns the user with the feed secret of given hash, nil if there is no such user
+	GetUserByCalendarFeedToken(ctx context.Context, tokenHash string) (*entities.User, error)
 }
 
 type UserUseCases struct {
-	repo UserRepo
+	repo   UserRepo
+	hasher PasswordHasher
 }
 
 type IUserUseCases interface {
 	GetUserByID(ctx context.Context, id string) (*entities.User, error)
 	CreateUser(ctx context.Context, u *UserInput) (*entities.User, error)
+	// UpdateUserProfile changes the username and preferences of the user
+	UpdateUserProfile(ctx context.Context, id string, profile *UserProfileInput) (*entities.User, error)
 }
 
 func (uc *UserUseCases) GetUserByID(
@@ -50,7 +83,7 @@ func (uc *UserUseCases) GetUserByID(
 func (uc *UserUseCases) CreateUser(
 	ctx context.Context,
 	u *UserInput) (*entities.User, error) {
-	passwordHash, err := hashPassword(u.Password)
+	passwordHash, err := uc.hasher.Hash(u.Password)
 	if err != nil {
 		return nil, errors.WithMessage(err, "incorrect password, cannot hash")
 	}
@@ -58,12 +91,25 @@ func (uc *UserUseCases) CreateUser(
 	return uc.repo.CreateUser(ctx, u.Username, u.EmailAddress, passwordHash)
 }
 
-func NewUserUseCases(userRepo UserRepo) IUserUseCases {
-	return &UserUseCases{
-		repo: userRepo,
+func (uc *UserUseCases) UpdateUserProfile(
+	ctx context.Context,
+	id string,
+	profile *UserProfileInput) (*entities.User, error) {
+	user, err := uc.repo.UpdateUserProfile(ctx, id, profile)
+	if err != nil {
+		return nil, err
 	}
+
+	if user == nil {
+		return nil, errors.WithMessage(
+			NewErrorRecordNotExists("user"), "usecases.UpdateUserProfile")
+	}
+	return user, nil
 }
 
-func hashPassword(pwd string) ([]byte, error) {
-	return bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.MinCost)
+func NewUserUseCases(userRepo UserRepo, hasher PasswordHasher) IUserUseCases {
+	return &UserUseCases{
+		repo:   userRepo,
+		hasher: hasher,
+	}
 }
@@ -2,8 +2,10 @@ package usecases_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	"github.com/unnamedxaer/gymm-api/entities"
 	"github.com/unnamedxaer/gymm-api/mocks"
 	"github.com/unnamedxaer/gymm-api/usecases"
 )
@@ -34,3 +36,27 @@ func TestGetUserByID(t *testing.T) {
 		t.Fatalf("want UserRepo.GetUserByID to be called and 'ID' to be '%s', got %s", mocks.UserID, got.ID)
 	}
 }
+
+func TestUpdateUserProfile(t *testing.T) {
+	ctx := context.TODO()
+	username := "Long John Silver"
+	units := entities.UnitsImperial
+
+	got, err := userUC.UpdateUserProfile(ctx, mocks.UserID, &usecases.UserProfileInput{
+		Username: &username,
+		Units:    &units,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != username || got.Preferences.Units != units ||
+		got.Preferences.Timezone != entities.DefaultUserPreferences.Timezone {
+		t.Errorf("want changed username and units only, got %+v", got)
+	}
+
+	_, err = userUC.UpdateUserProfile(ctx, "notfound", &usecases.UserProfileInput{Username: &username})
+	var rneErr *usecases.RecordNotExistsError
+	if !errors.As(err, &rneErr) {
+		t.Errorf("want error %q, got %v", usecases.NewErrorRecordNotExists("user"), err)
+	}
+}
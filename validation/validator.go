@@ -57,6 +57,7 @@ func New() *validator.Validate {
 
 	validate.RegisterValidation("set_unit", setUnitValidateFunc)
 	validate.RegisterValidation("ex_name_chars", exerciseNameCharsValidateFunc)
+	validate.RegisterValidation("api_key_scope", apiKeyScopeValidateFunc)
 
 	return validate
 }
@@ -97,6 +98,24 @@ func validateSetUnit(fld reflect.Value) bool {
 	return false
 }
 
+func apiKeyScopeValidateFunc(fldLev validator.FieldLevel) bool {
+	fld := fldLev.Field()
+	return validateAPIKeyScope(fld)
+}
+
+func validateAPIKeyScope(fld reflect.Value) bool {
+	if fld.Kind() != reflect.String {
+		return false
+	}
+
+	for _, scope := range entities.APIKeyScopes {
+		if fld.String() == string(scope) {
+			return true
+		}
+	}
+	return false
+}
+
 func pwdStrengthValidateFunc(fdl validator.FieldLevel) bool {
 	fldValue := fdl.Field().String()
 	return validatePassword(fldValue)
@@ -3,6 +3,8 @@ package validation
 import (
 	"reflect"
 	"testing"
+
+	"github.com/unnamedxaer/gymm-api/entities"
 )
 
 func TestValidatePassword(t *testing.T) {
@@ -69,3 +71,22 @@ func TestValidateSetUnit(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateAPIKeyScope(t *testing.T) {
+
+	givenWanted := map[interface{}]bool{
+		"trainings:read":                   true,
+		entities.APIKeyScopeTrainingsWrite: true,
+		"exercises":                        true,
+		"trainings":                        false,
+		"":                                 false,
+		1:                                  false,
+	}
+
+	for input, want := range givenWanted {
+		got := validateAPIKeyScope(reflect.ValueOf(input))
+		if got != want {
+			t.Errorf("api key scope: %v, want: %t, got: %t", input, want, got)
+		}
+	}
+}